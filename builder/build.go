@@ -16,6 +16,9 @@ import (
 	"github.com/tinygo-org/tinygo/compiler"
 	"github.com/tinygo-org/tinygo/goenv"
 	"github.com/tinygo-org/tinygo/interp"
+	"github.com/tinygo-org/tinygo/loader"
+	"github.com/tinygo-org/tinygo/transform"
+	"tinygo.org/x/go-llvm"
 )
 
 // Build performs a single package to executable Go build. It takes in a package
@@ -25,6 +28,10 @@ import (
 // The error value may be of type *MultiError. Callers will likely want to check
 // for this case and print such errors individually.
 func Build(pkgName, outpath string, config *compileopts.Config, action func(string) error) error {
+	if config.Options.PrintStacks && !config.AutomaticStackSize() {
+		return errors.New("-print-stacks is only supported on targets that determine goroutine stack sizes automatically")
+	}
+
 	c, err := compiler.NewCompiler(pkgName, config)
 	if err != nil {
 		return err
@@ -51,6 +58,26 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 		return errors.New("verification error after interpreting runtime.initAll")
 	}
 
+	// Create a temporary directory for intermediary files.
+	dir, err := ioutil.TempDir("", "tinygo")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Compile C files to LLVM bitcode and link them into the Go module, so
+	// that C and Go code are optimized together. For example, this allows C
+	// helper functions to be inlined into their Go callers.
+	if config.LTO() {
+		err := linkCFiles(c, config, dir)
+		if err != nil {
+			return err
+		}
+		if err := c.Verify(); err != nil {
+			return errors.New("verification error after linking C files")
+		}
+	}
+
 	if config.GOOS() != "darwin" {
 		c.ApplyFunctionSections() // -ffunction-sections
 	}
@@ -60,7 +87,7 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 	// keep functions interoperable, pass int64 types as pointers to
 	// stack-allocated values.
 	// Use -wasm-abi=generic to disable this behaviour.
-	if config.Options.WasmAbi == "js" && strings.HasPrefix(config.Triple(), "wasm") {
+	if config.WasmAbi() == "js" && strings.HasPrefix(config.Triple(), "wasm") {
 		err := c.ExternalInt64AsPtr()
 		if err != nil {
 			return err
@@ -103,6 +130,17 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 		}
 	}
 
+	// Replace calls to runtime.getGoroutineStackSize with loads from a global
+	// that will be updated after linking, once the stack size of each
+	// goroutine is known.
+	var stackSizeLoads []string
+	if config.AutomaticStackSize() {
+		stackSizeLoads = transform.CreateStackSizeLoads(c.Module(), config.DefaultStackSize())
+		if err := c.Verify(); err != nil {
+			return errors.New("verification error after adding stack size loads")
+		}
+	}
+
 	// Generate output.
 	outext := filepath.Ext(outpath)
 	switch outext {
@@ -115,16 +153,9 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 	default:
 		// Act as a compiler driver.
 
-		// Create a temporary directory for intermediary files.
-		dir, err := ioutil.TempDir("", "tinygo")
-		if err != nil {
-			return err
-		}
-		defer os.RemoveAll(dir)
-
 		// Write the object file.
 		objfile := filepath.Join(dir, "main.o")
-		err = c.EmitObject(objfile)
+		err := c.EmitObject(objfile)
 		if err != nil {
 			return err
 		}
@@ -150,6 +181,10 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 		// Compile extra files.
 		root := goenv.Get("TINYGOROOT")
 		for i, path := range config.ExtraFiles() {
+			if useLTO(config, path, config.NoLTOFiles()) {
+				// Already linked into the Go module.
+				continue
+			}
 			abspath := filepath.Join(root, path)
 			outpath := filepath.Join(dir, "extra-"+strconv.Itoa(i)+"-"+filepath.Base(path)+".o")
 			err := runCCompiler(config.Target.Compiler, append(config.CFlags(), "-c", "-o", outpath, abspath)...)
@@ -161,10 +196,21 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 
 		// Compile C files in packages.
 		for i, pkg := range c.Packages() {
-			for _, file := range pkg.CFiles {
-				path := filepath.Join(pkg.Package.Dir, file)
-				outpath := filepath.Join(dir, "pkg"+strconv.Itoa(i)+"-"+file+".o")
-				err := runCCompiler(config.Target.Compiler, append(config.CFlags(), "-c", "-o", outpath, path)...)
+			cflags, err := packageCFlags(config, pkg, i, dir)
+			if err != nil {
+				return err
+			}
+			paths, err := packageCFiles(pkg, i, dir)
+			if err != nil {
+				return err
+			}
+			for _, path := range paths {
+				if useLTO(config, path, nil) {
+					// Already linked into the Go module.
+					continue
+				}
+				outpath := filepath.Join(dir, "pkg"+strconv.Itoa(i)+"-"+filepath.Base(path)+".o")
+				err := runCCompiler(config.Target.Compiler, append(cflags, "-c", "-o", outpath, path)...)
 				if err != nil {
 					return &commandError{"failed to build", path, err}
 				}
@@ -172,12 +218,36 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 			}
 		}
 
+		// Add linker flags from #cgo lines, after all object files so that
+		// libraries can resolve symbols used in them.
+		for _, pkg := range c.Packages() {
+			ldflags = append(ldflags, cgoLinkerFlags(config, pkg.CgoLDFlags)...)
+		}
+
 		// Link the object files together.
 		err = link(config.Target.Linker, ldflags...)
 		if err != nil {
 			return &commandError{"failed to link", executable, err}
 		}
 
+		// Determine the stack size of each goroutine and store it in the
+		// executable.
+		if config.AutomaticStackSize() {
+			stackSizes, resetHandler, err := determineStackSizes(c.Module(), executable, stackSizeLoads)
+			if err != nil {
+				return err
+			}
+			if len(stackSizeLoads) != 0 {
+				err = modifyStackSizes(executable, stackSizes)
+				if err != nil {
+					return err
+				}
+			}
+			if config.Options.PrintStacks {
+				printStacks(stackSizes, resetHandler)
+			}
+		}
+
 		if config.Options.PrintSizes == "short" || config.Options.PrintSizes == "full" {
 			sizes, err := loadProgramSize(executable)
 			if err != nil {
@@ -215,3 +285,137 @@ func Build(pkgName, outpath string, config *compileopts.Config, action func(stri
 		return action(tmppath)
 	}
 }
+
+// useLTO returns whether the given C or assembly file should be compiled to
+// LLVM bitcode and linked into the Go module before optimization, instead of
+// being compiled to a separate object file. Only C files can be compiled to
+// bitcode, assembly files are always compiled separately. The same goes for
+// the files in noLTO, which are the no-lto-files of the target for extra
+// files. C files in packages can only be excluded all at once, with -no-lto.
+func useLTO(config *compileopts.Config, path string, noLTO []string) bool {
+	if !config.LTO() || filepath.Ext(path) != ".c" {
+		return false
+	}
+	for _, p := range noLTO {
+		if p == path {
+			return false
+		}
+	}
+	return true
+}
+
+// packageCFlags returns the flags to compile the C files in the given package,
+// including the flags set in #cgo lines. If the package exports functions to C,
+// the _cgo_export.h header is written to a directory inside dir so that these C
+// files can include it.
+func packageCFlags(config *compileopts.Config, pkg *loader.Package, index int, dir string) ([]string, error) {
+	cflags := append(config.CFlags(), "-I"+pkg.Package.Dir)
+	cflags = append(cflags, pkg.CgoCFlags...)
+	if pkg.CgoExportHeader != nil {
+		includeDir := filepath.Join(dir, "pkg"+strconv.Itoa(index)+"-include")
+		err := os.MkdirAll(includeDir, 0777)
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(filepath.Join(includeDir, "_cgo_export.h"), pkg.CgoExportHeader, 0666)
+		if err != nil {
+			return nil, err
+		}
+		cflags = append(cflags, "-I"+includeDir)
+	}
+	return cflags, nil
+}
+
+// packageCFiles returns the paths of the C files to compile for the given
+// package. These are the C files in the package directory and the C wrappers
+// generated by CGo, which are written to dir.
+func packageCFiles(pkg *loader.Package, index int, dir string) ([]string, error) {
+	var paths []string
+	for _, file := range pkg.CFiles {
+		paths = append(paths, filepath.Join(pkg.Package.Dir, file))
+	}
+	for i, stub := range pkg.CgoStubs {
+		path := filepath.Join(dir, "pkg"+strconv.Itoa(index)+"-cgo"+strconv.Itoa(i)+".c")
+		err := ioutil.WriteFile(path, stub, 0666)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// cgoLinkerFlags converts linker flags from #cgo lines to flags for the linker
+// of the target. These flags are written for a compiler driver like gcc, so
+// flags like -Wl,--foo,bar are unwrapped when the linker is invoked directly.
+func cgoLinkerFlags(config *compileopts.Config, flags []string) []string {
+	if config.Target.Linker != "ld.lld" && config.Target.Linker != "wasm-ld" {
+		return flags
+	}
+	var ldflags []string
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, "-Wl,") {
+			ldflags = append(ldflags, strings.Split(flag[len("-Wl,"):], ",")...)
+		} else {
+			ldflags = append(ldflags, flag)
+		}
+	}
+	return ldflags
+}
+
+// linkCFiles compiles the extra files of the target and the C files in all
+// packages to LLVM bitcode and links them into the Go module, skipping files
+// that must be compiled separately.
+func linkCFiles(c *compiler.Compiler, config *compileopts.Config, dir string) error {
+	root := goenv.Get("TINYGOROOT")
+	var paths []string
+	var pathFlags [][]string // the C flags to use for each path
+	for _, path := range config.ExtraFiles() {
+		if useLTO(config, path, config.NoLTOFiles()) {
+			paths = append(paths, filepath.Join(root, path))
+			pathFlags = append(pathFlags, config.CFlags())
+		}
+	}
+	for i, pkg := range c.Packages() {
+		cflags, err := packageCFlags(config, pkg, i, dir)
+		if err != nil {
+			return err
+		}
+		pkgPaths, err := packageCFiles(pkg, i, dir)
+		if err != nil {
+			return err
+		}
+		for _, path := range pkgPaths {
+			if useLTO(config, path, nil) {
+				paths = append(paths, path)
+				pathFlags = append(pathFlags, cflags)
+			}
+		}
+	}
+
+	mod := c.Module()
+	ctx := mod.Context()
+	for i, path := range paths {
+		outpath := filepath.Join(dir, "lto-"+strconv.Itoa(i)+"-"+filepath.Base(path)+".bc")
+		err := runCCompiler(config.Target.Compiler, append(pathFlags[i], "-emit-llvm", "-c", "-o", outpath, path)...)
+		if err != nil {
+			return &commandError{"failed to build", path, err}
+		}
+		buf, err := llvm.NewMemoryBufferFromFile(outpath)
+		if err != nil {
+			return &commandError{"failed to read", outpath, err}
+		}
+		cmod, err := ctx.ParseIR(buf) // takes ownership of buf
+		if err != nil {
+			return &commandError{"failed to load", outpath, err}
+		}
+		// Clang may normalize the target triple in a slightly different way.
+		// Use the triple of the Go module to avoid a warning while linking.
+		cmod.SetTarget(mod.Target())
+		err = llvm.LinkModules(mod, cmod) // destroys cmod
+		if err != nil {
+			return &commandError{"failed to link", path, err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/tinygo-org/tinygo/compileopts"
+)
+
+func TestUseLTO(t *testing.T) {
+	config := &compileopts.Config{
+		Options: &compileopts.Options{LTO: true},
+		Target:  &compileopts.TargetSpec{Compiler: "clang"},
+	}
+	noLTO := []string{"src/device/vectors.c", "/pkg/startup.c"}
+	for _, tc := range []struct {
+		path string
+		lto  bool
+	}{
+		{"src/runtime/helpers.c", true},
+		{"/pkg/foo.c", true},
+		{"src/device/arm/cortexm.s", false}, // assembly is never compiled to bitcode
+		{"src/device/vectors.c", false},     // listed in noLTO
+		{"/pkg/startup.c", false},           // listed in noLTO
+	} {
+		if lto := useLTO(config, tc.path, noLTO); lto != tc.lto {
+			t.Errorf("useLTO(%q): expected %v, got %v", tc.path, tc.lto, lto)
+		}
+	}
+
+	// With -no-lto, or with a C compiler that can't produce bitcode, all files
+	// are compiled separately.
+	config.Options.LTO = false
+	if useLTO(config, "src/runtime/helpers.c", noLTO) {
+		t.Error("useLTO: expected false with LTO disabled")
+	}
+	config.Options.LTO = true
+	config.Target.Compiler = "avr-gcc"
+	if useLTO(config, "src/runtime/helpers.c", noLTO) {
+		t.Error("useLTO: expected false with a C compiler other than clang")
+	}
+}
@@ -0,0 +1,159 @@
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os/exec"
+	"time"
+
+	"github.com/tinygo-org/tinygo/wasmvm"
+)
+
+// builtinEmulators lists emulators that are implemented inside TinyGo, so that
+// no external tools are needed to run a program. They can be used as the first
+// element of the emulator field in a target specification.
+var builtinEmulators = map[string]func(path string, stdout, stderr io.Writer) error{
+	"tinygo:wasm": runWasm,
+}
+
+// ExitError is returned by a built-in emulator when the program exits with a
+// non-zero exit code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// RunEmulator runs the program at path using the given emulator command, as
+// specified in the target specification. The path is appended to the emulator
+// command, unless the emulator is built into TinyGo in which case it is run
+// directly.
+func RunEmulator(emulator []string, path string, stdout, stderr io.Writer) error {
+	if run, ok := builtinEmulators[emulator[0]]; ok {
+		return run(path, stdout, stderr)
+	}
+	args := append(append([]string{}, emulator[1:]...), path)
+	cmd := exec.Command(emulator[0], args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// wasmRunner runs a WebAssembly module built for the wasm target. It provides
+// the same imports as targets/wasm_exec.js, with the syscall/js functions
+// implemented in run_syscalljs.go.
+type wasmRunner struct {
+	inst   *wasmvm.Instance
+	js     *jsEnv
+	stdout io.Writer
+	stderr io.Writer
+	timers []time.Time // pending calls to go_scheduler
+	exit   *ExitError
+}
+
+// errExit is returned from the syscall.Exit import to stop execution.
+var errExit = errors.New("program exited")
+
+// runWasm runs a WebAssembly module in the built-in interpreter, until the
+// program exits or there is no more work to do.
+func runWasm(path string, stdout, stderr io.Writer) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	mod, err := wasmvm.Decode(buf)
+	if err != nil {
+		return err
+	}
+	r := &wasmRunner{stdout: stdout, stderr: stderr}
+	r.js = newJSEnv(r)
+	r.inst, err = wasmvm.Instantiate(mod, r.resolve)
+	if err != nil {
+		return err
+	}
+	_, err = r.inst.Call("cwa_main")
+	for err == nil && len(r.timers) != 0 {
+		// Wait for the first timer to expire, and run the scheduler.
+		first := 0
+		for i, t := range r.timers {
+			if t.Before(r.timers[first]) {
+				first = i
+			}
+		}
+		time.Sleep(time.Until(r.timers[first]))
+		r.timers = append(r.timers[:first], r.timers[first+1:]...)
+		_, err = r.inst.Call("go_scheduler")
+	}
+	if err == errExit {
+		if r.exit != nil {
+			return r.exit
+		}
+		return nil
+	}
+	return err
+}
+
+// resolve returns the host function for an import of the wasm module.
+func (r *wasmRunner) resolve(module, name string, typ wasmvm.FuncType) wasmvm.HostFunc {
+	if module != "env" {
+		return nil
+	}
+	if fn := r.js.jsImport(name); fn != nil {
+		return fn
+	}
+	switch name {
+	case "io_get_stdout":
+		return func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			return []uint64{1}, nil
+		}
+	case "resource_write":
+		return func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			fd, ptr, length := uint32(args[0]), uint64(uint32(args[1])), uint64(uint32(args[2]))
+			if ptr+length > uint64(len(inst.Memory)) {
+				return nil, errors.New("resource_write: out of bounds memory access")
+			}
+			if fd == 1 {
+				// Write all output except for carriage returns, like
+				// wasm_exec.js.
+				r.stdout.Write(bytes.Replace(inst.Memory[ptr:ptr+length], []byte{'\r'}, nil, -1))
+			} else {
+				fmt.Fprintln(r.stderr, "invalid file descriptor:", fd)
+			}
+			return make([]uint64, len(typ.Results)), nil
+		}
+	case "runtime.ticks":
+		return func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			// Time in milliseconds, like Date.now().
+			now := float64(time.Now().UnixNano()) / 1e6
+			return []uint64{math.Float64bits(now)}, nil
+		}
+	case "runtime.sleepTicks":
+		return func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			// Do not sleep, only reactivate the scheduler after the given
+			// timeout (in milliseconds).
+			timeout := time.Duration(math.Float64frombits(args[0]) * float64(time.Millisecond))
+			r.timers = append(r.timers, time.Now().Add(timeout))
+			return nil, nil
+		}
+	case "syscall.Exit":
+		return func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			if code := int32(args[0]); code != 0 {
+				r.exit = &ExitError{int(code)}
+			}
+			r.timers = nil
+			return nil, errExit
+		}
+	default:
+		// Only fail when the import is actually used, as programs may import
+		// functions that are never called.
+		return func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			return nil, fmt.Errorf("unsupported import: %s.%s", module, name)
+		}
+	}
+}
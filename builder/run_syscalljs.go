@@ -0,0 +1,648 @@
+package builder
+
+// This file implements the syscall/js imports of the wasm target for the
+// built-in WebAssembly runner, so that programs using syscall/js can run
+// without a JavaScript environment. Values are encoded in the same way as in
+// targets/wasm_exec.js. Only a few built-in objects are available on the global
+// object: Object, Array, Uint8Array, Math and console. Programs that need a
+// browser or Node.js API must still be run there.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/tinygo-org/tinygo/wasmvm"
+)
+
+// A JavaScript value is represented as a Go value of one of these types: nil
+// (undefined), jsNullType (null), bool, float64, string or *jsObject.
+type jsNullType struct{}
+
+var jsNull = jsNullType{}
+
+// jsObject is a JavaScript object. Arrays, Uint8Arrays, functions and errors
+// are objects as well.
+type jsObject struct {
+	props     map[string]interface{}
+	isArray   bool
+	elems     []interface{} // elements of an array
+	isBytes   bool
+	bytes     []byte // contents of a Uint8Array
+	isError   bool
+	call      func(this interface{}, args []interface{}) (interface{}, error)
+	construct func(args []interface{}) (interface{}, error)
+}
+
+func newJSObject() *jsObject {
+	return &jsObject{props: map[string]interface{}{}}
+}
+
+// newJSFunction returns a function object that calls fn.
+func newJSFunction(fn func(this interface{}, args []interface{}) (interface{}, error)) *jsObject {
+	obj := newJSObject()
+	obj.call = fn
+	return obj
+}
+
+func newJSArray(elems []interface{}) *jsObject {
+	obj := newJSObject()
+	obj.isArray = true
+	obj.elems = elems
+	return obj
+}
+
+// jsThrow is returned by functions that throw a JavaScript exception. Other
+// errors stop the program.
+type jsThrow struct {
+	value interface{}
+}
+
+func (t *jsThrow) Error() string {
+	return "uncaught exception: " + jsString(t.value)
+}
+
+// throwTypeError returns a jsThrow with a new TypeError object.
+func throwTypeError(format string, args ...interface{}) error {
+	obj := newJSObject()
+	obj.isError = true
+	obj.props["name"] = "TypeError"
+	obj.props["message"] = fmt.Sprintf(format, args...)
+	return &jsThrow{obj}
+}
+
+// jsMemoryError is used as a panic value for out of bounds memory accesses in
+// the syscall/js imports, and is converted to an error by jsImport.
+type jsMemoryError struct{}
+
+// jsEnv is the JavaScript environment of a wasm program, with the same list of
+// values as the Go class in wasm_exec.js.
+type jsEnv struct {
+	runner *wasmRunner
+	values []interface{}
+	refs   map[interface{}]uint32 // index in values of strings and objects
+	goObj  *jsObject              // the instance of the Go class
+}
+
+func newJSEnv(r *wasmRunner) *jsEnv {
+	e := &jsEnv{
+		runner: r,
+		refs:   map[interface{}]uint32{},
+		goObj:  newJSObject(),
+	}
+	e.goObj.props["_makeFuncWrapper"] = newJSFunction(e.makeFuncWrapper)
+	e.values = []interface{}{math.NaN(), 0.0, jsNull, true, false, e.newGlobal(), newJSObject(), e.goObj}
+	for i, v := range e.values[5:] {
+		e.refs[v] = uint32(5 + i)
+	}
+	return e
+}
+
+// newGlobal returns the global object with the built-in objects.
+func (e *jsEnv) newGlobal() *jsObject {
+	global := newJSObject()
+	global.props["global"] = global
+
+	newObject := func(args []interface{}) (interface{}, error) {
+		return newJSObject(), nil
+	}
+	object := newJSFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+		return newObject(args)
+	})
+	object.construct = newObject
+	global.props["Object"] = object
+
+	newArray := func(args []interface{}) (interface{}, error) {
+		if len(args) == 1 {
+			if n, ok := args[0].(float64); ok {
+				if n < 0 || n != math.Floor(n) {
+					return nil, throwTypeError("Invalid array length")
+				}
+				return newJSArray(make([]interface{}, int(n))), nil
+			}
+		}
+		return newJSArray(append([]interface{}{}, args...)), nil
+	}
+	array := newJSFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+		return newArray(args)
+	})
+	array.construct = newArray
+	global.props["Array"] = array
+
+	uint8Array := newJSFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+		return nil, throwTypeError("Constructor Uint8Array requires 'new'")
+	})
+	uint8Array.construct = func(args []interface{}) (interface{}, error) {
+		obj := newJSObject()
+		obj.isBytes = true
+		if len(args) != 0 {
+			if src, ok := args[0].(*jsObject); ok && src.isArray {
+				for _, v := range src.elems {
+					obj.bytes = append(obj.bytes, byte(int64(jsNumber(v))))
+				}
+			} else if n := jsNumber(args[0]); n > 0 {
+				obj.bytes = make([]byte, int(n))
+			}
+		}
+		return obj, nil
+	}
+	global.props["Uint8Array"] = uint8Array
+
+	mathObj := newJSObject()
+	for name, fn := range map[string]func(float64) float64{
+		"abs":   math.Abs,
+		"ceil":  math.Ceil,
+		"floor": math.Floor,
+		"round": func(x float64) float64 { return math.Floor(x + 0.5) },
+		"sqrt":  math.Sqrt,
+	} {
+		fn := fn
+		mathObj.props[name] = newJSFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+			if len(args) == 0 {
+				return math.NaN(), nil
+			}
+			return fn(jsNumber(args[0])), nil
+		})
+	}
+	mathObj.props["pow"] = newJSFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+		if len(args) < 2 {
+			return math.NaN(), nil
+		}
+		return math.Pow(jsNumber(args[0]), jsNumber(args[1])), nil
+	})
+	for name, max := range map[string]bool{"max": true, "min": false} {
+		max := max
+		mathObj.props[name] = newJSFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+			result := math.Inf(1)
+			if max {
+				result = math.Inf(-1)
+			}
+			for _, arg := range args {
+				n := jsNumber(arg)
+				if math.IsNaN(n) {
+					return math.NaN(), nil
+				}
+				if (max && n > result) || (!max && n < result) {
+					result = n
+				}
+			}
+			return result, nil
+		})
+	}
+	global.props["Math"] = mathObj
+
+	console := newJSObject()
+	for name, w := range map[string]*io.Writer{"log": &e.runner.stdout, "error": &e.runner.stderr} {
+		w := w
+		console.props[name] = newJSFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+			strs := make([]string, len(args))
+			for i, arg := range args {
+				strs[i] = jsString(arg)
+			}
+			fmt.Fprintln(*w, strings.Join(strs, " "))
+			return nil, nil
+		})
+	}
+	global.props["console"] = console
+
+	return global
+}
+
+// makeFuncWrapper implements Go._makeFuncWrapper of wasm_exec.js, which is
+// used by js.FuncOf. Calling the returned function resumes the program to
+// handle the call.
+func (e *jsEnv) makeFuncWrapper(this interface{}, args []interface{}) (interface{}, error) {
+	var id interface{}
+	if len(args) != 0 {
+		id = args[0]
+	}
+	return newJSFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+		event := newJSObject()
+		event.props["id"] = id
+		event.props["this"] = this
+		event.props["args"] = newJSArray(append([]interface{}{}, args...))
+		e.goObj.props["_pendingEvent"] = event
+		if _, err := e.runner.inst.Call("resume"); err != nil {
+			return nil, err
+		}
+		return event.props["result"], nil
+	}), nil
+}
+
+// jsNumber converts a value to a number, like the unary + operator.
+func jsNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case jsNullType:
+		return 0
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+		return math.NaN()
+	default:
+		return math.NaN()
+	}
+}
+
+// jsString converts a value to a string, like String(v).
+func jsString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "undefined"
+	case jsNullType:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		case v == math.Floor(v) && math.Abs(v) < 1e21:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		// Go writes exponents with at least two digits, JavaScript doesn't.
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		s = strings.Replace(s, "e-0", "e-", 1)
+		return strings.Replace(s, "e+0", "e+", 1)
+	case string:
+		return v
+	case *jsObject:
+		switch {
+		case v.isArray:
+			strs := make([]string, len(v.elems))
+			for i, elem := range v.elems {
+				if elem != nil && elem != jsNull {
+					strs[i] = jsString(elem)
+				}
+			}
+			return strings.Join(strs, ",")
+		case v.isBytes:
+			strs := make([]string, len(v.bytes))
+			for i, b := range v.bytes {
+				strs[i] = strconv.Itoa(int(b))
+			}
+			return strings.Join(strs, ",")
+		case v.isError:
+			return jsString(v.props["name"]) + ": " + jsString(v.props["message"])
+		case v.call != nil:
+			return "function () { [native code] }"
+		}
+		return "[object Object]"
+	}
+	panic("unreachable")
+}
+
+// arrayIndex returns the array index of a property name, or -1 if it is not
+// an array index.
+func arrayIndex(prop string) int {
+	if prop == "" || (len(prop) > 1 && prop[0] == '0') {
+		return -1
+	}
+	index, err := strconv.ParseUint(prop, 10, 31)
+	if err != nil {
+		return -1
+	}
+	return int(index)
+}
+
+// get returns the property of a value, like Reflect.get.
+func (e *jsEnv) get(v interface{}, prop string) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, jsNullType:
+		return nil, throwTypeError("Cannot read property '%s' of %s", prop, jsString(v))
+	case string:
+		units := utf16.Encode([]rune(v))
+		if prop == "length" {
+			return float64(len(units)), nil
+		}
+		if i := arrayIndex(prop); i >= 0 && i < len(units) {
+			return string(utf16.Decode(units[i : i+1])), nil
+		}
+		return nil, nil
+	case *jsObject:
+		switch {
+		case v.isArray:
+			if prop == "length" {
+				return float64(len(v.elems)), nil
+			}
+			if i := arrayIndex(prop); i >= 0 {
+				if i < len(v.elems) {
+					return v.elems[i], nil
+				}
+				return nil, nil
+			}
+		case v.isBytes:
+			if prop == "length" || prop == "byteLength" {
+				return float64(len(v.bytes)), nil
+			}
+			if i := arrayIndex(prop); i >= 0 {
+				if i < len(v.bytes) {
+					return float64(v.bytes[i]), nil
+				}
+				return nil, nil
+			}
+		}
+		return v.props[prop], nil
+	default:
+		// Numbers and booleans have no properties that can be used here.
+		return nil, nil
+	}
+}
+
+// set sets the property of a value, like Reflect.set.
+func (e *jsEnv) set(v interface{}, prop string, x interface{}) error {
+	switch v := v.(type) {
+	case nil, jsNullType:
+		return throwTypeError("Cannot set property '%s' of %s", prop, jsString(v))
+	case *jsObject:
+		switch {
+		case v.isArray:
+			if prop == "length" {
+				n := jsNumber(x)
+				if n < 0 || n != math.Floor(n) || n > math.MaxInt32 {
+					return throwTypeError("Invalid array length")
+				}
+				for len(v.elems) < int(n) {
+					v.elems = append(v.elems, nil)
+				}
+				v.elems = v.elems[:int(n)]
+				return nil
+			}
+			if i := arrayIndex(prop); i >= 0 {
+				for len(v.elems) <= i {
+					v.elems = append(v.elems, nil)
+				}
+				v.elems[i] = x
+				return nil
+			}
+		case v.isBytes:
+			if i := arrayIndex(prop); i >= 0 {
+				if i < len(v.bytes) {
+					v.bytes[i] = byte(int64(jsNumber(x)))
+				}
+				return nil
+			}
+		}
+		v.props[prop] = x
+	}
+	// Setting a property of a primitive value has no effect.
+	return nil
+}
+
+// apply calls fn with the given this value and arguments, like Reflect.apply.
+func (e *jsEnv) apply(fn, this interface{}, args []interface{}) (interface{}, error) {
+	if obj, ok := fn.(*jsObject); ok && obj.call != nil {
+		return obj.call(this, args)
+	}
+	return nil, throwTypeError("%s is not a function", jsString(fn))
+}
+
+// construct calls fn as a constructor, like Reflect.construct.
+func (e *jsEnv) construct(fn interface{}, args []interface{}) (interface{}, error) {
+	if obj, ok := fn.(*jsObject); ok && obj.construct != nil {
+		return obj.construct(args)
+	}
+	return nil, throwTypeError("%s is not a constructor", jsString(fn))
+}
+
+// jsMemory returns the given range of the memory of the instance.
+func jsMemory(inst *wasmvm.Instance, addr, length uint64) []byte {
+	if addr+length > uint64(len(inst.Memory)) {
+		panic(jsMemoryError{})
+	}
+	return inst.Memory[addr : addr+length]
+}
+
+// load reads the value stored at addr, like loadValue in wasm_exec.js.
+func (e *jsEnv) load(inst *wasmvm.Instance, addr uint64) interface{} {
+	bits := binary.LittleEndian.Uint64(jsMemory(inst, addr, 8))
+	f := math.Float64frombits(bits)
+	if f == 0 {
+		return nil
+	}
+	if !math.IsNaN(f) {
+		return f
+	}
+	id := uint32(bits)
+	if uint64(id) >= uint64(len(e.values)) {
+		return nil
+	}
+	return e.values[id]
+}
+
+// store writes a reference to the value at addr, like storeValue in
+// wasm_exec.js.
+func (e *jsEnv) store(inst *wasmvm.Instance, addr uint64, v interface{}) {
+	const nanHead = 0x7ff80000
+	mem := jsMemory(inst, addr, 8)
+	put := func(head, id uint32) {
+		binary.LittleEndian.PutUint32(mem[4:], head)
+		binary.LittleEndian.PutUint32(mem, id)
+	}
+	switch v := v.(type) {
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			put(nanHead, 0)
+		case v == 0:
+			put(nanHead, 1)
+		default:
+			binary.LittleEndian.PutUint64(mem, math.Float64bits(v))
+		}
+		return
+	case nil:
+		binary.LittleEndian.PutUint64(mem, 0)
+		return
+	case jsNullType:
+		put(nanHead, 2)
+		return
+	case bool:
+		if v {
+			put(nanHead, 3)
+		} else {
+			put(nanHead, 4)
+		}
+		return
+	}
+	ref, ok := e.refs[v]
+	if !ok {
+		ref = uint32(len(e.values))
+		e.values = append(e.values, v)
+		e.refs[v] = ref
+	}
+	var typeFlag uint32
+	switch v := v.(type) {
+	case string:
+		typeFlag = 1
+	case *jsObject:
+		if v.call != nil {
+			typeFlag = 3
+		}
+	}
+	put(nanHead|typeFlag, ref)
+}
+
+// jsLoadString reads a Go string with the given pointer and length.
+func jsLoadString(inst *wasmvm.Instance, ptr, length uint64) string {
+	return string(jsMemory(inst, ptr, length))
+}
+
+// loadValues reads a slice of values.
+func (e *jsEnv) loadValues(inst *wasmvm.Instance, ptr, length uint64) []interface{} {
+	values := make([]interface{}, length)
+	for i := range values {
+		values[i] = e.load(inst, ptr+uint64(i)*8)
+	}
+	return values
+}
+
+// storeResult stores the result of a call that may throw: the value or the
+// exception, followed by a boolean that indicates success.
+func (e *jsEnv) storeResult(inst *wasmvm.Instance, addr uint64, result interface{}, err error) error {
+	if t, ok := err.(*jsThrow); ok {
+		e.store(inst, addr, t.value)
+		jsMemory(inst, addr+8, 1)[0] = 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e.store(inst, addr, result)
+	jsMemory(inst, addr+8, 1)[0] = 1
+	return nil
+}
+
+// jsImport returns the host function for a syscall/js import, or nil if it is
+// not supported. The comments show the Go declarations, all pointers and
+// lengths are 32-bit.
+func (e *jsEnv) jsImport(name string) wasmvm.HostFunc {
+	var fn func(inst *wasmvm.Instance, args []uint64) ([]uint64, error)
+	switch name {
+	case "syscall/js.stringVal":
+		// func stringVal(value string) ref
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			e.store(inst, args[0], jsLoadString(inst, args[1], args[2]))
+			return nil, nil
+		}
+	case "syscall/js.valueGet":
+		// func valueGet(v ref, p string) ref
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			result, err := e.get(e.load(inst, args[1]), jsLoadString(inst, args[2], args[3]))
+			if err != nil {
+				return nil, err
+			}
+			e.store(inst, args[0], result)
+			return nil, nil
+		}
+	case "syscall/js.valueSet":
+		// func valueSet(v ref, p string, x ref)
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			return nil, e.set(e.load(inst, args[0]), jsLoadString(inst, args[1], args[2]), e.load(inst, args[3]))
+		}
+	case "syscall/js.valueIndex":
+		// func valueIndex(v ref, i int) ref
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			result, err := e.get(e.load(inst, args[1]), strconv.Itoa(int(int32(args[2]))))
+			if err != nil {
+				return nil, err
+			}
+			e.store(inst, args[0], result)
+			return nil, nil
+		}
+	case "syscall/js.valueSetIndex":
+		// func valueSetIndex(v ref, i int, x ref)
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			return nil, e.set(e.load(inst, args[0]), strconv.Itoa(int(int32(args[1]))), e.load(inst, args[2]))
+		}
+	case "syscall/js.valueCall":
+		// func valueCall(v ref, m string, args []ref) (ref, bool)
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			v := e.load(inst, args[1])
+			callArgs := e.loadValues(inst, args[4], args[5])
+			m, err := e.get(v, jsLoadString(inst, args[2], args[3]))
+			var result interface{}
+			if err == nil {
+				result, err = e.apply(m, v, callArgs)
+			}
+			return nil, e.storeResult(inst, args[0], result, err)
+		}
+	case "syscall/js.valueInvoke":
+		// func valueInvoke(v ref, args []ref) (ref, bool)
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			result, err := e.apply(e.load(inst, args[1]), nil, e.loadValues(inst, args[2], args[3]))
+			return nil, e.storeResult(inst, args[0], result, err)
+		}
+	case "syscall/js.valueNew":
+		// func valueNew(v ref, args []ref) (ref, bool)
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			result, err := e.construct(e.load(inst, args[1]), e.loadValues(inst, args[2], args[3]))
+			return nil, e.storeResult(inst, args[0], result, err)
+		}
+	case "syscall/js.valueLength":
+		// func valueLength(v ref) int
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			length, err := e.get(e.load(inst, args[0]), "length")
+			if err != nil {
+				return nil, err
+			}
+			return []uint64{uint64(uint32(int32(jsNumber(length))))}, nil
+		}
+	case "syscall/js.valuePrepareString":
+		// func valuePrepareString(v ref) (ref, int)
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			str := newJSObject()
+			str.isBytes = true
+			str.bytes = []byte(jsString(e.load(inst, args[1])))
+			e.store(inst, args[0], str)
+			binary.LittleEndian.PutUint64(jsMemory(inst, args[0]+8, 8), uint64(len(str.bytes)))
+			return nil, nil
+		}
+	case "syscall/js.valueLoadString":
+		// func valueLoadString(v ref, b []byte)
+		fn = func(inst *wasmvm.Instance, args []uint64) ([]uint64, error) {
+			str, ok := e.load(inst, args[0]).(*jsObject)
+			if !ok || !str.isBytes {
+				return nil, errors.New("syscall/js.valueLoadString: not a string prepared by valuePrepareString")
+			}
+			copy(jsMemory(inst, args[1], args[2]), str.bytes)
+			return nil, nil
+		}
+	default:
+		return nil
+	}
+	return func(inst *wasmvm.Instance, args []uint64) (results []uint64, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(jsMemoryError); !ok {
+					panic(r)
+				}
+				results, err = nil, fmt.Errorf("%s: out of bounds memory access", name)
+			}
+		}()
+		for i := range args {
+			// Pointers, lengths and int values are all 32-bit.
+			args[i] = uint64(uint32(args[i]))
+		}
+		return fn(inst, args)
+	}
+}
@@ -0,0 +1,99 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/tinygo-org/tinygo/wasmvm"
+)
+
+func TestJSEnv(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	e := newJSEnv(&wasmRunner{stdout: stdout, stderr: stdout})
+	inst := &wasmvm.Instance{Memory: make([]byte, 1024)}
+	call := func(name string, args ...uint64) []uint64 {
+		results, err := e.jsImport(name)(inst, args)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return results
+	}
+	str := func(s string) (uint64, uint64) {
+		copy(inst.Memory[512:], s)
+		return 512, uint64(len(s))
+	}
+	putFloat := func(addr uint64, f float64) {
+		binary.LittleEndian.PutUint64(inst.Memory[addr:], math.Float64bits(f))
+	}
+	loadString := func(addr uint64) string {
+		call("syscall/js.valuePrepareString", 32, addr)
+		length := binary.LittleEndian.Uint64(inst.Memory[40:])
+		call("syscall/js.valueLoadString", 32, 600, length, length)
+		return string(inst.Memory[600 : 600+length])
+	}
+
+	// The global object is stored at address 0.
+	binary.LittleEndian.PutUint64(inst.Memory[0:], 0x7ff80000<<32|5)
+
+	// Math.max(3, 7)
+	p, n := str("Math")
+	call("syscall/js.valueGet", 8, 0, p, n)
+	putFloat(64, 3)
+	putFloat(72, 7)
+	p, n = str("max")
+	call("syscall/js.valueCall", 16, 8, p, n, 64, 2, 2)
+	if inst.Memory[24] != 1 || math.Float64frombits(binary.LittleEndian.Uint64(inst.Memory[16:])) != 7 {
+		t.Errorf("Math.max(3, 7) did not return 7")
+	}
+
+	// Calling a method that doesn't exist throws a TypeError.
+	p, n = str("missing")
+	call("syscall/js.valueCall", 16, 8, p, n, 64, 0, 0)
+	if inst.Memory[24] != 0 {
+		t.Errorf("Math.missing() did not throw")
+	} else if s := loadString(16); s != "TypeError: undefined is not a function" {
+		t.Errorf("unexpected exception: %s", s)
+	}
+
+	// Properties set on an object can be read back, and an array grows when
+	// setting an element past the end.
+	p, n = str("Array")
+	call("syscall/js.valueGet", 8, 0, p, n)
+	call("syscall/js.valueNew", 16, 8, 64, 0, 0)
+	p, n = str("element")
+	call("syscall/js.stringVal", 64, p, n)
+	call("syscall/js.valueSetIndex", 16, 2, 64)
+	if length := call("syscall/js.valueLength", 16); length[0] != 3 {
+		t.Errorf("expected array length 3, got %d", length[0])
+	}
+	call("syscall/js.valueIndex", 80, 16, 2)
+	if s := loadString(80); s != "element" {
+		t.Errorf("unexpected array element: %s", s)
+	}
+	p, n = str("answer")
+	putFloat(64, 42)
+	call("syscall/js.valueSet", 0, p, n, 64)
+	call("syscall/js.valueGet", 8, 0, p, n)
+	if s := loadString(8); s != "42" {
+		t.Errorf("unexpected property value: %s", s)
+	}
+
+	// console.log writes to stdout.
+	p, n = str("console")
+	call("syscall/js.valueGet", 8, 0, p, n)
+	p, n = str("hello")
+	call("syscall/js.stringVal", 64, p, n)
+	putFloat(72, 1.5)
+	p, n = str("log")
+	call("syscall/js.valueCall", 16, 8, p, n, 64, 2, 2)
+	if stdout.String() != "hello 1.5\n" {
+		t.Errorf("unexpected console.log output: %q", stdout.String())
+	}
+
+	// Out of bounds memory accesses are reported as an error.
+	if _, err := e.jsImport("syscall/js.stringVal")(inst, []uint64{0, 1020, 100}); err == nil {
+		t.Errorf("expected an error for an out of bounds memory access")
+	}
+}
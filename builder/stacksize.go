@@ -0,0 +1,167 @@
+package builder
+
+// This file determines the stack size of each goroutine after linking, and
+// updates the .tinygo_stacksizes section of the executable with those stack
+// sizes.
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tinygo-org/tinygo/stacksize"
+	"tinygo.org/x/go-llvm"
+)
+
+// goroutineStackSize contains the result of the stack size analysis of a
+// single goroutine.
+type goroutineStackSize struct {
+	humanName        string
+	stackSize        uint64
+	stackSizeType    stacksize.SizeType
+	missingStackSize *stacksize.CallNode
+}
+
+// determineStackSizes tries to determine the stack size of each goroutine start
+// wrapper (in the order given in wrappers) using the call graph that can be
+// reconstructed from the executable. The LLVM module is used to find which
+// functions do indirect calls, as those are not visible in the executable.
+func determineStackSizes(mod llvm.Module, executable string, wrappers []string) ([]goroutineStackSize, *stacksize.CallNode, error) {
+	var callsIndirectFunction []string
+	for fn := mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+	search:
+		for bb := fn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+			for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+				if inst.IsACallInst().IsNil() {
+					continue
+				}
+				callee := inst.CalledValue()
+				if callee.IsAFunction().IsNil() && callee.IsAInlineAsm().IsNil() {
+					callsIndirectFunction = append(callsIndirectFunction, fn.Name())
+					break search
+				}
+			}
+		}
+	}
+
+	f, err := elf.Open(executable)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	functions, err := stacksize.CallGraph(f, callsIndirectFunction)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sizes := make([]goroutineStackSize, len(wrappers))
+	for i, name := range wrappers {
+		humanName := "<function pointer>"
+		if strings.HasSuffix(name, "$gowrapper") {
+			humanName = strings.TrimSuffix(name, "$gowrapper")
+		}
+		sizes[i] = goroutineStackSize{
+			humanName:     humanName,
+			stackSizeType: stacksize.Unknown,
+		}
+		nodes := functions[name]
+		if len(nodes) != 1 {
+			// The wrapper was not found in the executable, or there are
+			// multiple functions with the same name (which shouldn't happen).
+			continue
+		}
+		sizes[i].stackSize, sizes[i].stackSizeType, sizes[i].missingStackSize = nodes[0].StackSize()
+	}
+
+	// Also determine the stack size of the system stack, which is used by the
+	// scheduler and by interrupts.
+	var resetHandler *stacksize.CallNode
+	if nodes := functions["Reset_Handler"]; len(nodes) == 1 {
+		resetHandler = nodes[0]
+	}
+	return sizes, resetHandler, nil
+}
+
+// modifyStackSizes updates the .tinygo_stacksizes section in the executable with
+// the stack size of each goroutine. Goroutines for which the stack size could
+// not be determined keep the default stack size.
+func modifyStackSizes(executable string, stackSizes []goroutineStackSize) error {
+	f, err := elf.Open(executable)
+	if err != nil {
+		return err
+	}
+	section := f.Section(".tinygo_stacksizes")
+	machine := f.Machine
+	byteOrder := f.ByteOrder
+	f.Close()
+	if section == nil {
+		return errors.New("could not find .tinygo_stacksizes section")
+	}
+	if section.Type != elf.SHT_PROGBITS || section.Size != uint64(len(stackSizes))*4 {
+		return fmt.Errorf("expected .tinygo_stacksizes section with %d stack sizes", len(stackSizes))
+	}
+
+	data := make([]byte, section.Size)
+	for i, size := range stackSizes {
+		stackSize := size.stackSize
+		if size.stackSizeType != stacksize.Bounded {
+			continue
+		}
+		switch machine {
+		case elf.EM_ARM:
+			// An interrupt may happen at any time, which pushes 8 registers
+			// (32 bytes) to the goroutine stack. The interrupt handler itself
+			// runs on the system stack (MSP).
+			stackSize += 32
+		}
+		byteOrder.PutUint32(data[i*4:], uint32(stackSize))
+	}
+
+	// Write back the stack sizes, leaving the default stack size in place for
+	// goroutines with an unknown stack size.
+	file, err := os.OpenFile(executable, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for i, size := range stackSizes {
+		if size.stackSizeType != stacksize.Bounded {
+			continue
+		}
+		_, err := file.WriteAt(data[i*4:i*4+4], int64(section.Offset)+int64(i*4))
+		if err != nil {
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// printStacks prints the stack usage of each goroutine, as requested with the
+// -print-stacks flag.
+func printStacks(stackSizes []goroutineStackSize, resetHandler *stacksize.CallNode) {
+	fmt.Printf("%-32s %s\n", "function", "stack usage (in bytes)")
+	if resetHandler != nil {
+		stackSize, stackSizeType, missing := resetHandler.StackSize()
+		printStackSize("Reset_Handler", stackSize, stackSizeType, missing)
+	}
+	for _, size := range stackSizes {
+		printStackSize(size.humanName, size.stackSize, size.stackSizeType, size.missingStackSize)
+	}
+}
+
+// printStackSize prints a single line of the -print-stacks output.
+func printStackSize(name string, stackSize uint64, stackSizeType stacksize.SizeType, missing *stacksize.CallNode) {
+	switch stackSizeType {
+	case stacksize.Bounded:
+		fmt.Printf("%-32s %d\n", name, stackSize)
+	case stacksize.Unknown:
+		fmt.Printf("%-32s unknown, %s does not have stack frame information\n", name, missing)
+	case stacksize.Recursive:
+		fmt.Printf("%-32s recursive, %s may call itself\n", name, missing)
+	case stacksize.IndirectCall:
+		fmt.Printf("%-32s unknown, %s calls a function pointer\n", name, missing)
+	}
+}
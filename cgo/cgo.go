@@ -14,6 +14,7 @@ package cgo
 import (
 	"fmt"
 	"go/ast"
+	"go/parser"
 	"go/token"
 	"sort"
 	"strconv"
@@ -38,7 +39,13 @@ type cgoPackage struct {
 	typedefs        map[string]*typedefInfo
 	elaboratedTypes map[string]*elaboratedTypeInfo
 	enums           map[string]enumInfo
+	signatures      map[string]cSignature // C signatures of all functions
+	macros          map[string]macroInfo  // function-like macros
+	fragments       []fragmentInfo        // CGo preambles
+	fragment        int                   // index of the preamble being parsed
 	anonStructNum   int
+	cflags          []string // CFLAGS from #cgo lines
+	ldflags         []string // LDFLAGS from #cgo lines
 }
 
 // constantInfo stores some information about a CGo constant found by libclang
@@ -51,9 +58,13 @@ type constantInfo struct {
 // functionInfo stores some information about a CGo function found by libclang
 // and declared in the AST.
 type functionInfo struct {
-	args    []paramInfo
-	results *ast.FieldList
-	pos     token.Pos
+	args     []paramInfo
+	results  *ast.FieldList
+	pos      token.Pos
+	variadic bool
+	static   bool   // static functions must be called through a wrapper
+	fragment int    // index in cgoPackage.fragments
+	linkName string // name of the C wrapper function, if any
 }
 
 // paramInfo is a parameter of a CGo function (see functionInfo).
@@ -113,6 +124,7 @@ var cgoAliases = map[string]string{
 	"C.uint32_t":  "uint32",
 	"C.uint64_t":  "uint64",
 	"C.uintptr_t": "uintptr",
+	"C.size_t":    "uintptr",
 }
 
 // builtinAliases are handled specially because they only exist on the Go side
@@ -149,12 +161,77 @@ typedef long long           _Cgo_longlong;
 typedef unsigned long long  _Cgo_ulonglong;
 `
 
+// cgoHelpers lists functions that are available in the C pseudo-package
+// without being declared in C, like C.CString. They are written in Go and call
+// the runtime through a _Cgo_ prefixed declaration. In this source, C.foo
+// refers to the CGo name of foo, and function names get a C. prefix (except
+// for _Cgo_ functions). Only the helpers that are used are added to the
+// generated AST.
+var cgoHelpers = map[string]string{
+	"CString": `
+func CString(s string) *C.char {
+	return (*C.char)(_Cgo_CString(s))
+}
+
+//go:linkname _Cgo_CString runtime.cgo_CString
+func _Cgo_CString(s string) unsafe.Pointer
+`,
+	"CBytes": `
+func CBytes(b []byte) unsafe.Pointer {
+	return _Cgo_CBytes(b)
+}
+
+//go:linkname _Cgo_CBytes runtime.cgo_CBytes
+func _Cgo_CBytes(b []byte) unsafe.Pointer
+`,
+	"GoString": `
+func GoString(cstr *C.char) string {
+	return _Cgo_GoString(unsafe.Pointer(cstr))
+}
+
+//go:linkname _Cgo_GoString runtime.cgo_GoString
+func _Cgo_GoString(cstr unsafe.Pointer) string
+`,
+	"GoStringN": `
+func GoStringN(cstr *C.char, length C.int) string {
+	return _Cgo_GoStringN(unsafe.Pointer(cstr), uintptr(length))
+}
+
+//go:linkname _Cgo_GoStringN runtime.cgo_GoStringN
+func _Cgo_GoStringN(cstr unsafe.Pointer, length uintptr) string
+`,
+	"GoBytes": `
+func GoBytes(ptr unsafe.Pointer, length C.int) []byte {
+	return _Cgo_GoBytes(ptr, uintptr(length))
+}
+
+//go:linkname _Cgo_GoBytes runtime.cgo_GoBytes
+func _Cgo_GoBytes(ptr unsafe.Pointer, length uintptr) []byte
+`,
+	"malloc": `
+func malloc(size C.size_t) unsafe.Pointer {
+	return _Cgo_malloc(uintptr(size))
+}
+
+//go:linkname _Cgo_malloc runtime.cgo_malloc
+func _Cgo_malloc(size uintptr) unsafe.Pointer
+`,
+	"free": `
+func free(ptr unsafe.Pointer)
+`,
+}
+
 // Process extracts `import "C"` statements from the AST, parses the comment
 // with libclang, and modifies the AST to use this information. It returns a
 // newly created *ast.File that should be added to the list of to-be-parsed
-// files. If there is one or more error, it returns these in the []error slice
-// but still modifies the AST.
-func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string) (*ast.File, []error) {
+// files, and the contents of the _cgo_export.h header if the package exports
+// functions to C (nil otherwise), followed by the C source files with wrappers
+// for static functions and function-like macros that must be compiled with the
+// package. It also returns the CFLAGS and LDFLAGS of the package, as set in
+// #cgo lines that match the build tags (which should include GOOS and GOARCH).
+// If there is one or more error, it returns these in the []error slice but
+// still modifies the AST.
+func Process(files []*ast.File, dir string, fset *token.FileSet, cflags, tags []string) (*ast.File, []byte, [][]byte, []string, []string, []error) {
 	p := &cgoPackage{
 		dir:             dir,
 		fset:            fset,
@@ -166,6 +243,8 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 		typedefs:        map[string]*typedefInfo{},
 		elaboratedTypes: map[string]*elaboratedTypeInfo{},
 		enums:           map[string]enumInfo{},
+		signatures:      map[string]cSignature{},
+		macros:          map[string]macroInfo{},
 	}
 
 	// Add a new location for the following file.
@@ -237,6 +316,7 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 
 	// Find `import "C"` statements in the file.
 	var statements []*ast.GenDecl
+	statementFiles := map[*ast.GenDecl]*ast.File{}
 	for _, f := range files {
 		for i := 0; i < len(f.Decls); i++ {
 			decl := f.Decls[i]
@@ -263,6 +343,7 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 
 			// Found a CGo statement.
 			statements = append(statements, genDecl)
+			statementFiles[genDecl] = f
 
 			// Remove this import declaration.
 			f.Decls = append(f.Decls[:i], f.Decls[i+1:]...)
@@ -319,26 +400,48 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 					continue
 				}
 
-				if len(fields) > 1 {
-					p.addErrorAfter(comment.Slash, comment.Text[:lineStart+5], "not implemented: build constraints in #cgo line")
+				if len(fields) > 1 && !matchBuildConstraint(fields[:len(fields)-1], tags) {
+					// This line is not for the current target.
 					continue
 				}
 
 				name := fields[len(fields)-1]
 				value := line[colon+1:]
 				switch name {
-				case "CFLAGS":
+				case "CFLAGS", "LDFLAGS":
 					flags, err := shlex.Split(value)
 					if err != nil {
 						// TODO: find the exact location where the error happened.
 						p.addErrorAfter(comment.Slash, comment.Text[:lineStart+colon+1], "failed to parse flags in #cgo line: "+err.Error())
 						continue
 					}
-					if err := checkCompilerFlags(name, flags); err != nil {
+					if name == "CFLAGS" {
+						err = checkCompilerFlags(name, flags)
+					} else {
+						err = checkLinkerFlags(name, flags)
+					}
+					if err != nil {
+						p.addErrorAfter(comment.Slash, comment.Text[:lineStart+colon+1], err.Error())
+						continue
+					}
+					if name == "CFLAGS" {
+						p.cflags = append(p.cflags, flags...)
+					} else {
+						p.ldflags = append(p.ldflags, flags...)
+					}
+				case "pkg-config":
+					args, err := shlex.Split(value)
+					if err != nil {
+						p.addErrorAfter(comment.Slash, comment.Text[:lineStart+colon+1], "failed to parse flags in #cgo line: "+err.Error())
+						continue
+					}
+					pkgCFlags, pkgLDFlags, err := pkgConfig(args, append(cflags, p.cflags...))
+					if err != nil {
 						p.addErrorAfter(comment.Slash, comment.Text[:lineStart+colon+1], err.Error())
 						continue
 					}
-					cflags = append(cflags, flags...)
+					p.cflags = append(p.cflags, pkgCFlags...)
+					p.ldflags = append(p.ldflags, pkgLDFlags...)
 				default:
 					startPos := strings.LastIndex(line[4:colon], name) + 4
 					p.addErrorAfter(comment.Slash, comment.Text[:lineStart+startPos], "invalid #cgo line: "+name)
@@ -349,7 +452,7 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 	}
 
 	// Process all CGo imports.
-	for _, genDecl := range statements {
+	for i, genDecl := range statements {
 		cgoComment := genDecl.Doc.Text()
 
 		pos := genDecl.Pos()
@@ -357,12 +460,24 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 			pos = genDecl.Doc.Pos()
 		}
 		position := fset.PositionFor(pos, true)
-		p.parseFragment(cgoComment+cgoTypes, cflags, position.Filename, position.Line)
+		p.fragment = i
+		p.fragments = append(p.fragments, fragmentInfo{
+			source:   cgoComment,
+			filename: position.Filename,
+			line:     position.Line,
+		})
+		p.parseFragment(cgoComment+cgoTypes, append(cflags, p.cflags...), position.Filename, position.Line)
 	}
 
+	// Create C wrappers for static functions and function-like macros.
+	stubs := p.createWrappers(append(cflags, p.cflags...))
+
 	// Declare functions found by libclang.
 	p.addFuncDecls()
 
+	// Add helper functions like C.CString that are used but not declared in C.
+	p.addHelperDecls()
+
 	// Declare stub function pointer values found by libclang.
 	p.addFuncPtrDecls()
 
@@ -384,6 +499,16 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 	// Add enum types and enum constants for C enums.
 	p.addEnumTypes()
 
+	// Create a header for Go functions exported to C. This must be done
+	// before patching the AST, as it needs the original C.* type names.
+	preambles := map[*ast.File]string{}
+	for _, genDecl := range statements {
+		if genDecl.Doc != nil {
+			preambles[statementFiles[genDecl]] += genDecl.Doc.Text()
+		}
+	}
+	exportHeader := p.makeExportHeader(files, preambles)
+
 	// Patch the AST to use the declared types and functions.
 	for _, f := range files {
 		astutil.Apply(f, p.walker, nil)
@@ -392,11 +517,16 @@ func Process(files []*ast.File, dir string, fset *token.FileSet, cflags []string
 	// Print the newly generated in-memory AST, for debugging.
 	//ast.Print(fset, p.generated)
 
-	return p.generated, p.errors
+	return p.generated, exportHeader, stubs, p.cflags, p.ldflags, p.errors
 }
 
 // addFuncDecls adds the C function declarations found by libclang in the
-// comment above the `import "C"` statement.
+// comment above the `import "C"` statement. Variadic C functions get an extra
+// ...interface{} parameter and a //go:variadic pragma, so that the compiler
+// can pass the extra arguments directly to the C function:
+//
+//     //go:variadic
+//     func C.printf(format *C.char, $varargs ...interface{}) C.int
 func (p *cgoPackage) addFuncDecls() {
 	names := make([]string, 0, len(p.functions))
 	for name := range p.functions {
@@ -443,10 +573,100 @@ func (p *cgoPackage) addFuncDecls() {
 				Type: arg.typeExpr,
 			}
 		}
+		if fn.linkName != "" {
+			// Call the C wrapper instead of the static function or macro.
+			decl.Doc = &ast.CommentGroup{
+				List: []*ast.Comment{
+					&ast.Comment{
+						Slash: fn.pos,
+						Text:  "//export " + fn.linkName,
+					},
+				},
+			}
+		}
+		if fn.variadic {
+			if decl.Doc == nil {
+				decl.Doc = &ast.CommentGroup{}
+			}
+			decl.Doc.List = append(decl.Doc.List, &ast.Comment{
+				Slash: fn.pos,
+				Text:  "//go:variadic",
+			})
+			decl.Type.Params.List = append(decl.Type.Params.List, &ast.Field{
+				Names: []*ast.Ident{
+					&ast.Ident{
+						NamePos: fn.pos,
+						Name:    "$varargs",
+						Obj: &ast.Object{
+							Kind: ast.Var,
+							Name: "$varargs",
+							Decl: decl,
+						},
+					},
+				},
+				Type: &ast.Ellipsis{
+					Ellipsis: fn.pos,
+					Elt: &ast.InterfaceType{
+						Interface: fn.pos,
+						Methods: &ast.FieldList{
+							Opening: fn.pos,
+							Closing: fn.pos,
+						},
+					},
+				},
+			})
+		}
 		p.generated.Decls = append(p.generated.Decls, decl)
 	}
 }
 
+// addHelperDecls adds the functions from cgoHelpers that are used in the
+// package, unless they have been declared in C. For example, C.malloc is
+// declared by libclang if the CGo preamble includes stdlib.h.
+func (p *cgoPackage) addHelperDecls() {
+	names := make([]string, 0, len(cgoHelpers))
+	for name := range cgoHelpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, required := p.missingSymbols[name]; !required {
+			continue
+		}
+		if _, ok := p.functions[name]; ok {
+			continue
+		}
+		source := "package C\n\nimport \"unsafe\"\n" + cgoHelpers[name]
+		f, err := parser.ParseFile(p.fset, "<cgo>", source, parser.ParseComments)
+		if err != nil {
+			// This is a bug in the cgoHelpers map.
+			panic("could not parse CGo helper " + name + ": " + err.Error())
+		}
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue // import "unsafe"
+			}
+			if !strings.HasPrefix(decl.Name.Name, "_Cgo_") {
+				decl.Name.Name = "C." + decl.Name.Name
+			}
+			astutil.Apply(decl, func(cursor *astutil.Cursor) bool {
+				// Replace C.foo with the literal name "C.foo", like walker.
+				if node, ok := cursor.Node().(*ast.SelectorExpr); ok {
+					if x, ok := node.X.(*ast.Ident); ok && x.Name == "C" {
+						cursor.Replace(&ast.Ident{
+							NamePos: x.NamePos,
+							Name:    "C." + node.Sel.Name,
+						})
+					}
+				}
+				return true
+			}, nil)
+			p.generated.Decls = append(p.generated.Decls, decl)
+		}
+	}
+}
+
 // addFuncPtrDecls creates stub declarations of function pointer values. These
 // values will later be replaced with the real values in the compiler.
 // It adds code like the following to the AST:
@@ -475,12 +695,12 @@ func (p *cgoPackage) addFuncPtrDecls() {
 		fn := p.functions[name]
 		obj := &ast.Object{
 			Kind: ast.Typ,
-			Name: "C." + name + "$funcaddr",
+			Name: p.funcAddrName(name),
 		}
 		valueSpec := &ast.ValueSpec{
 			Names: []*ast.Ident{&ast.Ident{
 				NamePos: fn.pos,
-				Name:    "C." + name + "$funcaddr",
+				Name:    p.funcAddrName(name),
 				Obj:     obj,
 			}},
 			Type: &ast.SelectorExpr{
@@ -500,6 +720,16 @@ func (p *cgoPackage) addFuncPtrDecls() {
 	}
 }
 
+// funcAddrName returns the name of the stub global for the function pointer of
+// the given C function. The compiler derives the C symbol from this name, so it
+// refers to the C wrapper if there is one.
+func (p *cgoPackage) funcAddrName(name string) string {
+	if linkName := p.functions[name].linkName; linkName != "" {
+		name = linkName
+	}
+	return "C." + name + "$funcaddr"
+}
+
 // addConstDecls declares external C constants in the Go source.
 // It adds code like the following to the AST:
 //
@@ -1291,7 +1521,7 @@ func (p *cgoPackage) walker(cursor *astutil.Cursor) bool {
 		if x.Name == "C" {
 			name := "C." + node.Sel.Name
 			if _, ok := p.functions[node.Sel.Name]; ok {
-				name += "$funcaddr"
+				name = p.funcAddrName(node.Sel.Name)
 			}
 			cursor.Replace(&ast.Ident{
 				NamePos: x.NamePos,
@@ -1327,3 +1557,34 @@ func renameFieldName(fieldList *ast.FieldList, name string) {
 	renameFieldName(fieldList, "_"+name)
 	ident.Name = "_" + ident.Name
 }
+
+// matchBuildConstraint returns whether the build constraint of a #cgo line is
+// satisfied. The constraint is a list of options of which at least one must
+// match. Each option is a comma-separated list of tags (optionally negated with
+// '!') that must all match, like in a // +build line.
+func matchBuildConstraint(options []string, tags []string) bool {
+	for _, option := range options {
+		matched := true
+		for _, term := range strings.Split(option, ",") {
+			negated := strings.HasPrefix(term, "!")
+			if negated {
+				term = term[1:]
+			}
+			found := false
+			for _, tag := range tags {
+				if tag == term {
+					found = true
+					break
+				}
+			}
+			if found == negated {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
@@ -21,8 +21,9 @@ var flagUpdate = flag.Bool("update", false, "Update images based on test output.
 
 func TestCGo(t *testing.T) {
 	var cflags = []string{"--target=armv6m-none-eabi"}
+	var tags = []string{"linux", "arm"}
 
-	for _, name := range []string{"basic", "errors", "types", "flags"} {
+	for _, name := range []string{"basic", "errors", "types", "flags", "export"} {
 		name := name // avoid a race condition
 		t.Run(name, func(t *testing.T) {
 			// Read the AST in memory.
@@ -34,7 +35,7 @@ func TestCGo(t *testing.T) {
 			}
 
 			// Process the AST with CGo.
-			cgoAST, cgoErrors := Process([]*ast.File{f}, "testdata", fset, cflags)
+			cgoAST, exportHeader, _, _, ldflags, cgoErrors := Process([]*ast.File{f}, "testdata", fset, cflags, tags)
 
 			// Check the AST for type errors.
 			var typecheckErrors []error
@@ -70,6 +71,16 @@ func TestCGo(t *testing.T) {
 				}
 				buf.WriteString("\n")
 			}
+			if len(ldflags) != 0 {
+				buf.WriteString("// Linker flags: " + strings.Join(ldflags, " ") + "\n\n")
+			}
+			if len(exportHeader) != 0 {
+				buf.WriteString("// Export header:\n")
+				for _, line := range strings.Split(strings.TrimSuffix(string(exportHeader), "\n"), "\n") {
+					buf.WriteString(strings.TrimRight("//     "+line, " ") + "\n")
+				}
+				buf.WriteString("\n")
+			}
 			err = format.Node(buf, fset, cgoAST)
 			if err != nil {
 				t.Errorf("could not write out CGo AST: %v", err)
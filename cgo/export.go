@@ -0,0 +1,231 @@
+package cgo
+
+// This file generates the _cgo_export.h header for Go functions that are
+// exported to C with //export. C files in the same package can include this
+// header to call these functions, for example to pass them as callbacks to a C
+// library.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// exportHeaderPrologue is written at the start of each _cgo_export.h file. It
+// declares C types for Go types that may be used in exported functions.
+const exportHeaderPrologue = `/* Code generated by TinyGo. DO NOT EDIT. */
+
+#pragma once
+
+#include <stddef.h>
+#include <stdint.h>
+
+typedef int8_t    GoInt8;
+typedef uint8_t   GoUint8;
+typedef int16_t   GoInt16;
+typedef uint16_t  GoUint16;
+typedef int32_t   GoInt32;
+typedef uint32_t  GoUint32;
+typedef int64_t   GoInt64;
+typedef uint64_t  GoUint64;
+typedef intptr_t  GoInt;
+typedef uintptr_t GoUint;
+typedef uintptr_t GoUintptr;
+typedef float     GoFloat32;
+typedef double    GoFloat64;
+typedef _Bool     GoBool;
+`
+
+// goExportTypes maps Go basic types to the C types declared in
+// exportHeaderPrologue.
+var goExportTypes = map[string]string{
+	"int8":    "GoInt8",
+	"uint8":   "GoUint8",
+	"byte":    "GoUint8",
+	"int16":   "GoInt16",
+	"uint16":  "GoUint16",
+	"int32":   "GoInt32",
+	"rune":    "GoInt32",
+	"uint32":  "GoUint32",
+	"int64":   "GoInt64",
+	"uint64":  "GoUint64",
+	"int":     "GoInt",
+	"uint":    "GoUint",
+	"uintptr": "GoUintptr",
+	"float32": "GoFloat32",
+	"float64": "GoFloat64",
+	"bool":    "GoBool",
+}
+
+// cExportTypes maps the special C.* types (see builtinAliases) to their C
+// spelling.
+var cExportTypes = map[string]string{
+	"char":      "char",
+	"schar":     "signed char",
+	"uchar":     "unsigned char",
+	"short":     "short",
+	"ushort":    "unsigned short",
+	"int":       "int",
+	"uint":      "unsigned int",
+	"long":      "long",
+	"ulong":     "unsigned long",
+	"longlong":  "long long",
+	"ulonglong": "unsigned long long",
+}
+
+// makeExportHeader creates the contents of the _cgo_export.h header for all
+// functions marked //export in the given files. The header includes the CGo
+// preamble of each file that exports functions, so that C types used in the
+// function signatures are declared. It returns nil if no functions are
+// exported.
+func (p *cgoPackage) makeExportHeader(files []*ast.File, preambles map[*ast.File]string) []byte {
+	var prototypes []string
+	var preambleFiles []*ast.File
+	for _, f := range files {
+		hasExports := false
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok || decl.Doc == nil {
+				continue
+			}
+			name := exportName(decl)
+			if name == "" {
+				continue
+			}
+			hasExports = true
+			prototype, err := exportPrototype(name, decl)
+			if err != nil {
+				p.addError(decl.Pos(), err.Error())
+				continue
+			}
+			prototypes = append(prototypes, prototype)
+		}
+		if hasExports {
+			preambleFiles = append(preambleFiles, f)
+		}
+	}
+	if len(prototypes) == 0 {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(exportHeaderPrologue)
+	for _, f := range preambleFiles {
+		preamble, ok := preambles[f]
+		if !ok {
+			continue
+		}
+		position := p.fset.PositionFor(f.Package, true)
+		fmt.Fprintf(buf, "\n/* Preamble from %s. */\n%s", position.Filename, preamble)
+	}
+	buf.WriteString("\n/* Exported Go functions. */\n")
+	for _, prototype := range prototypes {
+		buf.WriteString(prototype)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// exportName returns the name of a function with an //export comment, or the
+// empty string if the function is not exported.
+func exportName(decl *ast.FuncDecl) string {
+	for _, comment := range decl.Doc.List {
+		if !strings.HasPrefix(comment.Text, "//export ") {
+			continue
+		}
+		parts := strings.Fields(comment.Text)
+		if len(parts) == 2 {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// exportPrototype returns the C prototype of an exported function, or an error
+// if the function can't be called from C.
+func exportPrototype(name string, decl *ast.FuncDecl) (string, error) {
+	if decl.Recv != nil {
+		return "", errors.New("cannot export method " + decl.Name.Name + " to C")
+	}
+
+	result := "void"
+	if results := decl.Type.Results; results != nil && len(results.List) != 0 {
+		if len(results.List) != 1 || len(results.List[0].Names) > 1 {
+			return "", errors.New("exported function " + decl.Name.Name + " cannot return multiple values to C")
+		}
+		typ, ok := exportCType(results.List[0].Type)
+		if !ok {
+			return "", errors.New("unsupported result type in exported function " + decl.Name.Name)
+		}
+		result = typ
+	}
+
+	var params []string
+	for _, field := range decl.Type.Params.List {
+		typ, ok := exportCType(field.Type)
+		if !ok {
+			return "", errors.New("unsupported parameter type in exported function " + decl.Name.Name)
+		}
+		if len(field.Names) == 0 {
+			params = append(params, typ)
+		}
+		for _, paramName := range field.Names {
+			if paramName.Name == "_" {
+				params = append(params, typ)
+				continue
+			}
+			params = append(params, typ+" "+paramName.Name)
+		}
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	return "extern " + result + " " + name + "(" + strings.Join(params, ", ") + ");", nil
+}
+
+// exportCType returns the C type for a Go type expression used in the
+// signature of an exported function. Only types that can be passed directly
+// in C are supported: C types, Go integer, float and bool types, and pointers.
+func exportCType(expr ast.Expr) (string, bool) {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		typ, ok := goExportTypes[expr.Name]
+		return typ, ok
+	case *ast.SelectorExpr:
+		x, ok := expr.X.(*ast.Ident)
+		if !ok {
+			return "", false
+		}
+		switch x.Name {
+		case "C":
+			name := expr.Sel.Name
+			if typ, ok := cExportTypes[name]; ok {
+				return typ, true
+			}
+			for _, prefix := range []string{"struct_", "union_", "enum_"} {
+				if strings.HasPrefix(name, prefix) {
+					return prefix[:len(prefix)-1] + " " + name[len(prefix):], true
+				}
+			}
+			return name, true
+		case "unsafe":
+			if expr.Sel.Name == "Pointer" {
+				return "void*", true
+			}
+		}
+		return "", false
+	case *ast.StarExpr:
+		typ, ok := exportCType(expr.X)
+		if !ok {
+			// Pointers to Go types are passed as opaque pointers.
+			return "void*", true
+		}
+		return typ + "*", true
+	case *ast.ParenExpr:
+		return exportCType(expr.X)
+	default:
+		return "", false
+	}
+}
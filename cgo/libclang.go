@@ -52,6 +52,9 @@ CXTranslationUnit tinygo_clang_Cursor_getTranslationUnit(GoCXCursor c);
 long long tinygo_clang_getEnumConstantDeclValue(GoCXCursor c);
 CXType tinygo_clang_getEnumDeclIntegerType(GoCXCursor c);
 unsigned tinygo_clang_Cursor_isBitField(GoCXCursor c);
+unsigned tinygo_clang_Cursor_isAnonymousRecordDecl(GoCXCursor c);
+enum CXLinkageKind tinygo_clang_getCursorLinkage(GoCXCursor c);
+unsigned tinygo_clang_Cursor_isMacroFunctionLike(GoCXCursor c);
 
 int tinygo_clang_globals_visitor(GoCXCursor c, GoCXCursor parent, CXClientData client_data);
 int tinygo_clang_struct_visitor(GoCXCursor c, GoCXCursor parent, CXClientData client_data);
@@ -148,16 +151,19 @@ func tinygo_clang_globals_visitor(c, parent C.GoCXCursor, client_data C.CXClient
 	switch kind {
 	case C.CXCursor_FunctionDecl:
 		name := getString(C.tinygo_clang_getCursorSpelling(c))
+		// Remember the C signature of all functions, as they may be called
+		// from a function-like macro.
+		p.signatures[name] = getCSignature(c)
 		if _, required := p.missingSymbols[name]; !required {
 			return C.CXChildVisit_Continue
 		}
 		cursorType := C.tinygo_clang_getCursorType(c)
-		if C.clang_isFunctionTypeVariadic(cursorType) != 0 {
-			return C.CXChildVisit_Continue // not supported
-		}
 		numArgs := int(C.tinygo_clang_Cursor_getNumArguments(c))
 		fn := &functionInfo{
-			pos: pos,
+			pos:      pos,
+			variadic: C.clang_isFunctionTypeVariadic(cursorType) != 0,
+			static:   C.tinygo_clang_getCursorLinkage(c) == C.CXLinkage_Internal,
+			fragment: p.fragment,
 		}
 		p.functions[name] = fn
 		for i := 0; i < numArgs; i++ {
@@ -245,6 +251,16 @@ func tinygo_clang_globals_visitor(c, parent C.GoCXCursor, client_data C.CXClient
 			break
 		}
 		value := source[len(name):]
+		if C.tinygo_clang_Cursor_isMacroFunctionLike(c) != 0 {
+			// Function-like macros are called through a C wrapper, see
+			// createWrappers.
+			p.macros[name] = macroInfo{
+				source:   value,
+				pos:      pos,
+				fragment: p.fragment,
+			}
+			break
+		}
 		// Try to convert this #define into a Go constant expression.
 		expr, err := parseConst(pos+token.Pos(len(name)), p.fset, value)
 		if err != nil {
@@ -263,6 +279,22 @@ func tinygo_clang_globals_visitor(c, parent C.GoCXCursor, client_data C.CXClient
 	return C.CXChildVisit_Continue
 }
 
+// getCSignature returns the signature of a C function declaration, as spelled
+// in C.
+func getCSignature(c C.GoCXCursor) cSignature {
+	cursorType := C.tinygo_clang_getCursorType(c)
+	sig := cSignature{
+		result:   getString(C.clang_getTypeSpelling(C.tinygo_clang_getCursorResultType(c))),
+		variadic: C.clang_isFunctionTypeVariadic(cursorType) != 0,
+	}
+	numArgs := int(C.tinygo_clang_Cursor_getNumArguments(c))
+	for i := 0; i < numArgs; i++ {
+		argType := C.clang_getArgType(cursorType, C.uint(i))
+		sig.params = append(sig.params, getString(C.clang_getTypeSpelling(argType)))
+	}
+	return sig
+}
+
 func getString(clangString C.CXString) (s string) {
 	rawString := C.clang_getCString(clangString)
 	s = C.GoString(rawString)
@@ -591,6 +623,14 @@ func (p *cgoPackage) makeASTType(typ C.CXType, pos token.Pos) ast.Expr {
 				Name:    "C.enum_" + name,
 			}
 		}
+	case C.CXType_Unexposed:
+		// Types like __typeof__(expr), as used in the return type of
+		// function-like macro wrappers, are not exposed by libclang. Use the
+		// type they refer to instead.
+		canonical := C.clang_getCanonicalType(typ)
+		if canonical.kind != C.CXType_Unexposed {
+			return p.makeASTType(canonical, pos)
+		}
 	}
 	if typeName == "" {
 		// Report this as an error.
@@ -615,13 +655,15 @@ func (p *cgoPackage) makeASTRecordType(cursor C.GoCXCursor, pos token.Pos) *elab
 	var bitfieldList []bitfieldInfo
 	inBitfield := false
 	bitfieldNum := 0
+	anonNum := 0
 	ref := storedRefs.Put(struct {
 		fieldList    *ast.FieldList
 		pkg          *cgoPackage
 		inBitfield   *bool
 		bitfieldNum  *int
 		bitfieldList *[]bitfieldInfo
-	}{fieldList, p, &inBitfield, &bitfieldNum, &bitfieldList})
+		anonNum      *int
+	}{fieldList, p, &inBitfield, &bitfieldNum, &bitfieldList, &anonNum})
 	defer storedRefs.Remove(ref)
 	C.tinygo_clang_visitChildren(cursor, C.CXCursorVisitor(C.tinygo_clang_struct_visitor), C.CXClientData(ref))
 	renameFieldKeywords(fieldList)
@@ -682,6 +724,7 @@ func tinygo_clang_struct_visitor(c, parent C.GoCXCursor, client_data C.CXClientD
 		inBitfield   *bool
 		bitfieldNum  *int
 		bitfieldList *[]bitfieldInfo
+		anonNum      *int
 	})
 	fieldList := passed.fieldList
 	p := passed.pkg
@@ -693,7 +736,31 @@ func tinygo_clang_struct_visitor(c, parent C.GoCXCursor, client_data C.CXClientD
 	case C.CXCursor_FieldDecl:
 		// Expected. This is a regular field.
 	case C.CXCursor_StructDecl, C.CXCursor_UnionDecl:
-		// Ignore. The next field will be the struct/union itself.
+		if C.tinygo_clang_Cursor_isAnonymousRecordDecl(c) == 0 {
+			// Ignore. The next field will be the struct/union itself.
+			return C.CXChildVisit_Continue
+		}
+		// This is an anonymous struct or union (C11), which has no field
+		// declaration of its own. Add it as a field named anon0, anon1, etc.
+		// like gc does, so that its members can be accessed.
+		*inBitfield = false
+		name := "anon" + strconv.Itoa(*passed.anonNum)
+		*passed.anonNum++
+		field := &ast.Field{
+			Type: p.makeASTType(C.tinygo_clang_getCursorType(c), pos),
+		}
+		field.Names = []*ast.Ident{
+			&ast.Ident{
+				NamePos: pos,
+				Name:    name,
+				Obj: &ast.Object{
+					Kind: ast.Var,
+					Name: name,
+					Decl: field,
+				},
+			},
+		}
+		fieldList.List = append(fieldList.List, field)
 		return C.CXChildVisit_Continue
 	default:
 		cursorKindSpelling := getString(C.clang_getCursorKindSpelling(cursorKind))
@@ -702,8 +769,8 @@ func tinygo_clang_struct_visitor(c, parent C.GoCXCursor, client_data C.CXClientD
 	}
 	name := getString(C.tinygo_clang_getCursorSpelling(c))
 	if name == "" {
-		// Assume this is a bitfield of 0 bits.
-		// Warning: this is not necessarily true!
+		// This is either a bitfield of 0 bits or the implicit field of an
+		// anonymous struct or union, which has already been added above.
 		return C.CXChildVisit_Continue
 	}
 	typ := C.tinygo_clang_getCursorType(c)
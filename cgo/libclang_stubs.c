@@ -67,4 +67,15 @@ CXType tinygo_clang_getEnumDeclIntegerType(CXCursor c) {
 
 unsigned tinygo_clang_Cursor_isBitField(CXCursor c) {
 	return clang_Cursor_isBitField(c);
-}
\ No newline at end of file
+}
+unsigned tinygo_clang_Cursor_isAnonymousRecordDecl(CXCursor c) {
+	return clang_Cursor_isAnonymousRecordDecl(c);
+}
+
+enum CXLinkageKind tinygo_clang_getCursorLinkage(CXCursor c) {
+	return clang_getCursorLinkage(c);
+}
+
+unsigned tinygo_clang_Cursor_isMacroFunctionLike(CXCursor c) {
+	return clang_Cursor_isMacroFunctionLike(c);
+}
@@ -0,0 +1,100 @@
+package cgo
+
+// This file implements the pkg-config directive in #cgo lines, which is used
+// to find the flags needed to use a C library.
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/shlex"
+)
+
+// pkgConfig runs pkg-config for the given packages and returns the resulting
+// compiler and linker flags. Arguments starting with "--" are passed to
+// pkg-config as flags. When cross compiling with a sysroot (set with --sysroot
+// in the C flags), pkg-config searches for packages inside the sysroot.
+func pkgConfig(args []string, cflags []string) ([]string, []string, error) {
+	var flags, pkgs []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			flags = append(flags, arg)
+		} else {
+			if !safeArg(arg) {
+				return nil, nil, errors.New("invalid pkg-config package name: " + arg)
+			}
+			pkgs = append(pkgs, arg)
+		}
+	}
+	if len(pkgs) == 0 {
+		return nil, nil, errors.New("missing package name in #cgo pkg-config line")
+	}
+
+	env := os.Environ()
+	if sysroot := findSysroot(cflags); sysroot != "" {
+		env = append(env, "PKG_CONFIG_SYSROOT_DIR="+sysroot)
+		if os.Getenv("PKG_CONFIG_LIBDIR") == "" {
+			// Don't look for packages of the host system.
+			env = append(env, "PKG_CONFIG_LIBDIR="+strings.Join([]string{
+				filepath.Join(sysroot, "usr", "lib", "pkgconfig"),
+				filepath.Join(sysroot, "usr", "share", "pkgconfig"),
+			}, string(filepath.ListSeparator)))
+		}
+	}
+
+	pkgCFlags, err := runPkgConfig(env, append(append(flags, "--cflags", "--"), pkgs...))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkCompilerFlags("CFLAGS", pkgCFlags); err != nil {
+		return nil, nil, err
+	}
+	pkgLDFlags, err := runPkgConfig(env, append(append(flags, "--libs", "--"), pkgs...))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkLinkerFlags("LDFLAGS", pkgLDFlags); err != nil {
+		return nil, nil, err
+	}
+	return pkgCFlags, pkgLDFlags, nil
+}
+
+// runPkgConfig runs pkg-config (or $PKG_CONFIG) and splits the output into
+// separate flags.
+func runPkgConfig(env []string, args []string) ([]string, error) {
+	command := os.Getenv("PKG_CONFIG")
+	if command == "" {
+		command = "pkg-config"
+	}
+	cmd := exec.Command(command, args...)
+	cmd.Env = env
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, errors.New("pkg-config " + strings.Join(args, " ") + ": " + msg)
+	}
+	return shlex.Split(string(out))
+}
+
+// findSysroot returns the sysroot passed in the list of C flags, or the empty
+// string if there is none.
+func findSysroot(cflags []string) string {
+	sysroot := ""
+	for i, flag := range cflags {
+		if strings.HasPrefix(flag, "--sysroot=") {
+			sysroot = flag[len("--sysroot="):]
+		} else if flag == "--sysroot" && i+1 < len(cflags) {
+			sysroot = cflags[i+1]
+		}
+	}
+	return sysroot
+}
@@ -21,6 +21,7 @@ type C.int16_t = int16
 type C.int32_t = int32
 type C.int64_t = int64
 type C.int8_t = int8
+type C.size_t = uintptr
 type C.uint16_t = uint16
 type C.uint32_t = uint32
 type C.uint64_t = uint64
@@ -0,0 +1,41 @@
+package main
+
+/*
+typedef int myint;
+*/
+import "C"
+
+import "unsafe"
+
+//export add
+func add(a, b C.int) C.int {
+	return a + b
+}
+
+//export store
+func store(ptr *C.myint, value C.myint) {
+	*ptr = value
+}
+
+//export setFlag
+func setFlag(ptr unsafe.Pointer, _ uint8, flag bool) {
+	*(*bool)(ptr) = flag
+}
+
+//export getValue
+func getValue() float64 {
+	return 3.5
+}
+
+//export goCallback
+func callback(C.long) {
+}
+
+//export multipleResults
+func multipleResults() (int, int) {
+	return 0, 0
+}
+
+//export withString
+func withString(s string) {
+}
@@ -9,6 +9,16 @@ package main
 
 #cgo CFLAGS: -DFOO
 
+// build constraints
+#cgo linux CFLAGS: -DLINUX
+#cgo darwin windows CFLAGS: -DNOTLINUX -fdoes-not-exist
+#cgo !darwin,arm darwin,!arm CFLAGS: -DARM
+
+// linker flags
+#cgo LDFLAGS: -lm -Wl,--as-needed
+#cgo linux LDFLAGS: -Wl,-foo
+#cgo darwin LDFLAGS: -lobjc
+
 #if defined(FOO)
 #define BAR 3
 #else
@@ -18,9 +28,16 @@ package main
 #if defined(NOTDEFINED)
 #warning flag must not be defined
 #endif
+
+#if defined(LINUX) && defined(ARM) && !defined(NOTLINUX)
+#define CONSTRAINTS 1
+#else
+#define CONSTRAINTS 0
+#endif
 */
 import "C"
 
 var (
 	_ = C.BAR
+	_ = C.CONSTRAINTS
 )
@@ -1,6 +1,9 @@
 // CGo errors:
 //     testdata/flags.go:5:7: invalid #cgo line: NOFLAGS
 //     testdata/flags.go:8:13: invalid flag: -fdoes-not-exist
+//     testdata/flags.go:19:20: invalid flag: -Wl,-foo
+
+// Linker flags: -lm -Wl,--as-needed
 
 package main
 
@@ -9,11 +12,13 @@ import "unsafe"
 var _ unsafe.Pointer
 
 const C.BAR = 3
+const C.CONSTRAINTS = 1
 
 type C.int16_t = int16
 type C.int32_t = int32
 type C.int64_t = int64
 type C.int8_t = int8
+type C.size_t = uintptr
 type C.uint16_t = uint16
 type C.uint32_t = uint32
 type C.uint64_t = uint64
@@ -104,6 +104,19 @@ typedef struct {
 	unsigned char e : 3;
 	// Note that C++ allows bitfields bigger than the underlying type.
 } bitfield_t;
+
+// Anonymous structs and unions inside a struct.
+typedef struct {
+	int tag;
+	union {
+		int   i;
+		float f;
+	};
+	struct {
+		short x;
+		short y;
+	};
+} anonymous_t;
 */
 import "C"
 
@@ -140,6 +153,9 @@ var (
 
 	// Arrays.
 	_ C.myIntArray
+
+	// Anonymous structs and unions.
+	_ C.anonymous_t
 )
 
 // Test bitfield accesses.
@@ -163,3 +179,11 @@ func accessUnion() {
 	var _ *C.int = union2d.unionfield_i()
 	var _ *[2]float64 = union2d.unionfield_d()
 }
+
+// Test anonymous struct and union accesses.
+func accessAnonymous() {
+	var x C.anonymous_t
+	x.tag = 1
+	*x.anon0.unionfield_f() = 3.5
+	x.anon1.x = 5
+}
@@ -18,6 +18,7 @@ type C.int16_t = int16
 type C.int32_t = int32
 type C.int64_t = int64
 type C.int8_t = int8
+type C.size_t = uintptr
 type C.uint16_t = uint16
 type C.uint32_t = uint32
 type C.uint64_t = uint64
@@ -34,6 +35,15 @@ type C.uint uint32
 type C.ulong uint32
 type C.ulonglong uint64
 type C.ushort uint16
+type C.anonymous_t = struct {
+	tag   C.int
+	anon0 C.union_5
+
+	anon1 struct {
+		x C.short
+		y C.short
+	}
+}
 type C.bitfield_t = C.struct_4
 type C.myIntArray = [10]C.int
 type C.myint = C.int
@@ -111,6 +121,11 @@ func (union *C.union_3) unionfield_thing() *C.union3_t     { return (*C.union3_t
 
 type C.union_3 struct{ $union [2]uint64 }
 
+func (union *C.union_5) unionfield_i() *C.int   { return (*C.int)(unsafe.Pointer(&union.$union)) }
+func (union *C.union_5) unionfield_f() *float32 { return (*float32)(unsafe.Pointer(&union.$union)) }
+
+type C.union_5 struct{ $union uint32 }
+
 func (union *C.union_union2d) unionfield_i() *C.int      { return (*C.int)(unsafe.Pointer(&union.$union)) }
 func (union *C.union_union2d) unionfield_d() *[2]float64 { return (*[2]float64)(unsafe.Pointer(&union.$union)) }
 
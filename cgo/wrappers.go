@@ -0,0 +1,310 @@
+package cgo
+
+// This file creates C wrappers for static functions and function-like macros.
+// These cannot be called directly from Go: static functions are not visible
+// outside the C file that defines them and macros only exist in the
+// preprocessor. Instead, a C stub file is created for each CGo preamble that
+// needs them, which contains the preamble and a regular C function for each
+// of these symbols. This stub file is compiled and linked into the program.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// cSignature is the signature of a C function as spelled in C, for use in a C
+// wrapper function.
+type cSignature struct {
+	result   string
+	params   []string
+	variadic bool
+}
+
+// macroInfo stores the definition of a function-like macro found by libclang.
+type macroInfo struct {
+	source   string // the macro definition after the name
+	pos      token.Pos
+	fragment int // index in cgoPackage.fragments
+}
+
+// fragmentInfo is a CGo preamble, as passed to libclang.
+type fragmentInfo struct {
+	source   string
+	filename string
+	line     int
+}
+
+// wrapperPrefix returns a prefix for the wrapper functions of this package.
+// These wrappers are regular C functions, so the prefix must be unique for
+// each package to avoid conflicts when two packages include the same header.
+func (p *cgoPackage) wrapperPrefix() string {
+	var dir string
+	if len(p.fragments) != 0 {
+		dir = filepath.Dir(p.fragments[0].filename)
+	}
+	hash := sha256.Sum256([]byte(dir))
+	return hex.EncodeToString(hash[:4])
+}
+
+// createWrappers creates the C stub files for all static functions and
+// function-like macros that are used in the package, and changes the function
+// declarations to call the wrappers instead. Function-like macros are only
+// supported if they have no parameters, or if they call a C function with the
+// macro parameters passed directly as arguments:
+//
+//     #define ANSWER()      (40 + 2)
+//     #define SET_PIN(p, v) gpio_set(PORTA, p, v)
+func (p *cgoPackage) createWrappers(cflags []string) [][]byte {
+	prefix := p.wrapperPrefix()
+	wrappers := make([]strings.Builder, len(p.fragments))
+
+	// Static functions have already been declared by libclang, only the link
+	// name needs to change.
+	names := make([]string, 0, len(p.functions))
+	for name := range p.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fn := p.functions[name]
+		if !fn.static {
+			continue
+		}
+		sig := p.signatures[name]
+		if sig.variadic {
+			p.addError(fn.pos, "variadic static function "+name+" cannot be called from Go")
+			continue
+		}
+		fn.linkName = "_Cgo_static_" + prefix + "_" + name
+		writeWrapper(&wrappers[fn.fragment], p.fset.Position(fn.pos), fn.linkName, name, sig)
+	}
+
+	// Function-like macros need to be parsed again as a wrapper function, to
+	// find their Go signature.
+	macroNames := make([]string, 0, len(p.macros))
+	for name := range p.macros {
+		macroNames = append(macroNames, name)
+	}
+	sort.Strings(macroNames)
+	macroWrappers := map[string]string{} // wrapper name -> macro name
+	for _, name := range macroNames {
+		macro := p.macros[name]
+		if _, required := p.missingSymbols[name]; !required {
+			continue
+		}
+		sig, err := p.macroSignature(macro)
+		if err != nil {
+			p.addError(macro.pos, "unsupported function-like macro "+name+": "+err.Error())
+			continue
+		}
+		wrapperName := "_Cgo_macro_" + prefix + "_" + name
+		writeWrapper(&wrappers[macro.fragment], p.fset.Position(macro.pos), wrapperName, name, sig)
+		macroWrappers[wrapperName] = name
+	}
+
+	var stubs [][]byte
+	for i, fragment := range p.fragments {
+		if wrappers[i].Len() == 0 {
+			continue
+		}
+		source := fragment.source + "\n" + wrappers[i].String()
+		stubs = append(stubs, []byte(fmt.Sprintf("# %d %#v\n", fragment.line+1, fragment.filename)+source))
+		if len(macroWrappers) == 0 {
+			continue
+		}
+
+		// Parse the stub file to declare the macro wrappers. Only look for
+		// the wrappers, to avoid declaring the same types twice. Errors in
+		// the preamble have already been reported.
+		missingSymbols := p.missingSymbols
+		p.missingSymbols = map[string]struct{}{}
+		for wrapperName := range macroWrappers {
+			p.missingSymbols[wrapperName] = struct{}{}
+		}
+		reported := map[string]struct{}{}
+		for _, err := range p.errors {
+			reported[err.Error()] = struct{}{}
+		}
+		numErrors := len(p.errors)
+		p.fragment = i
+		p.parseFragment(source, cflags, fragment.filename, fragment.line)
+		errors := p.errors[:numErrors]
+		for _, err := range p.errors[numErrors:] {
+			if _, ok := reported[err.Error()]; !ok {
+				errors = append(errors, err)
+			}
+		}
+		p.errors = errors
+		p.missingSymbols = missingSymbols
+	}
+
+	// Call the macro wrappers under the name of the macro.
+	for wrapperName, name := range macroWrappers {
+		fn, ok := p.functions[wrapperName]
+		if !ok {
+			// An error has been reported while parsing the wrapper.
+			continue
+		}
+		delete(p.functions, wrapperName)
+		fn.linkName = wrapperName
+		fn.pos = p.macros[name].pos
+		p.functions[name] = fn
+	}
+
+	return stubs
+}
+
+// macroSignature returns the signature of the C wrapper for a function-like
+// macro, or an error if the macro is not supported.
+func (p *cgoPackage) macroSignature(macro macroInfo) (cSignature, error) {
+	// Split the macro definition in the parameter list and the body.
+	source := strings.TrimSpace(macro.source)
+	end := strings.IndexByte(source, ')')
+	if !strings.HasPrefix(source, "(") || end < 0 {
+		return cSignature{}, fmt.Errorf("could not parse parameter list")
+	}
+	var params []string
+	if paramList := strings.TrimSpace(source[1:end]); paramList != "" {
+		for _, param := range strings.Split(paramList, ",") {
+			params = append(params, strings.TrimSpace(param))
+		}
+	}
+	body := strings.TrimSpace(source[end+1:])
+
+	if len(params) == 0 {
+		// The return type can be determined by the C compiler.
+		return cSignature{result: "__typeof__(" + body + ")"}, nil
+	}
+
+	// Macros with parameters must call a function, so that the types of the
+	// parameters are known.
+	body = trimParens(body)
+	open := strings.IndexByte(body, '(')
+	if open < 0 || !strings.HasSuffix(body, ")") || !isIdentifier(strings.TrimSpace(body[:open])) {
+		return cSignature{}, fmt.Errorf("macros with parameters must call a C function")
+	}
+	callee := strings.TrimSpace(body[:open])
+	calleeSig, ok := p.signatures[callee]
+	if !ok {
+		return cSignature{}, fmt.Errorf("%s is not a C function", callee)
+	}
+	args := splitArgs(body[open+1 : len(body)-1])
+	sig := cSignature{result: calleeSig.result}
+	for _, param := range params {
+		index := -1
+		for i, arg := range args {
+			if trimParens(arg) == param {
+				index = i
+				break
+			}
+		}
+		if index < 0 || index >= len(calleeSig.params) {
+			return cSignature{}, fmt.Errorf("parameter %s must be passed directly to %s", param, callee)
+		}
+		sig.params = append(sig.params, calleeSig.params[index])
+	}
+	return sig, nil
+}
+
+// writeWrapper writes a C function with the given name and signature that
+// calls the given function or macro, like this:
+//
+//     int _Cgo_static_xxx_add(int _Cgo_arg0, int _Cgo_arg1) { return add(_Cgo_arg0, _Cgo_arg1); }
+func writeWrapper(buf *strings.Builder, position token.Position, wrapperName, name string, sig cSignature) {
+	var params, args []string
+	for i, param := range sig.params {
+		arg := fmt.Sprintf("_Cgo_arg%d", i)
+		params = append(params, prefixType(param)+" "+arg)
+		args = append(args, arg)
+	}
+	if len(params) == 0 {
+		params = append(params, "void")
+	}
+	result := prefixType(sig.result)
+	returnStatement := "return "
+	if sig.result == "void" {
+		returnStatement = ""
+	}
+	fmt.Fprintf(buf, "# %d %#v\n", position.Line, position.Filename)
+	fmt.Fprintf(buf, "%s %s(%s) { %s%s(%s); }\n", result, wrapperName, strings.Join(params, ", "), returnStatement, name, strings.Join(args, ", "))
+}
+
+// prefixType returns the C type in a form that can be written before a name.
+// Types like function pointers and arrays are wrapped in __typeof__ for this.
+func prefixType(typ string) string {
+	if strings.ContainsAny(typ, "([") && !strings.HasPrefix(typ, "__typeof__(") {
+		return "__typeof__(" + typ + ")"
+	}
+	return typ
+}
+
+// trimParens removes whitespace and parentheses around an expression, like
+// "((x))".
+func trimParens(expr string) string {
+	expr = strings.TrimSpace(expr)
+	for strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") && len(splitArgs(expr[1:len(expr)-1])) != 0 && balanced(expr[1:len(expr)-1]) {
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+	return expr
+}
+
+// balanced returns whether all parentheses in the expression are balanced.
+func balanced(expr string) bool {
+	depth := 0
+	for _, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+// splitArgs splits a list of arguments at the commas that are not nested in
+// parentheses.
+func splitArgs(list string) []string {
+	var args []string
+	depth := 0
+	start := 0
+	for i, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(list[start:]); last != "" || len(args) != 0 {
+		args = append(args, last)
+	}
+	return args
+}
+
+// isIdentifier returns whether s is a valid C identifier.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -105,6 +105,37 @@ func (c *Config) Scheduler() string {
 	return "coroutines"
 }
 
+// AutomaticStackSize returns whether goroutine stack sizes should be determined
+// automatically at compile time, if possible. If it is false, no attempt is
+// made and every goroutine gets the default stack size.
+func (c *Config) AutomaticStackSize() bool {
+	if c.Target.AutoStackSize != nil && c.Scheduler() == "tasks" {
+		return *c.Target.AutoStackSize
+	}
+	return false
+}
+
+// DefaultStackSize returns the stack size of a goroutine when it could not be
+// determined at compile time, either because automatic stack size calculation
+// is disabled or because the call graph contains recursion, indirect calls or
+// functions with an unknown stack frame size.
+func (c *Config) DefaultStackSize() uint64 {
+	if c.Target.DefaultStackSize != 0 {
+		return c.Target.DefaultStackSize
+	}
+	return 1024
+}
+
+// MaxStackAlloc returns the maximum size of an object that may be allocated on
+// the stack instead of the heap by the escape analysis. Bigger objects have an
+// increased risk of stack overflows and thus are always heap allocated.
+func (c *Config) MaxStackAlloc() uint64 {
+	if c.Target.MaxStackAlloc != 0 {
+		return c.Target.MaxStackAlloc
+	}
+	return 256
+}
+
 // PanicStrategy returns the panic strategy selected for this target. Valid
 // values are "print" (print the panic value, then exit) or "trap" (issue a trap
 // instruction).
@@ -133,7 +164,7 @@ func (c *Config) LDFlags() []string {
 		ldflags = append(ldflags, strings.Replace(flag, "{root}", root, -1))
 	}
 	ldflags = append(ldflags, "-L", root)
-	if c.Target.GOARCH == "wasm" {
+	if strings.HasPrefix(c.Triple(), "wasm") {
 		// Round heap size to next multiple of 65536 (the WebAssembly page
 		// size).
 		heapSize := (c.Options.HeapSize + (65536 - 1)) &^ (65536 - 1)
@@ -142,13 +173,42 @@ func (c *Config) LDFlags() []string {
 	if c.Target.LinkerScript != "" {
 		ldflags = append(ldflags, "-T", c.Target.LinkerScript)
 	}
+	if c.AutomaticStackSize() {
+		// Keep relocations in the executable: they are used to reconstruct
+		// the call graph for stack size analysis.
+		ldflags = append(ldflags, "--emit-relocs")
+	}
 	return ldflags
 }
 
 // ExtraFiles returns the list of extra files to be built and linked with the
 // executable. This can include extra C and assembly files.
 func (c *Config) ExtraFiles() []string {
-	return c.Target.ExtraFiles
+	files := c.Target.ExtraFiles
+	if c.Scheduler() == "tasks" && c.hasBuildTag("cortexm") && c.hasBuildTag("preempt") {
+		// The PendSV handler that preempts goroutines. It is not part of the
+		// target, so that programs without preemption can still define their
+		// own PendSV_Handler or use another scheduler.
+		files = append(files[:len(files):len(files)], "src/runtime/preempt_cortexm.S")
+	}
+	return files
+}
+
+// hasBuildTag returns whether the given build tag is set for this build.
+func (c *Config) hasBuildTag(tag string) bool {
+	for _, t := range c.BuildTags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// NoLTOFiles returns the extra C files that must be compiled to a separate
+// object file even when LTO is enabled, for example because they rely on the
+// exact layout of the generated code.
+func (c *Config) NoLTOFiles() []string {
+	return c.Target.NoLTOFiles
 }
 
 // DumpSSA returns whether to dump Go SSA while compiling (-dumpssa flag). Only
@@ -169,6 +229,26 @@ func (c *Config) Debug() bool {
 	return c.Options.Debug
 }
 
+// WasmAbi returns the WebAssembly ABI conventions to use for exported and
+// imported functions: "js" (no i64 parameters, for JavaScript hosts) or
+// "generic". It can be set in the target JSON and overridden with -wasm-abi.
+func (c *Config) WasmAbi() string {
+	if c.Options.WasmAbi != "" {
+		return c.Options.WasmAbi
+	}
+	if c.Target.WasmAbi != "" {
+		return c.Target.WasmAbi
+	}
+	return "js"
+}
+
+// LTO returns whether C files should be compiled to LLVM bitcode and optimized
+// together with the Go code, instead of being compiled to separate object
+// files. This is only possible when the C compiler is Clang.
+func (c *Config) LTO() bool {
+	return c.Options.LTO && c.Target.Compiler == "clang"
+}
+
 // Programmer returns the flash method and OpenOCD interface name given a
 // particular configuration. It may either be all configured in the target JSON
 // file or be modified using the -programmmer command-line option.
@@ -0,0 +1,34 @@
+package compileopts
+
+import "testing"
+
+func TestExtraFiles(t *testing.T) {
+	const preemptFile = "src/runtime/preempt_cortexm.S"
+	spec, err := LoadTarget("cortex-m-qemu")
+	if err != nil {
+		t.Fatal("failed to load target:", err)
+	}
+	for _, tc := range []struct {
+		scheduler string
+		tags      string
+		preempt   bool
+	}{
+		{"", "", false},
+		{"", "preempt", true},
+		{"coroutines", "preempt", false},
+	} {
+		config := &Config{
+			Options: &Options{Scheduler: tc.scheduler, Tags: tc.tags},
+			Target:  spec,
+		}
+		found := false
+		for _, path := range config.ExtraFiles() {
+			if path == preemptFile {
+				found = true
+			}
+		}
+		if found != tc.preempt {
+			t.Errorf("scheduler %q, tags %q: expected %s in extra files: %v", tc.scheduler, tc.tags, preemptFile, tc.preempt)
+		}
+	}
+}
@@ -12,7 +12,9 @@ type Options struct {
 	DumpSSA       bool
 	VerifyIR      bool
 	Debug         bool
+	LTO           bool
 	PrintSizes    string
+	PrintStacks   bool
 	CFlags        []string
 	LDFlags       []string
 	Tags          string
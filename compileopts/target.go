@@ -36,6 +36,7 @@ type TargetSpec struct {
 	LDFlags          []string `json:"ldflags"`
 	LinkerScript     string   `json:"linkerscript"`
 	ExtraFiles       []string `json:"extra-files"`
+	NoLTOFiles       []string `json:"no-lto-files"` // extra files that must be compiled separately
 	Emulator         []string `json:"emulator"`
 	FlashCommand     string   `json:"flash-command"`
 	GDB              string   `json:"gdb"`
@@ -46,6 +47,10 @@ type TargetSpec struct {
 	OpenOCDInterface string   `json:"openocd-interface"`
 	OpenOCDTarget    string   `json:"openocd-target"`
 	OpenOCDTransport string   `json:"openocd-transport"`
+	AutoStackSize    *bool    `json:"automatic-stack-size"` // Determine stack size automatically at compile time.
+	DefaultStackSize uint64   `json:"default-stack-size"`   // Default stack size if the size couldn't be determined at compile time.
+	MaxStackAlloc    uint64   `json:"max-stack-alloc"`      // Maximum size of a heap allocation that may be moved to the stack.
+	WasmAbi          string   `json:"wasm-abi"`
 }
 
 // copyProperties copies all properties that are set in spec2 into itself.
@@ -88,6 +93,7 @@ func (spec *TargetSpec) copyProperties(spec2 *TargetSpec) {
 		spec.LinkerScript = spec2.LinkerScript
 	}
 	spec.ExtraFiles = append(spec.ExtraFiles, spec2.ExtraFiles...)
+	spec.NoLTOFiles = append(spec.NoLTOFiles, spec2.NoLTOFiles...)
 	if len(spec2.Emulator) != 0 {
 		spec.Emulator = spec2.Emulator
 	}
@@ -118,6 +124,18 @@ func (spec *TargetSpec) copyProperties(spec2 *TargetSpec) {
 	if spec2.OpenOCDTransport != "" {
 		spec.OpenOCDTransport = spec2.OpenOCDTransport
 	}
+	if spec2.AutoStackSize != nil {
+		spec.AutoStackSize = spec2.AutoStackSize
+	}
+	if spec2.DefaultStackSize != 0 {
+		spec.DefaultStackSize = spec2.DefaultStackSize
+	}
+	if spec2.MaxStackAlloc != 0 {
+		spec.MaxStackAlloc = spec2.MaxStackAlloc
+	}
+	if spec2.WasmAbi != "" {
+		spec.WasmAbi = spec2.WasmAbi
+	}
 }
 
 // load reads a target specification from the JSON in the given io.Reader. It
@@ -2,6 +2,10 @@ package compiler
 
 import (
 	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+
 	"golang.org/x/tools/go/ssa"
 	"tinygo.org/x/go-llvm"
 )
@@ -182,3 +186,112 @@ func (c *Compiler) collapseFormalParamInternal(t llvm.Type, fields []llvm.Value)
 		return fields[0], fields[1:]
 	}
 }
+
+// parseVariadicCall creates a call to a variadic C function, like printf. CGo
+// declares these functions with an extra ...interface{} parameter. The values
+// stored in this slice are passed directly to the C function, after applying
+// the C default argument promotions.
+func (c *Compiler) parseVariadicCall(frame *Frame, instr *ssa.CallCommon, llvmFn llvm.Value) (llvm.Value, error) {
+	fixedArgs := instr.Args[:len(instr.Args)-1]
+	var params []llvm.Value
+	for _, arg := range fixedArgs {
+		params = append(params, c.getValue(frame, arg))
+	}
+	varargs, err := c.getVariadicArgs(instr.Args[len(instr.Args)-1], instr.Pos())
+	if err != nil {
+		return llvm.Value{}, err
+	}
+	for _, arg := range varargs {
+		param, err := c.promoteVariadicArg(frame, arg, instr.Pos())
+		if err != nil {
+			return llvm.Value{}, err
+		}
+		params = append(params, param)
+	}
+	return c.createCall(llvmFn, params, ""), nil
+}
+
+// getVariadicArgs returns the values stored in the ...interface{} slice of a
+// call to a variadic C function, before they were converted to an interface.
+// The slice must be created by the call itself: passing an existing slice with
+// args... is not supported.
+func (c *Compiler) getVariadicArgs(slice ssa.Value, pos token.Pos) ([]ssa.Value, error) {
+	switch slice := slice.(type) {
+	case *ssa.Const:
+		// No variadic arguments were passed.
+		return nil, nil
+	case *ssa.Slice:
+		alloc, ok := slice.X.(*ssa.Alloc)
+		if !ok {
+			break
+		}
+		arrayType := alloc.Type().Underlying().(*types.Pointer).Elem().Underlying().(*types.Array)
+		args := make([]ssa.Value, arrayType.Len())
+		for _, ref := range *alloc.Referrers() {
+			indexAddr, ok := ref.(*ssa.IndexAddr)
+			if !ok {
+				continue
+			}
+			index, ok := indexAddr.Index.(*ssa.Const)
+			if !ok {
+				continue
+			}
+			for _, ref := range *indexAddr.Referrers() {
+				store, ok := ref.(*ssa.Store)
+				if !ok || store.Addr != indexAddr {
+					continue
+				}
+				if makeInterface, ok := store.Val.(*ssa.MakeInterface); ok {
+					args[index.Int64()] = makeInterface.X
+				}
+			}
+		}
+		for _, arg := range args {
+			if arg == nil {
+				return nil, c.makeError(pos, "interface values cannot be passed to a variadic C function")
+			}
+		}
+		return args, nil
+	}
+	return nil, c.makeError(pos, "variadic C functions must be called with a list of arguments, not with a slice")
+}
+
+// promoteVariadicArg applies the C default argument promotions to a variadic
+// argument: float is passed as a double and integers smaller than an int are
+// extended to an int. A Go int or uint is passed as a C int or unsigned int,
+// like an integer constant would be in C, as it is bigger than a C int on some
+// targets: pass a sized type like int64 for bigger values. Only C-compatible
+// types can be passed.
+func (c *Compiler) promoteVariadicArg(frame *Frame, arg ssa.Value, pos token.Pos) (llvm.Value, error) {
+	value := c.getValue(frame, arg)
+	// The C int type is 16 bits on AVR and 32 bits elsewhere.
+	intType := c.ctx.Int32Type()
+	if strings.HasPrefix(c.Triple(), "avr") {
+		intType = c.ctx.Int16Type()
+	}
+	switch typ := arg.Type().Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case typ.Kind() == types.Float32:
+			return c.builder.CreateFPExt(value, c.ctx.DoubleType(), ""), nil
+		case typ.Kind() == types.Int || typ.Kind() == types.Uint:
+			if value.Type().IntTypeWidth() > intType.IntTypeWidth() {
+				return c.builder.CreateTrunc(value, intType, ""), nil
+			}
+			return value, nil
+		case typ.Info()&(types.IsInteger|types.IsBoolean) != 0:
+			if value.Type().IntTypeWidth() >= intType.IntTypeWidth() {
+				return value, nil
+			}
+			if typ.Info()&types.IsUnsigned != 0 || typ.Kind() == types.Bool {
+				return c.builder.CreateZExt(value, intType, ""), nil
+			}
+			return c.builder.CreateSExt(value, intType, ""), nil
+		case typ.Info()&types.IsFloat != 0, typ.Kind() == types.UnsafePointer:
+			return value, nil
+		}
+	case *types.Pointer:
+		return value, nil
+	}
+	return llvm.Value{}, c.makeError(pos, "unsupported type in call to variadic C function: "+arg.Type().String())
+}
@@ -63,8 +63,7 @@ func (c *Compiler) emitChanRecv(frame *Frame, unop *ssa.UnOp) llvm.Value {
 }
 
 // emitChanClose closes the given channel.
-func (c *Compiler) emitChanClose(frame *Frame, param ssa.Value) {
-	ch := c.getValue(frame, param)
+func (c *Compiler) emitChanClose(ch llvm.Value) {
 	c.createRuntimeCall("chanClose", []llvm.Value{ch}, "")
 }
 
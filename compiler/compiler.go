@@ -41,6 +41,7 @@ var functionsUsedInTransforms = []string{
 	"runtime.alloc",
 	"runtime.free",
 	"runtime.scheduler",
+	"runtime.mainReturned",
 	"runtime.nilPanic",
 }
 
@@ -80,6 +81,8 @@ type Compiler struct {
 	ir                      *ir.Program
 	diagnostics             []error
 	astComments             map[string]*ast.CommentGroup
+	interruptHandlers       map[string]token.Pos
+	blockingFuncs           map[llvm.Value]struct{}
 }
 
 type Frame struct {
@@ -96,6 +99,7 @@ type Frame struct {
 	deferFuncs        map[*ir.Function]int
 	deferInvokeFuncs  map[string]int
 	deferClosureFuncs map[*ir.Function]int
+	deferExprFuncs    map[ssa.Value]int
 	selectRecvBuf     map[*ssa.Select]llvm.Value
 }
 
@@ -109,6 +113,8 @@ func NewCompiler(pkgName string, config *compileopts.Config) (*Compiler, error)
 		Config:  config,
 		difiles: make(map[string]llvm.Metadata),
 		ditypes: make(map[types.Type]llvm.Metadata),
+
+		interruptHandlers: make(map[string]token.Pos),
 	}
 
 	target, err := llvm.GetTargetFromTriple(config.Triple())
@@ -217,14 +223,14 @@ func (c *Compiler) Compile(mainPath string) []error {
 				path = path[len(tinygoPath+"/src/"):]
 			}
 			switch path {
-			case "machine", "os", "reflect", "runtime", "runtime/volatile", "sync", "testing", "internal/reflectlite":
+			case "machine", "os", "os/memfs", "reflect", "runtime", "runtime/interrupt", "runtime/volatile", "sync", "testing", "internal/reflectlite":
 				return path
 			default:
-				if strings.HasPrefix(path, "device/") || strings.HasPrefix(path, "examples/") {
+				if strings.HasPrefix(path, "device/") || strings.HasPrefix(path, "examples/") || strings.HasPrefix(path, "machine/") {
 					return path
 				} else if path == "syscall" {
 					for _, tag := range c.BuildTags() {
-						if tag == "baremetal" || tag == "darwin" {
+						if tag == "baremetal" || tag == "darwin" || tag == "wasi" {
 							return path
 						}
 					}
@@ -381,17 +387,19 @@ func (c *Compiler) Compile(mainPath string) []error {
 	}
 
 	// see: https://reviews.llvm.org/D18355
+	// Use the same behavior (Warning) as Clang, so that C files compiled with
+	// -g can be linked into this module with LTO.
 	if c.Debug() {
 		c.mod.AddNamedMetadataOperand("llvm.module.flags",
 			c.ctx.MDNode([]llvm.Metadata{
-				llvm.ConstInt(c.ctx.Int32Type(), 1, false).ConstantAsMetadata(), // Error on mismatch
+				llvm.ConstInt(c.ctx.Int32Type(), 2, false).ConstantAsMetadata(), // Warning on mismatch
 				llvm.GlobalContext().MDString("Debug Info Version"),
 				llvm.ConstInt(c.ctx.Int32Type(), 3, false).ConstantAsMetadata(), // DWARF version
 			}),
 		)
 		c.mod.AddNamedMetadataOperand("llvm.module.flags",
 			c.ctx.MDNode([]llvm.Metadata{
-				llvm.ConstInt(c.ctx.Int32Type(), 1, false).ConstantAsMetadata(),
+				llvm.ConstInt(c.ctx.Int32Type(), 2, false).ConstantAsMetadata(),
 				llvm.GlobalContext().MDString("Dwarf Version"),
 				llvm.ConstInt(c.ctx.Int32Type(), 4, false).ConstantAsMetadata(),
 			}),
@@ -719,8 +727,14 @@ func (c *Compiler) parseFuncDecl(f *ir.Function) *Frame {
 		retType = c.ctx.StructType(results, false)
 	}
 
+	params := f.Params
+	if f.IsVariadic() {
+		// The last parameter holds the variadic arguments, which are passed
+		// directly to the C function (see parseVariadicCall).
+		params = params[:len(params)-1]
+	}
 	var paramTypes []llvm.Type
-	for _, param := range f.Params {
+	for _, param := range params {
 		paramType := c.getLLVMType(param.Type())
 		paramTypeFragments := c.expandFormalParamType(paramType)
 		paramTypes = append(paramTypes, paramTypeFragments...)
@@ -733,7 +747,7 @@ func (c *Compiler) parseFuncDecl(f *ir.Function) *Frame {
 		paramTypes = append(paramTypes, c.i8ptrType) // parent coroutine
 	}
 
-	fnType := llvm.FunctionType(retType, paramTypes, false)
+	fnType := llvm.FunctionType(retType, paramTypes, f.IsVariadic())
 
 	name := f.LinkName()
 	frame.fn.LLVMFn = c.mod.NamedFunction(name)
@@ -999,6 +1013,10 @@ func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
 			// Static callee is known. This makes it easier to start a new
 			// goroutine.
 			calleeFn := c.ir.GetFunction(callee)
+			if calleeFn.IsVariadic() {
+				c.addError(instr.Pos(), "cannot start goroutine with variadic C function "+calleeFn.CName())
+				break
+			}
 			var context llvm.Value
 			switch value := instr.Call.Value.(type) {
 			case *ssa.Function:
@@ -1014,7 +1032,7 @@ func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
 			}
 			params = append(params, context) // context parameter
 			c.emitStartGoroutine(calleeFn.LLVMFn, params)
-		} else if !instr.Call.IsInvoke() {
+		} else if _, ok := instr.Call.Value.(*ssa.Builtin); !ok && !instr.Call.IsInvoke() {
 			// This is a function pointer.
 			// At the moment, two extra params are passed to the newly started
 			// goroutine:
@@ -1033,7 +1051,9 @@ func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
 			}
 			c.emitStartGoroutine(funcPtr, params)
 		} else {
-			c.addError(instr.Pos(), "todo: go on interface call")
+			// A builtin or a method call on an interface. Start the goroutine
+			// through a wrapper function that does the actual call.
+			c.emitStartGoroutineCall(frame, &instr.Call)
 		}
 	case *ssa.If:
 		cond := c.getValue(frame, instr.Cond)
@@ -1086,11 +1106,15 @@ func (c *Compiler) parseInstr(frame *Frame, instr ssa.Instruction) {
 	}
 }
 
-func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string, pos token.Pos) (llvm.Value, error) {
+// emitBuiltin emits the code for a call to a builtin function. The argument
+// types and values are passed separately so that it can also be used for
+// deferred calls and goroutines, where the arguments have been evaluated
+// before.
+func (c *Compiler) emitBuiltin(argTypes []types.Type, argValues []llvm.Value, callName string, pos token.Pos) (llvm.Value, error) {
 	switch callName {
 	case "append":
-		src := c.getValue(frame, args[0])
-		elems := c.getValue(frame, args[1])
+		src := argValues[0]
+		elems := argValues[1]
 		srcBuf := c.builder.CreateExtractValue(src, 0, "append.srcBuf")
 		srcPtr := c.builder.CreateBitCast(srcBuf, c.i8ptrType, "append.srcPtr")
 		srcLen := c.builder.CreateExtractValue(src, 1, "append.srcLen")
@@ -1111,9 +1135,9 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		newSlice = c.builder.CreateInsertValue(newSlice, newCap, 2, "")
 		return newSlice, nil
 	case "cap":
-		value := c.getValue(frame, args[0])
+		value := argValues[0]
 		var llvmCap llvm.Value
-		switch args[0].Type().(type) {
+		switch argTypes[0].(type) {
 		case *types.Chan:
 			// Channel. Buffered channels haven't been implemented yet so always
 			// return 0.
@@ -1128,12 +1152,12 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		}
 		return llvmCap, nil
 	case "close":
-		c.emitChanClose(frame, args[0])
+		c.emitChanClose(argValues[0])
 		return llvm.Value{}, nil
 	case "complex":
-		r := c.getValue(frame, args[0])
-		i := c.getValue(frame, args[1])
-		t := args[0].Type().Underlying().(*types.Basic)
+		r := argValues[0]
+		i := argValues[1]
+		t := argTypes[0].Underlying().(*types.Basic)
 		var cplx llvm.Value
 		switch t.Kind() {
 		case types.Float32:
@@ -1147,8 +1171,8 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		cplx = c.builder.CreateInsertValue(cplx, i, 1, "")
 		return cplx, nil
 	case "copy":
-		dst := c.getValue(frame, args[0])
-		src := c.getValue(frame, args[1])
+		dst := argValues[0]
+		src := argValues[1]
 		dstLen := c.builder.CreateExtractValue(dst, 1, "copy.dstLen")
 		srcLen := c.builder.CreateExtractValue(src, 1, "copy.srcLen")
 		dstBuf := c.builder.CreateExtractValue(dst, 0, "copy.dstArray")
@@ -1159,16 +1183,16 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		elemSize := llvm.ConstInt(c.uintptrType, c.targetData.TypeAllocSize(elemType), false)
 		return c.createRuntimeCall("sliceCopy", []llvm.Value{dstBuf, srcBuf, dstLen, srcLen, elemSize}, "copy.n"), nil
 	case "delete":
-		m := c.getValue(frame, args[0])
-		key := c.getValue(frame, args[1])
-		return llvm.Value{}, c.emitMapDelete(args[1].Type(), m, key, pos)
+		m := argValues[0]
+		key := argValues[1]
+		return llvm.Value{}, c.emitMapDelete(argTypes[1], m, key, pos)
 	case "imag":
-		cplx := c.getValue(frame, args[0])
+		cplx := argValues[0]
 		return c.builder.CreateExtractValue(cplx, 1, "imag"), nil
 	case "len":
-		value := c.getValue(frame, args[0])
+		value := argValues[0]
 		var llvmLen llvm.Value
-		switch args[0].Type().Underlying().(type) {
+		switch argTypes[0].Underlying().(type) {
 		case *types.Basic, *types.Slice:
 			// string or slice
 			llvmLen = c.builder.CreateExtractValue(value, 1, "len")
@@ -1186,12 +1210,11 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 		}
 		return llvmLen, nil
 	case "print", "println":
-		for i, arg := range args {
+		for i, value := range argValues {
 			if i >= 1 && callName == "println" {
 				c.createRuntimeCall("printspace", nil, "")
 			}
-			value := c.getValue(frame, arg)
-			typ := arg.Type().Underlying()
+			typ := argTypes[i].Underlying()
 			switch typ := typ.(type) {
 			case *types.Basic:
 				switch typ.Kind() {
@@ -1242,14 +1265,19 @@ func (c *Compiler) parseBuiltin(frame *Frame, args []ssa.Value, callName string,
 			c.createRuntimeCall("printnl", nil, "")
 		}
 		return llvm.Value{}, nil // print() or println() returns void
+	case "panic":
+		// Only used in deferred calls and goroutines: a regular panic is an
+		// *ssa.Panic instruction.
+		c.createRuntimeCall("_panic", []llvm.Value{argValues[0]}, "")
+		return llvm.Value{}, nil
 	case "real":
-		cplx := c.getValue(frame, args[0])
+		cplx := argValues[0]
 		return c.builder.CreateExtractValue(cplx, 0, "real"), nil
 	case "recover":
 		return c.createRuntimeCall("_recover", nil, ""), nil
 	case "ssa:wrapnilchk":
 		// TODO: do an actual nil check?
-		return c.getValue(frame, args[0]), nil
+		return argValues[0], nil
 	default:
 		return llvm.Value{}, c.makeError(pos, "todo: builtin: "+callName)
 	}
@@ -1273,6 +1301,31 @@ func (c *Compiler) parseFunctionCall(frame *Frame, args []ssa.Value, llvmFn, con
 	return c.createCall(llvmFn, params, "")
 }
 
+// parseLinknameCall is like parseFunctionCall, but for a function declared
+// without body. Such a function may be implemented in another package using
+// //go:linkname, like time.startTimer in the runtime, which can't refer to the
+// named pointer types of the declaration. Pointer parameters are therefore cast
+// to the types of the LLVM function.
+func (c *Compiler) parseLinknameCall(frame *Frame, args []ssa.Value, llvmFn, context llvm.Value, exported bool) llvm.Value {
+	var params []llvm.Value
+	for _, param := range args {
+		params = append(params, c.expandFormalParam(c.getValue(frame, param))...)
+	}
+	if !exported {
+		params = append(params, context, llvm.Undef(c.i8ptrType))
+	}
+	paramTypes := llvmFn.Type().ElementType().ParamTypes()
+	for i, param := range params {
+		if i >= len(paramTypes) {
+			break
+		}
+		if param.Type() != paramTypes[i] && param.Type().TypeKind() == llvm.PointerTypeKind && paramTypes[i].TypeKind() == llvm.PointerTypeKind {
+			params[i] = c.builder.CreateBitCast(param, paramTypes[i], "")
+		}
+	}
+	return c.builder.CreateCall(llvmFn, params, "")
+}
+
 func (c *Compiler) parseCall(frame *Frame, instr *ssa.CallCommon) (llvm.Value, error) {
 	if instr.IsInvoke() {
 		fnCast, args := c.getInvokeCall(frame, instr)
@@ -1291,12 +1344,14 @@ func (c *Compiler) parseCall(frame *Frame, instr *ssa.CallCommon) (llvm.Value, e
 			return c.emitAsmFull(frame, instr)
 		case strings.HasPrefix(name, "device/arm.SVCall"):
 			return c.emitSVCall(frame, instr.Args)
-		case strings.HasPrefix(name, "syscall.Syscall"):
+		case strings.HasPrefix(name, "syscall.Syscall") || strings.HasPrefix(name, "syscall.RawSyscall"):
 			return c.emitSyscall(frame, instr)
 		case strings.HasPrefix(name, "runtime/volatile.Load"):
 			return c.emitVolatileLoad(frame, instr)
 		case strings.HasPrefix(name, "runtime/volatile.Store"):
 			return c.emitVolatileStore(frame, instr)
+		case name == "runtime/interrupt.New":
+			return c.emitInterruptNew(frame, instr)
 		}
 
 		targetFunc := c.ir.GetFunction(fn)
@@ -1316,13 +1371,20 @@ func (c *Compiler) parseCall(frame *Frame, instr *ssa.CallCommon) (llvm.Value, e
 		default:
 			panic("StaticCallee returned an unexpected value")
 		}
+		if targetFunc.IsVariadic() {
+			return c.parseVariadicCall(frame, instr, targetFunc.LLVMFn)
+		}
+		if fn.Blocks == nil {
+			return c.parseLinknameCall(frame, instr.Args, targetFunc.LLVMFn, context, targetFunc.IsExported()), nil
+		}
 		return c.parseFunctionCall(frame, instr.Args, targetFunc.LLVMFn, context, targetFunc.IsExported()), nil
 	}
 
 	// Builtin or function pointer.
 	switch call := instr.Value.(type) {
 	case *ssa.Builtin:
-		return c.parseBuiltin(frame, instr.Args, call.Name(), instr.Pos())
+		argTypes, argValues := c.getBuiltinArgs(frame, instr.Args)
+		return c.emitBuiltin(argTypes, argValues, call.Name(), instr.Pos())
 	default: // function pointer
 		value := c.getValue(frame, instr.Value)
 		// This is a func value, which cannot be called directly. We have to
@@ -1333,6 +1395,18 @@ func (c *Compiler) parseCall(frame *Frame, instr *ssa.CallCommon) (llvm.Value, e
 	}
 }
 
+// getBuiltinArgs returns the types and LLVM values of the arguments to a
+// builtin function call, for use in emitBuiltin.
+func (c *Compiler) getBuiltinArgs(frame *Frame, args []ssa.Value) ([]types.Type, []llvm.Value) {
+	var argTypes []types.Type
+	var argValues []llvm.Value
+	for _, arg := range args {
+		argTypes = append(argTypes, arg.Type())
+		argValues = append(argValues, c.getValue(frame, arg))
+	}
+	return argTypes, argValues
+}
+
 // getValue returns the LLVM value of a constant, function value, global, or
 // already processed SSA expression.
 func (c *Compiler) getValue(frame *Frame, expr ssa.Value) llvm.Value {
@@ -2532,7 +2606,9 @@ func (c *Compiler) ApplyFunctionSections() {
 	// linker to remove dead code (-ffunction-sections).
 	llvmFn := c.mod.FirstFunction()
 	for !llvmFn.IsNil() {
-		if !llvmFn.IsDeclaration() {
+		if !llvmFn.IsDeclaration() && llvmFn.Section() == "" {
+			// Functions (from C files) may already have an explicit section,
+			// keep it in that case.
 			name := llvmFn.Name()
 			llvmFn.SetSection(".text." + name)
 		}
@@ -14,6 +14,8 @@ package compiler
 //     frames.
 
 import (
+	"go/types"
+
 	"github.com/tinygo-org/tinygo/ir"
 	"golang.org/x/tools/go/ssa"
 	"tinygo.org/x/go-llvm"
@@ -27,6 +29,7 @@ func (c *Compiler) deferInitFunc(frame *Frame) {
 	frame.deferFuncs = make(map[*ir.Function]int)
 	frame.deferInvokeFuncs = make(map[string]int)
 	frame.deferClosureFuncs = make(map[*ir.Function]int)
+	frame.deferExprFuncs = make(map[ssa.Value]int)
 
 	// Create defer list pointer.
 	deferType := llvm.PointerType(c.getLLVMRuntimeType("_defer"), 0)
@@ -69,6 +72,11 @@ func (c *Compiler) emitDefer(frame *Frame, instr *ssa.Defer) {
 	} else if callee, ok := instr.Call.Value.(*ssa.Function); ok {
 		// Regular function call.
 		fn := c.ir.GetFunction(callee)
+		if fn.IsVariadic() {
+			// The extra arguments can't be stored in the defer struct.
+			c.addError(instr.Pos(), "cannot defer variadic C function "+fn.CName())
+			return
+		}
 
 		if _, ok := frame.deferFuncs[fn]; !ok {
 			frame.deferFuncs[fn] = len(frame.allDeferFuncs)
@@ -115,9 +123,47 @@ func (c *Compiler) emitDefer(frame *Frame, instr *ssa.Defer) {
 		values = append(values, context)
 		valueTypes = append(valueTypes, context.Type())
 
+	} else if _, ok := instr.Call.Value.(*ssa.Builtin); ok {
+		// Call to a builtin function, like close or println.
+
+		// Get the callback number. Every deferred builtin call has its own
+		// callback, as the argument types may differ between calls.
+		if _, ok := frame.deferExprFuncs[instr.Call.Value]; !ok {
+			frame.deferExprFuncs[instr.Call.Value] = len(frame.allDeferFuncs)
+			frame.allDeferFuncs = append(frame.allDeferFuncs, &instr.Call)
+		}
+		callback := llvm.ConstInt(c.uintptrType, uint64(frame.deferExprFuncs[instr.Call.Value]), false)
+
+		// Collect all values to be put in the struct (starting with
+		// runtime._defer fields, followed by the call parameters).
+		values = []llvm.Value{callback, next}
+		for _, param := range instr.Call.Args {
+			llvmParam := c.getValue(frame, param)
+			values = append(values, llvmParam)
+			valueTypes = append(valueTypes, llvmParam.Type())
+		}
+
 	} else {
-		c.addError(instr.Pos(), "todo: defer on uncommon function call type")
-		return
+		// Call through a function pointer (func value).
+
+		// Get the callback number.
+		if _, ok := frame.deferExprFuncs[instr.Call.Value]; !ok {
+			frame.deferExprFuncs[instr.Call.Value] = len(frame.allDeferFuncs)
+			frame.allDeferFuncs = append(frame.allDeferFuncs, &instr.Call)
+		}
+		callback := llvm.ConstInt(c.uintptrType, uint64(frame.deferExprFuncs[instr.Call.Value]), false)
+
+		// Collect all values to be put in the struct (starting with
+		// runtime._defer fields, followed by the func value and the call
+		// parameters).
+		funcValue := c.getValue(frame, instr.Call.Value)
+		values = []llvm.Value{callback, next, funcValue}
+		valueTypes = append(valueTypes, funcValue.Type())
+		for _, param := range instr.Call.Args {
+			llvmParam := c.getValue(frame, param)
+			values = append(values, llvmParam)
+			valueTypes = append(valueTypes, llvmParam.Type())
+		}
 	}
 
 	// Make a struct out of the collected values to put in the defer frame.
@@ -197,11 +243,74 @@ func (c *Compiler) emitRunDefers(frame *Frame) {
 		c.builder.SetInsertPointAtEnd(block)
 		switch callback := callback.(type) {
 		case *ssa.CallCommon:
-			// Call on an interface value.
+			if builtin, ok := callback.Value.(*ssa.Builtin); ok {
+				// Call to a builtin function.
+
+				// Get the real defer struct type and cast to it.
+				valueTypes := []llvm.Type{c.uintptrType, llvm.PointerType(c.getLLVMRuntimeType("_defer"), 0)}
+				var argTypes []types.Type
+				for _, arg := range callback.Args {
+					argTypes = append(argTypes, arg.Type())
+					valueTypes = append(valueTypes, c.getLLVMType(arg.Type()))
+				}
+				deferFrameType := c.ctx.StructType(valueTypes, false)
+				deferFramePtr := c.builder.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
+
+				// Extract the params from the struct.
+				var argValues []llvm.Value
+				zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+				for i := 2; i < len(valueTypes); i++ {
+					gep := c.builder.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(c.ctx.Int32Type(), uint64(i), false)}, "gep")
+					argValues = append(argValues, c.builder.CreateLoad(gep, "param"))
+				}
+
+				// Call the builtin.
+				_, err := c.emitBuiltin(argTypes, argValues, builtin.Name(), callback.Pos())
+				if err != nil {
+					c.diagnostics = append(c.diagnostics, err)
+				}
+				break
+			}
+
 			if !callback.IsInvoke() {
-				panic("expected an invoke call, not a direct call")
+				// Call through a function pointer.
+
+				// Get the real defer struct type and cast to it.
+				sig := callback.Value.Type().Underlying().(*types.Signature)
+				valueTypes := []llvm.Type{c.uintptrType, llvm.PointerType(c.getLLVMRuntimeType("_defer"), 0), c.getLLVMType(callback.Value.Type())}
+				for _, arg := range callback.Args {
+					valueTypes = append(valueTypes, c.getLLVMType(arg.Type()))
+				}
+				deferFrameType := c.ctx.StructType(valueTypes, false)
+				deferFramePtr := c.builder.CreateBitCast(deferData, llvm.PointerType(deferFrameType, 0), "deferFrame")
+
+				// Extract the func value and params from the struct.
+				zero := llvm.ConstInt(c.ctx.Int32Type(), 0, false)
+				gep := c.builder.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(c.ctx.Int32Type(), 2, false)}, "gep")
+				funcValue := c.builder.CreateLoad(gep, "funcValue")
+				forwardParams := []llvm.Value{}
+				for i := 3; i < len(valueTypes); i++ {
+					gep := c.builder.CreateInBoundsGEP(deferFramePtr, []llvm.Value{zero, llvm.ConstInt(c.ctx.Int32Type(), uint64(i), false)}, "gep")
+					forwardParam := c.builder.CreateLoad(gep, "param")
+					forwardParams = append(forwardParams, forwardParam)
+				}
+
+				// Add the context parameter, which is stored in the func value.
+				funcPtr, context := c.decodeFuncValue(funcValue, sig)
+				forwardParams = append(forwardParams, context)
+
+				// Parent coroutine handle.
+				forwardParams = append(forwardParams, llvm.Undef(c.i8ptrType))
+
+				// Call the function. A nil func value only panics when it is
+				// called, not when the defer statement is executed.
+				c.emitNilCheck(frame, funcPtr, "fpcall")
+				c.createCall(funcPtr, forwardParams, "")
+				break
 			}
 
+			// Call on an interface value.
+
 			// Get the real defer struct type and cast to it.
 			valueTypes := []llvm.Type{c.uintptrType, llvm.PointerType(c.getLLVMRuntimeType("_defer"), 0), c.i8ptrType}
 			for _, arg := range callback.Args {
@@ -304,4 +413,5 @@ func (c *Compiler) emitRunDefers(frame *Frame) {
 
 	// End of loop.
 	c.builder.SetInsertPointAtEnd(end)
+	frame.blockExits[frame.currentBlock] = end // adjust outgoing block for phi nodes
 }
@@ -145,14 +145,23 @@ func (c *Compiler) lowerTasks() error {
 	}
 	mainCall := uses[0]
 
+	// Goroutines can call blocking functions through function pointers, as
+	// they have their own stack.
+	blocking, err := c.findAsyncFunctions(true)
+	if err != nil {
+		return err
+	}
+	c.recordBlockingFunctions(blocking)
+
 	realMain := c.mod.NamedFunction(c.ir.MainPkg().Pkg.Path() + ".main")
 	if len(getUses(c.mod.NamedFunction("runtime.startGoroutine"))) != 0 || len(getUses(c.mod.NamedFunction("runtime.yield"))) != 0 {
 		// Program needs a scheduler. Start main.main as a goroutine and start
 		// the scheduler.
-		realMainWrapper := c.createGoroutineStartWrapper(realMain)
+		realMainWrapper := c.createGoroutineStartWrapper(c.createMainWrapper(realMain))
 		c.builder.SetInsertPointBefore(mainCall)
 		zero := llvm.ConstInt(c.uintptrType, 0, false)
-		c.createRuntimeCall("startGoroutine", []llvm.Value{realMainWrapper, zero}, "")
+		stackSize := c.getGoroutineStackSize(realMainWrapper)
+		c.createRuntimeCall("startGoroutine", []llvm.Value{realMainWrapper, zero, stackSize}, "")
 		c.createRuntimeCall("scheduler", nil, "")
 	} else {
 		// Program doesn't need a scheduler. Call main.main directly.
@@ -177,6 +186,11 @@ func (c *Compiler) lowerTasks() error {
 // sure that the first coroutine is started and the coroutine scheduler will be
 // run.
 func (c *Compiler) lowerCoroutines() error {
+	// Create the wrapper before marking async functions, so that it is
+	// transformed into a coroutine when main.main is one.
+	realMain := c.mod.NamedFunction(c.ir.MainPkg().Pkg.Path() + ".main")
+	mainWrapper := c.createMainWrapper(realMain)
+
 	needsScheduler, err := c.markAsyncFunctions()
 	if err != nil {
 		return err
@@ -189,18 +203,16 @@ func (c *Compiler) lowerCoroutines() error {
 	mainCall := uses[0]
 
 	// Replace call of runtime.callMain() with a real call to main.main(),
-	// optionally followed by a call to runtime.scheduler().
+	// optionally followed by a call to runtime.scheduler(). When a scheduler
+	// is needed, main.main is called through its wrapper so that the
+	// scheduler knows when it returns.
 	c.builder.SetInsertPointBefore(mainCall)
-	realMain := c.mod.NamedFunction(c.ir.MainPkg().Pkg.Path() + ".main")
-	var ph llvm.Value
-	if needsScheduler {
-		ph = c.createRuntimeCall("getFakeCoroutine", []llvm.Value{}, "")
-	} else {
-		ph = llvm.Undef(c.i8ptrType)
-	}
-	c.builder.CreateCall(realMain, []llvm.Value{llvm.Undef(c.i8ptrType), ph}, "")
 	if needsScheduler {
+		ph := c.createRuntimeCall("getFakeCoroutine", []llvm.Value{}, "")
+		c.builder.CreateCall(mainWrapper, []llvm.Value{llvm.Undef(c.i8ptrType), ph}, "")
 		c.createRuntimeCall("scheduler", nil, "")
+	} else {
+		c.builder.CreateCall(realMain, []llvm.Value{llvm.Undef(c.i8ptrType), llvm.Undef(c.i8ptrType)}, "")
 	}
 	mainCall.EraseFromParentAsInstruction()
 
@@ -225,25 +237,51 @@ func (c *Compiler) lowerCoroutines() error {
 	return nil
 }
 
+// createMainWrapper creates a function that calls main.main and then notifies
+// the scheduler that it has returned, so that the scheduler stops waiting for
+// interrupts once there is nothing left to do. It looks like this:
+//
+//     func main$wrapper() {
+//         main.main()
+//         runtime.mainReturned()
+//     }
+//
+// Like regular Go functions, it has a context and a parent handle parameter so
+// that it can be turned into a coroutine.
+func (c *Compiler) createMainWrapper(realMain llvm.Value) llvm.Value {
+	// Save the current position in the IR builder.
+	currentBlock := c.builder.GetInsertBlock()
+	defer c.builder.SetInsertPointAtEnd(currentBlock)
+
+	wrapperType := llvm.FunctionType(c.ctx.VoidType(), []llvm.Type{c.i8ptrType, c.i8ptrType}, false)
+	wrapper := llvm.AddFunction(c.mod, realMain.Name()+"$wrapper", wrapperType)
+	wrapper.SetLinkage(llvm.InternalLinkage)
+	wrapper.SetUnnamedAddr(true)
+	wrapper.Param(0).SetName("context")
+	wrapper.Param(1).SetName("parentHandle")
+	entry := c.ctx.AddBasicBlock(wrapper, "entry")
+	c.builder.SetInsertPointAtEnd(entry)
+	c.builder.CreateCall(realMain, []llvm.Value{llvm.Undef(c.i8ptrType), llvm.Undef(c.i8ptrType)}, "")
+	c.createRuntimeCall("mainReturned", nil, "")
+	c.builder.CreateRetVoid()
+	return wrapper
+}
+
 func coroDebugPrintln(s ...interface{}) {
 	if coroDebug {
 		fmt.Println(s...)
 	}
 }
 
-// markAsyncFunctions does the bulk of the work of lowering goroutines. It
-// determines whether a scheduler is needed, and if it is, it transforms
-// blocking operations into goroutines and blocking calls into await calls.
+// findAsyncFunctions returns all functions that may block: runtime.yield and
+// all functions that call a blocking function. Starting a blocking function as
+// a goroutine is not a blocking operation.
 //
-// It does the following operations:
-//    * Find all blocking functions.
-//    * Determine whether a scheduler is necessary. If not, it skips the
-//      following operations.
-//    * Transform call instructions into await calls.
-//    * Transform return instructions into final suspends.
-//    * Set up the coroutine frames for async functions.
-//    * Transform blocking calls into their async equivalents.
-func (c *Compiler) markAsyncFunctions() (needsScheduler bool, err error) {
+// With the coroutine implementation, async functions cannot be called through
+// a function pointer, so using them in any other way than a call is an error.
+// When allowFuncPointers is set, such uses are ignored instead: functions that
+// call a blocking function through a function pointer are not found.
+func (c *Compiler) findAsyncFunctions(allowFuncPointers bool) ([]llvm.Value, error) {
 	var worklist []llvm.Value
 
 	yield := c.mod.NamedFunction("runtime.yield")
@@ -251,18 +289,12 @@ func (c *Compiler) markAsyncFunctions() (needsScheduler bool, err error) {
 		worklist = append(worklist, yield)
 	}
 
-	if len(worklist) == 0 {
-		// There are no blocking operations, so no need to transform anything.
-		return false, c.lowerMakeGoroutineCalls(false)
-	}
-
-	// Find all async functions.
 	// Keep reducing this worklist by marking a function as recursively async
 	// from the worklist and pushing all its parents that are non-async.
 	// This is somewhat similar to a worklist in a mark-sweep garbage collector:
 	// the work items are then grey objects.
-	asyncFuncs := make(map[llvm.Value]*asyncFunc)
-	asyncList := make([]llvm.Value, 0, 4)
+	asyncFuncs := make(map[llvm.Value]struct{})
+	var asyncList []llvm.Value
 	for len(worklist) != 0 {
 		// Pick the topmost.
 		f := worklist[len(worklist)-1]
@@ -274,15 +306,31 @@ func (c *Compiler) markAsyncFunctions() (needsScheduler bool, err error) {
 			continue
 		}
 		// Add to set of async functions.
-		asyncFuncs[f] = &asyncFunc{}
+		asyncFuncs[f] = struct{}{}
 		asyncList = append(asyncList, f)
 
 		// Add all callees to the worklist.
 		for _, use := range getUses(f) {
+			if allowFuncPointers {
+				// Only follow calls, possibly through a bitcast (for example
+				// because of a //go:linkname with a different signature).
+				calledValue := f
+				calls := []llvm.Value{use}
+				if use.IsConstant() && use.Opcode() == llvm.BitCast {
+					calledValue = use
+					calls = getUses(use)
+				}
+				for _, call := range calls {
+					if !call.IsACallInst().IsNil() && call.CalledValue() == calledValue {
+						worklist = append(worklist, call.InstructionParent().Parent())
+					}
+				}
+				continue
+			}
 			if use.IsConstant() && use.Opcode() == llvm.PtrToInt {
 				for _, call := range getUses(use) {
 					if call.IsACallInst().IsNil() || call.CalledValue().Name() != "runtime.makeGoroutine" {
-						return false, errorAt(call, "async function incorrectly used in ptrtoint, expected runtime.makeGoroutine")
+						return nil, errorAt(call, "async function incorrectly used in ptrtoint, expected runtime.makeGoroutine")
 					}
 				}
 				// This is a go statement. Do not mark the parent as async, as
@@ -309,17 +357,59 @@ func (c *Compiler) markAsyncFunctions() (needsScheduler bool, err error) {
 					// location of the function instead.
 					at = f
 				}
-				return false, errorAt(at, "async function "+f.Name()+" used as function pointer")
+				return nil, errorAt(at, "async function "+f.Name()+" used as function pointer")
 			}
 			parent := use.InstructionParent().Parent()
 			for i := 0; i < use.OperandsCount()-1; i++ {
 				if use.Operand(i) == f {
-					return false, errorAt(use, "async function "+f.Name()+" used as function pointer")
+					return nil, errorAt(use, "async function "+f.Name()+" used as function pointer")
 				}
 			}
 			worklist = append(worklist, parent)
 		}
 	}
+	return asyncList, nil
+}
+
+// recordBlockingFunctions remembers the functions that may block, as found by
+// findAsyncFunctions, for checkInterruptHandlers. Goroutine lowering may
+// remove the calls to runtime.yield, so they cannot be found afterwards.
+func (c *Compiler) recordBlockingFunctions(list []llvm.Value) {
+	c.blockingFuncs = make(map[llvm.Value]struct{}, len(list))
+	for _, f := range list {
+		c.blockingFuncs[f] = struct{}{}
+	}
+}
+
+// markAsyncFunctions does the bulk of the work of lowering goroutines. It
+// determines whether a scheduler is needed, and if it is, it transforms
+// blocking operations into goroutines and blocking calls into await calls.
+//
+// It does the following operations:
+//    * Find all blocking functions.
+//    * Determine whether a scheduler is necessary. If not, it skips the
+//      following operations.
+//    * Transform call instructions into await calls.
+//    * Transform return instructions into final suspends.
+//    * Set up the coroutine frames for async functions.
+//    * Transform blocking calls into their async equivalents.
+func (c *Compiler) markAsyncFunctions() (needsScheduler bool, err error) {
+	asyncList, err := c.findAsyncFunctions(false)
+	if err != nil {
+		return false, err
+	}
+	c.recordBlockingFunctions(asyncList)
+
+	if len(asyncList) == 0 {
+		// There are no blocking operations, so no need to transform anything.
+		return false, c.lowerMakeGoroutineCalls(false)
+	}
+
+	yield := c.mod.NamedFunction("runtime.yield")
+	asyncFuncs := make(map[llvm.Value]*asyncFunc, len(asyncList))
+	for _, f := range asyncList {
+		asyncFuncs[f] = &asyncFunc{}
+	}
 
 	// Check whether a scheduler is needed.
 	makeGoroutine := c.mod.NamedFunction("runtime.makeGoroutine")
@@ -3,7 +3,10 @@ package compiler
 // This file implements the 'go' keyword to start a new goroutine. See
 // goroutine-lowering.go for more details.
 
-import "tinygo.org/x/go-llvm"
+import (
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
 
 // emitStartGoroutine starts a new goroutine with the provided function pointer
 // and parameters.
@@ -19,7 +22,8 @@ func (c *Compiler) emitStartGoroutine(funcPtr llvm.Value, params []llvm.Value) l
 		paramBundle = c.builder.CreatePtrToInt(paramBundle, c.uintptrType, "")
 
 		calleeValue := c.createGoroutineStartWrapper(funcPtr)
-		c.createRuntimeCall("startGoroutine", []llvm.Value{calleeValue, paramBundle}, "")
+		stackSize := c.getGoroutineStackSize(calleeValue)
+		c.createRuntimeCall("startGoroutine", []llvm.Value{calleeValue, paramBundle, stackSize}, "")
 	case "coroutines":
 		// We roundtrip through runtime.makeGoroutine as a signal (to find these
 		// calls) and to break any optimizations LLVM will try to do: they are
@@ -34,6 +38,81 @@ func (c *Compiler) emitStartGoroutine(funcPtr llvm.Value, params []llvm.Value) l
 	return llvm.Undef(funcPtr.Type().ElementType().ReturnType())
 }
 
+// emitStartGoroutineCall starts a new goroutine for a go statement that cannot
+// be started directly with emitStartGoroutine: a call to a builtin or a method
+// call on an interface. A wrapper function with the regular calling convention
+// is created that performs the call, and a new goroutine is started with that
+// wrapper.
+//
+// For example, the following go statement inside main.foo:
+//
+//     go itf.Method(x)
+//
+// Is compiled to something like this:
+//
+//     func main.foo$gocall(itf interface{ Method(int) }, x int) {
+//         itf.Method(x)
+//     }
+//     go main.foo$gocall(itf, x)
+func (c *Compiler) emitStartGoroutineCall(frame *Frame, instr *ssa.CallCommon) {
+	// Collect all values needed for the call: the interface value (if any)
+	// followed by the arguments.
+	builtin, isBuiltin := instr.Value.(*ssa.Builtin)
+	var values []llvm.Value
+	if !isBuiltin {
+		values = append(values, c.getValue(frame, instr.Value))
+	}
+	argTypes, argValues := c.getBuiltinArgs(frame, instr.Args)
+	values = append(values, argValues...)
+
+	// Save the current position in the IR builder.
+	currentBlock := c.builder.GetInsertBlock()
+
+	// Create the wrapper, with the context and parent handle parameters at the
+	// end.
+	var paramTypes []llvm.Type
+	for _, value := range values {
+		paramTypes = append(paramTypes, value.Type())
+	}
+	paramTypes = append(paramTypes, c.i8ptrType, c.i8ptrType)
+	wrapperType := llvm.FunctionType(c.ctx.VoidType(), paramTypes, false)
+	wrapper := llvm.AddFunction(c.mod, frame.fn.LinkName()+"$gocall", wrapperType)
+	wrapper.SetLinkage(llvm.InternalLinkage)
+	wrapper.SetUnnamedAddr(true)
+	entry := c.ctx.AddBasicBlock(wrapper, "entry")
+	c.builder.SetInsertPointAtEnd(entry)
+
+	// Do the call inside the wrapper.
+	params := wrapper.Params()[:len(values)]
+	if isBuiltin {
+		_, err := c.emitBuiltin(argTypes, params, builtin.Name(), instr.Pos())
+		if err != nil {
+			c.diagnostics = append(c.diagnostics, err)
+		}
+	} else {
+		fnPtr, callParams := c.emitInvokeLookup(params[0], params[1:], instr)
+		c.createCall(fnPtr, callParams, "")
+	}
+	c.builder.CreateRetVoid()
+	c.builder.SetInsertPointAtEnd(currentBlock)
+
+	// Start the wrapper as a new goroutine. The wrapper doesn't need a
+	// context.
+	c.emitStartGoroutine(wrapper, append(values, llvm.Undef(c.i8ptrType)))
+}
+
+// getGoroutineStackSize returns the stack size for a new goroutine started
+// with the given goroutine start wrapper. When the stack size is determined
+// automatically, this is a call to runtime.getGoroutineStackSize that will be
+// replaced with a value computed from the call graph after linking. Otherwise,
+// it is the default stack size of the target.
+func (c *Compiler) getGoroutineStackSize(wrapper llvm.Value) llvm.Value {
+	if c.AutomaticStackSize() {
+		return c.createRuntimeCall("getGoroutineStackSize", []llvm.Value{wrapper}, "stacksize")
+	}
+	return llvm.ConstInt(c.uintptrType, c.DefaultStackSize(), false)
+}
+
 // createGoroutineStartWrapper creates a wrapper for the task-based
 // implementation of goroutines. For example, to call a function like this:
 //
@@ -70,7 +149,10 @@ func (c *Compiler) createGoroutineStartWrapper(fn llvm.Value) llvm.Value {
 		// Create the wrapper.
 		wrapperType := llvm.FunctionType(c.ctx.VoidType(), []llvm.Type{c.i8ptrType}, false)
 		wrapper = llvm.AddFunction(c.mod, name+"$gowrapper", wrapperType)
-		wrapper.SetLinkage(llvm.PrivateLinkage)
+		// Use internal linkage instead of private linkage, so that the wrapper
+		// ends up in the symbol table where it can be found during stack size
+		// analysis.
+		wrapper.SetLinkage(llvm.InternalLinkage)
 		wrapper.SetUnnamedAddr(true)
 		entry := c.ctx.AddBasicBlock(wrapper, "entry")
 		c.builder.SetInsertPointAtEnd(entry)
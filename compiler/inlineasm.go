@@ -17,20 +17,36 @@ import (
 //
 //     func ReadRegister(name string) uintptr
 //
-// The register name must be a constant, for example "sp".
+// The register name must be a constant, for example "sp". Special registers
+// (like "primask" on ARM or "mstatus" on RISC-V) can be read as well. Because
+// they may be changed by other instructions, these reads are marked as having
+// side effects so that they are not reordered.
 func (c *Compiler) emitReadRegister(name string, args []ssa.Value) (llvm.Value, error) {
 	fnType := llvm.FunctionType(c.uintptrType, []llvm.Type{}, false)
 	regname := constant.StringVal(args[0].(*ssa.Const).Value)
 	var asm string
+	sideEffects := false
 	switch name {
 	case "device/arm.ReadRegister":
-		asm = "mov $0, " + regname
+		switch regname {
+		case "primask", "basepri", "faultmask", "control", "ipsr", "msp", "psp":
+			asm = "mrs $0, " + regname
+			sideEffects = true
+		default:
+			asm = "mov $0, " + regname
+		}
 	case "device/riscv.ReadRegister":
-		asm = "mv $0, " + regname
+		switch regname {
+		case "mstatus", "mie", "mip", "mcause", "mepc", "mtval":
+			asm = "csrr $0, " + regname
+			sideEffects = true
+		default:
+			asm = "mv $0, " + regname
+		}
 	default:
 		panic("unknown architecture")
 	}
-	target := llvm.InlineAsm(fnType, asm, "=r", false, false, 0)
+	target := llvm.InlineAsm(fnType, asm, "=r", sideEffects, false, 0)
 	return c.builder.CreateCall(target, nil, ""), nil
 }
 
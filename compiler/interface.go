@@ -394,9 +394,20 @@ func (c *Compiler) parseTypeAssert(frame *Frame, expr *ssa.TypeAssert) llvm.Valu
 // getInvokeCall creates and returns the function pointer and parameters of an
 // interface call. It can be used in a call or defer instruction.
 func (c *Compiler) getInvokeCall(frame *Frame, instr *ssa.CallCommon) (llvm.Value, []llvm.Value) {
-	// Call an interface method with dynamic dispatch.
 	itf := c.getValue(frame, instr.Value) // interface
+	var args []llvm.Value
+	for _, arg := range instr.Args {
+		args = append(args, c.getValue(frame, arg))
+	}
+	return c.emitInvokeLookup(itf, args, instr)
+}
 
+// emitInvokeLookup looks up the method to call on the given interface value,
+// and returns the function pointer and parameters (including receiver) to call
+// it with. The interface value and arguments have already been evaluated, so
+// this can also be used inside wrapper functions for goroutines.
+func (c *Compiler) emitInvokeLookup(itf llvm.Value, args []llvm.Value, instr *ssa.CallCommon) (llvm.Value, []llvm.Value) {
+	// Call an interface method with dynamic dispatch.
 	llvmFnType := c.getRawFuncType(instr.Method.Type().(*types.Signature))
 
 	typecode := c.builder.CreateExtractValue(itf, 0, "invoke.typecode")
@@ -409,17 +420,14 @@ func (c *Compiler) getInvokeCall(frame *Frame, instr *ssa.CallCommon) (llvm.Valu
 	fnCast := c.builder.CreateIntToPtr(fn, llvmFnType, "invoke.func.cast")
 	receiverValue := c.builder.CreateExtractValue(itf, 1, "invoke.func.receiver")
 
-	args := []llvm.Value{receiverValue}
-	for _, arg := range instr.Args {
-		args = append(args, c.getValue(frame, arg))
-	}
+	params := append([]llvm.Value{receiverValue}, args...)
 	// Add the context parameter. An interface call never takes a context but we
 	// have to supply the parameter anyway.
-	args = append(args, llvm.Undef(c.i8ptrType))
+	params = append(params, llvm.Undef(c.i8ptrType))
 	// Add the parent goroutine handle.
-	args = append(args, llvm.Undef(c.i8ptrType))
+	params = append(params, llvm.Undef(c.i8ptrType))
 
-	return fnCast, args
+	return fnCast, params
 }
 
 // interfaceInvokeWrapper keeps some state between getInterfaceInvokeWrapper and
@@ -0,0 +1,337 @@
+package compiler
+
+// This file implements runtime/interrupt.New, which registers an interrupt
+// handler at compile time, and checks that interrupt handlers do not block or
+// allocate heap memory.
+
+import (
+	"go/constant"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+	"tinygo.org/x/go-llvm"
+)
+
+// emitInterruptNew implements runtime/interrupt.New. It creates the interrupt
+// handler that is referenced from the interrupt vector: a function named after
+// the interrupt (for example, SERCOM1_IRQHandler on Cortex-M or
+// __vector_USART_RX on AVR) that calls the registered Go function. Because the
+// interrupt vector refers to the handlers using weak symbols, this overrides
+// the default handler at link time.
+//
+// Both parameters must be known at compile time: the interrupt number must be a
+// constant and the handler must be a top-level function.
+func (c *Compiler) emitInterruptNew(frame *Frame, instr *ssa.CallCommon) (llvm.Value, error) {
+	id, ok := instr.Args[0].(*ssa.Const)
+	if !ok {
+		return llvm.Value{}, c.makeError(instr.Pos(), "interrupt number passed to interrupt.New must be a constant")
+	}
+	num, _ := constant.Int64Val(id.Value)
+	handler, ok := instr.Args[1].(*ssa.Function)
+	if !ok {
+		return llvm.Value{}, c.makeError(instr.Pos(), "interrupt handler passed to interrupt.New must be a top-level function, not a closure or func value")
+	}
+	handlerFn := c.ir.GetFunction(handler)
+
+	// Determine the name of the interrupt handler as used in the interrupt
+	// vector.
+	irqName := c.getInterruptName(num)
+	if irqName == "" {
+		return llvm.Value{}, c.makeError(instr.Pos(), "unknown interrupt number "+strconv.FormatInt(num, 10)+" for this target")
+	}
+	var name string
+	if strings.HasPrefix(c.Triple(), "avr") {
+		name = "__vector_" + irqName
+	} else {
+		name = irqName + "_IRQHandler"
+	}
+
+	// There can only be one handler per interrupt: report a second call to
+	// interrupt.New or a conflicting //go:export or //go:interrupt function.
+	if otherPos, ok := c.interruptHandlers[name]; ok {
+		return llvm.Value{}, c.makeError(instr.Pos(), "interrupt "+irqName+" is already registered at "+c.ir.Program.Fset.Position(otherPos).String())
+	}
+	if !c.mod.NamedFunction(name).IsNil() {
+		return llvm.Value{}, c.makeError(instr.Pos(), "interrupt "+irqName+" is already handled by a function named "+name)
+	}
+	c.interruptHandlers[name] = instr.Pos()
+
+	// The Interrupt value that is passed to the handler and returned from
+	// interrupt.New.
+	interruptType := c.getLLVMType(instr.Signature().Results().At(0).Type())
+	interrupt := llvm.ConstInsertValue(llvm.ConstNull(interruptType), llvm.ConstInt(c.intType, uint64(num), true), []uint32{0})
+
+	// Create the interrupt handler itself, which simply calls the Go function.
+	currentBlock := c.builder.GetInsertBlock()
+	fn := llvm.AddFunction(c.mod, name, llvm.FunctionType(c.ctx.VoidType(), nil, false))
+	if strings.HasPrefix(c.Triple(), "avr") {
+		fn.SetFunctionCallConv(85) // CallingConv::AVR_SIGNAL
+	}
+	if c.Debug() {
+		pos := c.ir.Program.Fset.Position(instr.Pos())
+		difunc := c.attachDebugInfoRaw(handlerFn, fn, "$interrupt", pos.Filename, pos.Line)
+		c.builder.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), difunc, llvm.Metadata{})
+	}
+	entry := c.ctx.AddBasicBlock(fn, "entry")
+	c.builder.SetInsertPointAtEnd(entry)
+	params := c.expandFormalParam(interrupt)
+	if !handlerFn.IsExported() {
+		params = append(params, llvm.Undef(c.i8ptrType), llvm.Undef(c.i8ptrType))
+	}
+	c.createCall(handlerFn.LLVMFn, params, "")
+	c.builder.CreateRetVoid()
+
+	// Continue with the function that called interrupt.New.
+	c.builder.SetInsertPointAtEnd(currentBlock)
+	if c.Debug() {
+		pos := c.ir.Program.Fset.Position(instr.Pos())
+		c.builder.SetCurrentDebugLocation(uint(pos.Line), uint(pos.Column), frame.difunc, llvm.Metadata{})
+	}
+	return interrupt, nil
+}
+
+// getInterruptName returns the name of the given interrupt number as defined
+// in the device package (for example, SERCOM1 for sam.IRQ_SERCOM1), or the
+// empty string if there is no such interrupt. When multiple interrupts share a
+// number, the first one is used, like in the generated interrupt vector.
+func (c *Compiler) getInterruptName(num int64) string {
+	name := ""
+	var namePos token.Pos
+	for _, pkg := range c.ir.Program.AllPackages() {
+		if !strings.HasPrefix(pkg.Pkg.Path(), "device/") {
+			continue
+		}
+		for memberName, member := range pkg.Members {
+			if !strings.HasPrefix(memberName, "IRQ_") || memberName == "IRQ_max" {
+				continue
+			}
+			irq, ok := member.(*ssa.NamedConst)
+			if !ok {
+				continue
+			}
+			value, ok := constant.Int64Val(irq.Value.Value)
+			if !ok || value != num {
+				continue
+			}
+			if name == "" || irq.Pos() < namePos {
+				name = memberName[len("IRQ_"):]
+				namePos = irq.Pos()
+			}
+		}
+	}
+	return name
+}
+
+// allocatingFuncs are the functions that allocate heap memory: the Go heap
+// allocator, and the C allocator functions that may be linked into the program
+// (for example through C.malloc or C code in a package).
+var allocatingFuncs = []string{"runtime.alloc", "malloc", "calloc", "realloc"}
+
+// checkInterruptHandlers reports an error for every interrupt handler that may
+// block (by calling a function that may call runtime.yield, for example through
+// a channel operation or time.Sleep) or allocate heap memory (by calling one of
+// the allocatingFuncs). Neither is allowed in an interrupt: the scheduler and
+// the heap may be in an inconsistent state when the interrupt happens.
+//
+// Interrupt handlers are the functions created by interrupt.New and functions
+// marked //go:interrupt. This check must run after heap allocations have been
+// moved to the stack where possible and after goroutine lowering, which finds
+// the functions that may block.
+func (c *Compiler) checkInterruptHandlers() []error {
+	// Collect all interrupt handlers in a stable order.
+	var names []string
+	for name := range c.interruptHandlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, f := range c.ir.Functions {
+		if f.IsInterrupt() {
+			names = append(names, f.LinkName())
+		}
+	}
+
+	allocs := map[llvm.Value]struct{}{}
+	for _, name := range allocatingFuncs {
+		if fn := c.mod.NamedFunction(name); !fn.IsNil() {
+			allocs[fn] = struct{}{}
+		}
+	}
+	searches := []*callChainSearch{
+		newCallChainSearch(c.mod, c.blockingFuncs, "block"),
+		newCallChainSearch(c.mod, allocs, "allocate heap memory"),
+	}
+
+	var errs []error
+	for _, name := range names {
+		handler := c.mod.NamedFunction(name)
+		if handler.IsNil() || handler.IsDeclaration() {
+			continue
+		}
+		// Only report the first problem of each handler: blocking functions
+		// allocate their coroutine frame on the heap, for example.
+		for _, search := range searches {
+			if call, chain := search.find(handler); chain != nil {
+				errs = append(errs, errorAt(call, "interrupt handler "+name+" may "+search.what+": "+strings.Join(chain, " -> ")))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// callChainSearch searches for chains of calls from an interrupt handler to
+// one of the given target functions.
+//
+// Calls through func values are followed as well, but the functions they may
+// call are only known by their signature: these are all functions with the
+// same signature that are used as a func value anywhere in the program (this
+// is also how func values are lowered to a switch on some targets). A call
+// through a func value is reported when any of these functions leads to a
+// target, as it can't be known which one is called.
+type callChainSearch struct {
+	targets map[llvm.Value]struct{}
+	what    string
+	mod     llvm.Module
+
+	// Chains from a function to a target, or nil if there is none. Functions
+	// that are being searched are included (with no chain) to break cycles.
+	chains map[llvm.Value][]string
+
+	// Functions used as func values (or otherwise used in a way other than a
+	// call), by type. It is computed on first use.
+	funcValues map[llvm.Type][]llvm.Value
+}
+
+func newCallChainSearch(mod llvm.Module, targets map[llvm.Value]struct{}, what string) *callChainSearch {
+	return &callChainSearch{
+		targets: targets,
+		what:    what,
+		mod:     mod,
+		chains:  make(map[llvm.Value][]string),
+	}
+}
+
+// find searches for a chain of calls from fn to one of the targets. If there is
+// one, it returns the instruction in fn that starts the chain and the names of
+// the called functions, ending with the target.
+func (s *callChainSearch) find(fn llvm.Value) (llvm.Value, []string) {
+	s.chains[fn] = nil
+	for bb := fn.EntryBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+		if strings.HasPrefix(bb.AsValue().Name(), "func.call") {
+			// A switch case of a lowered func value call, which is handled
+			// at the switch.
+			continue
+		}
+		for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+			if !inst.IsASwitchInst().IsNil() {
+				if chain := s.findSwitch(inst); chain != nil {
+					s.chains[fn] = chain
+					return inst, chain
+				}
+				continue
+			}
+			if chain := s.callChain(inst); chain != nil {
+				s.chains[fn] = chain
+				return inst, chain
+			}
+		}
+	}
+	return llvm.Value{}, nil
+}
+
+// callChain returns the chain of calls starting with the given instruction, or
+// nil if it is not a call or doesn't lead to a target.
+func (s *callChainSearch) callChain(inst llvm.Value) []string {
+	if inst.IsACallInst().IsNil() {
+		return nil
+	}
+	callee := inst.CalledValue()
+	if !callee.IsAConstantExpr().IsNil() && callee.Opcode() == llvm.BitCast {
+		// Call through a bitcast, for example because of a //go:linkname
+		// with a different signature.
+		callee = callee.Operand(0)
+	}
+	if !callee.IsAFunction().IsNil() {
+		return s.chainFrom(callee)
+	}
+	if !callee.IsAInlineAsm().IsNil() {
+		return nil
+	}
+	return s.findFuncValue(s.funcValuesOfType(callee.Type()))
+}
+
+// chainFrom returns the chain of calls starting with a call to fn, or nil if
+// fn doesn't lead to a target.
+func (s *callChainSearch) chainFrom(fn llvm.Value) []string {
+	if _, ok := s.targets[fn]; ok {
+		return []string{fn.Name()}
+	}
+	if fn.IsDeclaration() {
+		return nil
+	}
+	chain, ok := s.chains[fn]
+	if !ok {
+		_, chain = s.find(fn)
+	}
+	if chain == nil {
+		return nil
+	}
+	return append([]string{fn.Name()}, chain...)
+}
+
+// findSwitch returns the chain of calls for a func value call that was lowered
+// to a switch, with a case for every function that may be called. It returns
+// nil if it is not such a switch, or if none of the cases lead to a target.
+func (s *callChainSearch) findSwitch(sw llvm.Value) []string {
+	for i := 1; i < sw.OperandsCount(); i++ {
+		if !sw.Operand(i).IsBasicBlock() {
+			continue
+		}
+		bb := sw.Operand(i).AsBasicBlock()
+		if !strings.HasPrefix(bb.AsValue().Name(), "func.call") {
+			continue
+		}
+		// The case may contain other calls than the call of the function
+		// itself after goroutine lowering, so look at all of them.
+		var caseChain []string
+		for inst := bb.FirstInstruction(); !inst.IsNil() && caseChain == nil; inst = llvm.NextInstruction(inst) {
+			caseChain = s.callChain(inst)
+		}
+		if caseChain != nil {
+			return append([]string{"(func value)"}, caseChain...)
+		}
+	}
+	return nil
+}
+
+// findFuncValue returns the chain of calls for a call through a func value
+// that may call any of the given functions, if one of them leads to a target.
+func (s *callChainSearch) findFuncValue(callees []llvm.Value) []string {
+	for _, callee := range callees {
+		if chain := s.chainFrom(callee); chain != nil {
+			return append([]string{"(func value)"}, chain...)
+		}
+	}
+	return nil
+}
+
+// funcValuesOfType returns the functions of the given pointer type that are
+// used in another way than a direct call, and thus may be called through a
+// func value.
+func (s *callChainSearch) funcValuesOfType(t llvm.Type) []llvm.Value {
+	if s.funcValues == nil {
+		s.funcValues = make(map[llvm.Type][]llvm.Value)
+		for fn := s.mod.FirstFunction(); !fn.IsNil(); fn = llvm.NextFunction(fn) {
+			for _, use := range getUses(fn) {
+				if use.IsACallInst().IsNil() || use.CalledValue() != fn {
+					s.funcValues[fn.Type()] = append(s.funcValues[fn.Type()], fn)
+					break
+				}
+			}
+		}
+	}
+	return s.funcValues[t]
+}
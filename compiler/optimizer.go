@@ -54,7 +54,7 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 		// Run Go-specific optimization passes.
 		transform.OptimizeMaps(c.mod)
 		transform.OptimizeStringToBytes(c.mod)
-		transform.OptimizeAllocs(c.mod)
+		transform.OptimizeAllocs(c.mod, c.MaxStackAlloc())
 		transform.LowerInterfaces(c.mod)
 		if c.funcImplementation() == funcValueSwitch {
 			transform.LowerFuncValues(c.mod)
@@ -66,7 +66,7 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 		goPasses.Run(c.mod)
 
 		// Run TinyGo-specific interprocedural optimizations.
-		transform.OptimizeAllocs(c.mod)
+		transform.OptimizeAllocs(c.mod, c.MaxStackAlloc())
 		transform.OptimizeStringToBytes(c.mod)
 
 		// Lower runtime.isnil calls to regular nil comparisons.
@@ -89,6 +89,12 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 		if err != nil {
 			return []error{err}
 		}
+
+		// Check interrupt handlers now that heap allocations have been moved
+		// to the stack where possible and blocking functions are known.
+		if errs := c.checkInterruptHandlers(); len(errs) != 0 {
+			return errs
+		}
 	} else {
 		// Must be run at any optimization level.
 		transform.LowerInterfaces(c.mod)
@@ -99,6 +105,9 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 		if err != nil {
 			return []error{err}
 		}
+		if errs := c.checkInterruptHandlers(); len(errs) != 0 {
+			return errs
+		}
 	}
 	if c.VerifyIR() {
 		if errs := c.checkModule(); errs != nil {
@@ -141,6 +150,19 @@ func (c *Compiler) Optimize(optLevel, sizeLevel int, inlinerThreshold uint) []er
 	builder.Populate(modPasses)
 	modPasses.Run(c.mod)
 
+	if optLevel > 0 {
+		// Functions returning a new object may have been inlined into their
+		// callers (OptimizeAllocs marks such calls alwaysinline if useful), so try
+		// again to move heap allocations to the stack. Run SROA afterwards to
+		// split these new stack objects into scalar values where possible.
+		transform.OptimizeAllocs(c.mod, c.MaxStackAlloc())
+		sroaPasses := llvm.NewPassManager()
+		defer sroaPasses.Dispose()
+		sroaPasses.AddScalarReplAggregatesPass()
+		sroaPasses.AddInstructionCombiningPass()
+		sroaPasses.Run(c.mod)
+	}
+
 	hasGCPass := transform.AddGlobalsBitmap(c.mod)
 	hasGCPass = transform.MakeGCStackSlots(c.mod) || hasGCPass
 	if hasGCPass {
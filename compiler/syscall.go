@@ -1,7 +1,9 @@
 package compiler
 
 // This file implements the syscall.Syscall and syscall.Syscall6 instructions as
-// compiler builtins.
+// compiler builtins. The same goes for syscall.RawSyscall and
+// syscall.RawSyscall6, which are identical without a scheduler that needs to be
+// notified of blocking system calls.
 
 import (
 	"strconv"
@@ -179,24 +179,101 @@ type MapValue struct {
 	ValueType  llvm.Type
 }
 
-func (v *MapValue) newBucket() llvm.Value {
+// mapEntry is a single key/value pair in a MapValue, with the hash of the key.
+type mapEntry struct {
+	key   llvm.Value
+	value llvm.Value
+	hash  uint32
+}
+
+// bucketType returns the LLVM type of a single bucket in this map.
+func (v *MapValue) bucketType() llvm.Type {
 	ctx := v.Eval.Mod.Context()
 	i8ptrType := llvm.PointerType(ctx.Int8Type(), 0)
-	bucketType := ctx.StructType([]llvm.Type{
+	return ctx.StructType([]llvm.Type{
 		llvm.ArrayType(ctx.Int8Type(), 8), // tophash
 		i8ptrType,                         // next bucket
 		llvm.ArrayType(v.KeyType, 8),      // key type
 		llvm.ArrayType(v.ValueType, 8),    // value type
 	}, false)
-	bucketValue := llvm.ConstNull(bucketType)
-	bucket := llvm.AddGlobal(v.Eval.Mod, bucketType, v.PkgName+"$mapbucket")
-	bucket.SetInitializer(bucketValue)
-	bucket.SetLinkage(llvm.InternalLinkage)
-	bucket.SetUnnamedAddr(true)
+}
+
+// bucketValue returns a constant bucket with the given (at most 8) entries and
+// pointer to the next bucket in the chain.
+func (v *MapValue) bucketValue(entries []mapEntry, next llvm.Value) llvm.Value {
+	ctx := v.Eval.Mod.Context()
+	bucket := llvm.ConstNull(v.bucketType())
+	bucket = llvm.ConstInsertValue(bucket, next, []uint32{1})
+	for i, entry := range entries {
+		tophashValue := llvm.ConstInt(ctx.Int8Type(), uint64(v.topHash(entry.hash)), false)
+		bucket = llvm.ConstInsertValue(bucket, tophashValue, []uint32{0, uint32(i)})
+		bucket = llvm.ConstInsertValue(bucket, entry.key, []uint32{2, uint32(i)})
+		bucket = llvm.ConstInsertValue(bucket, entry.value, []uint32{3, uint32(i)})
+	}
 	return bucket
 }
 
+// newGlobal creates a new internal global for this map with the given
+// initializer.
+func (v *MapValue) newGlobal(initializer llvm.Value, name string) llvm.Value {
+	global := llvm.AddGlobal(v.Eval.Mod, initializer.Type(), v.PkgName+name)
+	global.SetInitializer(initializer)
+	global.SetLinkage(llvm.InternalLinkage)
+	global.SetUnnamedAddr(true)
+	return global
+}
+
+// keyBytes returns the bytes of the given key, as they are hashed by the
+// runtime.
+func (v *MapValue) keyBytes(key Value) []byte {
+	var keyBuf []byte
+	llvmKey := key.Value()
+	if key.Type().TypeKind() == llvm.StructTypeKind && key.Type().StructName() == "runtime._string" {
+		keyPtr := llvm.ConstExtractValue(llvmKey, []uint32{0})
+		keyLen := llvm.ConstExtractValue(llvmKey, []uint32{1})
+		keyPtrVal := v.Eval.getValue(keyPtr)
+		keyBuf = getStringBytes(keyPtrVal, keyLen)
+	} else if key.Type().TypeKind() == llvm.IntegerTypeKind {
+		keyBuf = make([]byte, v.Eval.TargetData.TypeAllocSize(key.Type()))
+		n := llvmKey.ZExtValue()
+		for i := range keyBuf {
+			keyBuf[i] = byte(n)
+			n >>= 8
+		}
+	} else if key.Type().TypeKind() == llvm.ArrayTypeKind &&
+		key.Type().ElementType().TypeKind() == llvm.IntegerTypeKind &&
+		key.Type().ElementType().IntTypeWidth() == 8 {
+		keyBuf = make([]byte, v.Eval.TargetData.TypeAllocSize(key.Type()))
+		for i := range keyBuf {
+			keyBuf[i] = byte(llvm.ConstExtractValue(llvmKey, []uint32{uint32(i)}).ZExtValue())
+		}
+	} else {
+		panic("interp: map key type not implemented: " + key.Type().String())
+	}
+	return keyBuf
+}
+
+// hasRuntimeBucketLayout returns whether the LLVM bucket type has exactly the
+// same layout as the buckets the runtime expects, including the size. This is
+// needed to put buckets in an array: the runtime calculates the address of a
+// bucket in the array itself.
+func (v *MapValue) hasRuntimeBucketLayout() bool {
+	td := v.Eval.TargetData
+	bucketType := v.bucketType()
+	headerSize := uint64(8 + td.PointerSize()) // tophash and next pointer
+	keysSize := uint64(v.KeySize) * 8
+	valuesSize := uint64(v.ValueSize) * 8
+	return td.ElementOffset(bucketType, 2) == headerSize &&
+		td.ElementOffset(bucketType, 3) == headerSize+keysSize &&
+		td.TypeAllocSize(bucketType) == headerSize+keysSize+valuesSize
+}
+
 // Value returns a global variable which is a pointer to the actual hashmap.
+//
+// The hashmap is laid out exactly like the runtime would do it, with keys
+// spread over 1<<bucketBits buckets (plus overflow buckets where needed), so
+// that lookups are fast. The transform package may later mark the hashmap and
+// its buckets constant if the map is never modified.
 func (v *MapValue) Value() llvm.Value {
 	if !v.Underlying.IsNil() {
 		return v.Underlying
@@ -204,86 +281,74 @@ func (v *MapValue) Value() llvm.Value {
 
 	ctx := v.Eval.Mod.Context()
 	i8ptrType := llvm.PointerType(ctx.Int8Type(), 0)
+	zero := llvm.ConstInt(ctx.Int32Type(), 0, false)
 
-	var firstBucketGlobal llvm.Value
-	if len(v.Keys) == 0 {
-		// there are no buckets
-		firstBucketGlobal = llvm.ConstPointerNull(i8ptrType)
-	} else {
-		// create initial bucket
-		firstBucketGlobal = v.newBucket()
+	// Collect all key/value pairs. Storing the same key twice overwrites the
+	// previous value, like in the runtime.
+	var entries []mapEntry
+	entryIndices := map[string]int{}
+	for i, key := range v.Keys {
+		keyBuf := v.keyBytes(key)
+		value := v.Values[i].Value()
+		if index, ok := entryIndices[string(keyBuf)]; ok {
+			entries[index].value = value
+			continue
+		}
+		entryIndices[string(keyBuf)] = len(entries)
+		entries = append(entries, mapEntry{key.Value(), value, v.hash(keyBuf)})
 	}
 
-	// Insert each key/value pair in the hashmap.
-	bucketGlobal := firstBucketGlobal
-	for i, key := range v.Keys {
-		var keyBuf []byte
-		llvmKey := key.Value()
-		llvmValue := v.Values[i].Value()
-		if key.Type().TypeKind() == llvm.StructTypeKind && key.Type().StructName() == "runtime._string" {
-			keyPtr := llvm.ConstExtractValue(llvmKey, []uint32{0})
-			keyLen := llvm.ConstExtractValue(llvmKey, []uint32{1})
-			keyPtrVal := v.Eval.getValue(keyPtr)
-			keyBuf = getStringBytes(keyPtrVal, keyLen)
-		} else if key.Type().TypeKind() == llvm.IntegerTypeKind {
-			keyBuf = make([]byte, v.Eval.TargetData.TypeAllocSize(key.Type()))
-			n := key.Value().ZExtValue()
-			for i := range keyBuf {
-				keyBuf[i] = byte(n)
-				n >>= 8
-			}
-		} else if key.Type().TypeKind() == llvm.ArrayTypeKind &&
-			key.Type().ElementType().TypeKind() == llvm.IntegerTypeKind &&
-			key.Type().ElementType().IntTypeWidth() == 8 {
-			keyBuf = make([]byte, v.Eval.TargetData.TypeAllocSize(key.Type()))
-			for i := range keyBuf {
-				keyBuf[i] = byte(llvm.ConstExtractValue(llvmKey, []uint32{uint32(i)}).ZExtValue())
+	bucketBits := uint8(0)
+	bucketsPtr := llvm.ConstPointerNull(i8ptrType) // there are no buckets
+	if len(entries) != 0 {
+		// Determine the number of buckets in the same way as hashmapMake, if
+		// possible.
+		if v.hasRuntimeBucketLayout() {
+			for numBuckets := len(entries) / 8; numBuckets != 0; numBuckets /= 2 {
+				bucketBits++
 			}
-		} else {
-			panic("interp: map key type not implemented: " + key.Type().String())
 		}
-		hash := v.hash(keyBuf)
-
-		if i%8 == 0 && i != 0 {
-			// Bucket is full, create a new one.
-			newBucketGlobal := v.newBucket()
-			zero := llvm.ConstInt(ctx.Int32Type(), 0, false)
-			newBucketPtr := llvm.ConstInBoundsGEP(newBucketGlobal, []llvm.Value{zero})
-			newBucketPtrCast := llvm.ConstBitCast(newBucketPtr, i8ptrType)
-			// insert pointer into old bucket
-			bucket := bucketGlobal.Initializer()
-			bucket = llvm.ConstInsertValue(bucket, newBucketPtrCast, []uint32{1})
-			bucketGlobal.SetInitializer(bucket)
-			// switch to next bucket
-			bucketGlobal = newBucketGlobal
+
+		// Distribute the entries over the buckets.
+		chains := make([][]mapEntry, 1<<bucketBits)
+		for _, entry := range entries {
+			bucketNumber := entry.hash & (1<<bucketBits - 1)
+			chains[bucketNumber] = append(chains[bucketNumber], entry)
 		}
 
-		tophashValue := llvm.ConstInt(ctx.Int8Type(), uint64(v.topHash(hash)), false)
-		bucket := bucketGlobal.Initializer()
-		bucket = llvm.ConstInsertValue(bucket, tophashValue, []uint32{0, uint32(i % 8)})
-		bucket = llvm.ConstInsertValue(bucket, llvmKey, []uint32{2, uint32(i % 8)})
-		bucket = llvm.ConstInsertValue(bucket, llvmValue, []uint32{3, uint32(i % 8)})
-		bucketGlobal.SetInitializer(bucket)
+		// Create the buckets, with an overflow bucket for every 8 entries
+		// that don't fit in the first bucket of a chain.
+		bucketType := v.bucketType()
+		buckets := llvm.ConstNull(llvm.ArrayType(bucketType, len(chains)))
+		for i, chain := range chains {
+			next := llvm.ConstPointerNull(i8ptrType)
+			for len(chain) > 8 {
+				// Create the buckets at the end of the chain first, so that the
+				// next pointer is known.
+				last := (len(chain) - 1) / 8 * 8
+				overflowBucket := v.newGlobal(v.bucketValue(chain[last:], next), "$mapbucket")
+				next = llvm.ConstBitCast(overflowBucket, i8ptrType)
+				chain = chain[:last]
+			}
+			buckets = llvm.ConstInsertValue(buckets, v.bucketValue(chain, next), []uint32{uint32(i)})
+		}
+		bucketsGlobal := v.newGlobal(buckets, "$mapbucket")
+		bucketsPtr = llvm.ConstBitCast(bucketsGlobal, i8ptrType)
 	}
 
 	// Create the hashmap itself.
-	zero := llvm.ConstInt(ctx.Int32Type(), 0, false)
-	bucketPtr := llvm.ConstInBoundsGEP(firstBucketGlobal, []llvm.Value{zero})
 	hashmapType := v.Type()
 	hashmap := llvm.ConstNamedStruct(hashmapType, []llvm.Value{
-		llvm.ConstPointerNull(llvm.PointerType(hashmapType, 0)),                        // next
-		llvm.ConstBitCast(bucketPtr, i8ptrType),                                        // buckets
-		llvm.ConstInt(hashmapType.StructElementTypes()[2], uint64(len(v.Keys)), false), // count
-		llvm.ConstInt(ctx.Int8Type(), uint64(v.KeySize), false),                        // keySize
-		llvm.ConstInt(ctx.Int8Type(), uint64(v.ValueSize), false),                      // valueSize
-		llvm.ConstInt(ctx.Int8Type(), 0, false),                                        // bucketBits
+		llvm.ConstPointerNull(llvm.PointerType(hashmapType, 0)), // next
+		bucketsPtr, // buckets
+		llvm.ConstInt(hashmapType.StructElementTypes()[2], uint64(len(entries)), false), // count
+		llvm.ConstInt(ctx.Int8Type(), uint64(v.KeySize), false),                         // keySize
+		llvm.ConstInt(ctx.Int8Type(), uint64(v.ValueSize), false),                       // valueSize
+		llvm.ConstInt(ctx.Int8Type(), uint64(bucketBits), false),                        // bucketBits
 	})
 
 	// Create a pointer to this hashmap.
-	hashmapPtr := llvm.AddGlobal(v.Eval.Mod, hashmap.Type(), v.PkgName+"$map")
-	hashmapPtr.SetInitializer(hashmap)
-	hashmapPtr.SetLinkage(llvm.InternalLinkage)
-	hashmapPtr.SetUnnamedAddr(true)
+	hashmapPtr := v.newGlobal(hashmap, "$map")
 	v.Underlying = llvm.ConstInBoundsGEP(hashmapPtr, []llvm.Value{zero})
 	return v.Underlying
 }
@@ -341,7 +406,6 @@ func (v *MapValue) PutString(keyBuf, keyLen, valPtr *LocalValue) {
 	key = llvm.ConstInsertValue(key, keyBuf.Value(), []uint32{0})
 	key = llvm.ConstInsertValue(key, keyLen.Value(), []uint32{1})
 
-	// TODO: avoid duplicate keys
 	v.Keys = append(v.Keys, &LocalValue{v.Eval, key})
 	v.Values = append(v.Values, &LocalValue{v.Eval, value})
 }
@@ -386,7 +450,6 @@ func (v *MapValue) PutBinary(keyPtr, valPtr *LocalValue) {
 		}
 	}
 
-	// TODO: avoid duplicate keys
 	v.Keys = append(v.Keys, &LocalValue{v.Eval, key})
 	v.Values = append(v.Values, &LocalValue{v.Eval, value})
 }
@@ -34,6 +34,7 @@ type Function struct {
 	nobounds  bool       // go:nobounds
 	flag      bool       // used by dead code elimination
 	interrupt bool       // go:interrupt
+	variadic  bool       // go:variadic (CGo only)
 	inline    InlineType // go:inline
 }
 
@@ -266,6 +267,12 @@ func (f *Function) parsePragmas() {
 				if hasUnsafeImport(f.Pkg.Pkg) {
 					f.linkName = parts[2]
 				}
+			case "//go:variadic":
+				// Emitted by CGo for variadic C functions, like printf. It
+				// cannot be used in regular Go code.
+				if f.CName() != "" {
+					f.variadic = true
+				}
 			case "//go:nobounds":
 				// Skip bounds checking in this function. Useful for some
 				// runtime functions.
@@ -283,6 +290,13 @@ func (f *Function) IsNoBounds() bool {
 	return f.nobounds
 }
 
+// Return true for C functions that take a variable number of arguments. The
+// last (Go) parameter of these functions is a ...interface{} slice, which holds
+// the extra arguments to the C function.
+func (f *Function) IsVariadic() bool {
+	return f.variadic
+}
+
 // Return true iff this function is externally visible.
 func (f *Function) IsExported() bool {
 	return f.exported || f.CName() != ""
@@ -333,8 +347,10 @@ func (f *Function) CName() string {
 		// emitted by `go tool cgo`
 		return name[len("_Cfunc_"):]
 	}
-	if strings.HasPrefix(name, "C.") {
-		// created by ../loader/cgo.go
+	if strings.HasPrefix(name, "C.") && f.Blocks == nil {
+		// created by ../cgo/cgo.go
+		// Helper functions with a body, like C.CString, are regular Go
+		// functions.
 		return name[2:]
 	}
 	return ""
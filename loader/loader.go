@@ -42,6 +42,21 @@ type Package struct {
 	Files     []*ast.File
 	Pkg       *types.Package
 	types.Info
+
+	// CgoExportHeader is the contents of the _cgo_export.h header, with
+	// declarations for functions exported to C using //export. It is nil if
+	// the package doesn't export any functions to C.
+	CgoExportHeader []byte
+
+	// CgoStubs are generated C source files that must be compiled with the
+	// package. They contain wrappers for static C functions and function-like
+	// macros that are called from Go.
+	CgoStubs [][]byte
+
+	// CgoCFlags and CgoLDFlags are the flags set in #cgo lines (including
+	// flags from pkg-config) for the current target.
+	CgoCFlags  []string
+	CgoLDFlags []string
 }
 
 // Import loads the given package relative to srcDir (for the vendor directory).
@@ -421,11 +436,19 @@ func (p *Package) parseFiles(includeTests bool) ([]*ast.File, error) {
 		if p.ClangHeaders != "" {
 			cflags = append(cflags, "-I"+p.ClangHeaders)
 		}
-		generated, errs := cgo.Process(files, p.Program.Dir, p.fset, cflags)
+		tags := append([]string{p.Build.GOOS, p.Build.GOARCH}, p.Build.BuildTags...)
+		if p.Build.CgoEnabled {
+			tags = append(tags, "cgo")
+		}
+		generated, exportHeader, cgoStubs, cgoCFlags, cgoLDFlags, errs := cgo.Process(files, p.Program.Dir, p.fset, cflags, tags)
 		if errs != nil {
 			fileErrs = append(fileErrs, errs...)
 		}
 		files = append(files, generated)
+		p.CgoExportHeader = exportHeader
+		p.CgoStubs = cgoStubs
+		p.CgoCFlags = cgoCFlags
+		p.CgoLDFlags = cgoLDFlags
 	}
 	if len(fileErrs) != 0 {
 		return nil, Errors{p, fileErrs}
@@ -125,17 +125,25 @@ func Test(pkgName string, options *compileopts.Options) error {
 
 	options.TestConfig.CompileTestBinary = true
 	return builder.Build(pkgName, ".elf", config, func(tmppath string) error {
-		cmd := exec.Command(tmppath)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err := cmd.Run()
+		var err error
+		if len(config.Target.Emulator) == 0 {
+			cmd := exec.Command(tmppath)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			err = cmd.Run()
+		} else {
+			err = builder.RunEmulator(config.Target.Emulator, tmppath, os.Stdout, os.Stderr)
+		}
 		if err != nil {
 			// Propagate the exit code
-			if err, ok := err.(*exec.ExitError); ok {
+			switch err := err.(type) {
+			case *exec.ExitError:
 				if status, ok := err.Sys().(syscall.WaitStatus); ok {
 					os.Exit(status.ExitStatus())
 				}
 				os.Exit(1)
+			case *builder.ExitError:
+				os.Exit(err.Code)
 			}
 			return &commandError{"failed to run compiled binary", tmppath, err}
 		}
@@ -419,11 +427,7 @@ func Run(pkgName string, options *compileopts.Options) error {
 			return nil
 		} else {
 			// Run in an emulator.
-			args := append(config.Target.Emulator[1:], tmppath)
-			cmd := exec.Command(config.Target.Emulator[0], args...)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			err := cmd.Run()
+			err := builder.RunEmulator(config.Target.Emulator, tmppath, os.Stdout, os.Stderr)
 			if err != nil {
 				if err, ok := err.(*exec.ExitError); ok && err.Exited() {
 					// Workaround for QEMU which always exits with an error.
@@ -608,6 +612,7 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "  flash: compile and flash to the device")
 	fmt.Fprintln(os.Stderr, "  gdb:   run/flash and immediately enter GDB")
 	fmt.Fprintln(os.Stderr, "  env:   list environment variables used during build")
+	fmt.Fprintln(os.Stderr, "  symbolize: convert addresses in a panic backtrace to source locations")
 	fmt.Fprintln(os.Stderr, "  clean: empty cache directory ("+goenv.Get("GOCACHE")+")")
 	fmt.Fprintln(os.Stderr, "  help:  print this help text")
 	fmt.Fprintln(os.Stderr, "\nflags:")
@@ -662,13 +667,15 @@ func main() {
 	tags := flag.String("tags", "", "a space-separated list of extra build tags")
 	target := flag.String("target", "", "LLVM target | .json file with TargetSpec")
 	printSize := flag.String("size", "", "print sizes (none, short, full)")
+	printStacks := flag.Bool("print-stacks", false, "print stack sizes of goroutines")
 	nodebug := flag.Bool("no-debug", false, "disable DWARF debug symbol generation")
+	nolto := flag.Bool("no-lto", false, "compile C files separately instead of optimizing them together with Go code")
 	ocdOutput := flag.Bool("ocd-output", false, "print OCD daemon output during debug")
 	port := flag.String("port", "", "flash port")
 	programmer := flag.String("programmer", "", "which hardware programmer to use")
 	cFlags := flag.String("cflags", "", "additional cflags for compiler")
 	ldFlags := flag.String("ldflags", "", "additional ldflags for linker")
-	wasmAbi := flag.String("wasm-abi", "js", "WebAssembly ABI conventions: js (no i64 params) or generic")
+	wasmAbi := flag.String("wasm-abi", "", "WebAssembly ABI conventions: js (no i64 params) or generic")
 	heapSize := flag.String("heap-size", "1M", "default heap size in bytes (only supported by WebAssembly)")
 
 	if len(os.Args) < 2 {
@@ -689,7 +696,9 @@ func main() {
 		DumpSSA:       *dumpSSA,
 		VerifyIR:      *verifyIR,
 		Debug:         !*nodebug,
+		LTO:           !*nolto,
 		PrintSizes:    *printSize,
+		PrintStacks:   *printStacks,
 		Tags:          *tags,
 		WasmAbi:       *wasmAbi,
 		Programmer:    *programmer,
@@ -814,6 +823,19 @@ func main() {
 		fmt.Printf("build tags:        %s\n", strings.Join(config.BuildTags(), " "))
 		fmt.Printf("garbage collector: %s\n", config.GC())
 		fmt.Printf("scheduler:         %s\n", config.Scheduler())
+	case "symbolize":
+		// Annotate a backtrace (read from stdin) or a list of addresses with
+		// function names and line numbers from the given executable.
+		if flag.NArg() < 1 {
+			fmt.Fprintln(os.Stderr, "No executable specified.")
+			usage()
+			os.Exit(1)
+		}
+		err := Symbolize(flag.Arg(0), flag.Args()[1:], os.Stdin, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
 	case "clean":
 		// remove cache directory
 		err := os.RemoveAll(goenv.Get("GOCACHE"))
@@ -6,15 +6,19 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"debug/elf"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
 
+	"github.com/tinygo-org/tinygo/builder"
 	"github.com/tinygo-org/tinygo/compileopts"
 	"github.com/tinygo-org/tinygo/loader"
 )
@@ -64,6 +68,12 @@ func TestCompiler(t *testing.T) {
 		t.Run("WebAssembly", func(t *testing.T) {
 			runPlatTests("wasm", matches, t)
 		})
+		t.Run("WASI", func(t *testing.T) {
+			if _, err := exec.LookPath("wasmtime"); err != nil {
+				t.Skip("wasmtime not installed")
+			}
+			runPlatTests("wasi", matches, t)
+		})
 	}
 }
 
@@ -71,16 +81,43 @@ func runPlatTests(target string, matches []string, t *testing.T) {
 	t.Parallel()
 
 	for _, path := range matches {
+		if path == filepath.Join("testdata", "machinesim.go") && target != "" {
+			// The machine simulator is only available on the host.
+			continue
+		}
+		if path == filepath.Join("testdata", "syscalljs.go") && target != "wasm" {
+			// syscall/js is only available on the wasm target.
+			continue
+		}
 		switch {
-		case target == "wasm":
+		case target == "wasm" || target == "wasi":
 			// testdata/gc.go is known not to work on WebAssembly
 			if path == filepath.Join("testdata", "gc.go") {
 				continue
 			}
+			// there is no (complete) file system on WebAssembly
+			if path == filepath.Join("testdata", "filesystem.go") {
+				continue
+			}
+			// there is no network poller on WebAssembly
+			if path == filepath.Join("testdata", "net.go") {
+				continue
+			}
 		case target == "":
-			// run all tests on host
+			// the network poller is only implemented on Linux
+			if path == filepath.Join("testdata", "net.go") && runtime.GOOS != "linux" {
+				continue
+			}
 		case target == "cortex-m-qemu":
-			// all tests are supported
+			// the file system on the host is tested with semihosting in
+			// TestSemihosting
+			if path == filepath.Join("testdata", "filesystem.go") {
+				continue
+			}
+			// there is no network on microcontrollers
+			if path == filepath.Join("testdata", "net.go") {
+				continue
+			}
 		default:
 			// cross-compilation of cgo is not yet supported
 			if path == filepath.Join("testdata", "cgo")+string(filepath.Separator) {
@@ -91,7 +128,7 @@ func runPlatTests(target string, matches []string, t *testing.T) {
 		t.Run(filepath.Base(path), func(t *testing.T) {
 			t.Parallel()
 
-			runTest(path, target, t)
+			runTest(path, target, "", t)
 		})
 	}
 }
@@ -108,7 +145,258 @@ func runBuild(src, out string, opts *compileopts.Options) error {
 	return Build(src, out, opts)
 }
 
-func runTest(path, target string, t *testing.T) {
+// TestPreemption checks that goroutines that never block are preempted on
+// Cortex-M when preemption is enabled with the "preempt" build tag, and that a
+// goroutine with a higher priority preempts the running goroutine when it
+// becomes runnable.
+func TestPreemption(t *testing.T) {
+	if testing.Short() {
+		t.Skip("needs QEMU")
+	}
+	runTest(filepath.Join(TESTDATA, "preempt", "preempt.go"), "cortex-m-qemu", "preempt", t)
+}
+
+// TestPriority checks that goroutines run in order of priority on Cortex-M, and
+// that a goroutine holding a sync.Mutex inherits the priority of the goroutines
+// waiting for it.
+func TestPriority(t *testing.T) {
+	if testing.Short() {
+		t.Skip("needs QEMU")
+	}
+	runTest(filepath.Join(TESTDATA, "priority", "priority.go"), "cortex-m-qemu", "", t)
+}
+
+// TestSleep checks that sleeping works on RISC-V as well, where the processor
+// sleeps until the machine timer interrupt instead of using SysTick. The
+// Cortex-M version of this test runs as part of TestCompiler.
+func TestSleep(t *testing.T) {
+	if testing.Short() {
+		t.Skip("needs QEMU")
+	}
+	runTest(filepath.Join(TESTDATA, "sleep.go"), "hifive1-qemu", "", t)
+}
+
+// TestDebugCgo checks that a cgo package can be built with debug information in
+// both the Go and the C code. The C files are linked into the Go module with
+// LTO, which fails if the debug module flags of both modules don't match.
+func TestDebugCgo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("cgo is not tested on Windows")
+	}
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	config := &compileopts.Options{
+		Opt:      "z",
+		VerifyIR: true,
+		Debug:    true,
+		LTO:      true,
+		CFlags:   []string{"-g"},
+	}
+	err = runBuild("./"+filepath.Join(TESTDATA, "cgo")+"/", filepath.Join(tmpdir, "test"), config)
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+}
+
+// TestSemihosting checks that programs running in QEMU on Cortex-M can access
+// files on the host, read standard input, read their command line arguments
+// and return an exit code, all through semihosting.
+func TestSemihosting(t *testing.T) {
+	if testing.Short() {
+		t.Skip("needs QEMU")
+	}
+	path := filepath.Join(TESTDATA, "semihosting", "semihosting.go")
+	expected, err := ioutil.ReadFile(path[:len(path)-3] + ".txt")
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+	input := filepath.Join(tmpdir, "input.txt")
+	output := filepath.Join(tmpdir, "output.txt")
+	err = ioutil.WriteFile(input, []byte("hello world"), 0644)
+	if err != nil {
+		t.Fatal("could not write input file:", err)
+	}
+
+	config := &compileopts.Options{
+		Target:   "cortex-m-qemu",
+		Opt:      "z",
+		VerifyIR: true,
+		LTO:      true,
+	}
+	binary := filepath.Join(tmpdir, "test")
+	err = runBuild("./"+path, binary, config)
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+
+	// QEMU passes the kernel path followed by the -append option as the
+	// command line.
+	spec, err := compileopts.LoadTarget("cortex-m-qemu")
+	if err != nil {
+		t.Fatal("failed to load target spec:", err)
+	}
+	args := append(spec.Emulator[1:], binary, "-append", input+" "+output)
+	cmd := exec.Command(spec.Emulator[0], args...)
+	cmd.Stdin = bytes.NewBufferString("from stdin\n")
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	if err, ok := err.(*exec.ExitError); !ok || err.Sys().(syscall.WaitStatus).ExitStatus() != 3 {
+		t.Errorf("expected exit code 3, got: %v", err)
+	}
+
+	actual := bytes.Replace(stdout.Bytes(), []byte{'\r', '\n'}, []byte{'\n'}, -1)
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output did not match, got:\n%s", actual)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil || string(data) != "output" {
+		t.Errorf("output file: expected %q, got %q (error: %v)", "output", data, err)
+	}
+}
+
+// TestInterrupt checks that interrupt.New creates an interrupt handler with the
+// name used in the interrupt vector, and that it is called when the interrupt
+// happens.
+func TestInterrupt(t *testing.T) {
+	if testing.Short() {
+		t.Skip("needs QEMU")
+	}
+	path := filepath.Join(TESTDATA, "interrupt", "interrupt.go")
+	expected, err := ioutil.ReadFile(path[:len(path)-3] + ".txt")
+	if err != nil {
+		t.Fatal("could not read expected output file:", err)
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	config := &compileopts.Options{
+		Target:   "cortex-m-qemu",
+		Opt:      "z",
+		VerifyIR: true,
+		LTO:      true,
+	}
+	binary := filepath.Join(tmpdir, "test")
+	err = runBuild("./"+path, binary, config)
+	if err != nil {
+		t.Fatal("failed to build:", err)
+	}
+
+	// The handler overrides the weak default handler in the interrupt vector.
+	file, err := elf.Open(binary)
+	if err != nil {
+		t.Fatal("could not open binary:", err)
+	}
+	symbols, err := file.Symbols()
+	file.Close()
+	if err != nil {
+		t.Fatal("could not read symbols:", err)
+	}
+	found := false
+	for _, symbol := range symbols {
+		if symbol.Name == "UART1_IRQHandler" && elf.ST_TYPE(symbol.Info) == elf.STT_FUNC && elf.ST_BIND(symbol.Info) == elf.STB_GLOBAL {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("interrupt handler UART1_IRQHandler not found in binary")
+	}
+
+	spec, err := compileopts.LoadTarget("cortex-m-qemu")
+	if err != nil {
+		t.Fatal("failed to load target spec:", err)
+	}
+	stdout := &bytes.Buffer{}
+	err = builder.RunEmulator(spec.Emulator, binary, stdout, os.Stderr)
+	if _, ok := err.(*exec.ExitError); !ok && err != nil {
+		t.Fatal("failed to run:", err)
+	}
+	actual := bytes.Replace(stdout.Bytes(), []byte{'\r', '\n'}, []byte{'\n'}, -1)
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("output did not match, got:\n%s", actual)
+	}
+}
+
+// TestCompileErrors checks the errors reported by the compiler for the
+// programs in testdata/errors. Each program lists the errors it is expected to
+// produce in comments of the form "// ERROR: <message>", in order. Programs
+// without such comments must compile without errors.
+func TestCompileErrors(t *testing.T) {
+	matches, err := filepath.Glob(filepath.Join(TESTDATA, "errors", "*.go"))
+	if err != nil || len(matches) == 0 {
+		t.Fatal("could not read test files:", err)
+	}
+	for _, path := range matches {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			t.Parallel()
+			runCompileErrorTest(path, t)
+		})
+	}
+}
+
+func runCompileErrorTest(path string, t *testing.T) {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("could not read test file:", err)
+	}
+	var expected []string
+	for _, line := range strings.Split(string(source), "\n") {
+		if strings.HasPrefix(line, "// ERROR: ") {
+			expected = append(expected, strings.TrimSpace(line[len("// ERROR: "):]))
+		}
+	}
+
+	tmpdir, err := ioutil.TempDir("", "tinygo-test")
+	if err != nil {
+		t.Fatal("could not create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// The test programs use interrupts of the cortex-m-qemu target.
+	config := &compileopts.Options{
+		Target:   "cortex-m-qemu",
+		Opt:      "z",
+		VerifyIR: true,
+	}
+	err = runBuild("./"+path, filepath.Join(tmpdir, "test"), config)
+	var errs []error
+	switch err := err.(type) {
+	case nil:
+	case *builder.MultiError:
+		errs = err.Errs
+	case loader.Errors:
+		errs = err.Errs
+	default:
+		errs = []error{err}
+	}
+
+	if len(errs) != len(expected) {
+		t.Errorf("expected %d errors, got %d", len(expected), len(errs))
+	}
+	for i, err := range errs {
+		if i >= len(expected) || !strings.Contains(err.Error(), expected[i]) {
+			t.Error("unexpected error:", err)
+		}
+	}
+}
+
+func runTest(path, target, tags string, t *testing.T) {
 	// Get the expected output for this test.
 	txtpath := path[:len(path)-3] + ".txt"
 	if path[len(path)-1] == os.PathSeparator {
@@ -139,8 +427,9 @@ func runTest(path, target string, t *testing.T) {
 		DumpSSA:    false,
 		VerifyIR:   true,
 		Debug:      false,
+		LTO:        true,
 		PrintSizes: "",
-		WasmAbi:    "js",
+		Tags:       tags,
 	}
 	binary := filepath.Join(tmpdir, "test")
 	err = runBuild("./"+path, binary, config)
@@ -157,28 +446,23 @@ func runTest(path, target string, t *testing.T) {
 	}
 
 	// Run the test.
-	var cmd *exec.Cmd
+	stdout := &bytes.Buffer{}
 	if target == "" {
-		cmd = exec.Command(binary)
+		cmd := exec.Command(binary)
+		cmd.Stdout = stdout
+		err = cmd.Run()
 	} else {
-		spec, err := compileopts.LoadTarget(target)
-		if err != nil {
-			t.Fatal("failed to load target spec:", err)
+		spec, err2 := compileopts.LoadTarget(target)
+		if err2 != nil {
+			t.Fatal("failed to load target spec:", err2)
 		}
 		if len(spec.Emulator) == 0 {
 			t.Fatal("no emulator available for target:", target)
 		}
-		args := append(spec.Emulator[1:], binary)
-		cmd = exec.Command(spec.Emulator[0], args...)
-	}
-	stdout := &bytes.Buffer{}
-	cmd.Stdout = stdout
-	if target != "" {
-		cmd.Stderr = os.Stderr
-	}
-	err = cmd.Run()
-	if _, ok := err.(*exec.ExitError); ok && target != "" {
-		err = nil // workaround for QEMU
+		err = builder.RunEmulator(spec.Emulator, binary, stdout, os.Stderr)
+		if _, ok := err.(*exec.ExitError); ok {
+			err = nil // workaround for QEMU
+		}
 	}
 
 	// putchar() prints CRLF, convert it to LF.
@@ -53,7 +53,9 @@ func Asm(asm string)
 func AsmFull(asm string, regs map[string]interface{})
 
 // ReadRegister returns the contents of the specified register. The register
-// must be a processor register, reachable with the "mov" instruction.
+// must be a processor register, reachable with the "mov" instruction, or one of
+// the special registers primask, basepri, faultmask, control, ipsr, msp and
+// psp, which are read with the "mrs" instruction.
 func ReadRegister(name string) uintptr
 
 // Run the following system call (SVCall) with 0 arguments.
@@ -82,6 +84,34 @@ const (
 	SCB_AIRCR_VECTKEY_Pos     = 16
 	SCB_AIRCR_SYSRESETREQ_Pos = 2
 	SCB_AIRCR_SYSRESETREQ_Msk = 1 << SCB_AIRCR_SYSRESETREQ_Pos
+
+	// SCB.ICSR: Interrupt Control and State Register
+	SCB_ICSR_PENDSTCLR = 1 << 25 // clear the pending SysTick exception
+	SCB_ICSR_PENDSTSET = 1 << 26 // SysTick exception is pending (read) or make it pending (write)
+	SCB_ICSR_PENDSVSET = 1 << 28 // PendSV exception is pending (read) or make it pending (write)
+
+	// SCB.CPUID: the architecture field is 0xF for ARMv7-M and 0xC for ARMv6-M.
+	SCB_CPUID_ARCHITECTURE_Pos = 16
+	SCB_CPUID_ARCHITECTURE_Msk = 0xF << SCB_CPUID_ARCHITECTURE_Pos
+
+	// SCB.CFSR: Configurable Fault Status Register
+	SCB_CFSR_IACCVIOL    = 1 << 0  // MemManage: instruction access violation
+	SCB_CFSR_DACCVIOL    = 1 << 1  // MemManage: data access violation
+	SCB_CFSR_MMARVALID   = 1 << 7  // MMFAR holds a valid fault address
+	SCB_CFSR_IBUSERR     = 1 << 8  // BusFault: instruction bus error
+	SCB_CFSR_PRECISERR   = 1 << 9  // BusFault: precise data bus error
+	SCB_CFSR_IMPRECISERR = 1 << 10 // BusFault: imprecise data bus error
+	SCB_CFSR_BFARVALID   = 1 << 15 // BFAR holds a valid fault address
+	SCB_CFSR_UNDEFINSTR  = 1 << 16 // UsageFault: undefined instruction
+	SCB_CFSR_INVSTATE    = 1 << 17 // UsageFault: invalid state (e.g. ARM mode)
+	SCB_CFSR_INVPC       = 1 << 18 // UsageFault: invalid EXC_RETURN value
+	SCB_CFSR_NOCP        = 1 << 19 // UsageFault: no coprocessor
+	SCB_CFSR_UNALIGNED   = 1 << 24 // UsageFault: unaligned access
+	SCB_CFSR_DIVBYZERO   = 1 << 25 // UsageFault: divide by zero
+
+	// SCB.HFSR: HardFault Status Register
+	SCB_HFSR_VECTTBL = 1 << 1  // fault on vector table read
+	SCB_HFSR_FORCED  = 1 << 30 // escalated from a configurable fault
 )
 
 // System Control Block (SCB)
@@ -97,6 +127,15 @@ type SCB_Type struct {
 	_     volatile.Register32    // RESERVED1;
 	SHP   [2]volatile.Register32 // System Handlers Priority Registers. [0] is RESERVED
 	SHCSR volatile.Register32    // System Handler Control and State Register
+
+	// The following registers are only implemented on ARMv7-M (Cortex-M3 and
+	// higher). Do not access them on Cortex-M0 and Cortex-M0+.
+	CFSR  volatile.Register32 // Configurable Fault Status Register
+	HFSR  volatile.Register32 // HardFault Status Register
+	DFSR  volatile.Register32 // Debug Fault Status Register
+	MMFAR volatile.Register32 // MemManage Fault Address Register
+	BFAR  volatile.Register32 // BusFault Address Register
+	AFSR  volatile.Register32 // Auxiliary Fault Status Register
 }
 
 var SCB = (*SCB_Type)(unsafe.Pointer(uintptr(SCB_BASE)))
@@ -173,6 +212,11 @@ func EnableIRQ(irq uint32) {
 	NVIC.ISER[irq>>5].Set(1 << (irq & 0x1F))
 }
 
+// Disable the given interrupt number.
+func DisableIRQ(irq uint32) {
+	NVIC.ICER[irq>>5].Set(1 << (irq & 0x1F))
+}
+
 // Set the priority of the given interrupt number.
 // Note that the priority is given as a 0-255 number, where some of the lower
 // bits are not implemented by the hardware. For example, to set a low interrupt
@@ -190,22 +234,22 @@ func SetPriority(irq uint32, priority uint32) {
 	NVIC.IPR[regnum].Set((uint32(NVIC.IPR[regnum].Get()) &^ mask) | priority)
 }
 
-// DisableInterrupts disables all interrupts, and returns the old state.
-//
-// TODO: it doesn't actually return the old state, meaning that it cannot be
-// nested.
+// DisableInterrupts disables all interrupts, and returns the old state (the
+// value of PRIMASK). Calls can be nested, as long as every call is paired with
+// a call to EnableInterrupts.
 func DisableInterrupts() uintptr {
-	Asm("cpsid if")
-	return 0
+	mask := ReadRegister("primask")
+	Asm("cpsid i")
+	return mask
 }
 
-// EnableInterrupts enables all interrupts again. The value passed in must be
-// the mask returned by DisableInterrupts.
-//
-// TODO: it doesn't actually use the old state, meaning that it cannot be
-// nested.
+// EnableInterrupts restores the interrupt state. The value passed in must be
+// the mask returned by DisableInterrupts: interrupts are only enabled again
+// if they were enabled before the matching call to DisableInterrupts.
 func EnableInterrupts(mask uintptr) {
-	Asm("cpsie if")
+	AsmFull("msr primask, {mask}", map[string]interface{}{
+		"mask": mask,
+	})
 }
 
 // SystemReset performs a hard system reset.
@@ -223,6 +267,9 @@ func SystemReset() {
 // This will cause SysTick_Handler to fire once per tick.
 // The cyclecount parameter is a counter value which can range from 0 to
 // 0xffffff.  A value of 0 disables the timer.
+// The runtime uses the system timer itself on the cortex-m-qemu target, and on
+// other Cortex-M chips when goroutines are preempted (the "preempt" build tag).
+// Programs must not use it in these cases.
 func SetupSystemTimer(cyclecount uint32) error {
 	// turn it off
 	SYST.SYST_CSR.ClearBits(SYST_CSR_TICKINT | SYST_CSR_ENABLE)
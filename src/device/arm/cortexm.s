@@ -7,7 +7,18 @@ HardFault_Handler:
     // Put the old stack pointer in the first argument, for easy debugging. This
     // is especially useful on Cortex-M0, which supports far fewer debug
     // facilities.
-    mov r0, sp
+    // Bit 2 of the EXC_RETURN value in lr indicates which stack was in use at
+    // the moment of the fault: the main stack (MSP) or the process stack (PSP),
+    // which is used by goroutines in the tasks scheduler.
+    mov r0, lr
+    movs r1, #4
+    tst r0, r1
+    bne 1f
+    mrs r0, MSP
+    b 2f
+1:
+    mrs r0, PSP
+2:
 
     // Load the default stack pointer from address 0 so that we can call normal
     // functions again that expect a working stack. However, it will corrupt the
@@ -0,0 +1,19 @@
+// Package lm3s6965 contains the interrupt numbers of the Stellaris LM3S6965
+// microcontroller as emulated by QEMU, which is used by the cortex-m-qemu
+// target. Only the interrupts listed in the interrupt vector in
+// targets/cortex-m-qemu.s are defined here.
+package lm3s6965
+
+// Interrupt numbers
+const (
+	IRQ_GPIOA = 0 // GPIO Port A
+	IRQ_GPIOB = 1 // GPIO Port B
+	IRQ_GPIOC = 2 // GPIO Port C
+	IRQ_GPIOD = 3 // GPIO Port D
+	IRQ_GPIOE = 4 // GPIO Port E
+	IRQ_UART0 = 5 // UART0
+	IRQ_UART1 = 6 // UART1
+	IRQ_SSI0  = 7 // SSI0
+	IRQ_I2C0  = 8 // I2C0
+	IRQ_max   = 8 // Highest interrupt number on this device.
+)
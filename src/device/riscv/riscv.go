@@ -6,5 +6,18 @@ package riscv
 func Asm(asm string)
 
 // ReadRegister returns the contents of the specified register. The register
-// must be a processor register, reachable with the "mov" instruction.
+// must be a processor register, reachable with the "mv" instruction, or one of
+// the control and status registers mstatus, mie, mip, mcause, mepc and mtval,
+// which are read with the "csrr" instruction.
 func ReadRegister(name string) uintptr
+
+// Run the given inline assembly. The code will be marked as having side
+// effects, as it would otherwise be optimized away. The inline assembly string
+// recognizes template values in the form {name}, like so:
+//
+//     riscv.AsmFull(
+//         "csrs mie, {value}",
+//         map[string]interface{}{
+//             "value": 1 << 11,
+//         })
+func AsmFull(asm string, regs map[string]interface{})
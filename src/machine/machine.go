@@ -7,6 +7,10 @@ var (
 	ErrInvalidOutputPin = errors.New("machine: invalid output pin")
 	ErrInvalidClockPin  = errors.New("machine: invalid clock pin")
 	ErrInvalidDataPin   = errors.New("machine: invalid data pin")
+
+	// ErrNoPinChangeChannel is returned by Pin.SetInterrupt when all hardware
+	// channels for pin change interrupts are in use.
+	ErrNoPinChangeChannel = errors.New("machine: no channel available for pin interrupt")
 )
 
 type PinConfig struct {
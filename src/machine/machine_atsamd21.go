@@ -144,6 +144,136 @@ func findPinPadMapping(sercom uint8, pin Pin) (pinMode PinMode, pad uint32, ok b
 	return
 }
 
+// PinChange is the kind of pin change that triggers a pin interrupt.
+type PinChange uint8
+
+// Pin change interrupt constants for SetInterrupt.
+const (
+	PinRising  PinChange = sam.EIC_CONFIG_SENSE0_RISE
+	PinFalling PinChange = sam.EIC_CONFIG_SENSE0_FALL
+	PinToggle  PinChange = sam.EIC_CONFIG_SENSE0_BOTH
+)
+
+// Callbacks to be called for pins configured with SetInterrupt, one for each
+// EXTINT line. The value of interruptPins[i] is only valid when
+// pinCallbacks[i] is set.
+var (
+	interruptPins [16]Pin
+	pinCallbacks  [16]func(Pin)
+)
+
+// getEXTINT returns the EXTINT line this pin is connected to. Most pins are
+// connected to EXTINT p%16, but there are a few exceptions. The second return
+// value is false if this pin cannot be used as an external interrupt.
+func (p Pin) getEXTINT() (uint8, bool) {
+	switch p {
+	case PA08:
+		// Connected to NMI, which is not supported.
+		return 0, false
+	case PA24:
+		return 12, true
+	case PA25:
+		return 13, true
+	case PA27:
+		return 15, true
+	case PA28:
+		return 8, true
+	case PA30:
+		return 10, true
+	case PA31:
+		return 11, true
+	default:
+		return uint8(p) % 16, true
+	}
+}
+
+// SetInterrupt sets an interrupt to be executed when a particular pin changes
+// state. The callback is called from an interrupt, so it should return quickly
+// and must not block or allocate memory.
+//
+// This call will replace a previously set callback on this pin. You can pass a
+// nil func to unset the pin change interrupt. If you do so, the change
+// parameter is ignored and can be set to any value (such as 0).
+//
+// Each EXTINT line can only be used by one pin at a time. Trying to set an
+// interrupt on a pin that shares its EXTINT line with a pin that already has
+// an interrupt set results in ErrNoPinChangeChannel.
+func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error {
+	extint, ok := p.getEXTINT()
+	if !ok {
+		return ErrInvalidInputPin
+	}
+
+	if callback == nil {
+		// Disable this pin interrupt (if it was enabled).
+		if pinCallbacks[extint] != nil && interruptPins[extint] == p {
+			sam.EIC.INTENCLR.Set(1 << extint)
+			pinCallbacks[extint] = nil
+		}
+		return nil
+	}
+
+	if pinCallbacks[extint] != nil && interruptPins[extint] != p {
+		// The EXTINT line is already in use by another pin.
+		return ErrNoPinChangeChannel
+	}
+
+	if sam.EIC.CTRL.Get() == 0 {
+		// The EIC peripheral has not yet been initialized. It needs two
+		// clocks: CLK_EIC_APB, which is enabled by default, and GCLK_EIC,
+		// which is needed for edge detection and must be enabled here.
+		sam.GCLK.CLKCTRL.Set((sam.GCLK_CLKCTRL_ID_EIC << sam.GCLK_CLKCTRL_ID_Pos) |
+			(sam.GCLK_CLKCTRL_GEN_GCLK0 << sam.GCLK_CLKCTRL_GEN_Pos) |
+			sam.GCLK_CLKCTRL_CLKEN)
+		for sam.GCLK.STATUS.HasBits(sam.GCLK_STATUS_SYNCBUSY) {
+		}
+
+		sam.EIC.CTRL.Set(sam.EIC_CTRL_ENABLE)
+		for sam.EIC.STATUS.HasBits(sam.EIC_STATUS_SYNCBUSY) {
+		}
+	}
+
+	pinCallbacks[extint] = callback
+	interruptPins[extint] = p
+
+	// Set the sense bits for this EXTINT line. Each CONFIG register contains
+	// the configuration of 8 lines, 4 bits each.
+	config := &sam.EIC.CONFIG[extint/8]
+	pos := uint32(extint%8) * 4
+	config.Set(config.Get()&^(0xf<<pos) | uint32(change)<<pos)
+
+	// Clear a stale interrupt flag, if any, and enable the interrupt.
+	sam.EIC.INTFLAG.Set(1 << extint)
+	sam.EIC.INTENSET.Set(1 << extint)
+
+	// Route the pin to the EIC, which is peripheral function A. Keep the INEN
+	// and PULLEN flags, as the pin may have been configured as an input with
+	// a pullup before.
+	if p&1 > 0 {
+		// odd pin, so save the even pins
+		p.setPMux(p.getPMux() & sam.PORT_PMUX0_PMUXE_Msk)
+	} else {
+		// even pin, so save the odd pins
+		p.setPMux(p.getPMux() & sam.PORT_PMUX0_PMUXO_Msk)
+	}
+	p.setPinCfg(p.getPinCfg() | sam.PORT_PINCFG0_PMUXEN)
+
+	arm.SetPriority(sam.IRQ_EIC, 0xc0) // low priority
+	arm.EnableIRQ(sam.IRQ_EIC)
+	return nil
+}
+
+//go:interrupt EIC_IRQHandler
+func handleEIC() {
+	flags := sam.EIC.INTFLAG.Get()
+	sam.EIC.INTFLAG.Set(flags) // clear interrupt flags
+	for i := range pinCallbacks {
+		if flags&(1<<uint(i)) != 0 && pinCallbacks[i] != nil {
+			pinCallbacks[i](interruptPins[i])
+		}
+	}
+}
+
 // InitADC initializes the ADC.
 func InitADC() {
 	// ADC Bias Calibration
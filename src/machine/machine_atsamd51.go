@@ -259,6 +259,216 @@ func (p Pin) getPinGrouping() (uint8, uint8) {
 	return group, pin_in_group
 }
 
+// PinChange is the kind of pin change that triggers a pin interrupt.
+type PinChange uint8
+
+// Pin change interrupt constants for SetInterrupt.
+const (
+	PinRising  PinChange = sam.EIC_CONFIG_SENSE0_RISE
+	PinFalling PinChange = sam.EIC_CONFIG_SENSE0_FALL
+	PinToggle  PinChange = sam.EIC_CONFIG_SENSE0_BOTH
+)
+
+// Callbacks to be called for pins configured with SetInterrupt, one for each
+// EXTINT line. The value of interruptPins[i] is only valid when
+// pinCallbacks[i] is set.
+var (
+	interruptPins [16]Pin
+	pinCallbacks  [16]func(Pin)
+)
+
+// getEXTINT returns the EXTINT line this pin is connected to. Most pins are
+// connected to EXTINT p%16, but there are a few exceptions. The second return
+// value is false if this pin cannot be used as an external interrupt.
+func (p Pin) getEXTINT() (uint8, bool) {
+	switch p {
+	case PA08:
+		// Connected to NMI, which is not supported.
+		return 0, false
+	case PB26:
+		return 12, true
+	case PB27:
+		return 13, true
+	case PB28:
+		return 14, true
+	case PB29:
+		return 15, true
+	default:
+		return uint8(p) % 16, true
+	}
+}
+
+// SetInterrupt sets an interrupt to be executed when a particular pin changes
+// state. The callback is called from an interrupt, so it should return quickly
+// and must not block or allocate memory.
+//
+// This call will replace a previously set callback on this pin. You can pass a
+// nil func to unset the pin change interrupt. If you do so, the change
+// parameter is ignored and can be set to any value (such as 0).
+//
+// Each EXTINT line can only be used by one pin at a time. Trying to set an
+// interrupt on a pin that shares its EXTINT line with a pin that already has
+// an interrupt set results in ErrNoPinChangeChannel.
+func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error {
+	extint, ok := p.getEXTINT()
+	if !ok {
+		return ErrInvalidInputPin
+	}
+
+	if callback == nil {
+		// Disable this pin interrupt (if it was enabled).
+		if pinCallbacks[extint] != nil && interruptPins[extint] == p {
+			sam.EIC.INTENCLR.Set(1 << extint)
+			pinCallbacks[extint] = nil
+		}
+		return nil
+	}
+
+	if pinCallbacks[extint] != nil && interruptPins[extint] != p {
+		// The EXTINT line is already in use by another pin.
+		return ErrNoPinChangeChannel
+	}
+
+	if !sam.EIC.CTRLA.HasBits(sam.EIC_CTRLA_ENABLE) {
+		// The EIC peripheral has not yet been initialized. CLK_EIC_APB is
+		// enabled by default, but GCLK_EIC (peripheral channel 4) is needed
+		// for edge detection and must be enabled here.
+		sam.GCLK.PCHCTRL[4].Set((sam.GCLK_PCHCTRL_GEN_GCLK0 << sam.GCLK_PCHCTRL_GEN_Pos) |
+			sam.GCLK_PCHCTRL_CHEN)
+	} else {
+		// The CONFIG registers are enable-protected, so the EIC must be
+		// disabled while changing them.
+		sam.EIC.CTRLA.ClearBits(sam.EIC_CTRLA_ENABLE)
+		for sam.EIC.SYNCBUSY.HasBits(sam.EIC_SYNCBUSY_ENABLE) {
+		}
+	}
+
+	pinCallbacks[extint] = callback
+	interruptPins[extint] = p
+
+	// Set the sense bits for this EXTINT line. Each CONFIG register contains
+	// the configuration of 8 lines, 4 bits each.
+	config := &sam.EIC.CONFIG[extint/8]
+	pos := uint32(extint%8) * 4
+	config.Set(config.Get()&^(0xf<<pos) | uint32(change)<<pos)
+
+	// (Re)enable the EIC.
+	sam.EIC.CTRLA.SetBits(sam.EIC_CTRLA_ENABLE)
+	for sam.EIC.SYNCBUSY.HasBits(sam.EIC_SYNCBUSY_ENABLE) {
+	}
+
+	// Clear a stale interrupt flag, if any, and enable the interrupt.
+	sam.EIC.INTFLAG.Set(1 << extint)
+	sam.EIC.INTENSET.Set(1 << extint)
+
+	// Route the pin to the EIC, which is peripheral function A. Keep the INEN
+	// and PULLEN flags, as the pin may have been configured as an input with
+	// a pullup before.
+	if p&1 > 0 {
+		// odd pin, so save the even pins
+		p.setPMux(p.getPMux() & sam.PORT_GROUP_PMUX_PMUXE_Msk)
+	} else {
+		// even pin, so save the odd pins
+		p.setPMux(p.getPMux() & sam.PORT_GROUP_PMUX_PMUXO_Msk)
+	}
+	p.setPinCfg(p.getPinCfg() | sam.PORT_GROUP_PINCFG_PMUXEN)
+
+	// Every EXTINT line has its own interrupt on the atsamd51.
+	irq := sam.IRQ_EIC_EXTINT_0 + uint32(extint)
+	arm.SetPriority(irq, 0xc0) // low priority
+	arm.EnableIRQ(irq)
+	return nil
+}
+
+// callEICHandler clears the interrupt flag of the given EXTINT line and calls
+// the callback set for it.
+func callEICHandler(extint uint8) {
+	sam.EIC.INTFLAG.Set(1 << extint) // clear interrupt flag
+	if callback := pinCallbacks[extint]; callback != nil {
+		callback(interruptPins[extint])
+	}
+}
+
+//go:interrupt EIC_EXTINT_0_IRQHandler
+func handleEIC0() {
+	callEICHandler(0)
+}
+
+//go:interrupt EIC_EXTINT_1_IRQHandler
+func handleEIC1() {
+	callEICHandler(1)
+}
+
+//go:interrupt EIC_EXTINT_2_IRQHandler
+func handleEIC2() {
+	callEICHandler(2)
+}
+
+//go:interrupt EIC_EXTINT_3_IRQHandler
+func handleEIC3() {
+	callEICHandler(3)
+}
+
+//go:interrupt EIC_EXTINT_4_IRQHandler
+func handleEIC4() {
+	callEICHandler(4)
+}
+
+//go:interrupt EIC_EXTINT_5_IRQHandler
+func handleEIC5() {
+	callEICHandler(5)
+}
+
+//go:interrupt EIC_EXTINT_6_IRQHandler
+func handleEIC6() {
+	callEICHandler(6)
+}
+
+//go:interrupt EIC_EXTINT_7_IRQHandler
+func handleEIC7() {
+	callEICHandler(7)
+}
+
+//go:interrupt EIC_EXTINT_8_IRQHandler
+func handleEIC8() {
+	callEICHandler(8)
+}
+
+//go:interrupt EIC_EXTINT_9_IRQHandler
+func handleEIC9() {
+	callEICHandler(9)
+}
+
+//go:interrupt EIC_EXTINT_10_IRQHandler
+func handleEIC10() {
+	callEICHandler(10)
+}
+
+//go:interrupt EIC_EXTINT_11_IRQHandler
+func handleEIC11() {
+	callEICHandler(11)
+}
+
+//go:interrupt EIC_EXTINT_12_IRQHandler
+func handleEIC12() {
+	callEICHandler(12)
+}
+
+//go:interrupt EIC_EXTINT_13_IRQHandler
+func handleEIC13() {
+	callEICHandler(13)
+}
+
+//go:interrupt EIC_EXTINT_14_IRQHandler
+func handleEIC14() {
+	callEICHandler(14)
+}
+
+//go:interrupt EIC_EXTINT_15_IRQHandler
+func handleEIC15() {
+	callEICHandler(15)
+}
+
 // InitADC initializes the ADC.
 func InitADC() {
 	// ADC Bias Calibration
@@ -51,6 +51,80 @@ func (p Pin) Get() bool {
 	return (val > 0)
 }
 
+// PinChange is the kind of pin change that triggers a pin interrupt. It is a
+// bitmask of the edges to detect.
+type PinChange uint8
+
+// Pin change interrupt constants for SetInterrupt.
+const (
+	PinRising PinChange = 1 << iota
+	PinFalling
+	PinToggle = PinRising | PinFalling
+)
+
+// PLIC interrupt ID of GPIO pin 0. Every GPIO pin has its own interrupt source
+// in the PLIC: pin n uses ID gpioIRQBase+n.
+const gpioIRQBase = 8
+
+// Callbacks to be called for pins configured with SetInterrupt.
+var pinCallbacks [32]func(Pin)
+
+// setPLICHandler sets the function to be called by the runtime when the given
+// external interrupt fires. It is implemented in the runtime.
+func setPLICHandler(id uint32, handler func(id uint32))
+
+// SetInterrupt sets an interrupt to be executed when a particular pin changes
+// state. The callback is called from an interrupt, so it should return quickly
+// and must not block or allocate memory.
+//
+// This call will replace a previously set callback on this pin. You can pass a
+// nil func to unset the pin change interrupt. If you do so, the change
+// parameter is ignored and can be set to any value (such as 0).
+func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error {
+	mask := uint32(1) << uint8(p)
+	id := gpioIRQBase + uint32(p)
+
+	// Disable the interrupt and clear pending edges (if any) before changing
+	// the configuration.
+	sifive.GPIO0.RISE_IE.ClearBits(mask)
+	sifive.GPIO0.FALL_IE.ClearBits(mask)
+	sifive.GPIO0.RISE_IP.Set(mask)
+	sifive.GPIO0.FALL_IP.Set(mask)
+
+	pinCallbacks[p] = callback
+	if callback == nil {
+		sifive.PLIC.ENABLE[id/32].ClearBits(1 << (id % 32))
+		return nil
+	}
+
+	if change&PinRising != 0 {
+		sifive.GPIO0.RISE_IE.SetBits(mask)
+	}
+	if change&PinFalling != 0 {
+		sifive.GPIO0.FALL_IE.SetBits(mask)
+	}
+
+	setPLICHandler(id, handleGPIOInterrupt)
+	sifive.PLIC.PRIORITY[id].Set(1)
+	sifive.PLIC.ENABLE[id/32].SetBits(1 << (id % 32))
+	return nil
+}
+
+// handleGPIOInterrupt is called by the runtime when a GPIO interrupt has been
+// claimed from the PLIC.
+func handleGPIOInterrupt(id uint32) {
+	p := Pin(id - gpioIRQBase)
+	mask := uint32(1) << uint8(p)
+
+	// Clear the pending bits, which are write-1-to-clear.
+	sifive.GPIO0.RISE_IP.Set(mask)
+	sifive.GPIO0.FALL_IP.Set(mask)
+
+	if callback := pinCallbacks[p]; callback != nil {
+		callback(p)
+	}
+}
+
 type UART struct {
 	Bus    *sifive.UART_Type
 	Buffer *RingBuffer
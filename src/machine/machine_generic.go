@@ -2,7 +2,11 @@
 
 package machine
 
-// Dummy machine package that calls out to external functions.
+import "errors"
+
+// Dummy machine package that calls out to external functions. These functions
+// may be implemented in C or in Go (using //export), for example by the
+// simulator in the machine/sim package.
 
 var (
 	SPI0  = SPI{0}
@@ -31,6 +35,39 @@ func (p Pin) Get() bool {
 	return gpioGet(p)
 }
 
+// PinChange is the kind of pin change that triggers a pin interrupt. It is a
+// bitmask of the edges to detect.
+type PinChange uint8
+
+// Pin change interrupt constants for SetInterrupt.
+const (
+	PinRising PinChange = 1 << iota
+	PinFalling
+	PinToggle = PinRising | PinFalling
+)
+
+// Callbacks to be called for pins configured with SetInterrupt.
+var pinCallbacks = map[Pin]func(Pin){}
+
+// SetInterrupt sets a callback to be called when a particular pin changes
+// state. The external implementation is told which edges to detect, and calls
+// back into the machine package (through __tinygo_gpio_interrupt) when such an
+// edge happens.
+//
+// This call will replace a previously set callback on this pin. You can pass a
+// nil func to unset the pin change interrupt. If you do so, the change
+// parameter is ignored and can be set to any value (such as 0).
+func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error {
+	if callback == nil {
+		delete(pinCallbacks, p)
+		change = 0
+	} else {
+		pinCallbacks[p] = callback
+	}
+	gpioSetInterrupt(p, change)
+	return nil
+}
+
 //go:export __tinygo_gpio_configure
 func gpioConfigure(pin Pin, config PinConfig)
 
@@ -40,6 +77,18 @@ func gpioSet(pin Pin, value bool)
 //go:export __tinygo_gpio_get
 func gpioGet(pin Pin) bool
 
+//go:export __tinygo_gpio_set_interrupt
+func gpioSetInterrupt(pin Pin, change PinChange)
+
+// gpioInterrupt is called by the external implementation when an edge was
+// detected on a pin configured with SetInterrupt.
+//export __tinygo_gpio_interrupt
+func gpioInterrupt(pin Pin) {
+	if callback := pinCallbacks[pin]; callback != nil {
+		callback(pin)
+	}
+}
+
 type SPI struct {
 	Bus uint8
 }
@@ -118,10 +167,20 @@ func (i2c I2C) Configure(config I2CConfig) {
 	i2cConfigure(i2c.Bus, config.SCL, config.SDA)
 }
 
+var errI2CTransfer = errors.New("I2C transaction failed")
+
 // Tx does a single I2C transaction at the specified address.
 func (i2c I2C) Tx(addr uint16, w, r []byte) error {
-	i2cTransfer(i2c.Bus, &w[0], len(w), &r[0], len(r))
-	// TODO: do something with the returned error code.
+	var wptr, rptr *byte
+	if len(w) != 0 {
+		wptr = &w[0]
+	}
+	if len(r) != 0 {
+		rptr = &r[0]
+	}
+	if i2cTransfer(i2c.Bus, addr, wptr, len(w), rptr, len(r)) != 0 {
+		return errI2CTransfer
+	}
 	return nil
 }
 
@@ -129,7 +188,7 @@ func (i2c I2C) Tx(addr uint16, w, r []byte) error {
 func i2cConfigure(bus uint8, scl Pin, sda Pin)
 
 //go:export __tinygo_i2c_transfer
-func i2cTransfer(bus uint8, w *byte, wlen int, r *byte, rlen int) int
+func i2cTransfer(bus uint8, addr uint16, w *byte, wlen int, r *byte, rlen int) int
 
 type UART struct {
 	Bus uint8
@@ -148,11 +207,17 @@ func (uart UART) Configure(config UARTConfig) {
 
 // Read from the UART.
 func (uart UART) Read(data []byte) (n int, err error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
 	return uartRead(uart.Bus, &data[0], len(data)), nil
 }
 
 // Write to the UART.
 func (uart UART) Write(data []byte) (n int, err error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
 	return uartWrite(uart.Bus, &data[0], len(data)), nil
 }
 
@@ -59,6 +59,97 @@ func (p Pin) Get() bool {
 	return (port.IN.Get()>>pin)&1 != 0
 }
 
+// PinChange is the kind of pin change that triggers a pin interrupt.
+type PinChange uint8
+
+// Pin change interrupt constants for SetInterrupt.
+const (
+	PinRising  PinChange = nrf.GPIOTE_CONFIG_POLARITY_LoToHi
+	PinFalling PinChange = nrf.GPIOTE_CONFIG_POLARITY_HiToLo
+	PinToggle  PinChange = nrf.GPIOTE_CONFIG_POLARITY_Toggle
+)
+
+// Mask for the pin number in the GPIOTE CONFIG registers. On chips with more
+// than one port, the PSEL field is directly followed by the PORT field so this
+// mask covers both.
+const gpioteConfigPinMask = 0x3f << nrf.GPIOTE_CONFIG_PSEL_Pos
+
+// Callbacks to be called for pins configured with SetInterrupt, one for each
+// GPIOTE channel.
+var pinCallbacks [len(nrf.GPIOTE.CONFIG)]func(Pin)
+
+// SetInterrupt sets an interrupt to be executed when a particular pin changes
+// state. The callback is called from an interrupt, so it should return quickly
+// and must not block or allocate memory.
+//
+// This call will replace a previously set callback on this pin. You can pass a
+// nil func to unset the pin change interrupt. If you do so, the change
+// parameter is ignored and can be set to any value (such as 0).
+func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error {
+	// Some variables to easily check whether a channel was already configured
+	// as an event channel for the given pin.
+	// This is not just an optimization, this is required: the datasheet says
+	// that configuring more than one channel for a given pin results in
+	// unpredictable behavior.
+	expectedConfigMask := uint32(nrf.GPIOTE_CONFIG_MODE_Msk | gpioteConfigPinMask)
+	expectedConfig := nrf.GPIOTE_CONFIG_MODE_Event<<nrf.GPIOTE_CONFIG_MODE_Pos | uint32(p)<<nrf.GPIOTE_CONFIG_PSEL_Pos
+
+	// Find the channel already configured for this pin, or else the first
+	// unused channel.
+	channel := -1
+	for i := range nrf.GPIOTE.CONFIG {
+		config := nrf.GPIOTE.CONFIG[i].Get()
+		if config&expectedConfigMask == expectedConfig&expectedConfigMask {
+			channel = i
+			break
+		}
+		if config == 0 && channel < 0 {
+			channel = i
+		}
+	}
+
+	if callback == nil {
+		// Disable the channel, if this pin had one.
+		if channel >= 0 && nrf.GPIOTE.CONFIG[channel].Get() != 0 {
+			nrf.GPIOTE.INTENCLR.Set(nrf.GPIOTE_INTENSET_IN0 << uint(channel))
+			nrf.GPIOTE.CONFIG[channel].Set(0)
+			pinCallbacks[channel] = nil
+		}
+		return nil
+	}
+
+	if channel < 0 {
+		return ErrNoPinChangeChannel
+	}
+
+	// Enable this channel with the given callback.
+	nrf.GPIOTE.INTENCLR.Set(nrf.GPIOTE_INTENSET_IN0 << uint(channel))
+	nrf.GPIOTE.CONFIG[channel].Set(expectedConfig |
+		uint32(change)<<nrf.GPIOTE_CONFIG_POLARITY_Pos)
+	nrf.GPIOTE.EVENTS_IN[channel].Set(0)
+	pinCallbacks[channel] = callback
+	nrf.GPIOTE.INTENSET.Set(nrf.GPIOTE_INTENSET_IN0 << uint(channel))
+
+	// Set and enable the GPIOTE interrupt. It's not a problem if this happens
+	// more than once.
+	arm.SetPriority(nrf.IRQ_GPIOTE, 0xc0) // low priority
+	arm.EnableIRQ(nrf.IRQ_GPIOTE)
+	return nil
+}
+
+//go:interrupt GPIOTE_IRQHandler
+func handleGPIOTE() {
+	for i := range nrf.GPIOTE.EVENTS_IN {
+		if nrf.GPIOTE.EVENTS_IN[i].Get() != 0 {
+			nrf.GPIOTE.EVENTS_IN[i].Set(0)
+			pin := Pin((nrf.GPIOTE.CONFIG[i].Get() & gpioteConfigPinMask) >> nrf.GPIOTE_CONFIG_PSEL_Pos)
+			if callback := pinCallbacks[i]; callback != nil {
+				callback(pin)
+			}
+		}
+	}
+}
+
 // UART on the NRF.
 type UART struct {
 	Buffer *RingBuffer
@@ -4,4 +4,144 @@ package machine
 
 // Peripheral abstraction layer for the stm32.
 
+import (
+	"device/arm"
+	"device/stm32"
+)
+
 type PinMode uint8
+
+// PinChange is the kind of pin change that triggers a pin interrupt. It is a
+// bitmask of the edges to detect.
+type PinChange uint8
+
+// Pin change interrupt constants for SetInterrupt.
+const (
+	PinRising PinChange = 1 << iota
+	PinFalling
+	PinToggle = PinRising | PinFalling
+)
+
+// Callbacks to be called for pins configured with SetInterrupt, one for each
+// EXTI line. The value of interruptPins[i] is only valid when pinCallbacks[i]
+// is set.
+var (
+	interruptPins [16]Pin
+	pinCallbacks  [16]func(Pin)
+)
+
+// SetInterrupt sets an interrupt to be executed when a particular pin changes
+// state. The callback is called from an interrupt, so it should return quickly
+// and must not block or allocate memory.
+//
+// This call will replace a previously set callback on this pin. You can pass a
+// nil func to unset the pin change interrupt. If you do so, the change
+// parameter is ignored and can be set to any value (such as 0).
+//
+// Pin n of every port is connected to EXTI line n, and each line can only be
+// used by one pin at a time. For example, PA0 and PB0 cannot both have an
+// interrupt set: this results in ErrNoPinChangeChannel.
+func (p Pin) SetInterrupt(change PinChange, callback func(Pin)) error {
+	line := uint8(p) % 16
+	mask := uint32(1) << line
+
+	if callback == nil {
+		// Disable this pin interrupt (if it was enabled).
+		if pinCallbacks[line] != nil && interruptPins[line] == p {
+			stm32.EXTI.IMR.ClearBits(mask)
+			pinCallbacks[line] = nil
+		}
+		return nil
+	}
+
+	if pinCallbacks[line] != nil && interruptPins[line] != p {
+		// The EXTI line is already in use by a pin of another port.
+		return ErrNoPinChangeChannel
+	}
+
+	pinCallbacks[line] = callback
+	interruptPins[line] = p
+
+	// Connect the EXTI line to the port of this pin.
+	setEXTIPort(line, uint32(p/16))
+
+	// Select the edges that trigger the interrupt.
+	if change&PinRising != 0 {
+		stm32.EXTI.RTSR.SetBits(mask)
+	} else {
+		stm32.EXTI.RTSR.ClearBits(mask)
+	}
+	if change&PinFalling != 0 {
+		stm32.EXTI.FTSR.SetBits(mask)
+	} else {
+		stm32.EXTI.FTSR.ClearBits(mask)
+	}
+
+	// Clear a stale pending bit, if any, and unmask the interrupt.
+	stm32.EXTI.PR.Set(mask)
+	stm32.EXTI.IMR.SetBits(mask)
+
+	irq := extiIRQ(line)
+	arm.SetPriority(irq, 0xc0) // low priority
+	arm.EnableIRQ(irq)
+	return nil
+}
+
+// extiIRQ returns the interrupt number used for the given EXTI line. Lines 0-4
+// have their own interrupt, the other lines share two interrupts.
+func extiIRQ(line uint8) uint32 {
+	switch {
+	case line <= 4:
+		return stm32.IRQ_EXTI0 + uint32(line)
+	case line <= 9:
+		return stm32.IRQ_EXTI9_5
+	default:
+		return stm32.IRQ_EXTI15_10
+	}
+}
+
+// handleEXTI calls the callbacks of all EXTI lines with a pending interrupt.
+func handleEXTI() {
+	pending := stm32.EXTI.PR.Get() & stm32.EXTI.IMR.Get()
+	stm32.EXTI.PR.Set(pending) // clear pending bits
+	for line := uint(0); line < 16; line++ {
+		if pending&(1<<line) != 0 && pinCallbacks[line] != nil {
+			pinCallbacks[line](interruptPins[line])
+		}
+	}
+}
+
+//go:interrupt EXTI0_IRQHandler
+func handleEXTI0() {
+	handleEXTI()
+}
+
+//go:interrupt EXTI1_IRQHandler
+func handleEXTI1() {
+	handleEXTI()
+}
+
+//go:interrupt EXTI2_IRQHandler
+func handleEXTI2() {
+	handleEXTI()
+}
+
+//go:interrupt EXTI3_IRQHandler
+func handleEXTI3() {
+	handleEXTI()
+}
+
+//go:interrupt EXTI4_IRQHandler
+func handleEXTI4() {
+	handleEXTI()
+}
+
+//go:interrupt EXTI9_5_IRQHandler
+func handleEXTI9_5() {
+	handleEXTI()
+}
+
+//go:interrupt EXTI15_10_IRQHandler
+func handleEXTI15_10() {
+	handleEXTI()
+}
@@ -8,6 +8,7 @@ import (
 	"device/arm"
 	"device/stm32"
 	"errors"
+	"runtime/volatile"
 )
 
 func CPUFrequency() uint32 {
@@ -89,6 +90,26 @@ func (p Pin) Configure(config PinConfig) {
 	}
 }
 
+// setEXTIPort connects the given EXTI line to a port, where port 0 is GPIOA,
+// port 1 is GPIOB, etc.
+func setEXTIPort(line uint8, port uint32) {
+	stm32.RCC.APB2ENR.SetBits(stm32.RCC_APB2ENR_AFIOEN)
+
+	var exticr *volatile.Register32
+	switch line / 4 {
+	case 0:
+		exticr = &stm32.AFIO.EXTICR1
+	case 1:
+		exticr = &stm32.AFIO.EXTICR2
+	case 2:
+		exticr = &stm32.AFIO.EXTICR3
+	default:
+		exticr = &stm32.AFIO.EXTICR4
+	}
+	pos := uint32(line%4) * 4
+	exticr.Set(exticr.Get()&^(0xf<<pos) | port<<pos)
+}
+
 // Set the pin to high or low.
 // Warning: only use this on an output pin!
 func (p Pin) Set(high bool) {
@@ -7,6 +7,7 @@ package machine
 import (
 	"device/arm"
 	"device/stm32"
+	"runtime/volatile"
 )
 
 func CPUFrequency() uint32 {
@@ -141,6 +142,26 @@ func (p Pin) setAltFunc(af uint32) {
 	}
 }
 
+// setEXTIPort connects the given EXTI line to a port, where port 0 is GPIOA,
+// port 1 is GPIOB, etc.
+func setEXTIPort(line uint8, port uint32) {
+	stm32.RCC.APB2ENR.SetBits(stm32.RCC_APB2ENR_SYSCFGEN)
+
+	var exticr *volatile.Register32
+	switch line / 4 {
+	case 0:
+		exticr = &stm32.SYSCFG.EXTICR1
+	case 1:
+		exticr = &stm32.SYSCFG.EXTICR2
+	case 2:
+		exticr = &stm32.SYSCFG.EXTICR3
+	default:
+		exticr = &stm32.SYSCFG.EXTICR4
+	}
+	pos := uint32(line%4) * 4
+	exticr.Set(exticr.Get()&^(0xf<<pos) | port<<pos)
+}
+
 // Set the pin to high or low.
 // Warning: only use this on an output pin!
 func (p Pin) Set(high bool) {
@@ -0,0 +1,99 @@
+// +build !baremetal
+
+package sim
+
+import "machine"
+
+// I2CDevice is a simulated device on an I2C bus. Tx is called for every
+// transaction addressed to this device: w contains the bytes written by the
+// program and r must be filled with the bytes to send back. Returning an error
+// makes the transaction fail in the program.
+type I2CDevice interface {
+	Tx(w, r []byte) error
+}
+
+// RegisterMap is a simple I2C device with 256 8-bit registers, as implemented
+// by many sensors. The first byte written in a transaction selects the
+// register, following bytes are written to consecutive registers. Reads start
+// at the selected register and also auto-increment.
+//
+// The Registers field can be set up before a test and inspected afterwards.
+type RegisterMap struct {
+	Registers [256]byte
+	register  uint8
+}
+
+// Tx implements I2CDevice.
+func (m *RegisterMap) Tx(w, r []byte) error {
+	if len(w) != 0 {
+		m.register = w[0]
+		for _, b := range w[1:] {
+			m.Registers[m.register] = b
+			m.register++
+		}
+	}
+	for i := range r {
+		r[i] = m.Registers[m.register]
+		m.register++
+	}
+	return nil
+}
+
+// i2cBus is the simulated state of a single I2C bus.
+type i2cBus struct {
+	configured bool
+	scl, sda   machine.Pin
+	devices    map[uint16]I2CDevice
+}
+
+var i2cBuses = map[uint8]*i2cBus{}
+
+// getI2C returns the state of the given I2C bus, creating it if needed.
+func getI2C(bus uint8) *i2cBus {
+	state := i2cBuses[bus]
+	if state == nil {
+		state = &i2cBus{devices: map[uint16]I2CDevice{}}
+		i2cBuses[bus] = state
+	}
+	return state
+}
+
+// AttachI2C attaches a simulated device at the given address on an I2C bus,
+// replacing the previous device at that address (if any). Transactions to
+// addresses without a device fail, like a NACK on real hardware.
+func AttachI2C(bus uint8, addr uint16, device I2CDevice) {
+	getI2C(bus).devices[addr] = device
+}
+
+// DetachI2C removes the device at the given address from an I2C bus.
+func DetachI2C(bus uint8, addr uint16) {
+	delete(getI2C(bus).devices, addr)
+}
+
+// I2CConfigured returns whether the given I2C bus has been configured, and if
+// so, the pins it was configured with.
+func I2CConfigured(bus uint8) (configured bool, scl, sda machine.Pin) {
+	state := getI2C(bus)
+	return state.configured, state.scl, state.sda
+}
+
+//export __tinygo_i2c_configure
+func i2cConfigure(bus uint8, scl machine.Pin, sda machine.Pin) {
+	state := getI2C(bus)
+	state.configured = true
+	state.scl = scl
+	state.sda = sda
+}
+
+//export __tinygo_i2c_transfer
+func i2cTransfer(bus uint8, addr uint16, w *byte, wlen int, r *byte, rlen int) int {
+	device := getI2C(bus).devices[addr]
+	if device == nil {
+		return -1
+	}
+	err := device.Tx(byteSlice(w, wlen), byteSlice(r, rlen))
+	if err != nil {
+		return -1
+	}
+	return 0
+}
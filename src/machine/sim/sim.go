@@ -0,0 +1,170 @@
+// +build !baremetal
+
+// Package sim implements the external functions used by the generic machine
+// package, so that code using the machine package (like drivers) can run and
+// be tested on the host. Importing this package is enough to link it into the
+// program:
+//
+//     import _ "machine/sim"
+//
+// The simulator keeps a model of all pins, SPI and I2C buses and UARTs that
+// can be controlled and inspected by a test. For example, a test for an I2C
+// sensor driver may look like this:
+//
+//     regs := &sim.RegisterMap{}
+//     regs.Registers[0x0F] = 0x33 // WHO_AM_I
+//     sim.AttachI2C(0, 0x19, regs)
+//     // ... run the driver on machine.I2C0 and check the result
+//
+// The simulator is not safe for concurrent use from multiple threads, but it
+// can be used from multiple goroutines as goroutines are scheduled
+// cooperatively.
+package sim
+
+import (
+	"machine"
+	"unsafe"
+)
+
+// pinState is the simulated state of a single pin.
+type pinState struct {
+	configured bool
+	mode       machine.PinMode
+	value      bool
+	history    []bool
+	adc        uint16
+	pwm        uint16
+	interrupt  machine.PinChange
+}
+
+var pins = map[machine.Pin]*pinState{}
+
+// getPin returns the state of the given pin, creating it if needed.
+func getPin(pin machine.Pin) *pinState {
+	state := pins[pin]
+	if state == nil {
+		state = &pinState{}
+		pins[pin] = state
+	}
+	return state
+}
+
+// Reset resets the simulator to its initial state: all pins are unconfigured
+// and low, and all devices attached to buses are removed.
+func Reset() {
+	pins = map[machine.Pin]*pinState{}
+	spiBuses = map[uint8]*spiBus{}
+	i2cBuses = map[uint8]*i2cBus{}
+	uarts = map[uint8]*uart{}
+}
+
+// PinMode returns the mode the pin was last configured with. The second return
+// value is false if the pin was never configured.
+func PinMode(pin machine.Pin) (machine.PinMode, bool) {
+	state := getPin(pin)
+	return state.mode, state.configured
+}
+
+// SetPin sets the level of a pin as seen by the program, for example to
+// simulate a button press. It is not recorded in the pin history. If the
+// program has set a pin change interrupt on this pin and the new level is a
+// matching edge, the interrupt callback is called before SetPin returns.
+func SetPin(pin machine.Pin, value bool) {
+	state := getPin(pin)
+	old := state.value
+	state.value = value
+	switch {
+	case !old && value && state.interrupt&machine.PinRising != 0:
+		gpioInterrupt(pin)
+	case old && !value && state.interrupt&machine.PinFalling != 0:
+		gpioInterrupt(pin)
+	}
+}
+
+// PinInterrupt returns the pin change interrupt the program has set on this
+// pin, or 0 if there is none.
+func PinInterrupt(pin machine.Pin) machine.PinChange {
+	return getPin(pin).interrupt
+}
+
+// PinValue returns the current level of a pin.
+func PinValue(pin machine.Pin) bool {
+	return getPin(pin).value
+}
+
+// PinHistory returns all values the program has set on this pin (using
+// Pin.Set, Pin.High or Pin.Low), oldest first.
+func PinHistory(pin machine.Pin) []bool {
+	return getPin(pin).history
+}
+
+// ClearPinHistory clears the recorded history of the given pin.
+func ClearPinHistory(pin machine.Pin) {
+	getPin(pin).history = nil
+}
+
+// SetADC sets the value that will be returned when the program reads the ADC
+// on the given pin.
+func SetADC(pin machine.Pin, value uint16) {
+	getPin(pin).adc = value
+}
+
+// PWMValue returns the duty cycle last set by the program on the PWM of the
+// given pin.
+func PWMValue(pin machine.Pin) uint16 {
+	return getPin(pin).pwm
+}
+
+// byteSlice converts a pointer and length as passed in the external functions
+// to a byte slice.
+func byteSlice(ptr *byte, length int) []byte {
+	if length == 0 {
+		return nil
+	}
+	return (*[1 << 24]byte)(unsafe.Pointer(ptr))[:length:length]
+}
+
+//export __tinygo_gpio_configure
+func gpioConfigure(pin machine.Pin, config machine.PinConfig) {
+	state := getPin(pin)
+	state.configured = true
+	state.mode = config.Mode
+	switch config.Mode {
+	case machine.PinInputPullup:
+		state.value = true
+	case machine.PinInputPulldown:
+		state.value = false
+	}
+}
+
+//export __tinygo_gpio_set
+func gpioSet(pin machine.Pin, value bool) {
+	state := getPin(pin)
+	state.value = value
+	state.history = append(state.history, value)
+}
+
+//export __tinygo_gpio_get
+func gpioGet(pin machine.Pin) bool {
+	return getPin(pin).value
+}
+
+//export __tinygo_gpio_set_interrupt
+func gpioSetInterrupt(pin machine.Pin, change machine.PinChange) {
+	getPin(pin).interrupt = change
+}
+
+// gpioInterrupt calls the interrupt callback set by the program. It is
+// implemented in the machine package.
+//go:export __tinygo_gpio_interrupt
+func gpioInterrupt(pin machine.Pin)
+
+//export __tinygo_adc_read
+func adcRead(pin machine.Pin) uint16 {
+	return getPin(pin).adc
+}
+
+//export __tinygo_pwm_set
+func pwmSet(pin machine.Pin, value uint16) {
+	getPin(pin).pwm = value
+}
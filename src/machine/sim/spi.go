@@ -0,0 +1,82 @@
+// +build !baremetal
+
+package sim
+
+import "machine"
+
+// SPIDevice is a simulated device on a SPI bus. Transfer is called for every
+// byte transferred by the program, and returns the byte the device sends back.
+type SPIDevice interface {
+	Transfer(w byte) byte
+}
+
+// SPIFunc is an adapter to use an ordinary function as a SPIDevice.
+type SPIFunc func(w byte) byte
+
+// Transfer calls f(w).
+func (f SPIFunc) Transfer(w byte) byte {
+	return f(w)
+}
+
+// spiBus is the simulated state of a single SPI bus.
+type spiBus struct {
+	configured    bool
+	sck, sdo, sdi machine.Pin
+	device        SPIDevice
+	written       []byte
+}
+
+var spiBuses = map[uint8]*spiBus{}
+
+// getSPI returns the state of the given SPI bus, creating it if needed.
+func getSPI(bus uint8) *spiBus {
+	state := spiBuses[bus]
+	if state == nil {
+		state = &spiBus{}
+		spiBuses[bus] = state
+	}
+	return state
+}
+
+// AttachSPI attaches a simulated device to the given SPI bus, replacing the
+// previous device (if any). Without a device, every transfer returns 0. Chip
+// select pins are not handled by the simulator, use PinHistory to check them.
+func AttachSPI(bus uint8, device SPIDevice) {
+	getSPI(bus).device = device
+}
+
+// SPIConfigured returns whether the given SPI bus has been configured, and if
+// so, the pins it was configured with.
+func SPIConfigured(bus uint8) (configured bool, sck, mosi, miso machine.Pin) {
+	state := getSPI(bus)
+	return state.configured, state.sck, state.sdo, state.sdi
+}
+
+// SPIWritten returns all bytes the program has sent over the given SPI bus.
+func SPIWritten(bus uint8) []byte {
+	return getSPI(bus).written
+}
+
+// ClearSPIWritten clears the recorded bytes sent over the given SPI bus.
+func ClearSPIWritten(bus uint8) {
+	getSPI(bus).written = nil
+}
+
+//export __tinygo_spi_configure
+func spiConfigure(bus uint8, sck machine.Pin, mosi machine.Pin, miso machine.Pin) {
+	state := getSPI(bus)
+	state.configured = true
+	state.sck = sck
+	state.sdo = mosi
+	state.sdi = miso
+}
+
+//export __tinygo_spi_transfer
+func spiTransfer(bus uint8, w uint8) uint8 {
+	state := getSPI(bus)
+	state.written = append(state.written, w)
+	if state.device == nil {
+		return 0
+	}
+	return state.device.Transfer(w)
+}
@@ -0,0 +1,84 @@
+// +build !baremetal
+
+package sim
+
+import "machine"
+
+// uart is the simulated state of a single UART.
+type uart struct {
+	configured bool
+	tx, rx     machine.Pin
+	noLoopback bool
+	rxBuffer   []byte
+	written    []byte
+}
+
+var uarts = map[uint8]*uart{}
+
+// getUART returns the state of the given UART, creating it if needed.
+func getUART(bus uint8) *uart {
+	state := uarts[bus]
+	if state == nil {
+		state = &uart{}
+		uarts[bus] = state
+	}
+	return state
+}
+
+// SetUARTLoopback enables or disables loopback on the given UART. With
+// loopback enabled (the default), every byte written by the program can be
+// read back from the same UART, as if TX and RX were connected.
+func SetUARTLoopback(bus uint8, enabled bool) {
+	getUART(bus).noLoopback = !enabled
+}
+
+// UARTConfigured returns whether the given UART has been configured, and if so,
+// the pins it was configured with.
+func UARTConfigured(bus uint8) (configured bool, tx, rx machine.Pin) {
+	state := getUART(bus)
+	return state.configured, state.tx, state.rx
+}
+
+// UARTInput adds data to the receive buffer of the given UART, to be read by
+// the program.
+func UARTInput(bus uint8, data []byte) {
+	state := getUART(bus)
+	state.rxBuffer = append(state.rxBuffer, data...)
+}
+
+// UARTOutput returns all bytes the program has written to the given UART.
+func UARTOutput(bus uint8) []byte {
+	return getUART(bus).written
+}
+
+// ClearUARTOutput clears the recorded bytes written to the given UART.
+func ClearUARTOutput(bus uint8) {
+	getUART(bus).written = nil
+}
+
+//export __tinygo_uart_configure
+func uartConfigure(bus uint8, tx machine.Pin, rx machine.Pin) {
+	state := getUART(bus)
+	state.configured = true
+	state.tx = tx
+	state.rx = rx
+}
+
+//export __tinygo_uart_read
+func uartRead(bus uint8, buf *byte, bufLen int) int {
+	state := getUART(bus)
+	n := copy(byteSlice(buf, bufLen), state.rxBuffer)
+	state.rxBuffer = state.rxBuffer[n:]
+	return n
+}
+
+//export __tinygo_uart_write
+func uartWrite(bus uint8, buf *byte, bufLen int) int {
+	state := getUART(bus)
+	data := byteSlice(buf, bufLen)
+	state.written = append(state.written, data...)
+	if !state.noLoopback {
+		state.rxBuffer = append(state.rxBuffer, data...)
+	}
+	return bufLen
+}
@@ -0,0 +1,83 @@
+package os
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Portable analogs of some common system call errors.
+var (
+	ErrInvalid    = errors.New("invalid argument")
+	ErrPermission = errors.New("permission denied")
+	ErrExist      = errors.New("file already exists")
+	ErrNotExist   = errors.New("file does not exist")
+	ErrClosed     = errors.New("file already closed")
+)
+
+// LinkError records an error during a link or symlink or rename system call
+// and the paths that caused it.
+type LinkError struct {
+	Op  string
+	Old string
+	New string
+	Err error
+}
+
+func (e *LinkError) Error() string {
+	return e.Op + " " + e.Old + " " + e.New + ": " + e.Err.Error()
+}
+
+// SyscallError records an error from a specific system call.
+type SyscallError struct {
+	Syscall string
+	Err     error
+}
+
+func (e *SyscallError) Error() string { return e.Syscall + ": " + e.Err.Error() }
+
+// NewSyscallError returns, as an error, a new SyscallError with the given
+// system call name and error details. As a convenience, if err is nil,
+// NewSyscallError returns nil.
+func NewSyscallError(syscall string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &SyscallError{syscall, err}
+}
+
+// IsExist returns a boolean indicating whether the error is known to report
+// that a file or directory already exists. It is satisfied by ErrExist as well
+// as some syscall errors.
+func IsExist(err error) bool {
+	err = underlyingError(err)
+	return err == syscall.EEXIST || err == syscall.ENOTEMPTY || err == ErrExist
+}
+
+// IsNotExist returns a boolean indicating whether the error is known to report
+// that a file or directory does not exist. It is satisfied by ErrNotExist as
+// well as some syscall errors.
+func IsNotExist(err error) bool {
+	err = underlyingError(err)
+	return err == syscall.ENOENT || err == ErrNotExist
+}
+
+// IsPermission returns a boolean indicating whether the error is known to
+// report that permission is denied. It is satisfied by ErrPermission as well
+// as some syscall errors.
+func IsPermission(err error) bool {
+	err = underlyingError(err)
+	return err == syscall.EACCES || err == syscall.EPERM || err == ErrPermission
+}
+
+// underlyingError returns the underlying error for known os error types.
+func underlyingError(err error) error {
+	switch err := err.(type) {
+	case *PathError:
+		return err.Err
+	case *LinkError:
+		return err.Err
+	case *SyscallError:
+		return err.Err
+	}
+	return err
+}
@@ -7,9 +7,11 @@ package os
 
 import (
 	"errors"
+	"io"
+	"syscall"
+	"time"
 )
 
-// Portable analogs of some common system call errors.
 var (
 	errUnsupported = errors.New("operation not supported")
 	notImplemented = errors.New("os: not implemented")
@@ -18,40 +20,147 @@ var (
 // Stdin, Stdout, and Stderr are open Files pointing to the standard input,
 // standard output, and standard error file descriptors.
 var (
-	Stdin  = &File{0, "/dev/stdin"}
-	Stdout = &File{1, "/dev/stdout"}
-	Stderr = &File{2, "/dev/stderr"}
+	Stdin  = &File{fd: 0, name: "/dev/stdin"}
+	Stdout = &File{fd: 1, name: "/dev/stdout"}
+	Stderr = &File{fd: 2, name: "/dev/stderr"}
 )
 
-// File represents an open file descriptor.
+// File represents an open file descriptor, or a file opened by a file system
+// mounted with Mount.
 type File struct {
-	fd   uintptr
-	name string
+	fd      uintptr
+	name    string
+	dirinfo *dirInfo   // nil unless directory being read
+	handle  FileHandle // nil unless opened from a mounted file system
 }
 
-// Readdir is a stub, not yet implemented
-func (f *File) Readdir(n int) ([]FileInfo, error) {
-	return nil, notImplemented
+// dirInfo stores the state of a directory that is being read with Readdir or
+// Readdirnames.
+type dirInfo struct {
+	buf  []byte // buffer for directory I/O
+	nbuf int    // length of buf; return value from ReadDirent
+	bufp int    // location of next record in buf
 }
 
-// Readdirnames is a stub, not yet implemented
-func (f *File) Readdirnames(n int) (names []string, err error) {
-	return nil, notImplemented
+// Name returns the name of the file as presented to Open.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Read reads up to len(b) bytes from the File. It returns the number of bytes
+// read and any error encountered. At end of file, Read returns 0, io.EOF.
+func (f *File) Read(b []byte) (n int, err error) {
+	if f.handle != nil {
+		return f.handle.Read(b)
+	}
+	return f.read(b)
+}
+
+// Write writes len(b) bytes to the File. It returns the number of bytes written
+// and an error, if any. Write returns a non-nil error when n != len(b).
+func (f *File) Write(b []byte) (n int, err error) {
+	if f.handle != nil {
+		return f.handle.Write(b)
+	}
+	return f.write(b)
+}
+
+// Close closes the File, rendering it unusable for I/O.
+func (f *File) Close() error {
+	if f.handle != nil {
+		return f.handle.Close()
+	}
+	return f.close()
 }
 
-// Stat is a stub, not yet implemented
+// Seek sets the offset for the next Read or Write on file to offset,
+// interpreted according to whence: 0 means relative to the origin of the file,
+// 1 means relative to the current offset, and 2 means relative to the end. It
+// returns the new offset and an error, if any. Files opened from a mounted
+// file system can only seek if their FileHandle implements io.Seeker.
+func (f *File) Seek(offset int64, whence int) (ret int64, err error) {
+	if f.handle != nil {
+		seeker, ok := f.handle.(io.Seeker)
+		if !ok {
+			return 0, &PathError{"seek", f.name, errUnsupported}
+		}
+		ret, err = seeker.Seek(offset, whence)
+	} else {
+		ret, err = f.seek(offset, whence)
+	}
+	if err != nil {
+		return 0, &PathError{"seek", f.name, err}
+	}
+	return ret, nil
+}
+
+// Stat returns the FileInfo structure describing file.
 func (f *File) Stat() (FileInfo, error) {
-	return nil, notImplemented
+	if f.handle != nil {
+		info, err := f.handle.Stat()
+		if err != nil {
+			return nil, &PathError{"stat", f.name, err}
+		}
+		return info, nil
+	}
+	return f.stat()
+}
+
+// Readdirnames reads the contents of the directory associated with file and
+// returns a slice of up to n names of files in the directory, in directory
+// order. If n <= 0, Readdirnames returns all the names from the directory in a
+// single slice.
+func (f *File) Readdirnames(n int) (names []string, err error) {
+	if f.handle != nil {
+		infos, err := f.Readdir(n)
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names, err
+	}
+	return f.readdirnames(n)
+}
+
+// Readdir reads the contents of the directory associated with file and returns
+// a slice of up to n FileInfo values, as would be returned by Lstat, in
+// directory order. If n <= 0, Readdir returns all the FileInfo from the
+// directory in a single slice.
+func (f *File) Readdir(n int) ([]FileInfo, error) {
+	if f.handle != nil {
+		infos, err := f.handle.Readdir(n)
+		if err != nil && err != io.EOF {
+			err = &PathError{"readdir", f.name, err}
+		}
+		return infos, err
+	}
+	names, err := f.Readdirnames(n)
+	fi := make([]FileInfo, 0, len(names))
+	for _, name := range names {
+		info, lerr := Lstat(f.name + "/" + name)
+		if IsNotExist(lerr) {
+			// File disappeared between readdir and stat.
+			continue
+		}
+		if lerr != nil {
+			return fi, lerr
+		}
+		fi = append(fi, info)
+	}
+	return fi, err
 }
 
 // NewFile returns a new File with the given file descriptor and name.
 func NewFile(fd uintptr, name string) *File {
-	return &File{fd, name}
+	return &File{fd: fd, name: name}
 }
 
 // Fd returns the integer Unix file descriptor referencing the open file. The
-// file descriptor is valid only until f.Close is called.
+// file descriptor is valid only until f.Close is called. Files opened from a
+// mounted file system have no file descriptor, Fd returns ^uintptr(0) for them.
 func (f *File) Fd() uintptr {
+	if f.handle != nil {
+		return ^uintptr(0)
+	}
 	return f.fd
 }
 
@@ -74,30 +183,32 @@ type PathError struct {
 
 func (e *PathError) Error() string { return e.Op + " " + e.Path + ": " + e.Err.Error() }
 
-// Open is a super simple stub function (for now), only capable of opening stdin, stdout, and stderr
+// Open opens the named file for reading.
 func Open(name string) (*File, error) {
-	fd := uintptr(999)
-	switch name {
-	case "/dev/stdin":
-		fd = 0
-	case "/dev/stdout":
-		fd = 1
-	case "/dev/stderr":
-		fd = 2
-	default:
-		return nil, &PathError{"open", name, notImplemented}
-	}
-	return &File{fd, name}, nil
+	return OpenFile(name, O_RDONLY, 0)
 }
 
-// OpenFile is a stub, passing through to the stub Open() call
+// OpenFile opens the named file with specified flag (O_RDONLY etc.). Support
+// for opening files depends on the system: some systems can only open stdin,
+// stdout, and stderr, unless a file system has been mounted with Mount.
 func OpenFile(name string, flag int, perm FileMode) (*File, error) {
-	return Open(name)
+	if mount, relname := findMount(name); mount != nil {
+		handle, err := mount.filesystem.OpenFile(relname, flag, perm)
+		if err != nil {
+			return nil, &PathError{"open", name, err}
+		}
+		return &File{name: name, handle: handle}, nil
+	}
+	fd, err := openFile(name, flag, perm)
+	if err != nil {
+		return nil, &PathError{"open", name, err}
+	}
+	return &File{fd: fd, name: name}, nil
 }
 
-// Create is a stub, passing through to the stub Open() call
+// Create creates or truncates the named file.
 func Create(name string) (*File, error) {
-	return Open(name)
+	return OpenFile(name, O_RDWR|O_CREATE|O_TRUNC, 0666)
 }
 
 type FileMode uint32
@@ -126,9 +237,45 @@ const (
 	ModePerm FileMode = 0777 // Unix permission bits
 )
 
-// IsDir is a stub, always returning false
+func (m FileMode) String() string {
+	const str = "dalTLDpSugct?"
+	var buf [32]byte // Mode is uint32.
+	w := 0
+	for i, c := range str {
+		if m&(1<<uint(32-1-i)) != 0 {
+			buf[w] = byte(c)
+			w++
+		}
+	}
+	if w == 0 {
+		buf[w] = '-'
+		w++
+	}
+	const rwx = "rwxrwxrwx"
+	for i, c := range rwx {
+		if m&(1<<uint(9-1-i)) != 0 {
+			buf[w] = byte(c)
+		} else {
+			buf[w] = '-'
+		}
+		w++
+	}
+	return string(buf[:w])
+}
+
+// IsDir reports whether m describes a directory.
 func (m FileMode) IsDir() bool {
-	return false
+	return m&ModeDir != 0
+}
+
+// IsRegular reports whether m describes a regular file.
+func (m FileMode) IsRegular() bool {
+	return m&ModeType == 0
+}
+
+// Perm returns the Unix permission bits in m.
+func (m FileMode) Perm() FileMode {
+	return m & ModePerm
 }
 
 // Stub constants
@@ -145,52 +292,119 @@ const (
 
 // A FileInfo describes a file and is returned by Stat and Lstat.
 type FileInfo interface {
-	Name() string   // base name of the file
-	Size() int64    // length in bytes for regular files; system-dependent for others
-	Mode() FileMode // file mode bits
-	// ModTime() time.Time // modification time
-	IsDir() bool      // abbreviation for Mode().IsDir()
-	Sys() interface{} // underlying data source (can return nil)
+	Name() string       // base name of the file
+	Size() int64        // length in bytes for regular files; system-dependent for others
+	Mode() FileMode     // file mode bits
+	ModTime() time.Time // modification time
+	IsDir() bool        // abbreviation for Mode().IsDir()
+	Sys() interface{}   // underlying data source (can return nil)
 }
 
-// Stat is a stub, not yet implemented
+// Stat returns a FileInfo describing the named file.
 func Stat(name string) (FileInfo, error) {
-	return nil, notImplemented
+	if mount, relname := findMount(name); mount != nil {
+		info, err := mount.filesystem.Stat(relname)
+		if err != nil {
+			return nil, &PathError{"stat", name, err}
+		}
+		return info, nil
+	}
+	return stat(name)
 }
 
-// Lstat is a stub, not yet implemented
+// Lstat returns a FileInfo describing the named file. If the file is a
+// symbolic link, the returned FileInfo describes the symbolic link. Mounted
+// file systems do not support symbolic links, so Lstat is the same as Stat for
+// them.
 func Lstat(name string) (FileInfo, error) {
-	return nil, notImplemented
+	if mount, relname := findMount(name); mount != nil {
+		info, err := mount.filesystem.Stat(relname)
+		if err != nil {
+			return nil, &PathError{"lstat", name, err}
+		}
+		return info, nil
+	}
+	return lstat(name)
 }
 
-// Getwd is a stub (for now), always returning an empty string
-func Getwd() (string, error) {
-	return "", nil
+// Mkdir creates a new directory with the specified name and permission bits
+// (before umask).
+func Mkdir(name string, perm FileMode) error {
+	if mount, relname := findMount(name); mount != nil {
+		if err := mount.filesystem.Mkdir(relname, perm); err != nil {
+			return &PathError{"mkdir", name, err}
+		}
+		return nil
+	}
+	return mkdir(name, perm)
 }
 
-// Readlink is a stub (for now), always returning the string it was given
-func Readlink(name string) (string, error) {
-	return name, nil
+// Remove removes the named file or (empty) directory.
+func Remove(name string) error {
+	if mount, relname := findMount(name); mount != nil {
+		if err := mount.filesystem.Remove(relname); err != nil {
+			return &PathError{"remove", name, err}
+		}
+		return nil
+	}
+	return remove(name)
 }
 
-// TempDir is a stub (for now), always returning the string "/tmp"
-func TempDir() string {
-	return "/tmp"
+// Rename renames (moves) oldpath to newpath. If newpath already exists and is
+// not a directory, Rename replaces it. Files cannot be moved between different
+// mounted file systems.
+func Rename(oldpath, newpath string) error {
+	oldmount, oldrel := findMount(oldpath)
+	newmount, newrel := findMount(newpath)
+	if oldmount != newmount {
+		return &LinkError{"rename", oldpath, newpath, syscall.EXDEV}
+	}
+	if oldmount != nil {
+		if err := oldmount.filesystem.Rename(oldrel, newrel); err != nil {
+			return &LinkError{"rename", oldpath, newpath, err}
+		}
+		return nil
+	}
+	return rename(oldpath, newpath)
 }
 
-// Mkdir is a stub, not yet implemented
-func Mkdir(name string, perm FileMode) error {
-	return notImplemented
+// A fileStat is the implementation of FileInfo returned by Stat and Lstat.
+type fileStat struct {
+	name    string
+	size    int64
+	mode    FileMode
+	modTime time.Time
+	sys     interface{}
 }
 
-// IsExist is a stub (for now), always returning false
-func IsExist(err error) bool {
-	return false
+func (fs *fileStat) Name() string       { return fs.name }
+func (fs *fileStat) Size() int64        { return fs.size }
+func (fs *fileStat) Mode() FileMode     { return fs.mode }
+func (fs *fileStat) ModTime() time.Time { return fs.modTime }
+func (fs *fileStat) IsDir() bool        { return fs.mode.IsDir() }
+func (fs *fileStat) Sys() interface{}   { return fs.sys }
+
+// basename removes trailing slashes and the leading directory name from path
+// name.
+func basename(name string) string {
+	i := len(name) - 1
+	// Remove trailing slashes
+	for ; i > 0 && name[i] == '/'; i-- {
+		name = name[:i]
+	}
+	// Remove leading directory name
+	for i--; i >= 0; i-- {
+		if name[i] == '/' {
+			name = name[i+1:]
+			break
+		}
+	}
+	return name
 }
 
-// IsNotExist is a stub (for now), always returning false
-func IsNotExist(err error) bool {
-	return false
+// TempDir is a stub (for now), always returning the string "/tmp"
+func TempDir() string {
+	return "/tmp"
 }
 
 // Getpid is a stub (for now), always returning 1
@@ -0,0 +1,57 @@
+// +build baremetal wasm
+
+package os
+
+// This file implements the file system functions for systems without a file
+// system (or without one that can be accessed through the syscall package).
+// File systems can still be mounted on these systems, see Mount.
+
+// stat is unsupported on this system.
+func stat(name string) (FileInfo, error) {
+	return nil, &PathError{"stat", name, errUnsupported}
+}
+
+// lstat is unsupported on this system.
+func lstat(name string) (FileInfo, error) {
+	return nil, &PathError{"lstat", name, errUnsupported}
+}
+
+// stat is unsupported on this system.
+func (f *File) stat() (FileInfo, error) {
+	return nil, &PathError{"stat", f.name, errUnsupported}
+}
+
+// readdirnames is unsupported on this system.
+func (f *File) readdirnames(n int) (names []string, err error) {
+	return nil, &PathError{"readdirent", f.name, errUnsupported}
+}
+
+// mkdir is unsupported on this system.
+func mkdir(name string, perm FileMode) error {
+	return &PathError{"mkdir", name, errUnsupported}
+}
+
+// remove is unsupported on this system.
+func remove(name string) error {
+	return &PathError{"remove", name, errUnsupported}
+}
+
+// rename is unsupported on this system.
+func rename(oldpath, newpath string) error {
+	return &LinkError{"rename", oldpath, newpath, errUnsupported}
+}
+
+// Chdir is unsupported on this system.
+func Chdir(dir string) error {
+	return &PathError{"chdir", dir, errUnsupported}
+}
+
+// Getwd is unsupported on this system.
+func Getwd() (dir string, err error) {
+	return "", errUnsupported
+}
+
+// Readlink is unsupported on this system.
+func Readlink(name string) (string, error) {
+	return "", &PathError{"readlink", name, errUnsupported}
+}
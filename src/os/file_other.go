@@ -1,4 +1,4 @@
-// +build baremetal wasm
+// +build baremetal,!qemu baremetal,!cortexm wasm,!wasi
 
 package os
 
@@ -6,14 +6,28 @@ import (
 	_ "unsafe"
 )
 
-// Read is unsupported on this system.
-func (f *File) Read(b []byte) (n int, err error) {
+// openFile is only capable of opening stdin, stdout, and stderr on this system.
+func openFile(name string, flag int, perm FileMode) (uintptr, error) {
+	switch name {
+	case "/dev/stdin":
+		return 0, nil
+	case "/dev/stdout":
+		return 1, nil
+	case "/dev/stderr":
+		return 2, nil
+	default:
+		return 0, notImplemented
+	}
+}
+
+// read is unsupported on this system.
+func (f *File) read(b []byte) (n int, err error) {
 	return 0, errUnsupported
 }
 
-// Write writes len(b) bytes to the output. It returns the number of bytes
+// write writes len(b) bytes to the output. It returns the number of bytes
 // written or an error if this file is not stdout or stderr.
-func (f *File) Write(b []byte) (n int, err error) {
+func (f *File) write(b []byte) (n int, err error) {
 	switch f.fd {
 	case Stdout.fd, Stderr.fd:
 		for _, c := range b {
@@ -25,8 +39,13 @@ func (f *File) Write(b []byte) (n int, err error) {
 	}
 }
 
-// Close is unsupported on this system.
-func (f *File) Close() error {
+// seek is unsupported on this system.
+func (f *File) seek(offset int64, whence int) (ret int64, err error) {
+	return 0, errUnsupported
+}
+
+// close is unsupported on this system.
+func (f *File) close() error {
 	return errUnsupported
 }
 
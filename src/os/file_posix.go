@@ -0,0 +1,222 @@
+// +build darwin linux,!baremetal,!wasi
+
+package os
+
+import (
+	"io"
+	"syscall"
+)
+
+// Size of the buffer used to read directory entries.
+const direntBufSize = 8192
+
+// stat returns a FileInfo describing the named file.
+func stat(name string) (FileInfo, error) {
+	var st syscall.Stat_t
+	err := ignoringEINTR(func() error {
+		return syscall.Stat(name, &st)
+	})
+	if err != nil {
+		return nil, &PathError{"stat", name, err}
+	}
+	return newFileStat(basename(name), &st), nil
+}
+
+// lstat returns a FileInfo describing the named file. If the file is a
+// symbolic link, the returned FileInfo describes the symbolic link.
+func lstat(name string) (FileInfo, error) {
+	var st syscall.Stat_t
+	err := ignoringEINTR(func() error {
+		return syscall.Lstat(name, &st)
+	})
+	if err != nil {
+		return nil, &PathError{"lstat", name, err}
+	}
+	return newFileStat(basename(name), &st), nil
+}
+
+// stat returns the FileInfo structure describing the file descriptor.
+func (f *File) stat() (FileInfo, error) {
+	var st syscall.Stat_t
+	err := ignoringEINTR(func() error {
+		return syscall.Fstat(int(f.fd), &st)
+	})
+	if err != nil {
+		return nil, &PathError{"stat", f.name, err}
+	}
+	return newFileStat(basename(f.name), &st), nil
+}
+
+// readdirnames reads up to n names from the directory associated with the file
+// descriptor, or all remaining names if n <= 0.
+func (f *File) readdirnames(n int) (names []string, err error) {
+	if f.dirinfo == nil {
+		f.dirinfo = &dirInfo{
+			buf: make([]byte, direntBufSize),
+		}
+	}
+	d := f.dirinfo
+
+	size := n
+	if size <= 0 {
+		size = 100
+		n = -1
+	}
+
+	names = make([]string, 0, size)
+	for n != 0 {
+		// Refill the buffer if necessary.
+		if d.bufp >= d.nbuf {
+			d.bufp = 0
+			var errno error
+			d.nbuf, errno = syscall.ReadDirent(int(f.fd), d.buf)
+			if errno != nil {
+				return names, &PathError{"readdirent", f.name, errno}
+			}
+			if d.nbuf <= 0 {
+				break // EOF
+			}
+		}
+
+		// Drain the buffer.
+		var nb, nc int
+		nb, nc, names = syscall.ParseDirent(d.buf[d.bufp:d.nbuf], n, names)
+		d.bufp += nb
+		n -= nc
+	}
+	if n >= 0 && len(names) == 0 {
+		return names, io.EOF
+	}
+	return names, nil
+}
+
+// mkdir creates a new directory with the specified name and permission bits
+// (before umask).
+func mkdir(name string, perm FileMode) error {
+	err := syscall.Mkdir(name, syscallMode(perm))
+	if err != nil {
+		return &PathError{"mkdir", name, err}
+	}
+	return nil
+}
+
+// remove removes the named file or (empty) directory.
+func remove(name string) error {
+	// System call interface forces us to know whether name is a file or
+	// directory. Try both: it is cheaper on average than doing a Stat plus
+	// the right one.
+	e := syscall.Unlink(name)
+	if e == nil {
+		return nil
+	}
+	e1 := syscall.Rmdir(name)
+	if e1 == nil {
+		return nil
+	}
+
+	// Both failed: figure out which error to return. Unlink reports EISDIR or
+	// EPERM for directories, in which case the error of Rmdir is more useful.
+	if e1 != syscall.ENOTDIR {
+		e = e1
+	}
+	return &PathError{"remove", name, e}
+}
+
+// rename renames (moves) oldpath to newpath. If newpath already exists and is
+// not a directory, it is replaced.
+func rename(oldpath, newpath string) error {
+	err := syscall.Rename(oldpath, newpath)
+	if err != nil {
+		return &LinkError{"rename", oldpath, newpath, err}
+	}
+	return nil
+}
+
+// Chdir changes the current working directory to the named directory.
+func Chdir(dir string) error {
+	if err := syscall.Chdir(dir); err != nil {
+		return &PathError{"chdir", dir, err}
+	}
+	return nil
+}
+
+// Getwd returns a rooted path name corresponding to the current directory.
+func Getwd() (dir string, err error) {
+	return syscall.Getwd()
+}
+
+// Readlink returns the destination of the named symbolic link.
+func Readlink(name string) (string, error) {
+	for size := 128; ; size *= 2 {
+		b := make([]byte, size)
+		n, err := syscall.Readlink(name, b)
+		if err != nil {
+			return "", &PathError{"readlink", name, err}
+		}
+		if n < size {
+			return string(b[0:n]), nil
+		}
+	}
+}
+
+// newFileStat converts a syscall.Stat_t to a FileInfo.
+func newFileStat(name string, st *syscall.Stat_t) *fileStat {
+	fs := &fileStat{
+		name:    name,
+		size:    int64(st.Size),
+		mode:    FileMode(st.Mode & 0777),
+		modTime: modTime(st),
+		sys:     st,
+	}
+	switch st.Mode & syscall.S_IFMT {
+	case syscall.S_IFBLK:
+		fs.mode |= ModeDevice
+	case syscall.S_IFCHR:
+		fs.mode |= ModeDevice | ModeCharDevice
+	case syscall.S_IFDIR:
+		fs.mode |= ModeDir
+	case syscall.S_IFIFO:
+		fs.mode |= ModeNamedPipe
+	case syscall.S_IFLNK:
+		fs.mode |= ModeSymlink
+	case syscall.S_IFSOCK:
+		fs.mode |= ModeSocket
+	}
+	if st.Mode&syscall.S_ISGID != 0 {
+		fs.mode |= ModeSetgid
+	}
+	if st.Mode&syscall.S_ISUID != 0 {
+		fs.mode |= ModeSetuid
+	}
+	if st.Mode&syscall.S_ISVTX != 0 {
+		fs.mode |= ModeSticky
+	}
+	return fs
+}
+
+// syscallMode returns the syscall-specific mode bits from Go's portable mode
+// bits.
+func syscallMode(i FileMode) (o uint32) {
+	o |= uint32(i.Perm())
+	if i&ModeSetuid != 0 {
+		o |= syscall.S_ISUID
+	}
+	if i&ModeSetgid != 0 {
+		o |= syscall.S_ISGID
+	}
+	if i&ModeSticky != 0 {
+		o |= syscall.S_ISVTX
+	}
+	return
+}
+
+// ignoringEINTR makes a function call and repeats it if it returns an EINTR
+// error.
+func ignoringEINTR(fn func() error) error {
+	for {
+		err := fn()
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// +build cortexm,qemu
+
+package os
+
+// This file implements files for Cortex-M programs running in QEMU: files are
+// opened on the host through semihosting, and stdin is the console of QEMU.
+// Standard output is written to the UART like on other baremetal systems, so
+// that it is not reordered with the output of println.
+
+import (
+	"io"
+	"syscall"
+	_ "unsafe"
+)
+
+// openFile opens the named file on the host using semihosting.
+func openFile(name string, flag int, perm FileMode) (uintptr, error) {
+	switch name {
+	case "/dev/stdin":
+		return 0, nil
+	case "/dev/stdout":
+		return 1, nil
+	case "/dev/stderr":
+		return 2, nil
+	}
+
+	var mode int
+	switch {
+	case flag&O_RDWR != 0:
+		mode = syscall.O_RDWR
+	case flag&O_WRONLY != 0:
+		mode = syscall.O_WRONLY
+	default:
+		mode = syscall.O_RDONLY
+	}
+	if flag&O_APPEND != 0 {
+		mode |= syscall.O_APPEND
+	}
+	if flag&O_CREATE != 0 {
+		mode |= syscall.O_CREAT
+	}
+	if flag&O_EXCL != 0 {
+		mode |= syscall.O_EXCL
+	}
+	if flag&O_TRUNC != 0 {
+		mode |= syscall.O_TRUNC
+	}
+	fd, err := syscall.Open(name, mode, uint32(perm&ModePerm))
+	if err != nil {
+		return 0, err
+	}
+	return uintptr(fd), nil
+}
+
+// read reads up to len(b) bytes from the file or the console. At end of file,
+// it returns 0, io.EOF.
+func (f *File) read(b []byte) (n int, err error) {
+	n, err = syscall.Read(int(f.fd), b)
+	if n == 0 && len(b) > 0 && err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+// write writes len(b) bytes to the file or the UART.
+func (f *File) write(b []byte) (n int, err error) {
+	switch f.fd {
+	case Stdout.fd, Stderr.fd:
+		for _, c := range b {
+			putchar(c)
+		}
+		return len(b), nil
+	default:
+		return syscall.Write(int(f.fd), b)
+	}
+}
+
+// seek sets the offset of the file.
+func (f *File) seek(offset int64, whence int) (ret int64, err error) {
+	return syscall.Seek(int(f.fd), offset, whence)
+}
+
+// close closes the file.
+func (f *File) close() error {
+	return syscall.Close(int(f.fd))
+}
+
+//go:linkname putchar runtime.putchar
+func putchar(c byte)
@@ -3,22 +3,65 @@
 package os
 
 import (
+	"io"
 	"syscall"
 )
 
-// Read reads up to len(b) bytes from the File. It returns the number of bytes
-// read and any error encountered. At end of file, Read returns 0, io.EOF.
-func (f *File) Read(b []byte) (n int, err error) {
-	return syscall.Read(int(f.fd), b)
+// openFile opens the named file using the open system call, after converting
+// the os flags to the flags of the syscall package.
+func openFile(name string, flag int, perm FileMode) (uintptr, error) {
+	var mode int
+	switch {
+	case flag&O_RDWR != 0:
+		mode = syscall.O_RDWR
+	case flag&O_WRONLY != 0:
+		mode = syscall.O_WRONLY
+	default:
+		mode = syscall.O_RDONLY
+	}
+	if flag&O_APPEND != 0 {
+		mode |= syscall.O_APPEND
+	}
+	if flag&O_CREATE != 0 {
+		mode |= syscall.O_CREAT
+	}
+	if flag&O_EXCL != 0 {
+		mode |= syscall.O_EXCL
+	}
+	if flag&O_SYNC != 0 {
+		mode |= syscall.O_SYNC
+	}
+	if flag&O_TRUNC != 0 {
+		mode |= syscall.O_TRUNC
+	}
+	fd, err := syscall.Open(name, mode, uint32(perm&ModePerm))
+	if err != nil {
+		return 0, err
+	}
+	return uintptr(fd), nil
 }
 
-// Write writes len(b) bytes to the File. It returns the number of bytes written
-// and an error, if any. Write returns a non-nil error when n != len(b).
-func (f *File) Write(b []byte) (n int, err error) {
+// read reads up to len(b) bytes from the file descriptor. At end of file, it
+// returns 0, io.EOF.
+func (f *File) read(b []byte) (n int, err error) {
+	n, err = syscall.Read(int(f.fd), b)
+	if n == 0 && len(b) > 0 && err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+// write writes len(b) bytes to the file descriptor.
+func (f *File) write(b []byte) (n int, err error) {
 	return syscall.Write(int(f.fd), b)
 }
 
-// Close closes the File, rendering it unusable for I/O.
-func (f *File) Close() error {
+// seek sets the offset of the file descriptor.
+func (f *File) seek(offset int64, whence int) (ret int64, err error) {
+	return syscall.Seek(int(f.fd), offset, whence)
+}
+
+// close closes the file descriptor.
+func (f *File) close() error {
 	return syscall.Close(int(f.fd))
 }
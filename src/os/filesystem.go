@@ -0,0 +1,117 @@
+package os
+
+import (
+	"path"
+	"strings"
+)
+
+// Filesystem is a file system that can be mounted with Mount, for example a
+// file system on SPI flash or an SD card.
+//
+// Paths passed to a Filesystem are relative to the mount point and cleaned
+// like path.Clean, without a leading slash: the root of the file system is
+// ".". Errors should not include the path (they are wrapped in a *PathError by
+// the os package), and should be ErrNotExist, ErrExist or ErrPermission, or a
+// syscall.Errno, so that IsNotExist and similar functions work as expected.
+type Filesystem interface {
+	// OpenFile opens the named file with the given flag (O_RDONLY etc.),
+	// creating it with the given permission bits if O_CREATE is set.
+	OpenFile(name string, flag int, perm FileMode) (FileHandle, error)
+
+	// Stat returns a FileInfo describing the named file.
+	Stat(name string) (FileInfo, error)
+
+	// Mkdir creates a new directory.
+	Mkdir(name string, perm FileMode) error
+
+	// Remove removes the named file or (empty) directory.
+	Remove(name string) error
+
+	// Rename renames (moves) a file or directory in this file system.
+	Rename(oldname, newname string) error
+}
+
+// FileHandle is a file opened by a Filesystem.
+type FileHandle interface {
+	Read(b []byte) (n int, err error)
+	Write(b []byte) (n int, err error)
+	Close() error
+
+	// Stat returns a FileInfo describing the file.
+	Stat() (FileInfo, error)
+
+	// Readdir reads up to n entries from the directory, or all remaining
+	// entries if n <= 0. It behaves like File.Readdir.
+	Readdir(n int) ([]FileInfo, error)
+}
+
+// A mountPoint is a Filesystem mounted with Mount.
+type mountPoint struct {
+	prefix     string
+	filesystem Filesystem
+}
+
+// List of mount points, sorted with the longest prefix first.
+var mounts []mountPoint
+
+// Mount mounts the file system at the given absolute path prefix. Files opened
+// with Open, OpenFile and Create and paths passed to Stat, Lstat, Mkdir,
+// Remove and Rename are handled by the file system if they start with the
+// prefix. Mount points take precedence over the file system of the operating
+// system, if there is one.
+func Mount(prefix string, filesystem Filesystem) error {
+	if prefix == "" || prefix[0] != '/' {
+		return &PathError{"mount", prefix, ErrInvalid}
+	}
+	prefix = path.Clean(prefix)
+	for _, mount := range mounts {
+		if mount.prefix == prefix {
+			return &PathError{"mount", prefix, ErrExist}
+		}
+	}
+
+	// Insert the mount point so that longer prefixes are tried first.
+	i := 0
+	for i < len(mounts) && len(mounts[i].prefix) >= len(prefix) {
+		i++
+	}
+	mounts = append(mounts, mountPoint{})
+	copy(mounts[i+1:], mounts[i:])
+	mounts[i] = mountPoint{prefix, filesystem}
+	return nil
+}
+
+// Unmount removes the file system mounted at the given path prefix. Files that
+// are still open remain usable.
+func Unmount(prefix string) error {
+	cleaned := path.Clean(prefix)
+	for i, mount := range mounts {
+		if mount.prefix == cleaned {
+			mounts = append(mounts[:i], mounts[i+1:]...)
+			return nil
+		}
+	}
+	return &PathError{"unmount", prefix, ErrNotExist}
+}
+
+// findMount returns the mount point that handles the given path and the path
+// relative to the mount point, or nil if the path is not inside a mount point.
+func findMount(name string) (*mountPoint, string) {
+	if len(mounts) == 0 || name == "" || name[0] != '/' {
+		return nil, ""
+	}
+	name = path.Clean(name)
+	for i := range mounts {
+		mount := &mounts[i]
+		if name == mount.prefix {
+			return mount, "."
+		}
+		if mount.prefix == "/" {
+			return mount, name[1:]
+		}
+		if strings.HasPrefix(name, mount.prefix) && name[len(mount.prefix)] == '/' {
+			return mount, name[len(mount.prefix)+1:]
+		}
+	}
+	return nil, ""
+}
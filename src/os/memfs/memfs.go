@@ -0,0 +1,378 @@
+// Package memfs implements an in-memory file system that can be mounted with
+// os.Mount. It is mostly useful for tests, on the host and in emulators, of
+// code that reads and writes files.
+//
+//     fs := memfs.New()
+//     os.Mount("/data", fs)
+//     f, err := os.Create("/data/config.txt")
+package memfs
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FS is an in-memory file system. The zero value is not usable, use New to
+// create one.
+type FS struct {
+	lock sync.Mutex
+	root *node
+}
+
+// A node is a file or directory in the file system.
+type node struct {
+	name     string
+	mode     os.FileMode
+	modTime  time.Time
+	data     []byte           // file contents
+	children map[string]*node // directory entries
+}
+
+// New creates a new, empty, in-memory file system.
+func New() *FS {
+	return &FS{
+		root: &node{
+			name:     "/",
+			mode:     os.ModeDir | 0777,
+			modTime:  time.Now(),
+			children: map[string]*node{},
+		},
+	}
+}
+
+// split splits a path into its components, ignoring empty and "." components.
+func split(name string) []string {
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// lookup returns the node at the given path.
+func (fs *FS) lookup(name string) (*node, error) {
+	n := fs.root
+	for _, part := range split(name) {
+		if !n.mode.IsDir() {
+			return nil, syscall.ENOTDIR
+		}
+		if part == ".." {
+			// Paths are cleaned by the os package, so this can only happen
+			// above the root.
+			return nil, syscall.EINVAL
+		}
+		child, ok := n.children[part]
+		if !ok {
+			return nil, syscall.ENOENT
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// lookupParent returns the directory that contains the given path and the
+// name of the path in that directory.
+func (fs *FS) lookupParent(name string) (*node, string, error) {
+	parts := split(name)
+	if len(parts) == 0 {
+		// The root has no parent.
+		return nil, "", syscall.EINVAL
+	}
+	dir, err := fs.lookup(strings.Join(parts[:len(parts)-1], "/"))
+	if err != nil {
+		return nil, "", err
+	}
+	if !dir.mode.IsDir() {
+		return nil, "", syscall.ENOTDIR
+	}
+	return dir, parts[len(parts)-1], nil
+}
+
+// OpenFile opens the named file, see os.OpenFile.
+func (fs *FS) OpenFile(name string, flag int, perm os.FileMode) (os.FileHandle, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	n, err := fs.lookup(name)
+	if err == syscall.ENOENT && flag&os.O_CREATE != 0 {
+		dir, base, err := fs.lookupParent(name)
+		if err != nil {
+			return nil, err
+		}
+		n = &node{
+			name:    base,
+			mode:    perm & os.ModePerm,
+			modTime: time.Now(),
+		}
+		dir.children[base] = n
+	} else if err != nil {
+		return nil, err
+	} else if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, syscall.EEXIST
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if n.mode.IsDir() && writable {
+		return nil, syscall.EISDIR
+	}
+	if flag&os.O_TRUNC != 0 && writable {
+		n.data = nil
+		n.modTime = time.Now()
+	}
+	return &handle{
+		fs:       fs,
+		node:     n,
+		readable: flag&os.O_WRONLY == 0,
+		writable: writable,
+		append:   flag&os.O_APPEND != 0,
+	}, nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func (fs *FS) Stat(name string) (os.FileInfo, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	n, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(), nil
+}
+
+// Mkdir creates a new directory.
+func (fs *FS) Mkdir(name string, perm os.FileMode) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if len(split(name)) == 0 {
+		return syscall.EEXIST // the root
+	}
+	dir, base, err := fs.lookupParent(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.children[base]; ok {
+		return syscall.EEXIST
+	}
+	dir.children[base] = &node{
+		name:     base,
+		mode:     os.ModeDir | perm&os.ModePerm,
+		modTime:  time.Now(),
+		children: map[string]*node{},
+	}
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (fs *FS) Remove(name string) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	dir, base, err := fs.lookupParent(name)
+	if err != nil {
+		return err
+	}
+	n, ok := dir.children[base]
+	if !ok {
+		return syscall.ENOENT
+	}
+	if len(n.children) != 0 {
+		return syscall.ENOTEMPTY
+	}
+	delete(dir.children, base)
+	return nil
+}
+
+// Rename renames (moves) a file or directory. If newname already exists, it
+// is replaced unless it is a non-empty directory.
+func (fs *FS) Rename(oldname, newname string) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	olddir, oldbase, err := fs.lookupParent(oldname)
+	if err != nil {
+		return err
+	}
+	n, ok := olddir.children[oldbase]
+	if !ok {
+		return syscall.ENOENT
+	}
+	newdir, newbase, err := fs.lookupParent(newname)
+	if err != nil {
+		return err
+	}
+	if n.mode.IsDir() {
+		// A directory cannot be moved inside itself.
+		oldpath := strings.Join(split(oldname), "/") + "/"
+		newpath := strings.Join(split(newname), "/") + "/"
+		if newpath != oldpath && strings.HasPrefix(newpath, oldpath) {
+			return syscall.EINVAL
+		}
+	}
+	if existing, ok := newdir.children[newbase]; ok {
+		if existing == n {
+			return nil
+		}
+		if existing.mode.IsDir() != n.mode.IsDir() {
+			if existing.mode.IsDir() {
+				return syscall.EISDIR
+			}
+			return syscall.ENOTDIR
+		}
+		if len(existing.children) != 0 {
+			return syscall.ENOTEMPTY
+		}
+	}
+	delete(olddir.children, oldbase)
+	n.name = newbase
+	newdir.children[newbase] = n
+	return nil
+}
+
+// info returns a snapshot of the file information of this node.
+func (n *node) info() *fileInfo {
+	return &fileInfo{
+		name:    n.name,
+		size:    int64(len(n.data)),
+		mode:    n.mode,
+		modTime: n.modTime,
+	}
+}
+
+// fileInfo implements os.FileInfo.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+// handle is an open file or directory, it implements os.FileHandle.
+type handle struct {
+	fs       *FS
+	node     *node
+	offset   int64
+	readable bool
+	writable bool
+	append   bool
+	closed   bool
+	entries  []string // directory entries not yet returned by Readdir
+	listed   bool     // whether entries has been filled
+}
+
+func (h *handle) Read(b []byte) (n int, err error) {
+	h.fs.lock.Lock()
+	defer h.fs.lock.Unlock()
+
+	if h.closed || !h.readable {
+		return 0, syscall.EBADF
+	}
+	if h.node.mode.IsDir() {
+		return 0, syscall.EISDIR
+	}
+	if h.offset >= int64(len(h.node.data)) {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n = copy(b, h.node.data[h.offset:])
+	h.offset += int64(n)
+	return n, nil
+}
+
+func (h *handle) Write(b []byte) (n int, err error) {
+	h.fs.lock.Lock()
+	defer h.fs.lock.Unlock()
+
+	if h.closed || !h.writable {
+		return 0, syscall.EBADF
+	}
+	if h.append {
+		h.offset = int64(len(h.node.data))
+	}
+	end := h.offset + int64(len(b))
+	if end > int64(len(h.node.data)) {
+		// Grow the file.
+		data := make([]byte, end, end+end/2)
+		copy(data, h.node.data)
+		h.node.data = data
+	}
+	copy(h.node.data[h.offset:], b)
+	h.node.modTime = time.Now()
+	h.offset = end
+	return len(b), nil
+}
+
+func (h *handle) Close() error {
+	h.fs.lock.Lock()
+	defer h.fs.lock.Unlock()
+
+	if h.closed {
+		return syscall.EBADF
+	}
+	h.closed = true
+	return nil
+}
+
+func (h *handle) Stat() (os.FileInfo, error) {
+	h.fs.lock.Lock()
+	defer h.fs.lock.Unlock()
+
+	if h.closed {
+		return nil, syscall.EBADF
+	}
+	return h.node.info(), nil
+}
+
+// Readdir returns up to n entries of the directory, sorted by name. If n <= 0,
+// it returns all remaining entries.
+func (h *handle) Readdir(n int) ([]os.FileInfo, error) {
+	h.fs.lock.Lock()
+	defer h.fs.lock.Unlock()
+
+	if h.closed {
+		return nil, syscall.EBADF
+	}
+	if !h.node.mode.IsDir() {
+		return nil, syscall.ENOTDIR
+	}
+	if !h.listed {
+		h.listed = true
+		for name := range h.node.children {
+			h.entries = append(h.entries, name)
+		}
+		sort.Strings(h.entries)
+	}
+
+	var infos []os.FileInfo
+	for len(h.entries) != 0 && (n <= 0 || len(infos) < n) {
+		child, ok := h.node.children[h.entries[0]]
+		h.entries = h.entries[1:]
+		if !ok {
+			// Removed after the directory was opened.
+			continue
+		}
+		infos = append(infos, child.info())
+	}
+	if n > 0 && len(infos) == 0 {
+		return nil, io.EOF
+	}
+	return infos, nil
+}
@@ -0,0 +1,124 @@
+package os
+
+import (
+	"io"
+	"syscall"
+)
+
+// MkdirAll creates a directory named path, along with any necessary parents,
+// and returns nil, or else returns an error. The permission bits perm (before
+// umask) are used for all directories that MkdirAll creates. If path is
+// already a directory, MkdirAll does nothing and returns nil.
+func MkdirAll(path string, perm FileMode) error {
+	// Fast path: if we can tell whether path is a directory or file, stop with
+	// success or error.
+	dir, err := Stat(path)
+	if err == nil {
+		if dir.IsDir() {
+			return nil
+		}
+		return &PathError{"mkdir", path, syscall.ENOTDIR}
+	}
+
+	// Slow path: make sure parent exists and then call Mkdir for path.
+	i := len(path)
+	for i > 0 && IsPathSeparator(path[i-1]) { // Skip trailing path separator.
+		i--
+	}
+
+	j := i
+	for j > 0 && !IsPathSeparator(path[j-1]) { // Scan backward over element.
+		j--
+	}
+
+	if j > 1 {
+		// Create parent.
+		err = MkdirAll(path[:j-1], perm)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Parent now exists; invoke Mkdir and use its result.
+	err = Mkdir(path, perm)
+	if err != nil {
+		// Handle arguments like "foo/." by double-checking that directory
+		// doesn't exist.
+		dir, err1 := Lstat(path)
+		if err1 == nil && dir.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveAll removes path and any children it contains. It removes everything
+// it can but returns the first error it encounters. If the path does not
+// exist, RemoveAll returns nil (no error).
+func RemoveAll(path string) error {
+	if path == "" {
+		// Fail silently to retain compatibility with previous behavior of
+		// RemoveAll.
+		return nil
+	}
+
+	// Simple case: if Remove works, we're done.
+	err := Remove(path)
+	if err == nil || IsNotExist(err) {
+		return nil
+	}
+
+	// Otherwise, is this a directory we need to recurse into?
+	dir, serr := Lstat(path)
+	if serr != nil {
+		if IsNotExist(serr) {
+			return nil
+		}
+		return serr
+	}
+	if !dir.IsDir() {
+		// Not a directory; return the error from Remove.
+		return err
+	}
+
+	// Remove contents & return first error.
+	err = nil
+	for {
+		fd, err1 := Open(path)
+		if err1 != nil {
+			if IsNotExist(err1) {
+				// Already deleted by someone else.
+				return nil
+			}
+			return err1
+		}
+		names, err1 := fd.Readdirnames(100)
+		for _, name := range names {
+			err2 := RemoveAll(path + string(PathSeparator) + name)
+			if err == nil {
+				err = err2
+			}
+		}
+		fd.Close()
+		if err1 == io.EOF || len(names) == 0 {
+			break
+		}
+		if err1 != nil {
+			if err == nil {
+				err = err1
+			}
+			break
+		}
+	}
+
+	// Remove directory.
+	err1 := Remove(path)
+	if err1 == nil || IsNotExist(err1) {
+		return nil
+	}
+	if err == nil {
+		err = err1
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package os
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// SyscallConn returns a raw file. This implements the syscall.Conn interface.
+func (f *File) SyscallConn() (syscall.RawConn, error) {
+	if f.handle != nil {
+		// Files of mounted file systems have no file descriptor.
+		return nil, &PathError{"SyscallConn", f.name, errUnsupported}
+	}
+	return &rawConn{file: f}, nil
+}
+
+// rawConn implements syscall.RawConn. The functions passed to Read and Write
+// are called again whenever the file descriptor may have become ready, until
+// they return true.
+type rawConn struct {
+	file *File
+}
+
+func (c *rawConn) Control(f func(uintptr)) error {
+	f(c.file.fd)
+	return nil
+}
+
+func (c *rawConn) Read(f func(uintptr) bool) error {
+	for !f(c.file.fd) {
+		c.wait('r')
+	}
+	return nil
+}
+
+func (c *rawConn) Write(f func(uintptr) bool) error {
+	for !f(c.file.fd) {
+		c.wait('w')
+	}
+	return nil
+}
+
+// wait waits until the file descriptor may be ready for reading (mode 'r') or
+// writing (mode 'w') using the network poller of the runtime. If it cannot be
+// polled, other goroutines get a chance to run before it is tried again.
+func (c *rawConn) wait(mode int) {
+	if !runtime_pollWaitFD(c.file.fd, mode) {
+		runtime.Gosched()
+	}
+}
+
+func runtime_pollWaitFD(fd uintptr, mode int) bool // in package runtime
@@ -0,0 +1,13 @@
+// +build darwin
+
+package os
+
+import (
+	"syscall"
+	"time"
+)
+
+// modTime returns the modification time stored in a syscall.Stat_t.
+func modTime(st *syscall.Stat_t) time.Time {
+	return time.Unix(int64(st.Mtimespec.Sec), int64(st.Mtimespec.Nsec))
+}
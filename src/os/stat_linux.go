@@ -0,0 +1,13 @@
+// +build linux,!baremetal,!wasi
+
+package os
+
+import (
+	"syscall"
+	"time"
+)
+
+// modTime returns the modification time stored in a syscall.Stat_t.
+func modTime(st *syscall.Stat_t) time.Time {
+	return time.Unix(int64(st.Mtim.Sec), int64(st.Mtim.Nsec))
+}
@@ -0,0 +1,23 @@
+// +build linux,!baremetal,!wasi
+
+package os
+
+// hostname reads the host name from /proc, like the Go standard library does.
+func hostname() (name string, err error) {
+	f, err := Open("/proc/sys/kernel/hostname")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var buf [512]byte // Enough for a DNS name.
+	n, err := f.Read(buf[:])
+	if err != nil {
+		return "", err
+	}
+
+	if n > 0 && buf[n-1] == '\n' {
+		n--
+	}
+	return string(buf[:n]), nil
+}
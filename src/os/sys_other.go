@@ -0,0 +1,8 @@
+// +build !linux baremetal wasi
+
+package os
+
+// hostname is unsupported on this system.
+func hostname() (name string, err error) {
+	return "", errUnsupported
+}
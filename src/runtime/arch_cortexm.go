@@ -4,6 +4,7 @@ package runtime
 
 import (
 	"device/arm"
+	"runtime/interrupt"
 )
 
 const GOARCH = "arm"
@@ -19,3 +20,16 @@ func align(ptr uintptr) uintptr {
 func getCurrentStackPointer() uintptr {
 	return arm.ReadRegister("sp")
 }
+
+// waitForInterrupt sleeps until an interrupt happens, which may have made a
+// goroutine runnable. Interrupts are disabled while checking the runqueue so
+// that an interrupt that happens right before the wfi instruction is not
+// missed: a pending interrupt will still wake up the processor.
+func waitForInterrupt() bool {
+	mask := interrupt.Disable()
+	if runqueueEmpty() {
+		arm.Asm("wfi")
+	}
+	interrupt.Restore(mask)
+	return true
+}
@@ -2,7 +2,10 @@
 
 package runtime
 
-import "device/riscv"
+import (
+	"device/riscv"
+	"runtime/interrupt"
+)
 
 const GOARCH = "arm" // riscv pretends to be arm
 
@@ -17,3 +20,16 @@ func align(ptr uintptr) uintptr {
 func getCurrentStackPointer() uintptr {
 	return riscv.ReadRegister("sp")
 }
+
+// waitForInterrupt sleeps until an interrupt happens, which may have made a
+// goroutine runnable. Interrupts are disabled while checking the runqueue so
+// that an interrupt that happens right before the wfi instruction is not
+// missed: a pending interrupt will still wake up the processor.
+func waitForInterrupt() bool {
+	mask := interrupt.Disable()
+	if runqueueEmpty() {
+		riscv.Asm("wfi")
+	}
+	interrupt.Restore(mask)
+	return true
+}
@@ -30,3 +30,11 @@ func align(ptr uintptr) uintptr {
 }
 
 func getCurrentStackPointer() uintptr
+
+//go:export memset
+func memset(ptr unsafe.Pointer, c byte, size uintptr) unsafe.Pointer {
+	for i := uintptr(0); i < size; i++ {
+		*(*byte)(unsafe.Pointer(uintptr(ptr) + i)) = c
+	}
+	return ptr
+}
@@ -0,0 +1,65 @@
+// +build cortexm
+
+package runtime
+
+import (
+	"unsafe"
+)
+
+//go:extern _stext
+var textStartSymbol unsafe.Pointer
+
+//go:extern _etext
+var textEndSymbol unsafe.Pointer
+
+// Maximum number of return addresses printed in a backtrace.
+const maxBacktraceDepth = 16
+
+// printBacktrace prints the return addresses found on the current stack. It is
+// called after printing a panic message.
+//go:noinline
+func printBacktrace() {
+	sp := getCurrentStackPointer()
+	printStackBacktrace(sp, stackLimit(sp))
+}
+
+// stackLimit returns the upper bound for scanning the stack that contains the
+// given stack pointer. The system stack ends at the top of the stack provided
+// by the linker, while goroutine stacks are allocated on the heap. Only the
+// stack of the running goroutine is known: for other heap addresses nothing is
+// scanned.
+func stackLimit(sp uintptr) uintptr {
+	if sp >= heapStart && sp < heapEnd {
+		if top := goroutineStackTop(); sp < top {
+			return top
+		}
+		return sp
+	}
+	return stackTop
+}
+
+// printStackBacktrace prints all words between sp and top that look like a
+// return address: a Thumb code pointer (with the lowest bit set) that points
+// into the .text section.
+//
+// Code for Cortex-M is compiled without frame pointers and unwind tables, so
+// there is no reliable way to walk the stack. Some of the printed addresses may
+// be stale values left behind by earlier calls, but the innermost frames are
+// nearly always correct. The addresses can be converted to function names and
+// line numbers using `tinygo symbolize`.
+func printStackBacktrace(sp, top uintptr) {
+	textStart := uintptr(unsafe.Pointer(&textStartSymbol))
+	textEnd := uintptr(unsafe.Pointer(&textEndSymbol))
+	println("backtrace:")
+	depth := 0
+	for ptr := sp &^ 3; ptr < top && depth < maxBacktraceDepth; ptr += 4 {
+		addr := *(*uintptr)(unsafe.Pointer(ptr))
+		if addr&1 == 0 || addr < textStart || addr >= textEnd {
+			continue
+		}
+		printstring("  ")
+		printptr(addr)
+		printnl()
+		depth++
+	}
+}
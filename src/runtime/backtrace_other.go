@@ -0,0 +1,8 @@
+// +build !cortexm
+
+package runtime
+
+// printBacktrace prints the return addresses found on the current stack. It is
+// not yet implemented on this architecture.
+func printBacktrace() {
+}
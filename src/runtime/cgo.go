@@ -0,0 +1,86 @@
+package runtime
+
+// This file implements the helper functions that CGo provides in the C
+// pseudo-package, like C.CString and C.GoString. CGo calls them through
+// //go:linkname declarations.
+
+import (
+	"unsafe"
+)
+
+// cgo_CString implements C.CString: it copies a Go string to a new
+// zero-terminated C string. The C string must be freed with C.free.
+func cgo_CString(s _string) unsafe.Pointer {
+	buf := cgoMalloc(s.length + 1)
+	memcpy(buf, unsafe.Pointer(s.ptr), s.length)
+	*(*byte)(unsafe.Pointer(uintptr(buf) + s.length)) = 0
+	return buf
+}
+
+// cgo_CBytes implements C.CBytes: it copies a byte slice to a new C array. The
+// array must be freed with C.free.
+func cgo_CBytes(b struct {
+	ptr *byte
+	len uintptr
+	cap uintptr
+}) unsafe.Pointer {
+	buf := cgoMalloc(b.len)
+	memcpy(buf, unsafe.Pointer(b.ptr), b.len)
+	return buf
+}
+
+// cgo_GoString implements C.GoString: it copies a zero-terminated C string to
+// a Go string.
+func cgo_GoString(cstr unsafe.Pointer) _string {
+	if cstr == nil {
+		return _string{}
+	}
+	length := uintptr(0)
+	for *(*byte)(unsafe.Pointer(uintptr(cstr) + length)) != 0 {
+		length++
+	}
+	return cgo_GoStringN(cstr, length)
+}
+
+// cgo_GoStringN implements C.GoStringN: it copies length bytes of C data to a
+// Go string.
+func cgo_GoStringN(cstr unsafe.Pointer, length uintptr) _string {
+	if length == 0 {
+		return _string{}
+	}
+	buf := alloc(length)
+	memcpy(buf, cstr, length)
+	return _string{ptr: (*byte)(buf), length: length}
+}
+
+// cgo_GoBytes implements C.GoBytes: it copies length bytes of C data to a new
+// byte slice.
+func cgo_GoBytes(ptr unsafe.Pointer, length uintptr) (slice struct {
+	ptr *byte
+	len uintptr
+	cap uintptr
+}) {
+	if length == 0 {
+		return
+	}
+	buf := alloc(length)
+	memcpy(buf, ptr, length)
+	slice.ptr = (*byte)(buf)
+	slice.len = length
+	slice.cap = length
+	return
+}
+
+// cgo_malloc implements C.malloc. Like in gc, it never returns nil: it panics
+// when there is no memory available.
+func cgo_malloc(size uintptr) unsafe.Pointer {
+	if size == 0 {
+		// Return a unique pointer, as malloc(0) may return nil.
+		size = 1
+	}
+	ptr := cgoMalloc(size)
+	if ptr == nil {
+		runtimePanic("C malloc failed")
+	}
+	return ptr
+}
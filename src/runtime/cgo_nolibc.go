@@ -0,0 +1,16 @@
+// +build !darwin
+// +build !linux baremetal wasi
+
+package runtime
+
+import (
+	"unsafe"
+)
+
+// cgoMalloc allocates memory for C.malloc, C.CString and C.CBytes. There is no
+// libc on this target, so the memory is allocated on the garbage collected
+// heap: C.free is not available and a reference must be kept in Go for as
+// long as the memory is used from C.
+func cgoMalloc(size uintptr) unsafe.Pointer {
+	return alloc(size)
+}
@@ -22,8 +22,16 @@ package runtime
 // the 'comma-ok' value to true.
 // A receive operation on a closed channel is completed by zeroing the data
 // element of the receiving coroutine and setting the 'comma-ok' value to false.
+//
+// All channel operations run with interrupts disabled, so that interrupt
+// handlers can do non-blocking operations (a select statement with a default
+// case) on channels shared with goroutines. Blocking operations also yield
+// with interrupts disabled, so that the goroutine is not woken up or preempted
+// before it has switched to the scheduler. Interrupts are restored once the
+// goroutine runs again.
 
 import (
+	"runtime/interrupt"
 	"unsafe"
 )
 
@@ -157,6 +165,11 @@ func (ch *channel) resumeRX(ok bool) unsafe.Pointer {
 		b.detach()
 	}
 
+	if ok && ch.bufSize == 0 {
+		// the receiver handles the value on behalf of this goroutine
+		passPriority(b.t)
+	}
+
 	// push task onto runqueue
 	runqueuePushBack(b.t)
 
@@ -184,6 +197,13 @@ func (ch *channel) resumeTX() unsafe.Pointer {
 		b.detach()
 	}
 
+	if ch.bufSize == 0 {
+		// the sender continues on behalf of this goroutine, and this
+		// goroutine handles the value on behalf of the sender
+		passPriority(b.t)
+		takePriority(b.t)
+	}
+
 	// push task onto runqueue
 	runqueuePushBack(b.t)
 
@@ -412,14 +432,17 @@ type chanSelectState struct {
 // This operation will block unless a value is immediately available.
 // May panic if the channel is closed.
 func chanSend(ch *channel, value unsafe.Pointer) {
+	mask := interrupt.Disable()
 	if ch.trySend(value) {
 		// value immediately sent
 		chanDebug(ch)
+		interrupt.Restore(mask)
 		return
 	}
 
 	if ch == nil {
 		// A nil channel blocks forever. Do not schedule this goroutine again.
+		interrupt.Restore(mask)
 		deadlock()
 	}
 
@@ -433,8 +456,10 @@ func chanSend(ch *channel, value unsafe.Pointer) {
 		t:    sender,
 	}
 	chanDebug(ch)
+	dropPassedPriority()
 	yield()
 	senderState.ptr = nil
+	interrupt.Restore(mask)
 }
 
 // chanRecv receives a single value over a channel.
@@ -442,14 +467,17 @@ func chanSend(ch *channel, value unsafe.Pointer) {
 // The recieved value is copied into the value pointer.
 // Returns the comma-ok value.
 func chanRecv(ch *channel, value unsafe.Pointer) bool {
+	mask := interrupt.Disable()
 	if rx, ok := ch.tryRecv(value); rx {
 		// value immediately available
 		chanDebug(ch)
+		interrupt.Restore(mask)
 		return ok
 	}
 
 	if ch == nil {
 		// A nil channel blocks forever. Do not schedule this goroutine again.
+		interrupt.Restore(mask)
 		deadlock()
 	}
 
@@ -463,9 +491,11 @@ func chanRecv(ch *channel, value unsafe.Pointer) bool {
 		t:    receiver,
 	}
 	chanDebug(ch)
+	dropPassedPriority()
 	yield()
 	ok := receiverState.data == 1
 	receiverState.ptr, receiverState.data = nil, 0
+	interrupt.Restore(mask)
 	return ok
 }
 
@@ -476,6 +506,7 @@ func chanClose(ch *channel) {
 		// Not allowed by the language spec.
 		runtimePanic("close of nil channel")
 	}
+	mask := interrupt.Disable()
 	switch ch.state {
 	case chanStateClosed:
 		// Not allowed by the language spec.
@@ -497,6 +528,7 @@ func chanClose(ch *channel) {
 	}
 	ch.state = chanStateClosed
 	chanDebug(ch)
+	interrupt.Restore(mask)
 }
 
 // chanSelect is the runtime implementation of the select statement. This is
@@ -506,8 +538,10 @@ func chanClose(ch *channel) {
 // TODO: do this in a round-robin fashion (as specified in the Go spec) instead
 // of picking the first one that can proceed.
 func chanSelect(recvbuf unsafe.Pointer, states []chanSelectState, ops []channelBlockedList) (uintptr, bool) {
+	mask := interrupt.Disable()
 	if selected, ok := tryChanSelect(recvbuf, states); selected != ^uintptr(0) {
 		// one channel was immediately ready
+		interrupt.Restore(mask)
 		return selected, ok
 	}
 
@@ -551,30 +585,38 @@ func chanSelect(recvbuf unsafe.Pointer, states []chanSelectState, ops []channelB
 	getCoroutine().state().data = 1
 
 	// wait for one case to fire
+	dropPassedPriority()
 	yield()
+	interrupt.Restore(mask)
 
 	// figure out which one fired and return the ok value
 	return (uintptr(getCoroutine().state().ptr) - uintptr(unsafe.Pointer(&states[0]))) / unsafe.Sizeof(chanSelectState{}), getCoroutine().state().data != 0
 }
 
 // tryChanSelect is like chanSelect, but it does a non-blocking select operation.
+// It is safe to call from an interrupt handler.
 func tryChanSelect(recvbuf unsafe.Pointer, states []chanSelectState) (uintptr, bool) {
+	mask := interrupt.Disable()
+
 	// See whether we can receive from one of the channels.
 	for i, state := range states {
 		if state.value == nil {
 			// A receive operation.
 			if rx, ok := state.ch.tryRecv(recvbuf); rx {
 				chanDebug(state.ch)
+				interrupt.Restore(mask)
 				return uintptr(i), ok
 			}
 		} else {
 			// A send operation: state.value is not nil.
 			if state.ch.trySend(state.value) {
 				chanDebug(state.ch)
+				interrupt.Restore(mask)
 				return uintptr(i), true
 			}
 		}
 	}
 
+	interrupt.Restore(mask)
 	return ^uintptr(0), false
 }
@@ -217,6 +217,7 @@ func alloc(size uintptr) unsafe.Pointer {
 		return unsafe.Pointer(&zeroSizedAlloc)
 	}
 
+	mask := disablePreemption()
 	neededBlocks := (size + (bytesPerBlock - 1)) / bytesPerBlock
 
 	// Continue looping until a run of free blocks has been found that fits the
@@ -275,6 +276,7 @@ func alloc(size uintptr) unsafe.Pointer {
 			// Return a pointer to this allocation.
 			pointer := thisAlloc.pointer()
 			memzero(pointer, size)
+			enablePreemption(mask)
 			return pointer
 		}
 	}
@@ -286,6 +288,7 @@ func free(ptr unsafe.Pointer) {
 
 // GC performs a garbage collection cycle.
 func GC() {
+	mask := disablePreemption()
 	if gcDebug {
 		println("running collection cycle...")
 	}
@@ -302,6 +305,7 @@ func GC() {
 	if gcDebug {
 		dumpHeap()
 	}
+	enablePreemption(mask)
 }
 
 // markRoots reads all pointers from start to end (exclusive) and if they look
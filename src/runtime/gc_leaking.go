@@ -18,8 +18,10 @@ func alloc(size uintptr) unsafe.Pointer {
 	// much. And by using platform-native data types (e.g. *uint8 for 8-bit
 	// systems).
 	size = align(size)
+	mask := disablePreemption()
 	addr := heapptr
 	heapptr += size
+	enablePreemption(mask)
 	if heapptr >= heapEnd {
 		runtimePanic("out of memory")
 	}
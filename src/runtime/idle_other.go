@@ -0,0 +1,10 @@
+// +build !cortexm,!tinygo.riscv
+
+package runtime
+
+// waitForInterrupt would wait for an interrupt that may make a goroutine
+// runnable, but this system has no interrupts that can do so. Return false to
+// let the scheduler exit when no goroutine can make progress.
+func waitForInterrupt() bool {
+	return false
+}
@@ -0,0 +1,36 @@
+// Package interrupt provides access to hardware interrupts. It provides a way
+// to define interrupts and to enable/disable them.
+package interrupt
+
+// Interrupt provides direct access to hardware interrupts. You can configure
+// this interrupt through this interface.
+//
+// Do not use the zero value of an Interrupt object. Instead, call New to obtain
+// an interrupt handle.
+type Interrupt struct {
+	// Make this number unexported so it cannot be set directly. This provides
+	// some encapsulation.
+	num int
+}
+
+// New is a compiler intrinsic that creates a new Interrupt object. The handler
+// is installed in the interrupt vector at compile time, so you may call it only
+// once per interrupt and must pass constant parameters to it: the interrupt
+// number must be a Go constant (for example, sam.IRQ_SERCOM1) and the handler
+// must be a top-level function, not a closure.
+//
+// Registering the same interrupt twice, or registering an interrupt that is
+// also handled by a //go:export or //go:interrupt function, is a compile error.
+// So is a handler that may block (for example, on a channel or in time.Sleep)
+// or allocate heap memory, because neither is safe inside an interrupt. To send
+// a value to a goroutine, use a select statement with a default case, which
+// never blocks.
+func New(id int, handler func(Interrupt)) Interrupt
+
+// State represents the previous global interrupt state, as returned by Disable.
+type State uintptr
+
+// Number returns the interrupt number of this interrupt.
+func (irq Interrupt) Number() int {
+	return irq.num
+}
@@ -0,0 +1,36 @@
+// +build avr
+
+package interrupt
+
+import (
+	"device/avr"
+	"runtime/volatile"
+	"unsafe"
+)
+
+// The status register, which contains the global interrupt enable flag (bit
+// 7). It is at the same address on all supported AVR chips.
+var sreg = (*volatile.Register8)(unsafe.Pointer(uintptr(0x5f)))
+
+// Disable disables all interrupts and returns the previous interrupt state. It
+// can be used in a critical section like this:
+//
+//     state := interrupt.Disable()
+//     // critical section
+//     interrupt.Restore(state)
+//
+// Critical sections can be nested. Make sure to call Restore with the same
+// state object that was returned by Disable.
+func Disable() (state State) {
+	state = State(sreg.Get())
+	avr.Asm("cli")
+	return state
+}
+
+// Restore restores interrupts to what they were before. Give the previous state
+// returned by Disable as a parameter. If interrupts were disabled before
+// calling Disable, this will not re-enable interrupts, allowing for nested
+// critical sections.
+func Restore(state State) {
+	sreg.Set(uint8(state))
+}
@@ -0,0 +1,17 @@
+// +build !cortexm,!avr,!tinygo.riscv
+
+package interrupt
+
+// This file is used on systems without hardware interrupts, such as operating
+// systems and WebAssembly. Critical sections are still needed in portable code,
+// but they do not need to do anything.
+
+// Disable disables all interrupts and returns the previous interrupt state. It
+// is a no-op on this system, as it doesn't have hardware interrupts.
+func Disable() (state State) {
+	return 0
+}
+
+// Restore restores interrupts to what they were before. It is a no-op on this
+// system, as it doesn't have hardware interrupts.
+func Restore(state State) {}
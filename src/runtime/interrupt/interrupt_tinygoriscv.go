@@ -0,0 +1,32 @@
+// +build tinygo.riscv
+
+package interrupt
+
+import (
+	"device/riscv"
+)
+
+// Disable disables all interrupts and returns the previous interrupt state. It
+// can be used in a critical section like this:
+//
+//     state := interrupt.Disable()
+//     // critical section
+//     interrupt.Restore(state)
+//
+// Critical sections can be nested. Make sure to call Restore with the same
+// state object that was returned by Disable.
+func Disable() (state State) {
+	state = State(riscv.ReadRegister("mstatus"))
+	riscv.Asm("csrci mstatus, 8") // clear the MIE bit
+	return state
+}
+
+// Restore restores interrupts to what they were before. Give the previous state
+// returned by Disable as a parameter. If interrupts were disabled before
+// calling Disable, this will not re-enable interrupts, allowing for nested
+// critical sections.
+func Restore(state State) {
+	if state&8 != 0 {
+		riscv.Asm("csrsi mstatus, 8") // set the MIE bit
+	}
+}
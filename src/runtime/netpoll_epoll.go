@@ -0,0 +1,101 @@
+// +build linux,!baremetal,!wasi
+
+package runtime
+
+// This file implements the network poller on Linux using epoll.
+
+import "unsafe"
+
+const hasNetpoll = true
+
+//go:export epoll_create1
+func epoll_create1(flags int32) int32
+
+//go:export epoll_ctl
+func epoll_ctl(epfd, op, fd int32, ev *epollevent) int32
+
+//go:export epoll_wait
+func epoll_wait(epfd int32, ev *epollevent, maxevents, timeout int32) int32
+
+//go:export __errno_location
+func libc_errno_location() *int32
+
+const (
+	_EPOLLIN       = 0x1
+	_EPOLLOUT      = 0x4
+	_EPOLLERR      = 0x8
+	_EPOLLHUP      = 0x10
+	_EPOLLRDHUP    = 0x2000
+	_EPOLLET       = 0x80000000
+	_EPOLL_CLOEXEC = 0x80000
+	_EPOLL_CTL_ADD = 1
+	_EPOLL_CTL_DEL = 2
+	_EINTR         = 4
+)
+
+var (
+	epfd int32 = -1
+
+	// File descriptors registered with epoll. The epoll event only contains
+	// the file descriptor, which is looked up here.
+	pollDescs = map[int32]*pollDesc{}
+)
+
+func netpollinit() {
+	epfd = epoll_create1(_EPOLL_CLOEXEC)
+	if epfd < 0 {
+		runtimePanic("netpollinit: failed to create epoll descriptor")
+	}
+}
+
+func netpollIsPollDescriptor(fd uintptr) bool {
+	return int32(fd) == epfd
+}
+
+func netpollopen(fd uintptr, pd *pollDesc) int32 {
+	var ev epollevent
+	ev.events = _EPOLLIN | _EPOLLOUT | _EPOLLRDHUP | _EPOLLET
+	*(*int32)(unsafe.Pointer(&ev.data)) = int32(fd)
+	if epoll_ctl(epfd, _EPOLL_CTL_ADD, int32(fd), &ev) < 0 {
+		return *libc_errno_location()
+	}
+	pollDescs[int32(fd)] = pd
+	return 0
+}
+
+func netpollclose(fd uintptr) {
+	var ev epollevent
+	epoll_ctl(epfd, _EPOLL_CTL_DEL, int32(fd), &ev)
+	delete(pollDescs, int32(fd))
+}
+
+func netpoll(delay timeUnit, forever bool) {
+	timeout := int32(-1)
+	if !forever {
+		// Round up to whole milliseconds so that the scheduler doesn't wake
+		// up just before a timer or sleeping goroutine is due.
+		ms := (int64(delay)*tickMicros + 999999) / 1000000
+		if ms > 1<<31-1 {
+			ms = 1<<31 - 1
+		}
+		timeout = int32(ms)
+	}
+	var events [32]epollevent
+	n := epoll_wait(epfd, &events[0], int32(len(events)), timeout)
+	if n < 0 {
+		if *libc_errno_location() != _EINTR {
+			runtimePanic("netpoll: epoll_wait failed")
+		}
+		return
+	}
+	for i := range events[:n] {
+		ev := &events[i]
+		pd := pollDescs[*(*int32)(unsafe.Pointer(&ev.data))]
+		if pd == nil {
+			continue
+		}
+		readable := ev.events&(_EPOLLIN|_EPOLLRDHUP|_EPOLLHUP|_EPOLLERR) != 0
+		writable := ev.events&(_EPOLLOUT|_EPOLLHUP|_EPOLLERR) != 0
+		netpollready(pd, readable, writable)
+	}
+}
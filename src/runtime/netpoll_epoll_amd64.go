@@ -0,0 +1,9 @@
+// +build linux,!baremetal,!wasi
+
+package runtime
+
+// The epoll_event struct is packed on amd64.
+type epollevent struct {
+	events uint32
+	data   [8]byte
+}
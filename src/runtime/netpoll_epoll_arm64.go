@@ -0,0 +1,9 @@
+// +build linux,!baremetal,!wasi
+
+package runtime
+
+type epollevent struct {
+	events uint32
+	_      uint32
+	data   [8]byte
+}
@@ -0,0 +1,25 @@
+// +build !linux baremetal wasi
+
+package runtime
+
+// There is no network poller on this system. Opening a file descriptor for
+// polling fails with ENOSYS, so goroutines will never wait in the poller.
+
+const hasNetpoll = false
+
+func netpollinit() {
+}
+
+func netpollIsPollDescriptor(fd uintptr) bool {
+	return false
+}
+
+func netpollopen(fd uintptr, pd *pollDesc) int32 {
+	return _ENOSYS
+}
+
+func netpollclose(fd uintptr) {
+}
+
+func netpoll(delay timeUnit, forever bool) {
+}
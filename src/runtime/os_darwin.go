@@ -3,3 +3,6 @@
 package runtime
 
 const GOOS = "darwin"
+
+// Value of ENOSYS, which the runtime cannot import from the syscall package.
+const _ENOSYS = 78
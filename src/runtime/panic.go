@@ -10,6 +10,7 @@ func _panic(message interface{}) {
 	printstring("panic: ")
 	printitf(message)
 	printnl()
+	printBacktrace()
 	abort()
 }
 
@@ -17,6 +18,7 @@ func _panic(message interface{}) {
 func runtimePanic(msg string) {
 	printstring("panic: runtime error: ")
 	println(msg)
+	printBacktrace()
 	abort()
 }
 
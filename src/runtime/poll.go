@@ -1,23 +1,254 @@
 package runtime
 
-// This file implements stub functions for internal/poll.
+// This file implements the network poller hooks of internal/poll. Goroutines
+// that wait for a file descriptor to become ready are parked until the
+// scheduler finds out (using netpoll) that the file descriptor is ready or
+// until the deadline of the operation expires.
+//
+// The platform-specific part of the poller consists of these functions:
+//
+//   - netpollinit initializes the poller.
+//   - netpollopen starts polling a file descriptor and returns an errno.
+//   - netpollclose stops polling a file descriptor.
+//   - netpoll waits for events for at most the given number of ticks (or
+//     forever) and calls netpollready for each file descriptor that became
+//     ready.
+//   - hasNetpoll is a constant that is false when there is no poller, so that
+//     the scheduler doesn't include the code to call netpoll.
+//   - netpollIsPollDescriptor returns whether the given file descriptor is used
+//     by the poller itself.
+
+import "unsafe"
+
+// Error codes returned to internal/poll.
+const (
+	pollNoError        = 0 // no error
+	pollErrClosing     = 1 // descriptor is closed
+	pollErrTimeout     = 2 // I/O timeout
+	pollErrNotPollable = 3 // general error polling descriptor
+)
+
+// pollDesc is the state of a file descriptor that is used with the poller.
+type pollDesc struct {
+	fd      uintptr
+	closing bool
+
+	// The goroutine waiting for the file descriptor to become readable or
+	// writable, if any.
+	rg, wg *task
+
+	// Whether the file descriptor became readable or writable since the last
+	// reset. The poller is edge-triggered, so this must be remembered.
+	rready, wready bool
+
+	// Deadlines for reading and writing: 0 if there is no deadline, -1 if it
+	// has expired, or the nanotime at which it expires.
+	rd, wd int64
+	rt, wt timer
+}
+
+// Number of goroutines parked in pollWait. The scheduler only needs to call
+// netpoll when this is non-zero.
+var netpollWaiters int
+
+var netpollInited bool
 
 //go:linkname poll_runtime_pollServerInit internal/poll.runtime_pollServerInit
 func poll_runtime_pollServerInit() {
-	panic("todo: runtime_pollServerInit")
+	if !netpollInited {
+		netpollinit()
+		netpollInited = true
+	}
+}
+
+//go:linkname poll_runtime_isPollServerDescriptor internal/poll.runtime_isPollServerDescriptor
+func poll_runtime_isPollServerDescriptor(fd uintptr) bool {
+	return netpollInited && netpollIsPollDescriptor(fd)
 }
 
 //go:linkname poll_runtime_pollOpen internal/poll.runtime_pollOpen
 func poll_runtime_pollOpen(fd uintptr) (uintptr, int) {
-	panic("todo: runtime_pollOpen")
+	pd := &pollDesc{fd: fd}
+	if errno := netpollopen(fd, pd); errno != 0 {
+		return 0, int(errno)
+	}
+	return uintptr(unsafe.Pointer(pd)), 0
 }
 
 //go:linkname poll_runtime_pollClose internal/poll.runtime_pollClose
 func poll_runtime_pollClose(ctx uintptr) {
-	panic("todo: runtime_pollClose")
+	pd := (*pollDesc)(unsafe.Pointer(ctx))
+	if !pd.closing {
+		runtimePanic("runtime_pollClose: close w/o unblock")
+	}
+	if pd.rg != nil || pd.wg != nil {
+		runtimePanic("runtime_pollClose: blocked read or write on closing descriptor")
+	}
+	netpollclose(pd.fd)
+}
+
+//go:linkname poll_runtime_pollReset internal/poll.runtime_pollReset
+func poll_runtime_pollReset(ctx uintptr, mode int) int {
+	pd := (*pollDesc)(unsafe.Pointer(ctx))
+	if errcode := pd.check(mode); errcode != pollNoError {
+		return errcode
+	}
+	if mode == 'r' {
+		pd.rready = false
+	} else if mode == 'w' {
+		pd.wready = false
+	}
+	return pollNoError
+}
+
+//go:linkname poll_runtime_pollWait internal/poll.runtime_pollWait
+func poll_runtime_pollWait(ctx uintptr, mode int) int {
+	pd := (*pollDesc)(unsafe.Pointer(ctx))
+	for {
+		if errcode := pd.check(mode); errcode != pollNoError {
+			return errcode
+		}
+		// Consume the readiness notification, if there is one. Otherwise,
+		// park this goroutine until there is one (or until the deadline
+		// expires or the descriptor is closed).
+		if mode == 'r' {
+			if pd.rready {
+				pd.rready = false
+				return pollNoError
+			}
+			pd.rg = getCoroutine()
+		} else {
+			if pd.wready {
+				pd.wready = false
+				return pollNoError
+			}
+			pd.wg = getCoroutine()
+		}
+		netpollWaiters++
+		yield()
+	}
+}
+
+//go:linkname poll_runtime_pollSetDeadline internal/poll.runtime_pollSetDeadline
+func poll_runtime_pollSetDeadline(ctx uintptr, d int64, mode int) {
+	pd := (*pollDesc)(unsafe.Pointer(ctx))
+	if pd.closing {
+		return
+	}
+	// The deadline is passed relative to the current time.
+	if d > 0 {
+		d += nanotime()
+		if d <= 0 {
+			// Overflow: the deadline is too far in the future.
+			d = 1<<63 - 1
+		}
+	}
+	if mode == 'r' || mode == 'r'+'w' {
+		pd.rd = d
+		pd.setTimer(&pd.rt, d, pollReadDeadline)
+	}
+	if mode == 'w' || mode == 'r'+'w' {
+		pd.wd = d
+		pd.setTimer(&pd.wt, d, pollWriteDeadline)
+	}
+	if pd.rd < 0 {
+		pd.wake('r')
+	}
+	if pd.wd < 0 {
+		pd.wake('w')
+	}
 }
 
 //go:linkname poll_runtime_pollUnblock internal/poll.runtime_pollUnblock
 func poll_runtime_pollUnblock(ctx uintptr) {
-	panic("todo: runtime_pollUnblock")
+	pd := (*pollDesc)(unsafe.Pointer(ctx))
+	if pd.closing {
+		runtimePanic("runtime_pollUnblock: already closing")
+	}
+	pd.closing = true
+	removeTimer(&pd.rt)
+	removeTimer(&pd.wt)
+	pd.wake('r')
+	pd.wake('w')
+}
+
+// os_runtime_pollWaitFD waits until the given file descriptor may be ready for
+// reading (mode 'r') or writing (mode 'w'). It is used by the raw connections
+// of package os, which don't use internal/poll: the file descriptor is only
+// registered with the poller while waiting. It returns false without waiting
+// if the file descriptor cannot be polled.
+//go:linkname os_runtime_pollWaitFD os.runtime_pollWaitFD
+func os_runtime_pollWaitFD(fd uintptr, mode int) bool {
+	poll_runtime_pollServerInit()
+	pd := &pollDesc{fd: fd}
+	if netpollopen(fd, pd) != 0 {
+		return false
+	}
+	poll_runtime_pollWait(uintptr(unsafe.Pointer(pd)), mode)
+	netpollclose(fd)
+	return true
+}
+
+// check returns the error code for an operation in the given mode: whether the
+// descriptor is closing or the deadline has expired.
+func (pd *pollDesc) check(mode int) int {
+	if pd.closing {
+		return pollErrClosing
+	}
+	if (mode == 'r' && pd.rd < 0) || (mode == 'w' && pd.wd < 0) {
+		return pollErrTimeout
+	}
+	return pollNoError
+}
+
+// wake makes the goroutine that is waiting for the given mode runnable again,
+// if there is one.
+func (pd *pollDesc) wake(mode int) {
+	t := &pd.wg
+	if mode == 'r' {
+		t = &pd.rg
+	}
+	if *t != nil {
+		activateTask(*t)
+		*t = nil
+		netpollWaiters--
+	}
+}
+
+// netpollready is called by netpoll when the file descriptor has become
+// readable and/or writable.
+func netpollready(pd *pollDesc, readable, writable bool) {
+	if readable {
+		pd.rready = true
+		pd.wake('r')
+	}
+	if writable {
+		pd.wready = true
+		pd.wake('w')
+	}
+}
+
+// setTimer starts, resets or stops the deadline timer of one mode.
+func (pd *pollDesc) setTimer(t *timer, d int64, f func(interface{}, uintptr)) {
+	removeTimer(t)
+	if d > 0 {
+		t.when = d
+		t.f = f
+		t.arg = pd
+		addTimer(t)
+	}
+}
+
+// pollReadDeadline is called when the read deadline of a pollDesc expires.
+func pollReadDeadline(arg interface{}, seq uintptr) {
+	pd := arg.(*pollDesc)
+	pd.rd = -1
+	pd.wake('r')
+}
+
+// pollWriteDeadline is called when the write deadline of a pollDesc expires.
+func pollWriteDeadline(arg interface{}, seq uintptr) {
+	pd := arg.(*pollDesc)
+	pd.wd = -1
+	pd.wake('w')
 }
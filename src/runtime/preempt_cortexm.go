@@ -0,0 +1,113 @@
+// +build cortexm,scheduler.tasks,preempt
+
+package runtime
+
+// This file implements preemptive time slicing for the tasks scheduler, which
+// is enabled with the "preempt" build tag. The SysTick timer fires once every
+// time slice and triggers the PendSV exception, which makes the running
+// goroutine call preempt once all other interrupts have been handled (see
+// preempt_cortexm.S). The scheduler then runs the next goroutine in the
+// runqueue. A goroutine is also preempted when a goroutine with a higher
+// priority becomes runnable.
+//
+// Goroutines are never preempted with interrupts disabled. The runtime uses
+// this to protect the data structures it shares with interrupts (the runqueue,
+// channels, etc.) with critical sections. Data structures that are only shared
+// between goroutines, like the heap, are protected by disabling preemption
+// instead, which leaves interrupts enabled.
+
+import (
+	"device/arm"
+	"runtime/interrupt"
+	"runtime/volatile"
+)
+
+// preemptDisabled is set while the running goroutine must not be preempted. It
+// is checked by PendSV_Handler, which sets preemptPending instead of preempting
+// the goroutine.
+//go:extern tinygo_preemptDisabled
+var preemptDisabled volatile.Register8
+
+//go:extern tinygo_preemptPending
+var preemptPending volatile.Register8
+
+// preemptState is the state returned by disablePreemption.
+type preemptState uint8
+
+// timeSlice is the time in nanoseconds a goroutine may run before it is
+// preempted. A value of 0 disables preemption.
+var timeSlice int64 = 10 * 1000 * 1000 // 10ms
+
+func init() {
+	// Give PendSV the lowest priority (in SHPR3), so that it only runs when
+	// no other interrupt is active.
+	arm.SCB.SHP[1].SetBits(0xff << 16)
+	mask := interrupt.Disable()
+	timeSliceChanged()
+	interrupt.Restore(mask)
+}
+
+// SetTimeSlice sets the time in nanoseconds a goroutine may run before it is
+// preempted to let other goroutines run. A value of 0 disables preemption. The
+// default is 10 milliseconds.
+//
+// This function is only available when preemption is enabled with the
+// "preempt" build tag.
+func SetTimeSlice(nanoseconds int64) {
+	mask := interrupt.Disable()
+	timeSlice = nanoseconds
+	timeSliceChanged()
+	interrupt.Restore(mask)
+}
+
+// preemptTick is called from the SysTick handler at the end of each time
+// slice. It preempts the running goroutine, if any: the PendSV handler ignores
+// the request when the scheduler is running.
+func preemptTick() {
+	if timeSlice != 0 {
+		arm.SCB.ICSR.Set(arm.SCB_ICSR_PENDSVSET)
+	}
+}
+
+// preemptFor is called when a goroutine is added to the runqueue. If it has a
+// higher priority than the running goroutine, the running goroutine is
+// preempted right away so that the new goroutine can run, even when time
+// slicing is disabled.
+func preemptFor(t *task) {
+	if currentTask != nil && t.priority > currentTask.priority {
+		arm.SCB.ICSR.Set(arm.SCB_ICSR_PENDSVSET)
+	}
+}
+
+// disablePreemption prevents the current goroutine from being preempted, until
+// enablePreemption is called with the returned state. It is used to protect
+// data structures that are shared between goroutines but not with interrupts.
+// Interrupts are still handled in the meantime, so a long operation like a
+// garbage collection cycle does not delay them.
+func disablePreemption() preemptState {
+	state := preemptState(preemptDisabled.Get())
+	preemptDisabled.Set(1)
+	return state
+}
+
+// enablePreemption restores the state from before the call to
+// disablePreemption. If the goroutine should have been preempted in the
+// meantime, it is preempted now.
+func enablePreemption(state preemptState) {
+	preemptDisabled.Set(uint8(state))
+	if state == 0 && preemptPending.Get() != 0 {
+		preemptPending.Set(0)
+		arm.SCB.ICSR.Set(arm.SCB_ICSR_PENDSVSET)
+	}
+}
+
+// switchPreemption is called by yield with interrupts disabled, before
+// switching to the scheduler. It enables preemption for the goroutine that runs
+// next and returns the state of the current goroutine, which yield restores
+// with enablePreemption once it runs again.
+func switchPreemption() preemptState {
+	state := preemptState(preemptDisabled.Get())
+	preemptDisabled.Set(0)
+	preemptPending.Set(0)
+	return state
+}
@@ -0,0 +1,23 @@
+// +build cortexm,scheduler.tasks,preempt,!qemu
+
+package runtime
+
+import (
+	"device/arm"
+	"machine"
+)
+
+//go:export SysTick_Handler
+func handleSysTick() {
+	preemptTick()
+}
+
+// timeSliceChanged reconfigures the SysTick timer to fire once every time
+// slice. It is turned off when preemption is disabled.
+func timeSliceChanged() {
+	cycles := uint64(machine.CPUFrequency()) * uint64(timeSlice) / 1e9
+	if cycles > arm.SYST_RVR_RELOAD_Msk {
+		cycles = arm.SYST_RVR_RELOAD_Msk
+	}
+	arm.SetupSystemTimer(uint32(cycles))
+}
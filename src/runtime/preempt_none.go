@@ -0,0 +1,35 @@
+// +build !cortexm !scheduler.tasks !preempt
+
+package runtime
+
+// Preemption is not enabled or not supported: goroutines only switch when they
+// block or call Gosched. The runtime does not need to protect its data
+// structures from other goroutines, only from interrupts.
+
+// There is no time slice without preemption.
+const timeSlice = 0
+
+// preemptTick is called from the SysTick handler on cortex-m-qemu, and does
+// nothing without preemption.
+func preemptTick() {}
+
+// preemptFor is called when a goroutine is added to the runqueue, and does
+// nothing without preemption.
+func preemptFor(t *task) {}
+
+// preemptState is the state returned by disablePreemption.
+type preemptState uint8
+
+// disablePreemption does nothing without preemption.
+func disablePreemption() preemptState {
+	return 0
+}
+
+// enablePreemption does nothing without preemption.
+func enablePreemption(state preemptState) {}
+
+// switchPreemption is called by yield with the tasks scheduler, and does
+// nothing without preemption.
+func switchPreemption() preemptState {
+	return 0
+}
@@ -0,0 +1,41 @@
+package runtime
+
+// Goroutine priorities, see SetPriority.
+const (
+	MinPriority     = 0
+	DefaultPriority = 1
+	MaxPriority     = 3
+)
+
+// SetPriority sets the priority of the current goroutine, which must be
+// between MinPriority and MaxPriority. Whenever goroutines of different
+// priorities are runnable, the goroutine with the highest priority runs first.
+// Goroutines of the same priority take turns. A goroutine starts with the
+// priority of the goroutine that started it, the main goroutine starts with
+// DefaultPriority.
+//
+// A goroutine holding a sync.Mutex temporarily inherits the priority of the
+// goroutines waiting for it, so that it can't be held up by goroutines with a
+// lower priority than those. Likewise, a goroutine that is woken up by an
+// operation on an unbuffered channel runs with at least the priority of the
+// goroutine that woke it, and a goroutine that receives a value from a blocked
+// sender runs with at least the priority of the sender, until they block on a
+// channel again. While a goroutine is blocked on a channel, no other goroutine
+// inherits its priority: a lower priority goroutine that is about to complete
+// the operation can still be held up by goroutines with a priority in between.
+//
+// Priorities are only supported by the tasks scheduler (used on Cortex-M). With
+// other schedulers all goroutines have the same priority.
+func SetPriority(priority int) {
+	if priority < MinPriority || priority > MaxPriority {
+		runtimePanic("invalid goroutine priority")
+	}
+	setCurrentPriority(uint8(priority))
+}
+
+// Priority returns the priority of the current goroutine, as set with
+// SetPriority. It does not include a priority inherited through a sync.Mutex or
+// passed on through a channel.
+func Priority() int {
+	return int(currentPriority())
+}
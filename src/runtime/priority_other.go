@@ -0,0 +1,26 @@
+// +build !scheduler.tasks
+
+package runtime
+
+// Goroutine priorities are not supported by the coroutine scheduler: a task is
+// only the topmost coroutine of a goroutine, so it cannot keep the priority of
+// the goroutine. All goroutines share a single runqueue.
+
+const runqueueCount = 1
+
+// taskPriority returns the index of the runqueue of the task.
+func taskPriority(t *task) int {
+	return 0
+}
+
+func currentPriority() uint8 {
+	return DefaultPriority
+}
+
+func setCurrentPriority(priority uint8) {}
+
+func passPriority(t *task) {}
+
+func takePriority(t *task) {}
+
+func dropPassedPriority() {}
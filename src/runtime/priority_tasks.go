@@ -0,0 +1,212 @@
+// +build scheduler.tasks
+
+package runtime
+
+// This file implements goroutine priorities and sync.Mutex for the tasks
+// scheduler. Each priority has its own runqueue, see scheduler.go.
+//
+// To avoid priority inversion, a goroutine that holds a sync.Mutex inherits the
+// priority of the goroutines waiting for it. If it is waiting for another mutex
+// in turn, the goroutine holding that mutex inherits the priority as well, and
+// so on. Like in many small RTOSes, the inherited priority is only dropped once
+// the goroutine has released all mutexes it holds.
+//
+// Channels have no owner that could inherit a priority: any goroutine may send
+// on a channel, so the goroutine a waiter is waiting for is not known. Instead,
+// priorities are passed on like in message passing RTOSes. When a goroutine
+// completes an operation on an unbuffered channel by waking up a goroutine
+// blocked on the other side, that goroutine runs with at least the priority of
+// the goroutine that woke it until it blocks on a channel again. A goroutine
+// that receives a value from a sender that blocked first takes over the
+// priority of the sender in the same way. A goroutine serving requests received
+// over a channel thus handles each request with the priority of the goroutine
+// that sent it, whether the sender or the server blocked first. Before that,
+// while a goroutine is blocked, nobody inherits its priority: the goroutine
+// that will complete the operation is not known. Semaphores have no owner
+// either and don't pass on priorities.
+
+import (
+	"runtime/interrupt"
+	"unsafe"
+)
+
+// There is a runqueue for each priority.
+const runqueueCount = MaxPriority + 1
+
+// mutex is the runtime equivalent of sync.Mutex (with the tasks scheduler), and
+// must be kept in sync with it.
+type mutex struct {
+	locked  bool
+	owner   *task // goroutine that locked the mutex
+	waiters *task // goroutines waiting for the mutex, highest priority first
+}
+
+// taskPriority returns the current priority of the task, which is also the
+// index of its runqueue.
+//go:inline
+func taskPriority(t *task) int {
+	return int(t.priority)
+}
+
+// initPriority sets the priority of a new goroutine to the priority of the
+// goroutine that starts it.
+func initPriority(t *task) {
+	t.basePriority = currentPriority()
+	t.priority = t.basePriority
+}
+
+func currentPriority() uint8 {
+	if currentTask == nil {
+		return DefaultPriority
+	}
+	return currentTask.basePriority
+}
+
+func setCurrentPriority(priority uint8) {
+	t := currentTask
+	if t == nil {
+		// Package initializers don't run in a goroutine.
+		return
+	}
+	mask := disablePreemption()
+	t.basePriority = priority
+	if t.mutexesHeld == 0 || priority > t.priority {
+		t.priority = priority
+	}
+	enablePreemption(mask)
+	if runqueueHasPriority(int(t.priority) + 1) {
+		// The priority was lowered: let the goroutines with a higher priority
+		// run first.
+		Gosched()
+	}
+}
+
+// changePriority changes the current priority of a goroutine, moving it to
+// another runqueue or to another place in the waiters of a mutex if needed.
+func changePriority(t *task, priority uint8) {
+	mask := interrupt.Disable()
+	queued := runqueueRemove(t)
+	t.priority = priority
+	if queued {
+		runqueuePushBack(t)
+	}
+	interrupt.Restore(mask)
+	if m := t.waitingFor; m != nil {
+		dropChain(t, &m.waiters, nil)
+		m.addWaiter(t)
+	}
+}
+
+// passPriority is called when the current goroutine wakes up t, which was
+// blocked on the other side of an unbuffered channel. It raises the priority of
+// t to at least the priority of the current goroutine. Interrupt handlers have
+// no priority to pass on.
+func passPriority(t *task) {
+	if currentTask == nil || inInterrupt() {
+		return
+	}
+	if currentTask.priority > t.priority {
+		t.priority = currentTask.priority
+	}
+}
+
+// takePriority is called when the current goroutine receives a value from t,
+// which blocked first on an unbuffered channel. It raises the priority of the
+// current goroutine to at least the priority of t, as it handles the value on
+// behalf of t.
+func takePriority(t *task) {
+	if currentTask == nil || inInterrupt() {
+		return
+	}
+	if t.priority > currentTask.priority {
+		currentTask.priority = t.priority
+	}
+}
+
+// dropPassedPriority is called before the current goroutine blocks on a
+// channel. It drops the priority passed on by passPriority or taken over by
+// takePriority, unless the goroutine holds a mutex: the priority is then
+// dropped once all mutexes are released.
+func dropPassedPriority() {
+	t := currentTask
+	if t != nil && t.mutexesHeld == 0 {
+		t.priority = t.basePriority
+	}
+}
+
+// inheritPriority raises the priority of the goroutine holding the mutex to at
+// least the given priority. If that goroutine is waiting for another mutex, the
+// goroutine holding that mutex inherits the priority as well, and so on.
+func inheritPriority(m *mutex, priority uint8) {
+	for m != nil && m.owner != nil && m.owner.priority < priority {
+		owner := m.owner
+		changePriority(owner, priority)
+		m = owner.waitingFor
+	}
+}
+
+// addWaiter adds a goroutine to the waiters of the mutex, after the waiters with
+// the same or a higher priority.
+func (m *mutex) addWaiter(t *task) {
+	w := &m.waiters
+	for *w != nil && (*w).priority >= t.priority {
+		w = &(*w).state().next
+	}
+	t.state().next = *w
+	*w = t
+}
+
+//go:linkname sync_runtime_mutexLock sync.runtime_mutexLock
+func sync_runtime_mutexLock(ptr unsafe.Pointer) {
+	m := (*mutex)(ptr)
+	mask := disablePreemption()
+	for m.locked {
+		t := currentTask
+		if t == nil {
+			runtimePanic("sync.Mutex locked outside of a goroutine")
+		}
+		// Wait until the mutex is unlocked. The goroutine holding it runs
+		// with at least the priority of this goroutine in the meantime.
+		t.waitingFor = m
+		m.addWaiter(t)
+		inheritPriority(m, t.priority)
+		yield()
+	}
+	m.locked = true
+	m.owner = currentTask
+	if m.owner != nil {
+		m.owner.mutexesHeld++
+		if m.waiters != nil {
+			// Take over the priority of the remaining waiters.
+			inheritPriority(m, m.waiters.priority)
+		}
+	}
+	enablePreemption(mask)
+}
+
+//go:linkname sync_runtime_mutexUnlock sync.runtime_mutexUnlock
+func sync_runtime_mutexUnlock(ptr unsafe.Pointer) {
+	m := (*mutex)(ptr)
+	mask := disablePreemption()
+	if !m.locked {
+		enablePreemption(mask)
+		panic("sync: unlock of unlocked Mutex")
+	}
+	m.locked = false
+	if owner := m.owner; owner != nil {
+		m.owner = nil
+		owner.mutexesHeld--
+		if owner.mutexesHeld == 0 && owner.priority != owner.basePriority {
+			// Drop the inherited priority.
+			changePriority(owner, owner.basePriority)
+		}
+	}
+	// Wake up the waiter with the highest priority.
+	if t := m.waiters; t != nil {
+		m.waiters = t.state().next
+		t.state().next = nil
+		t.waitingFor = nil
+		activateTask(t)
+	}
+	enablePreemption(mask)
+}
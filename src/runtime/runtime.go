@@ -33,9 +33,16 @@ func GOROOT() string {
 	return "/usr/local/go"
 }
 
+// Command line arguments and environment variables of the program, on systems
+// that provide them. They are set by the entry point before initAll is called.
+var (
+	args []string
+	envs []string
+)
+
 //go:linkname os_runtime_args os.runtime_args
 func os_runtime_args() []string {
-	return nil
+	return args
 }
 
 // Copy size bytes from src to dst. The memory areas must not overlap.
@@ -112,5 +119,5 @@ func os_sigpipe() {
 
 //go:linkname syscall_runtime_envs syscall.runtime_envs
 func syscall_runtime_envs() []string {
-	return nil
+	return envs
 }
@@ -6,6 +6,7 @@ import (
 	"device/arm"
 	"device/sam"
 	"machine"
+	"runtime/interrupt"
 	"runtime/volatile"
 	"unsafe"
 )
@@ -235,12 +236,15 @@ var timerWakeup volatile.Register8
 
 const asyncScheduler = false
 
-// sleepTicks should sleep for d number of microseconds.
+// sleepTicks should sleep for d number of microseconds, or until an interrupt
+// makes a goroutine runnable.
 func sleepTicks(d timeUnit) {
 	for d != 0 {
 		ticks() // update timestamp
 		ticks := uint32(d)
-		timerSleep(ticks)
+		if !timerSleep(ticks) {
+			return
+		}
 		d -= timeUnit(ticks)
 	}
 }
@@ -258,8 +262,9 @@ func ticks() timeUnit {
 	return timestamp
 }
 
-// ticks are in microseconds
-func timerSleep(ticks uint32) {
+// timerSleep sleeps for the given number of microseconds. It returns false when
+// it returned early because an interrupt made a goroutine runnable.
+func timerSleep(ticks uint32) bool {
 	timerWakeup.Set(0)
 	if ticks < 214 {
 		// due to around 183us delay waiting for the register value to sync, the minimum sleep value
@@ -281,8 +286,20 @@ func timerSleep(ticks uint32) {
 	// enable IRQ for CMP0 compare
 	sam.RTC_MODE0.INTENSET.SetBits(sam.RTC_MODE0_INTENSET_CMP0)
 
-	for timerWakeup.Get() == 0 {
+	for {
+		mask := interrupt.Disable()
+		if timerWakeup.Get() != 0 {
+			interrupt.Restore(mask)
+			return true
+		}
+		if !runqueueEmpty() {
+			interrupt.Restore(mask)
+			return false
+		}
+		// Interrupts are disabled, but the processor still wakes up on a
+		// pending interrupt. It will be handled when interrupts are restored.
 		arm.Asm("wfi")
+		interrupt.Restore(mask)
 	}
 }
 
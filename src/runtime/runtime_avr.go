@@ -73,7 +73,9 @@ func putchar(c byte) {
 
 const asyncScheduler = false
 
-// Sleep this number of ticks of 16ms.
+// Sleep this number of ticks of 16ms. There is no scheduler on AVR (time.Sleep
+// is lowered to avrSleep), so there are no goroutines that could need to wake
+// up early.
 //
 // TODO: not very accurate. Improve accuracy by calibrating on startup and every
 // once in a while.
@@ -63,6 +63,12 @@ func (r *calleeSavedRegs) prepareStartTask(fn, args uintptr) {
 	r.r5 = args
 }
 
+// inInterrupt returns whether an interrupt handler is running, as opposed to a
+// goroutine or the scheduler.
+func inInterrupt() bool {
+	return arm.ReadRegister("ipsr") != 0
+}
+
 func abort() {
 	// disable all interrupts
 	arm.DisableInterrupts()
@@ -89,10 +95,11 @@ type interruptStack struct {
 
 // This function is called at HardFault.
 // Before this function is called, the stack pointer is reset to the initial
-// stack pointer (loaded from addres 0x0) and the previous stack pointer is
-// passed as an argument to this function. This allows for easy inspection of
-// the stack the moment a HardFault occurs, but it means that the stack will be
-// corrupted by this function and thus this handler must not attempt to recover.
+// stack pointer (loaded from addres 0x0) and the stack pointer in use at the
+// moment of the fault (MSP or PSP) is passed as an argument to this function.
+// This allows for easy inspection of the stack the moment a HardFault occurs,
+// but it means that the system stack will be corrupted by this function and
+// thus this handler must not attempt to recover.
 //
 // For details, see:
 // https://community.arm.com/developer/ip-products/system/f/embedded-forum/3257/debugging-a-cortex-m0-hard-fault
@@ -103,22 +110,83 @@ func handleHardFault(sp *interruptStack) {
 	if uintptr(unsafe.Pointer(sp)) < 0x20000000 {
 		print("stack overflow")
 	} else {
-		// TODO: try to find the cause of the hard fault. Especially on
-		// Cortex-M3 and higher it is possible to find more detailed information
-		// in special status registers.
 		print("HardFault")
 	}
 	print(" with sp=", sp)
-	if uintptr(unsafe.Pointer(&sp.PC)) >= 0x20000000 {
-		// Only print the PC if it points into memory.
-		// It may not point into memory during a stack overflow, so check that
-		// first before accessing the stack.
-		print(" pc=", sp.PC)
+	if uintptr(unsafe.Pointer(&sp.PSR)) >= 0x20000000 {
+		// Only print the PC and LR if they point into memory.
+		// They may not point into memory during a stack overflow, so check
+		// that first before accessing the stack.
+		print(" pc=")
+		printptr(sp.PC)
+		print(" lr=")
+		printptr(sp.LR)
 	}
 	println()
+	if hasFaultStatusRegisters() {
+		printFaultStatus()
+	}
+	if uintptr(unsafe.Pointer(&sp.PSR)) >= 0x20000000 {
+		// Scan the rest of the stack, above the registers that were pushed by
+		// the exception entry.
+		top := uintptr(unsafe.Pointer(sp)) + unsafe.Sizeof(interruptStack{})
+		printStackBacktrace(top, stackLimit(top))
+	}
 	abort()
 }
 
+// hasFaultStatusRegisters returns whether this chip implements the fault
+// status registers, which are only present on ARMv7-M (Cortex-M3 and higher).
+func hasFaultStatusRegisters() bool {
+	return arm.SCB.CPUID.Get()&arm.SCB_CPUID_ARCHITECTURE_Msk == 0xF<<arm.SCB_CPUID_ARCHITECTURE_Pos
+}
+
+// printFaultStatus prints the fault status registers, followed by a short
+// description of the fault cause if it can be determined.
+func printFaultStatus() {
+	cfsr := arm.SCB.CFSR.Get()
+	hfsr := arm.SCB.HFSR.Get()
+	print("  cfsr=")
+	printptr(uintptr(cfsr))
+	print(" hfsr=")
+	printptr(uintptr(hfsr))
+	if cfsr&arm.SCB_CFSR_MMARVALID != 0 {
+		print(" mmfar=")
+		printptr(uintptr(arm.SCB.MMFAR.Get()))
+	}
+	if cfsr&arm.SCB_CFSR_BFARVALID != 0 {
+		print(" bfar=")
+		printptr(uintptr(arm.SCB.BFAR.Get()))
+	}
+	println()
+	switch {
+	case hfsr&arm.SCB_HFSR_VECTTBL != 0:
+		println("  cause: bus error on vector table read")
+	case cfsr&arm.SCB_CFSR_IACCVIOL != 0:
+		println("  cause: instruction access violation")
+	case cfsr&arm.SCB_CFSR_DACCVIOL != 0:
+		println("  cause: data access violation")
+	case cfsr&arm.SCB_CFSR_IBUSERR != 0:
+		println("  cause: instruction bus error")
+	case cfsr&arm.SCB_CFSR_PRECISERR != 0:
+		println("  cause: precise data bus error")
+	case cfsr&arm.SCB_CFSR_IMPRECISERR != 0:
+		println("  cause: imprecise data bus error")
+	case cfsr&arm.SCB_CFSR_UNDEFINSTR != 0:
+		println("  cause: undefined instruction")
+	case cfsr&arm.SCB_CFSR_INVSTATE != 0:
+		println("  cause: invalid processor state")
+	case cfsr&arm.SCB_CFSR_INVPC != 0:
+		println("  cause: invalid exception return")
+	case cfsr&arm.SCB_CFSR_NOCP != 0:
+		println("  cause: no coprocessor")
+	case cfsr&arm.SCB_CFSR_UNALIGNED != 0:
+		println("  cause: unaligned memory access")
+	case cfsr&arm.SCB_CFSR_DIVBYZERO != 0:
+		println("  cause: integer divide by zero")
+	}
+}
+
 // Implement memset for LLVM and compiler-rt.
 //go:export memset
 func libc_memset(ptr unsafe.Pointer, c byte, size uintptr) {
@@ -7,6 +7,7 @@ package runtime
 
 import (
 	"device/arm"
+	"runtime/interrupt"
 	"runtime/volatile"
 	"unsafe"
 )
@@ -15,26 +16,179 @@ type timeUnit int64
 
 const tickMicros = 1
 
-var timestamp timeUnit
+// QEMU runs the LM3S6965 at 12.5MHz, so that one SysTick cycle (using the
+// processor clock) takes 80ns.
+const nanosecondsPerCycle = 80
+
+// The time in nanoseconds at the start of the current SysTick period, and the
+// length of that period in SysTick cycles.
+var (
+	timestamp     timeUnit
+	systickPeriod uint32
+)
 
 //go:export Reset_Handler
 func main() {
 	preinit()
+	initSysTick()
+	loadArgs()
 	initAll()
 	callMain()
-	arm.SemihostingCall(arm.SemihostingReportException, arm.SemihostingApplicationExit)
+	exit(0)
+}
+
+// Buffers for the command line, which is read before the heap is initialized.
+var (
+	cmdline     [256]byte
+	cmdlineArgs [32]string
+)
+
+// loadArgs reads the command line of QEMU (the kernel followed by the -append
+// option) using semihosting and splits it at spaces into args.
+func loadArgs() {
+	block := [2]uintptr{uintptr(unsafe.Pointer(&cmdline[0])), uintptr(len(cmdline))}
+	if arm.SemihostingCall(arm.SemihostingGetCmdline, uintptr(unsafe.Pointer(&block))) != 0 {
+		return
+	}
+	buf := cmdline[:block[1]]
+	n := 0
+	for i := 0; i < len(buf) && n < len(cmdlineArgs); {
+		if buf[i] == ' ' {
+			i++
+			continue
+		}
+		start := i
+		for i < len(buf) && buf[i] != ' ' {
+			i++
+		}
+		// Refer to the static buffer instead of allocating a new string.
+		s := _string{ptr: &buf[start], length: uintptr(i - start)}
+		cmdlineArgs[n] = *(*string)(unsafe.Pointer(&s))
+		n++
+	}
+	args = cmdlineArgs[:n]
+}
+
+// exit stops QEMU with the given exit code using semihosting.
+func exit(code int) {
+	block := [2]uintptr{arm.SemihostingApplicationExit, uintptr(code)}
+	arm.SemihostingCall(arm.SemihostingExitExtended, uintptr(unsafe.Pointer(&block)))
 	abort()
 }
 
+//go:linkname syscall_Exit syscall.Exit
+func syscall_Exit(code int) {
+	exit(code)
+}
+
 const asyncScheduler = false
 
+// initSysTick starts the SysTick timer, which keeps track of time. While the
+// processor is running, it fires only once every SysTick period of 2^24 cycles
+// (about 1.3 seconds), or once every time slice when goroutines are preempted.
+// When sleeping, it is reprogrammed to fire at the next wakeup.
+func initSysTick() {
+	setSysTickPeriod(runningSysTickPeriod())
+	arm.SYST.SYST_CSR.Set(arm.SYST_CSR_TICKINT | arm.SYST_CSR_ENABLE | arm.SYST_CSR_CLKSOURCE)
+}
+
+// runningSysTickPeriod returns the SysTick period in cycles to use while the
+// processor is running.
+func runningSysTickPeriod() uint32 {
+	period := uint32(arm.SYST_RVR_RELOAD_Msk + 1)
+	if timeSlice != 0 && timeSlice/nanosecondsPerCycle < int64(period) {
+		period = uint32(timeSlice / nanosecondsPerCycle)
+		if period < 2 {
+			period = 2
+		}
+	}
+	return period
+}
+
+// timeSliceChanged is called when preemption is enabled and the time slice has
+// changed. It must be called with interrupts disabled.
+func timeSliceChanged() {
+	setSysTickPeriod(runningSysTickPeriod())
+}
+
+// setSysTickPeriod restarts the SysTick timer with a new period, adding the
+// time elapsed in the current period to the timestamp. It must be called with
+// interrupts disabled.
+func setSysTickPeriod(cycles uint32) {
+	timestamp = ticks()
+	// A pending SysTick exception has already been accounted for in the new
+	// timestamp.
+	arm.SCB.ICSR.Set(arm.SCB_ICSR_PENDSTCLR)
+	systickPeriod = cycles
+	arm.SYST.SYST_RVR.Set(cycles - 1)
+	arm.SYST.SYST_CVR.Set(0) // any write clears the counter
+}
+
+// handleSysTick keeps track of time. The runtime owns the SysTick timer on this
+// target, as it is the clock behind time.Now and time.Sleep: programs can't
+// define their own SysTick_Handler or reconfigure the timer with
+// arm.SetupSystemTimer.
+//go:export SysTick_Handler
+func handleSysTick() {
+	timestamp += timeUnit(systickPeriod) * nanosecondsPerCycle
+	preemptTick()
+}
+
+// sleepTicks sleeps for the given number of nanoseconds, or until an interrupt
+// makes a goroutine runnable. Instead of waking up at every SysTick period, the
+// SysTick timer is reprogrammed to fire once at the requested wakeup time and
+// the processor waits for it with the wfi instruction.
 func sleepTicks(d timeUnit) {
-	// TODO: actually sleep here for the given time.
-	timestamp += d
+	wakeup := ticks() + d
+	for {
+		mask := interrupt.Disable()
+		now := ticks()
+		if now >= wakeup || !runqueueEmpty() {
+			interrupt.Restore(mask)
+			break
+		}
+		cycles := (wakeup - now + nanosecondsPerCycle - 1) / nanosecondsPerCycle
+		if cycles > arm.SYST_RVR_RELOAD_Msk+1 {
+			cycles = arm.SYST_RVR_RELOAD_Msk + 1
+		} else if cycles < 2 {
+			// A reload value of 0 would stop the timer.
+			cycles = 2
+		}
+		setSysTickPeriod(uint32(cycles))
+		// Interrupts are disabled, but the processor still wakes up on a
+		// pending interrupt. It will be handled when interrupts are restored.
+		arm.Asm("wfi")
+		interrupt.Restore(mask)
+	}
+
+	// Go back to the SysTick period used while running.
+	mask := interrupt.Disable()
+	setSysTickPeriod(runningSysTickPeriod())
+	interrupt.Restore(mask)
 }
 
+// ticks returns the number of nanoseconds since the SysTick timer was started.
 func ticks() timeUnit {
-	return timestamp
+	mask := interrupt.Disable()
+	base := timestamp
+	current := arm.SYST.SYST_CVR.Get()
+	if arm.SCB.ICSR.HasBits(arm.SCB_ICSR_PENDSTSET) {
+		// The counter wrapped around, but the SysTick exception has not yet
+		// been handled. Read the counter again to be sure it is read after
+		// the wraparound.
+		base += timeUnit(systickPeriod) * nanosecondsPerCycle
+		current = arm.SYST.SYST_CVR.Get()
+	}
+	interrupt.Restore(mask)
+
+	// The counter counts down from systickPeriod-1 to 0. It is also 0 right
+	// after the period has been changed, until it is reloaded on the next
+	// cycle.
+	elapsed := uint32(0)
+	if current != 0 {
+		elapsed = systickPeriod - 1 - current
+	}
+	return base + timeUnit(elapsed)*nanosecondsPerCycle
 }
 
 // UART0 output register.
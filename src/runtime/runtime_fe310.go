@@ -7,14 +7,18 @@ package runtime
 
 import (
 	"machine"
+	"runtime/interrupt"
+	"runtime/volatile"
 	"unsafe"
 
+	"device/riscv"
 	"device/sifive"
 )
 
 type timeUnit int64
 
-const tickMicros = 32768 // RTC runs at 32.768kHz
+// ticks are in nanoseconds, converted from the 32.768kHz mtime counter
+const tickMicros = 1
 
 //go:extern _sbss
 var _sbss unsafe.Pointer
@@ -41,6 +45,7 @@ func main() {
 
 func init() {
 	pric_init()
+	initPLIC()
 	machine.UART0.Configure(machine.UARTConfig{})
 }
 
@@ -59,6 +64,58 @@ func pric_init() {
 	sifive.RTC.RTCCFG.Set(sifive.RTC_RTCCFG_ENALWAYS)
 }
 
+// Handlers for external interrupts, indexed by PLIC interrupt ID. The FE310
+// has 52 interrupt sources, ID 0 means "no interrupt".
+var plicHandlers [53]func(id uint32)
+
+// initPLIC disables all external interrupts in the PLIC (they are enabled one
+// by one by the machine package) and enables external interrupts in the CPU.
+func initPLIC() {
+	sifive.PLIC.ENABLE[0].Set(0)
+	sifive.PLIC.ENABLE[1].Set(0)
+	sifive.PLIC.THRESHOLD.Set(0)
+
+	// Enable machine external interrupts (MEIE in mie) and set the global
+	// interrupt enable flag (MIE in mstatus).
+	riscv.AsmFull("csrs mie, {mask}", map[string]interface{}{
+		"mask": uint32(1 << 11),
+	})
+	riscv.Asm("csrsi mstatus, 8")
+}
+
+//go:linkname setPLICHandler machine.setPLICHandler
+func setPLICHandler(id uint32, handler func(id uint32)) {
+	plicHandlers[id] = handler
+}
+
+// handleInterrupt is called from the trap handler in handleinterrupt.S with
+// the contents of the mcause register.
+//export handleInterrupt
+func handleInterrupt(cause uintptr) {
+	if cause&(1<<31) == 0 {
+		// Exceptions cannot be recovered from: returning would retry the
+		// faulting instruction.
+		print("fatal error: exception with mcause=", cause)
+		println()
+		abort()
+	}
+	switch cause &^ (1 << 31) {
+	case 7: // machine timer interrupt
+		// Disable the timer interrupt, as it stays pending until mtimecmp is
+		// changed. The sleeping code checks the time itself after wakeup.
+		riscv.AsmFull("csrc mie, {mask}", map[string]interface{}{
+			"mask": uint32(1 << 7),
+		})
+	case 11: // machine external interrupt
+		// Claim the interrupt, call the handler, and mark it as completed.
+		id := sifive.PLIC.CLAIM.Get()
+		if id < uint32(len(plicHandlers)) && plicHandlers[id] != nil {
+			plicHandlers[id](id)
+		}
+		sifive.PLIC.CLAIM.Set(id)
+	}
+}
+
 func preinit() {
 	// Initialize .bss: zero-initialized global variables.
 	ptr := unsafe.Pointer(&_sbss)
@@ -81,16 +138,33 @@ func putchar(c byte) {
 	machine.UART0.WriteByte(c)
 }
 
+// The mtime and mtimecmp registers of the CLINT. The mtime counter is driven by
+// the same 32.768kHz clock as the RTC and keeps running while the processor
+// waits for an interrupt. QEMU emulates it at the same frequency, unlike the
+// RTC.
+var (
+	clintMtimecmpLo = (*volatile.Register32)(unsafe.Pointer(uintptr(0x02004000)))
+	clintMtimecmpHi = (*volatile.Register32)(unsafe.Pointer(uintptr(0x02004004)))
+	clintMtimeLo    = (*volatile.Register32)(unsafe.Pointer(uintptr(0x0200bff8)))
+	clintMtimeHi    = (*volatile.Register32)(unsafe.Pointer(uintptr(0x0200bffc)))
+)
+
+// ticks returns the number of nanoseconds since the mtime counter started.
 func ticks() timeUnit {
+	return mtimeToNanoseconds(mtime())
+}
+
+// mtime returns the current value of the 64-bit mtime counter.
+func mtime() uint64 {
 	// Combining the low bits and the high bits yields a time span of over 270
 	// years without counter rollover.
-	highBits := sifive.RTC.RTCHI.Get()
+	highBits := clintMtimeHi.Get()
 	for {
-		lowBits := sifive.RTC.RTCLO.Get()
-		newHighBits := sifive.RTC.RTCHI.Get()
+		lowBits := clintMtimeLo.Get()
+		newHighBits := clintMtimeHi.Get()
 		if newHighBits == highBits {
 			// High bits stayed the same.
-			return timeUnit(lowBits) | (timeUnit(highBits) << 32)
+			return uint64(lowBits) | (uint64(highBits) << 32)
 		}
 		// Retry, because there was a rollover in the low bits (happening every
 		// 1.5 days).
@@ -98,10 +172,57 @@ func ticks() timeUnit {
 	}
 }
 
+// One mtime tick at 32.768kHz is 1e9/32768 = 1953125/64 nanoseconds. The
+// conversions below are split to avoid overflowing 64 bits.
+
+func mtimeToNanoseconds(t uint64) timeUnit {
+	return timeUnit(t/64*1953125 + t%64*1953125/64)
+}
+
+// nanosecondsToMtime converts a positive duration to mtime ticks, rounding up
+// so that a sleep never ends too early.
+func nanosecondsToMtime(d timeUnit) uint64 {
+	n := uint64(d)
+	return n/1953125*64 + (n%1953125*64+1953124)/1953125
+}
+
 const asyncScheduler = false
 
+// sleepTicks sleeps for the given number of nanoseconds, or until an interrupt
+// makes a goroutine runnable. It sets the timer compare register to the wakeup
+// time and waits for the timer interrupt with the wfi instruction.
 func sleepTicks(d timeUnit) {
-	target := ticks() + d
-	for ticks() < target {
+	if d <= 0 {
+		return
 	}
+	wakeup := mtime() + nanosecondsToMtime(d)
+
+	// Set mtimecmp without ever making it lower than both the old and the new
+	// value, to avoid a spurious timer interrupt.
+	clintMtimecmpHi.Set(0xffffffff)
+	clintMtimecmpLo.Set(uint32(wakeup))
+	clintMtimecmpHi.Set(uint32(wakeup >> 32))
+
+	for {
+		mask := interrupt.Disable()
+		if mtime() >= wakeup || !runqueueEmpty() {
+			interrupt.Restore(mask)
+			break
+		}
+		// Enable the timer interrupt, which is disabled again by the interrupt
+		// handler. Interrupts are disabled here, but the processor still wakes
+		// up on a pending interrupt. It will be handled when interrupts are
+		// restored.
+		riscv.AsmFull("csrs mie, {mask}", map[string]interface{}{
+			"mask": uint32(1 << 7),
+		})
+		riscv.Asm("wfi")
+		interrupt.Restore(mask)
+	}
+
+	// The interrupt handler might not have run if the loop ended because of
+	// another interrupt.
+	riscv.AsmFull("csrc mie, {mask}", map[string]interface{}{
+		"mask": uint32(1 << 7),
+	})
 }
@@ -1,4 +1,4 @@
-// +build darwin linux,!baremetal
+// +build darwin linux,!baremetal,!wasi
 
 package runtime
 
@@ -15,6 +15,12 @@ func usleep(usec uint) int
 //go:export malloc
 func malloc(size uintptr) unsafe.Pointer
 
+// cgoMalloc allocates memory for C.malloc, C.CString and C.CBytes. This memory
+// is not managed by the garbage collector and must be freed with C.free.
+func cgoMalloc(size uintptr) unsafe.Pointer {
+	return malloc(size)
+}
+
 //go:export abort
 func abort()
 
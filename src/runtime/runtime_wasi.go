@@ -0,0 +1,197 @@
+// +build wasm,wasi
+
+package runtime
+
+import (
+	"unsafe"
+)
+
+// This file implements the runtime for WASI hosts (like wasmtime), using the
+// wasi_snapshot_preview1 system interface:
+// https://github.com/WebAssembly/WASI/blob/master/phases/snapshot/docs.md
+
+type timeUnit int64 // time in nanoseconds
+
+const tickMicros = 1
+
+// Implements __wasi_iovec_t.
+type __wasi_iovec_t struct {
+	buf    unsafe.Pointer
+	bufLen uint
+}
+
+// Implements __wasi_subscription_t for a clock subscription.
+type __wasi_subscription_t struct {
+	userData uint64
+	tag      uint8
+	clock    __wasi_subscription_clock_t
+}
+
+// Implements __wasi_subscription_clock_t.
+type __wasi_subscription_clock_t struct {
+	id        uint32
+	timeout   uint64
+	precision uint64
+	flags     uint16
+}
+
+// Implements __wasi_event_t. The fd_readwrite field is not used and only
+// included for the size of the struct.
+type __wasi_event_t struct {
+	userData    uint64
+	errno       uint16
+	eventType   uint8
+	fdReadwrite [16]byte
+}
+
+const (
+	__WASI_CLOCKID_REALTIME  = 0
+	__WASI_CLOCKID_MONOTONIC = 1
+
+	__WASI_EVENTTYPE_CLOCK = 0
+)
+
+// The iovs parameter is really a *__wasi_iovec_t, but it is declared as a
+// plain pointer to match the declaration in the syscall package.
+//go:wasm-module wasi_snapshot_preview1
+//go:export fd_write
+func fd_write(id uint32, iovs unsafe.Pointer, iovsLen uint, nwritten *uint) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export clock_time_get
+func clock_time_get(clockID uint32, precision uint64, time *uint64) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export poll_oneoff
+func poll_oneoff(in *__wasi_subscription_t, out *__wasi_event_t, nsubscriptions uint, nevents *uint) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export args_sizes_get
+func args_sizes_get(argc, argvBufSize *uint) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export args_get
+func args_get(argv **byte, argvBuf *byte) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export environ_sizes_get
+func environ_sizes_get(environc, environBufSize *uint) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export environ_get
+func environ_get(environ **byte, environBuf *byte) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export proc_exit
+func proc_exit(exitcode uint32)
+
+//go:export _start
+func _start() {
+	// Load the command line and environment before running package
+	// initializers, as the os package reads them in its init function.
+	var count, bufSize uint
+	if args_sizes_get(&count, &bufSize) == 0 && count != 0 {
+		list := make([]*byte, count)
+		buf := make([]byte, bufSize)
+		if args_get(&list[0], &buf[0]) == 0 {
+			args = splitStrings(list, buf)
+		}
+	}
+	if environ_sizes_get(&count, &bufSize) == 0 && count != 0 {
+		list := make([]*byte, count)
+		buf := make([]byte, bufSize)
+		if environ_get(&list[0], &buf[0]) == 0 {
+			envs = splitStrings(list, buf)
+		}
+	}
+
+	// Let the monotonic clock (used for time.Now) start at the current
+	// wall clock time.
+	var realtime uint64
+	clock_time_get(__WASI_CLOCKID_REALTIME, 1, &realtime)
+	timeOffset = int64(realtime) - int64(ticks())
+
+	initAll()
+	callMain()
+	flushStdout()
+}
+
+// splitStrings converts the command line or environment as returned by WASI
+// (a list of pointers to NUL-terminated strings in buf) to a Go string slice.
+func splitStrings(list []*byte, buf []byte) []string {
+	strings := make([]string, len(list))
+	for i, ptr := range list {
+		start := uintptr(unsafe.Pointer(ptr)) - uintptr(unsafe.Pointer(&buf[0]))
+		end := start
+		for buf[end] != 0 {
+			end++
+		}
+		strings[i] = string(buf[start:end])
+	}
+	return strings
+}
+
+// Output written with putchar is buffered until the end of the line, to avoid a
+// system call for every byte.
+var (
+	putcharBuffer   [120]byte
+	putcharPosition uint
+)
+
+func putchar(c byte) {
+	putcharBuffer[putcharPosition] = c
+	putcharPosition++
+	if c == '\n' || putcharPosition >= uint(len(putcharBuffer)) {
+		flushStdout()
+	}
+}
+
+// flushStdout writes the output buffered by putchar to stdout.
+func flushStdout() {
+	if putcharPosition == 0 {
+		return
+	}
+	iov := __wasi_iovec_t{
+		buf:    unsafe.Pointer(&putcharBuffer[0]),
+		bufLen: putcharPosition,
+	}
+	var nwritten uint
+	fd_write(1, unsafe.Pointer(&iov), 1, &nwritten)
+	putcharPosition = 0
+}
+
+const asyncScheduler = false
+
+// sleepTicks blocks until the given number of nanoseconds has passed, using a
+// relative clock subscription.
+func sleepTicks(d timeUnit) {
+	subscription := __wasi_subscription_t{
+		tag: __WASI_EVENTTYPE_CLOCK,
+		clock: __wasi_subscription_clock_t{
+			id:        __WASI_CLOCKID_MONOTONIC,
+			timeout:   uint64(d),
+			precision: 1000, // 1µs
+		},
+	}
+	var event __wasi_event_t
+	var nevents uint
+	poll_oneoff(&subscription, &event, 1, &nevents)
+}
+
+func ticks() timeUnit {
+	var nano uint64
+	clock_time_get(__WASI_CLOCKID_MONOTONIC, 1, &nano)
+	return timeUnit(nano)
+}
+
+// Abort executes the wasm 'unreachable' instruction.
+func abort() {
+	flushStdout()
+	trap()
+}
+
+//go:linkname syscall_Exit syscall.Exit
+func syscall_Exit(code int) {
+	flushStdout()
+	proc_exit(uint32(code))
+}
@@ -1,11 +1,7 @@
-// +build wasm
+// +build wasm,!wasi
 
 package runtime
 
-import (
-	"unsafe"
-)
-
 type timeUnit float64 // time in milliseconds, just like Date.now() in JavaScript
 
 const tickMicros = 1000000
@@ -68,11 +64,3 @@ func ticks() timeUnit
 func abort() {
 	trap()
 }
-
-//go:export memset
-func memset(ptr unsafe.Pointer, c byte, size uintptr) unsafe.Pointer {
-	for i := uintptr(0); i < size; i++ {
-		*(*byte)(unsafe.Pointer(uintptr(ptr) + i)) = c
-	}
-	return ptr
-}
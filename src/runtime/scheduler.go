@@ -1,10 +1,12 @@
 package runtime
 
 // This file implements the TinyGo scheduler. This scheduler is a very simple
-// cooperative round robin scheduler, with a runqueue that contains a linked
-// list of goroutines (tasks) that should be run next, in order of when they
-// were added to the queue (first-in, first-out). It also contains a sleep queue
-// with sleeping goroutines in order of when they should be re-activated.
+// cooperative round robin scheduler, with runqueues that contain linked lists
+// of goroutines (tasks) that should be run next, in order of when they were
+// added to the queue (first-in, first-out). There is one runqueue per goroutine
+// priority (see SetPriority), and goroutines in a runqueue only run when the
+// runqueues of higher priorities are empty. It also contains a sleep queue with
+// sleeping goroutines in order of when they should be re-activated.
 //
 // The scheduler is used both for the coroutine based scheduler and for the task
 // based scheduler (see compiler/goroutine-lowering.go for a description). In
@@ -13,31 +15,62 @@ package runtime
 // to the bottom of the stack where some important fields are kept. In the case
 // of the coroutine-based scheduler, it is the coroutine pointer (a *i8 in
 // LLVM).
+//
+// Interrupt handlers may make goroutines runnable, for example by sending on a
+// channel. Therefore, the runqueue is only modified with interrupts disabled.
+// Goroutines may also switch to the scheduler with interrupts disabled (see
+// chanSend for example), so the scheduler restores them after each goroutine
+// switch.
 
-import "unsafe"
+import (
+	"runtime/interrupt"
+	"unsafe"
+)
 
 const schedulerDebug = false
 
 // State of a task. Internally represented as:
 //
-//     {i8* next, i8* ptr, i32/i64 data}
+//     {i8* next, i8* ptr, timeUnit data}
+//
+// The data field is a timeUnit because it holds the remaining delay of a
+// sleeping task, which doesn't fit in 32 bits for sleeps of more than a few
+// seconds when a tick is a nanosecond.
 type taskState struct {
 	next *task
 	ptr  unsafe.Pointer
-	data uint
+	data timeUnit
 }
 
-// Queues used by the scheduler.
+// Queues used by the scheduler. The runqueues are indexed by priority, see
+// taskPriority.
 //
-// TODO: runqueueFront can be removed by making the run queue a circular linked
-// list. The runqueueBack will simply refer to the front in the 'next' pointer.
+// TODO: runqueueFront can be removed by making the run queues circular linked
+// lists. The runqueueBack will simply refer to the front in the 'next' pointer.
 var (
-	runqueueFront      *task
-	runqueueBack       *task
+	runqueueFront      [runqueueCount]*task
+	runqueueBack       [runqueueCount]*task
 	sleepQueue         *task
 	sleepQueueBaseTime timeUnit
 )
 
+// The scheduler checks for I/O readiness once every netpollInterval task
+// switches while goroutines are waiting for I/O and others are runnable.
+const netpollInterval = 16
+
+var netpollCounter uint8
+
+// mainExited is set when main.main has returned. Until then, the scheduler
+// waits for interrupts when there is nothing else to do, as an interrupt
+// handler may still wake up a goroutine.
+var mainExited bool
+
+// mainReturned is called by the compiler-generated wrapper of main.main when it
+// returns.
+func mainReturned() {
+	mainExited = true
+}
+
 // Simple logging, for debugging.
 func scheduleLog(msg string) {
 	if schedulerDebug {
@@ -125,8 +158,10 @@ func dropChain(t *task, chain **task, tail ***task) {
 // Pause the current task for a given time.
 //go:linkname sleep time.Sleep
 func sleep(duration int64) {
+	mask := disablePreemption()
 	addSleepTask(getCoroutine(), duration)
 	yield()
+	enablePreemption(mask)
 }
 
 func avrSleep(duration int64) {
@@ -148,12 +183,12 @@ func activateTask(t *task) {
 // getTaskStateData is a helper function to get the current .data field of the
 // goroutine state.
 //go:inline
-func getTaskStateData(t *task) uint {
+func getTaskStateData(t *task) timeUnit {
 	return t.state().data
 }
 
-// Add this task to the end of the run queue. May also destroy the task if it's
-// done.
+// Add this task to the end of the run queue of its priority. May also destroy
+// the task if it's done.
 func runqueuePushBack(t *task) {
 	if schedulerDebug {
 		scheduleLogTask("  pushing back:", t)
@@ -161,41 +196,95 @@ func runqueuePushBack(t *task) {
 			panic("runtime: runqueuePushBack: expected next task to be nil")
 		}
 	}
-	if runqueueBack == nil { // empty runqueue
-		runqueueBack = t
-		runqueueFront = t
+	mask := interrupt.Disable()
+	p := taskPriority(t)
+	if runqueueBack[p] == nil { // empty runqueue
+		runqueueBack[p] = t
+		runqueueFront[p] = t
 	} else {
-		lastTaskState := runqueueBack.state()
+		lastTaskState := runqueueBack[p].state()
 		lastTaskState.next = t
-		runqueueBack = t
+		runqueueBack[p] = t
 	}
+	preemptFor(t)
+	interrupt.Restore(mask)
 }
 
-// Get a task from the front of the run queue. Returns nil if there is none.
+// Get a task from the front of the highest priority run queue that is not
+// empty. Returns nil if there is none.
 func runqueuePopFront() *task {
-	t := runqueueFront
-	if t == nil {
-		return nil
+	mask := interrupt.Disable()
+	for p := len(runqueueFront) - 1; p >= 0; p-- {
+		t := runqueueFront[p]
+		if t == nil {
+			continue
+		}
+		state := t.state()
+		runqueueFront[p] = state.next
+		if runqueueFront[p] == nil {
+			// Runqueue is empty now.
+			runqueueBack[p] = nil
+		}
+		state.next = nil
+		interrupt.Restore(mask)
+		return t
 	}
-	state := t.state()
-	runqueueFront = state.next
-	if runqueueFront == nil {
-		// Runqueue is empty now.
-		runqueueBack = nil
+	interrupt.Restore(mask)
+	return nil
+}
+
+// Remove this task from its run queue, for example because its priority is
+// about to change. Returns whether the task was in the run queue.
+func runqueueRemove(t *task) bool {
+	mask := interrupt.Disable()
+	p := taskPriority(t)
+	var prev *task
+	for c := runqueueFront[p]; c != nil; c = c.state().next {
+		if c == t {
+			next := t.state().next
+			if prev == nil {
+				runqueueFront[p] = next
+			} else {
+				prev.state().next = next
+			}
+			if runqueueBack[p] == t {
+				runqueueBack[p] = prev
+			}
+			t.state().next = nil
+			interrupt.Restore(mask)
+			return true
+		}
+		prev = c
 	}
-	state.next = nil
-	return t
+	interrupt.Restore(mask)
+	return false
+}
+
+// runqueueEmpty returns whether there are no runnable tasks.
+func runqueueEmpty() bool {
+	return !runqueueHasPriority(0)
+}
+
+// runqueueHasPriority returns whether there is a runnable task with at least
+// the given priority.
+func runqueueHasPriority(p int) bool {
+	for ; p < len(runqueueFront); p++ {
+		if runqueueFront[p] != nil {
+			return true
+		}
+	}
+	return false
 }
 
 // Add this task to the sleep queue, assuming its state is set to sleeping.
 func addSleepTask(t *task, duration int64) {
 	if schedulerDebug {
-		println("  set sleep:", t, uint(duration/tickMicros))
+		println("  set sleep:", t, duration/tickMicros)
 		if t.state().next != nil {
 			panic("runtime: addSleepTask: expected next task to be nil")
 		}
 	}
-	t.state().data = uint(duration / tickMicros) // TODO: longer durations
+	t.state().data = timeUnit(duration / tickMicros)
 	now := ticks()
 	if sleepQueue == nil {
 		scheduleLog("  -> sleep new queue")
@@ -225,30 +314,54 @@ func addSleepTask(t *task, duration int64) {
 
 // Run the scheduler until all tasks have finished.
 func scheduler() {
+	// Remember the interrupt state of the scheduler, to restore it when a
+	// goroutine switches back with interrupts disabled.
+	mask := interrupt.Disable()
+	interrupt.Restore(mask)
+
 	// Main scheduler loop.
 	var now timeUnit
 	for {
 		scheduleLog("")
 		scheduleLog("  schedule")
-		if sleepQueue != nil {
+		if sleepQueue != nil || len(timerQueue) != 0 {
 			now = ticks()
 		}
 
 		// Add tasks that are done sleeping to the end of the runqueue so they
 		// will be executed soon.
-		if sleepQueue != nil && now-sleepQueueBaseTime >= timeUnit(sleepQueue.state().data) {
+		if sleepQueue != nil && now-sleepQueueBaseTime >= sleepQueue.state().data {
 			t := sleepQueue
 			scheduleLogTask("  awake:", t)
 			state := t.state()
-			sleepQueueBaseTime += timeUnit(state.data)
+			sleepQueueBaseTime += state.data
 			sleepQueue = state.next
 			state.next = nil
 			runqueuePushBack(t)
 		}
 
+		// Run the functions of timers (time.AfterFunc etc.) that have fired.
+		if len(timerQueue) != 0 {
+			runTimers(now)
+		}
+
+		// Check for file descriptors that became ready every now and then,
+		// even when there are runnable goroutines, so that goroutines waiting
+		// for I/O are not starved.
+		if hasNetpoll && netpollWaiters != 0 && !runqueueEmpty() {
+			netpollCounter++
+			if netpollCounter%netpollInterval == 0 {
+				netpoll(0, false)
+			}
+		}
+
 		t := runqueuePopFront()
 		if t == nil {
-			if sleepQueue == nil {
+			if sleepQueue == nil && len(timerQueue) == 0 && netpollWaiters == 0 {
+				if !mainExited && waitForInterrupt() {
+					// An interrupt may have made a goroutine runnable.
+					continue
+				}
 				// No more tasks to execute.
 				// It would be nice if we could detect deadlocks here, because
 				// there might still be functions waiting on each other in a
@@ -256,13 +369,36 @@ func scheduler() {
 				scheduleLog("  no tasks left!")
 				return
 			}
-			timeLeft := timeUnit(sleepQueue.state().data) - (now - sleepQueueBaseTime)
+			// Only goroutines waiting for I/O remain when there are no sleeping
+			// goroutines and no timers. timeUnit is unsigned on some systems,
+			// so this is tracked separately from timeLeft.
+			waitForever := true
+			var timeLeft timeUnit
+			if sleepQueue != nil {
+				timeLeft = sleepQueue.state().data - (now - sleepQueueBaseTime)
+				waitForever = false
+			}
+			if len(timerQueue) != 0 {
+				var timerLeft timeUnit
+				if when := timerTicks(); when > now {
+					timerLeft = when - now
+				}
+				if waitForever || timerLeft < timeLeft {
+					timeLeft = timerLeft
+				}
+				waitForever = false
+			}
 			if schedulerDebug {
 				println("  sleeping...", sleepQueue, uint(timeLeft))
 				for t := sleepQueue; t != nil; t = t.state().next {
-					println("    task sleeping:", t, timeUnit(t.state().data))
+					println("    task sleeping:", t, t.state().data)
 				}
 			}
+			if hasNetpoll && netpollWaiters != 0 {
+				// Wait for I/O until the next goroutine or timer is due.
+				netpoll(timeLeft, waitForever)
+				continue
+			}
 			sleepTicks(timeLeft)
 			if asyncScheduler {
 				// The sleepTicks function above only sets a timeout at which
@@ -276,10 +412,13 @@ func scheduler() {
 		// Run the given task.
 		scheduleLogTask("  run:", t)
 		t.resume()
+		interrupt.Restore(mask)
 	}
 }
 
 func Gosched() {
+	mask := disablePreemption()
 	runqueuePushBack(getCoroutine())
 	yield()
+	enablePreemption(mask)
 }
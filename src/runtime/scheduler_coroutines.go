@@ -75,6 +75,12 @@ func getSystemStackPointer() uintptr {
 	return getCurrentStackPointer()
 }
 
+// goroutineStackTop returns the top of the stack of the running goroutine, or 0
+// when running on the system stack. Coroutines always run on the system stack.
+func goroutineStackTop() uintptr {
+	return 0
+}
+
 func fakeCoroutine(dst **task) {
 	*dst = getCoroutine()
 	for {
@@ -2,9 +2,10 @@
 
 package runtime
 
-import "unsafe"
-
-const stackSize = 1024
+import (
+	"runtime/interrupt"
+	"unsafe"
+)
 
 // Stack canary, to detect a stack overflow. The number is a random number
 // generated by random.org. The bit fiddling dance is necessary because
@@ -25,6 +26,12 @@ type task struct {
 	sp uintptr
 	taskState
 	canaryPtr *uintptr // used to detect stack overflows
+
+	// Scheduling priority, see priority_tasks.go.
+	priority     uint8  // current priority, including inherited priority
+	basePriority uint8  // priority set with SetPriority
+	mutexesHeld  uint8  // number of sync.Mutex locks held
+	waitingFor   *mutex // the sync.Mutex this goroutine is waiting for, if any
 }
 
 // getCoroutine returns the currently executing goroutine. It is used as an
@@ -42,6 +49,13 @@ func (t *task) state() *taskState {
 	return &t.taskState
 }
 
+// goroutineStackTop returns the top of the stack of the running goroutine, or 0
+// when running on the system stack. The task struct is stored right above the
+// goroutine stack, see startGoroutine.
+func goroutineStackTop() uintptr {
+	return uintptr(unsafe.Pointer(currentTask))
+}
+
 // resume is a small helper that resumes this task until this task switches back
 // to the scheduler.
 func (t *task) resume() {
@@ -71,12 +85,23 @@ func switchToTask(t *task)
 //go:extern tinygo_startTask
 var startTask [0]uint8
 
+// getGoroutineStackSize is a compiler intrinsic that returns the stack size
+// for the goroutine started with the given function pointer (a goroutine start
+// wrapper). It is replaced with a load from a special section just before code
+// generation, so that the stack size can be filled in after linking once the
+// call graph of the goroutine is known.
+func getGoroutineStackSize(fn uintptr) uintptr
+
 // startGoroutine starts a new goroutine with the given function pointer and
 // argument. It creates a new goroutine stack, prepares it for execution, and
-// adds it to the runqueue.
-func startGoroutine(fn, args uintptr) {
-	stack := alloc(stackSize)
-	t := (*task)(unsafe.Pointer(uintptr(stack) + stackSize - unsafe.Sizeof(task{})))
+// adds it to the runqueue. The stackSize is the number of bytes available to
+// the goroutine itself: the stack canary and the task struct are allocated in
+// addition to it.
+func startGoroutine(fn, args, stackSize uintptr) {
+	// Keep the initial stack pointer 8-byte aligned, as required by most ABIs.
+	stackSize = (stackSize + unsafe.Sizeof(uintptr(0)) + 7) &^ 7
+	stack := alloc(stackSize + unsafe.Sizeof(task{}))
+	t := (*task)(unsafe.Pointer(uintptr(stack) + stackSize))
 
 	// Set up the stack canary, a random number that should be checked when
 	// switching from the task back to the scheduler. The stack canary pointer
@@ -87,9 +112,10 @@ func startGoroutine(fn, args uintptr) {
 
 	// Store the initial sp/pc for the startTask function (implemented in
 	// assembly).
-	t.sp = uintptr(stack) + stackSize - unsafe.Sizeof(task{})
+	t.sp = uintptr(stack) + stackSize
 	t.pc = uintptr(unsafe.Pointer(&startTask))
 	t.prepareStartTask(fn, args)
+	initPriority(t)
 	scheduleLogTask("  start goroutine:", t)
 	runqueuePushBack(t)
 }
@@ -103,7 +129,24 @@ func yield() {
 	if *currentTask.canaryPtr != stackCanary {
 		runtimePanic("goroutine stack overflow")
 	}
+	// The goroutine must not be preempted while switching to the scheduler.
+	mask := interrupt.Disable()
+	saved := switchPreemption()
 	switchToScheduler(currentTask)
+	enablePreemption(saved)
+	interrupt.Restore(mask)
+}
+
+// preempt is called from the PendSV handler (through tinygo_preemptTask in
+// assembly) when the time slice of the current goroutine has expired. It puts
+// the goroutine at the back of the runqueue, so that other goroutines can run.
+// See preempt_cortexm.go.
+//export runtime.preempt
+func preempt() {
+	mask := interrupt.Disable()
+	runqueuePushBack(currentTask)
+	yield()
+	interrupt.Restore(mask)
 }
 
 // getSystemStackPointer returns the current stack pointer of the system stack.
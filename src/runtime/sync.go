@@ -1,13 +1,81 @@
 package runtime
 
-// This file contains stub implementations for internal/poll.
+// This file implements semaphores for the sync and internal/poll packages, and
+// lets the sync package disable preemption.
 
-//go:linkname semacquire internal/poll.runtime_Semacquire
+// A goroutine that is waiting in semacquire.
+type semaWaiter struct {
+	sema *uint32
+	t    *task
+	next *semaWaiter
+}
+
+// Goroutines blocked on a semaphore, in the order in which they started
+// waiting.
+var semaWaiters *semaWaiter
+
+// semacquire waits until *sema is greater than zero and then decrements it.
 func semacquire(sema *uint32) {
-	panic("todo: semacquire")
+	mask := disablePreemption()
+	for *sema == 0 {
+		// Wait until semrelease is called on this semaphore.
+		w := &semaWaiter{
+			sema: sema,
+			t:    getCoroutine(),
+		}
+		last := &semaWaiters
+		for *last != nil {
+			last = &(*last).next
+		}
+		*last = w
+		yield()
+	}
+	*sema--
+	enablePreemption(mask)
 }
 
-//go:linkname semrelease internal/poll.runtime_Semrelease
+// semrelease increments *sema and wakes up a goroutine that is waiting for it
+// in semacquire, if there is one.
 func semrelease(sema *uint32) {
-	panic("todo: semrelease")
+	mask := disablePreemption()
+	*sema++
+	for w := &semaWaiters; *w != nil; w = &(*w).next {
+		if (*w).sema == sema {
+			t := (*w).t
+			*w = (*w).next
+			activateTask(t)
+			break
+		}
+	}
+	enablePreemption(mask)
+}
+
+//go:linkname poll_runtime_Semacquire internal/poll.runtime_Semacquire
+func poll_runtime_Semacquire(sema *uint32) {
+	semacquire(sema)
+}
+
+//go:linkname poll_runtime_Semrelease internal/poll.runtime_Semrelease
+func poll_runtime_Semrelease(sema *uint32) {
+	semrelease(sema)
+}
+
+//go:linkname sync_runtime_Semacquire sync.runtime_Semacquire
+func sync_runtime_Semacquire(sema *uint32) {
+	semacquire(sema)
+}
+
+//go:linkname sync_runtime_Semrelease sync.runtime_Semrelease
+func sync_runtime_Semrelease(sema *uint32) {
+	semrelease(sema)
+}
+
+//go:linkname sync_runtime_disablePreemption sync.runtime_disablePreemption
+func sync_runtime_disablePreemption() uint8 {
+	return uint8(disablePreemption())
+}
+
+//go:linkname sync_runtime_enablePreemption sync.runtime_enablePreemption
+func sync_runtime_enablePreemption(state uint8) {
+	enablePreemption(preemptState(state))
 }
@@ -0,0 +1,91 @@
+package runtime
+
+// This file implements the timers of the time package (time.AfterFunc,
+// time.NewTimer, time.NewTicker) and of the network poller. Timers are kept in
+// a queue, sorted by the time at which they fire, that is checked by the
+// scheduler.
+
+import "unsafe"
+
+// timer is the runtime equivalent of time.runtimeTimer, and must be kept in
+// sync with it (Go 1.11 - 1.13).
+type timer struct {
+	tb uintptr // unused
+	i  int     // unused
+
+	when   int64 // nanotime at which the timer fires
+	period int64 // if non-zero, the timer fires again after this period
+	f      func(interface{}, uintptr)
+	arg    interface{}
+	seq    uintptr
+}
+
+// Active timers, sorted by when they fire.
+var timerQueue []*timer
+
+// Note: the parameters are unsafe.Pointer instead of *timer because the time
+// package declares these functions with its own timer type.
+
+//go:linkname startTimer time.startTimer
+func startTimer(tim unsafe.Pointer) {
+	mask := disablePreemption()
+	addTimer((*timer)(tim))
+	enablePreemption(mask)
+}
+
+//go:linkname stopTimer time.stopTimer
+func stopTimer(tim unsafe.Pointer) bool {
+	mask := disablePreemption()
+	removed := removeTimer((*timer)(tim))
+	enablePreemption(mask)
+	return removed
+}
+
+// addTimer adds the timer to the timer queue.
+func addTimer(t *timer) {
+	i := 0
+	for i < len(timerQueue) && timerQueue[i].when <= t.when {
+		i++
+	}
+	timerQueue = append(timerQueue, nil)
+	copy(timerQueue[i+1:], timerQueue[i:])
+	timerQueue[i] = t
+}
+
+// removeTimer removes the timer from the timer queue. It returns whether the
+// timer was active.
+func removeTimer(t *timer) bool {
+	for i, queued := range timerQueue {
+		if queued == t {
+			copy(timerQueue[i:], timerQueue[i+1:])
+			timerQueue[len(timerQueue)-1] = nil
+			timerQueue = timerQueue[:len(timerQueue)-1]
+			return true
+		}
+	}
+	return false
+}
+
+// timerTicks returns the time in ticks at which the first timer in the queue
+// fires. The timer queue must not be empty.
+func timerTicks() timeUnit {
+	return timeUnit(timerQueue[0].when / tickMicros)
+}
+
+// runTimers calls the functions of all timers that have fired by the given
+// time. The functions must not block: time.Timer sends on a buffered channel
+// and time.AfterFunc starts a new goroutine.
+func runTimers(now timeUnit) {
+	for len(timerQueue) != 0 && timerTicks() <= now {
+		t := timerQueue[0]
+		removeTimer(t)
+		if t.period > 0 {
+			// Ticker: schedule the next tick, skipping ticks that were
+			// missed (like the Go runtime does).
+			delta := t.when - int64(now)*tickMicros
+			t.when += t.period * (1 + -delta/t.period)
+			addTimer(t)
+		}
+		t.f(t.arg, t.seq)
+	}
+}
@@ -1,25 +1,8 @@
 package sync
 
-// These mutexes assume there is only one thread of operation: no goroutines,
-// interrupts or anything else.
-
-type Mutex struct {
-	locked bool
-}
-
-func (m *Mutex) Lock() {
-	if m.locked {
-		panic("todo: block on locked mutex")
-	}
-	m.locked = true
-}
-
-func (m *Mutex) Unlock() {
-	if !m.locked {
-		panic("sync: unlock of unlocked Mutex")
-	}
-	m.locked = false
-}
+// Mutex is implemented in mutex_tasks.go and mutex_other.go. The readers count
+// of RWMutex is protected from other goroutines by disabling preemption, but
+// RWMutex can't be used from interrupts.
 
 type RWMutex struct {
 	m       Mutex
@@ -35,18 +18,26 @@ func (rw *RWMutex) Unlock() {
 }
 
 func (rw *RWMutex) RLock() {
+	state := runtime_disablePreemption()
 	if rw.readers == 0 {
 		rw.m.Lock()
 	}
 	rw.readers++
+	runtime_enablePreemption(state)
 }
 
 func (rw *RWMutex) RUnlock() {
+	state := runtime_disablePreemption()
 	if rw.readers == 0 {
+		runtime_enablePreemption(state)
 		panic("sync: unlock of unlocked RWMutex")
 	}
 	rw.readers--
 	if rw.readers == 0 {
 		rw.m.Unlock()
 	}
+	runtime_enablePreemption(state)
 }
+
+func runtime_disablePreemption() uint8     // in package runtime
+func runtime_enablePreemption(state uint8) // in package runtime
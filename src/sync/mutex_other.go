@@ -0,0 +1,24 @@
+// +build !scheduler.tasks
+
+package sync
+
+// These mutexes assume there is only one thread of operation: no goroutines,
+// interrupts or anything else.
+
+type Mutex struct {
+	locked bool
+}
+
+func (m *Mutex) Lock() {
+	if m.locked {
+		panic("todo: block on locked mutex")
+	}
+	m.locked = true
+}
+
+func (m *Mutex) Unlock() {
+	if !m.locked {
+		panic("sync: unlock of unlocked Mutex")
+	}
+	m.locked = false
+}
@@ -0,0 +1,26 @@
+// +build scheduler.tasks
+
+package sync
+
+import "unsafe"
+
+// Mutex is a mutual exclusion lock. Goroutines waiting for it are woken up in
+// order of priority, and the goroutine holding it inherits the priority of the
+// goroutines waiting for it (see runtime.SetPriority).
+type Mutex struct {
+	// This struct is the same as the mutex type in the runtime.
+	locked  bool
+	owner   unsafe.Pointer
+	waiters unsafe.Pointer
+}
+
+func (m *Mutex) Lock() {
+	runtime_mutexLock(m)
+}
+
+func (m *Mutex) Unlock() {
+	runtime_mutexUnlock(m)
+}
+
+func runtime_mutexLock(m *Mutex)   // in package runtime
+func runtime_mutexUnlock(m *Mutex) // in package runtime
@@ -0,0 +1,229 @@
+// +build cortexm,qemu
+
+package syscall
+
+// This file implements file I/O on the host through ARM semihosting, as
+// supported by QEMU when it is started with the -semihosting flag.
+// http://infocenter.arm.com/help/index.jsp?topic=/com.arm.doc.dui0471c/Bgbjhiea.html
+
+import (
+	"device/arm"
+	"unsafe"
+)
+
+// File descriptors of opened files are the semihosting handle plus this
+// offset, so that they never clash with the standard streams (the host may
+// return handles 1 and 2).
+const fdOffset = 3
+
+// Mode parameters of SYS_OPEN, which correspond to the mode strings of fopen.
+// The "+" variant of a mode (open for reading and writing) is the mode plus
+// semihostingModePlus.
+const (
+	semihostingModeRead         = 0 // "r"
+	semihostingModeReadBinary   = 1 // "rb"
+	semihostingModeUpdateBinary = 3 // "r+b"
+	semihostingModeWriteBinary  = 5 // "wb"
+	semihostingModeAppendBinary = 9 // "ab"
+	semihostingModePlus         = 2
+)
+
+// An open semihosting file.
+type semihostingFile struct {
+	handle int
+	offset int64 // current offset, semihosting has no call to query it
+	append bool
+}
+
+var (
+	files       = map[int]*semihostingFile{}
+	stdinHandle = -1 // handle of ":tt" once opened for reading
+)
+
+func Getenv(key string) (value string, found bool) {
+	return "", false // stub
+}
+
+// Open opens the named file on the host. Semihosting only supports the modes
+// of fopen, so O_EXCL is emulated by trying to open the file first.
+func Open(path string, mode int, perm uint32) (fd int, err error) {
+	var flags int
+	switch {
+	case mode&(O_WRONLY|O_RDWR) == 0:
+		flags = semihostingModeReadBinary
+	case mode&O_APPEND != 0:
+		flags = semihostingModeAppendBinary
+	case mode&O_TRUNC != 0:
+		flags = semihostingModeWriteBinary
+	default:
+		// Open for writing without truncating: this requires the file to
+		// exist, unless it may be created.
+		flags = semihostingModeUpdateBinary
+		if mode&O_CREAT != 0 && !exists(path) {
+			flags = semihostingModeWriteBinary
+		}
+	}
+	if mode&O_RDWR != 0 {
+		flags |= semihostingModePlus
+	}
+	if mode&(O_CREAT|O_EXCL) == O_CREAT|O_EXCL && exists(path) {
+		return -1, EEXIST
+	}
+
+	handle, err := semihostingOpen(path, flags)
+	if err != nil {
+		return -1, err
+	}
+	files[handle] = &semihostingFile{
+		handle: handle,
+		append: mode&O_APPEND != 0,
+	}
+	return handle + fdOffset, nil
+}
+
+func Read(fd int, p []byte) (n int, err error) {
+	if fd == Stdin {
+		if stdinHandle < 0 {
+			stdinHandle, err = semihostingOpen(":tt", semihostingModeRead)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return semihostingTransfer(arm.SemihostingRead, stdinHandle, p)
+	}
+	f := files[fd-fdOffset]
+	if f == nil {
+		return 0, EBADF
+	}
+	n, err = semihostingTransfer(arm.SemihostingRead, f.handle, p)
+	f.offset += int64(n)
+	return
+}
+
+func Write(fd int, p []byte) (n int, err error) {
+	f := files[fd-fdOffset]
+	if f == nil {
+		return 0, EBADF
+	}
+	n, err = semihostingTransfer(arm.SemihostingWrite, f.handle, p)
+	if f.append {
+		f.offset, _ = semihostingFileLen(f.handle)
+	} else {
+		f.offset += int64(n)
+	}
+	return
+}
+
+// Seek sets the offset of the file. Semihosting only supports absolute offsets,
+// so relative offsets are calculated from the offset tracked by this package
+// or the file length.
+func Seek(fd int, offset int64, whence int) (off int64, err error) {
+	f := files[fd-fdOffset]
+	if f == nil {
+		return 0, EBADF
+	}
+	switch whence {
+	case 0: // SEEK_SET
+		off = offset
+	case 1: // SEEK_CUR
+		off = f.offset + offset
+	case 2: // SEEK_END
+		size, err := semihostingFileLen(f.handle)
+		if err != nil {
+			return 0, err
+		}
+		off = size + offset
+	default:
+		return 0, EINVAL
+	}
+	if off < 0 {
+		return 0, EINVAL
+	}
+	block := [2]uintptr{uintptr(f.handle), uintptr(off)}
+	if arm.SemihostingCall(arm.SemihostingSeek, uintptr(unsafe.Pointer(&block))) != 0 {
+		return 0, semihostingErrno()
+	}
+	f.offset = off
+	return off, nil
+}
+
+func Close(fd int) (err error) {
+	if fd < fdOffset {
+		// The standard streams are not real semihosting files.
+		return nil
+	}
+	f := files[fd-fdOffset]
+	if f == nil {
+		return EBADF
+	}
+	delete(files, f.handle)
+	block := [1]uintptr{uintptr(f.handle)}
+	if arm.SemihostingCall(arm.SemihostingClose, uintptr(unsafe.Pointer(&block))) != 0 {
+		return semihostingErrno()
+	}
+	return nil
+}
+
+// exists returns whether the given path can be opened for reading.
+func exists(path string) bool {
+	handle, err := semihostingOpen(path, semihostingModeReadBinary)
+	if err != nil {
+		return false
+	}
+	block := [1]uintptr{uintptr(handle)}
+	arm.SemihostingCall(arm.SemihostingClose, uintptr(unsafe.Pointer(&block)))
+	return true
+}
+
+// semihostingOpen opens a file with SYS_OPEN and returns the host handle.
+func semihostingOpen(path string, flags int) (handle int, err error) {
+	// The path must be NUL-terminated, but the length is passed as well.
+	buf := make([]byte, len(path)+1)
+	copy(buf, path)
+	block := [3]uintptr{uintptr(unsafe.Pointer(&buf[0])), uintptr(flags), uintptr(len(path))}
+	handle = arm.SemihostingCall(arm.SemihostingOpen, uintptr(unsafe.Pointer(&block)))
+	if handle == -1 {
+		return -1, semihostingErrno()
+	}
+	return handle, nil
+}
+
+// semihostingTransfer reads into or writes from p with SYS_READ or SYS_WRITE.
+// Both return the number of bytes that were not transferred.
+func semihostingTransfer(call int, handle int, p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	block := [3]uintptr{uintptr(handle), uintptr(unsafe.Pointer(&p[0])), uintptr(len(p))}
+	remaining := arm.SemihostingCall(call, uintptr(unsafe.Pointer(&block)))
+	if remaining < 0 || remaining > len(p) {
+		return 0, semihostingErrno()
+	}
+	n = len(p) - remaining
+	if call == arm.SemihostingWrite && remaining != 0 {
+		// Unlike reads, short writes are errors.
+		return n, semihostingErrno()
+	}
+	return n, nil
+}
+
+// semihostingFileLen returns the length of the file with SYS_FLEN.
+func semihostingFileLen(handle int) (int64, error) {
+	block := [1]uintptr{uintptr(handle)}
+	size := arm.SemihostingCall(arm.SemihostingFileLen, uintptr(unsafe.Pointer(&block)))
+	if size < 0 {
+		return 0, semihostingErrno()
+	}
+	return int64(size), nil
+}
+
+// semihostingErrno returns the errno value of the last failed semihosting
+// call. Hosts report their own errno values, which match the values in this
+// package on Linux hosts.
+func semihostingErrno() error {
+	errno := arm.SemihostingCall(arm.SemihostingErrno, 0)
+	if errno == 0 {
+		return EIO
+	}
+	return Errno(errno)
+}
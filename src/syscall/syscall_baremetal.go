@@ -1,4 +1,4 @@
-// +build baremetal
+// +build baremetal wasi
 
 package syscall
 
@@ -47,26 +47,6 @@ const (
 	O_CLOEXEC = 0
 )
 
-func Getenv(key string) (value string, found bool) {
-	return "", false // stub
-}
-
-func Open(path string, mode int, perm uint32) (fd int, err error) {
-	return 0, ENOSYS
-}
-
-func Read(fd int, p []byte) (n int, err error) {
-	return 0, ENOSYS
-}
-
-func Seek(fd int, offset int64, whence int) (off int64, err error) {
-	return 0, ENOSYS
-}
-
-func Close(fd int) (err error) {
-	return ENOSYS
-}
-
 // Processes
 
 type WaitStatus uint32
@@ -24,13 +24,26 @@ func getErrno() Errno {
 }
 
 const (
-	ENOENT      Errno = 2
-	EINTR       Errno = 4
-	EMFILE      Errno = 24
-	EAGAIN      Errno = 35
-	ETIMEDOUT   Errno = 60
-	ENOSYS      Errno = 78
-	EWOULDBLOCK Errno = EAGAIN
+	EPERM        Errno = 1
+	ENOENT       Errno = 2
+	EINTR        Errno = 4
+	EIO          Errno = 5
+	EBADF        Errno = 9
+	EACCES       Errno = 13
+	EEXIST       Errno = 17
+	EXDEV        Errno = 18
+	ENOTDIR      Errno = 20
+	EISDIR       Errno = 21
+	EINVAL       Errno = 22
+	EMFILE       Errno = 24
+	ERANGE       Errno = 34
+	EAGAIN       Errno = 35
+	ETIMEDOUT    Errno = 60
+	ELOOP        Errno = 62
+	ENAMETOOLONG Errno = 63
+	ENOTEMPTY    Errno = 66
+	ENOSYS       Errno = 78
+	EWOULDBLOCK  Errno = EAGAIN
 )
 
 type Signal int
@@ -48,4 +61,66 @@ const (
 	O_RDONLY = 0
 	O_WRONLY = 1
 	O_RDWR   = 2
+	O_APPEND = 0x8
+	O_SYNC   = 0x80
+	O_CREAT  = 0x200
+	O_TRUNC  = 0x400
+	O_EXCL   = 0x800
 )
+
+const (
+	S_IFMT   = 0xf000
+	S_IFBLK  = 0x6000
+	S_IFCHR  = 0x2000
+	S_IFDIR  = 0x4000
+	S_IFIFO  = 0x1000
+	S_IFLNK  = 0xa000
+	S_IFREG  = 0x8000
+	S_IFSOCK = 0xc000
+	S_ISGID  = 0x400
+	S_ISUID  = 0x800
+	S_ISVTX  = 0x200
+)
+
+// PATH_MAX in sys/syslimits.h.
+const pathMax = 1024
+
+type Timespec struct {
+	Sec  int64
+	Nsec int64
+}
+
+// Stat_t is struct stat with 64-bit inode numbers, as used by the stat$INODE64
+// family of functions.
+type Stat_t struct {
+	Dev           int32
+	Mode          uint16
+	Nlink         uint16
+	Ino           uint64
+	Uid           uint32
+	Gid           uint32
+	Rdev          int32
+	Pad_cgo_0     [4]byte
+	Atimespec     Timespec
+	Mtimespec     Timespec
+	Ctimespec     Timespec
+	Birthtimespec Timespec
+	Size          int64
+	Blocks        int64
+	Blksize       int32
+	Flags         uint32
+	Gen           uint32
+	Lspare        int32
+	Qspare        [2]int64
+}
+
+// Dirent is a directory entry as returned by __getdirentries64.
+type Dirent struct {
+	Ino       uint64
+	Seekoff   uint64
+	Reclen    uint16
+	Namlen    uint16
+	Type      uint8
+	Name      [1024]int8
+	Pad_cgo_0 [3]byte
+}
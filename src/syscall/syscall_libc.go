@@ -7,7 +7,10 @@ import (
 )
 
 func Close(fd int) (err error) {
-	return ENOSYS // TODO
+	if libc_close(int32(fd)) < 0 {
+		err = getErrno()
+	}
+	return
 }
 
 func Write(fd int, p []byte) (n int, err error) {
@@ -20,15 +23,140 @@ func Write(fd int, p []byte) (n int, err error) {
 }
 
 func Read(fd int, p []byte) (n int, err error) {
-	return 0, ENOSYS // TODO
+	buf, count := splitSlice(p)
+	n = libc_read(int32(fd), buf, uint(count))
+	if n < 0 {
+		err = getErrno()
+	}
+	return
 }
 
 func Seek(fd int, offset int64, whence int) (off int64, err error) {
-	return 0, ENOSYS // TODO
+	off = libc_lseek(int32(fd), offset, int32(whence))
+	if off < 0 {
+		err = getErrno()
+	}
+	return
 }
 
 func Open(path string, mode int, perm uint32) (fd int, err error) {
-	return 0, ENOSYS // TODO
+	fd = int(libc_open(cstring(path), int32(mode), perm))
+	if fd < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+func Stat(path string, st *Stat_t) (err error) {
+	if libc_stat(cstring(path), st) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+func Lstat(path string, st *Stat_t) (err error) {
+	if libc_lstat(cstring(path), st) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+func Fstat(fd int, st *Stat_t) (err error) {
+	if libc_fstat(int32(fd), st) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+func Mkdir(path string, mode uint32) (err error) {
+	if libc_mkdir(cstring(path), uint16(mode)) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+func Rmdir(path string) (err error) {
+	if libc_rmdir(cstring(path)) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+func Unlink(path string) (err error) {
+	if libc_unlink(cstring(path)) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+func Rename(from, to string) (err error) {
+	if libc_rename(cstring(from), cstring(to)) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+func Chdir(path string) (err error) {
+	if libc_chdir(cstring(path)) < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+func Getwd() (wd string, err error) {
+	var buf [pathMax]byte
+	if libc_getcwd(&buf[0], uint(len(buf))) == nil {
+		return "", getErrno()
+	}
+	return gostring(buf[:]), nil
+}
+
+func Readlink(path string, buf []byte) (n int, err error) {
+	ptr, count := splitSlice(buf)
+	n = libc_readlink(cstring(path), ptr, uint(count))
+	if n < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+// ReadDirent reads directory entries from fd into buf, in the format parsed by
+// ParseDirent.
+func ReadDirent(fd int, buf []byte) (n int, err error) {
+	ptr, count := splitSlice(buf)
+	var base uintptr
+	n = libc___getdirentries64(int32(fd), ptr, uint(count), &base)
+	if n < 0 {
+		err = getErrno()
+	}
+	return
+}
+
+// ParseDirent parses up to max directory entries in buf, appending the names
+// to names. It returns the number of bytes consumed from buf, the number of
+// entries added to names, and the new names slice.
+func ParseDirent(buf []byte, max int, names []string) (consumed int, count int, newnames []string) {
+	origlen := len(buf)
+	for max != 0 && len(buf) > 0 {
+		dirent := (*Dirent)(unsafe.Pointer(&buf[0]))
+		if dirent.Reclen == 0 || int(dirent.Reclen) > len(buf) {
+			// Invalid entry, stop parsing.
+			break
+		}
+		buf = buf[dirent.Reclen:]
+		if dirent.Ino == 0 {
+			// File absent in directory.
+			continue
+		}
+		name := (*[len(Dirent{}.Name)]byte)(unsafe.Pointer(&dirent.Name[0]))[:dirent.Namlen]
+		if string(name) == "." || string(name) == ".." {
+			continue
+		}
+		max--
+		count++
+		names = append(names, string(name))
+	}
+	return origlen - len(buf), count, names
 }
 
 func Kill(pid int, sig Signal) (err error) {
@@ -52,6 +180,83 @@ func splitSlice(p []byte) (buf *byte, len uintptr) {
 	return slice.buf, slice.len
 }
 
+// cstring returns a pointer to a NUL-terminated copy of s, for passing to libc.
+func cstring(s string) *byte {
+	buf := make([]byte, len(s)+1)
+	copy(buf, s)
+	return &buf[0]
+}
+
+// gostring returns the string in buf up to the first NUL byte.
+func gostring(buf []byte) string {
+	for i, c := range buf {
+		if c == 0 {
+			return string(buf[:i])
+		}
+	}
+	return string(buf)
+}
+
 // ssize_t write(int fd, const void *buf, size_t count)
 //go:export write
 func libc_write(fd int32, buf *byte, count uint) int
+
+// ssize_t read(int fd, void *buf, size_t count)
+//go:export read
+func libc_read(fd int32, buf *byte, count uint) int
+
+// off_t lseek(int fd, off_t offset, int whence)
+//go:export lseek
+func libc_lseek(fd int32, offset int64, whence int32) int64
+
+// int open(const char *pathname, int flags, mode_t mode)
+//go:export open
+func libc_open(pathname *byte, flags int32, mode uint32) int32
+
+// int close(int fd)
+//go:export close
+func libc_close(fd int32) int32
+
+// int stat(const char *path, struct stat *buf)
+//go:export stat$INODE64
+func libc_stat(path *byte, buf *Stat_t) int32
+
+// int lstat(const char *path, struct stat *buf)
+//go:export lstat$INODE64
+func libc_lstat(path *byte, buf *Stat_t) int32
+
+// int fstat(int fd, struct stat *buf)
+//go:export fstat$INODE64
+func libc_fstat(fd int32, buf *Stat_t) int32
+
+// int mkdir(const char *path, mode_t mode)
+//go:export mkdir
+func libc_mkdir(path *byte, mode uint16) int32
+
+// int rmdir(const char *path)
+//go:export rmdir
+func libc_rmdir(path *byte) int32
+
+// int unlink(const char *path)
+//go:export unlink
+func libc_unlink(path *byte) int32
+
+// int rename(const char *from, const char *to)
+//go:export rename
+func libc_rename(from, to *byte) int32
+
+// int chdir(const char *path)
+//go:export chdir
+func libc_chdir(path *byte) int32
+
+// char *getcwd(char *buf, size_t size)
+//go:export getcwd
+func libc_getcwd(buf *byte, size uint) *byte
+
+// ssize_t readlink(const char *path, char *buf, size_t bufsize)
+//go:export readlink
+func libc_readlink(path *byte, buf *byte, bufsize uint) int
+
+// ssize_t __getdirentries64(int fd, void *buf, size_t bufsize, off_t *basep)
+//go:export __getdirentries64
+func libc___getdirentries64(fd int32, buf *byte, bufsize uint, basep *uintptr) int
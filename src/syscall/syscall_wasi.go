@@ -0,0 +1,387 @@
+// +build wasi
+
+package syscall
+
+import (
+	"unsafe"
+)
+
+// This file implements file access using the wasi_snapshot_preview1 system
+// interface. WASI has no global file system namespace: files can only be
+// opened relative to directories that were preopened by the host, for example
+// using the --dir flag of wasmtime.
+
+// Implements __wasi_iovec_t.
+type iovec struct {
+	buf    unsafe.Pointer
+	bufLen uint
+}
+
+// Implements __wasi_prestat_t.
+type prestat struct {
+	tag     uint8
+	nameLen uint32
+}
+
+// Implements __wasi_fdstat_t.
+type fdstat struct {
+	filetype         uint8
+	flags            uint16
+	rightsBase       uint64
+	rightsInheriting uint64
+}
+
+const (
+	preopentypeDir = 0
+
+	lookupflagSymlinkFollow = 1 << 0
+
+	oflagCreat = 1 << 0
+	oflagExcl  = 1 << 2
+	oflagTrunc = 1 << 3
+
+	fdflagAppend = 1 << 0
+	fdflagSync   = 1 << 4
+
+	rightFdRead  = 1 << 1
+	rightFdWrite = 1 << 6
+)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export fd_write
+func fd_write(fd uint32, iovs unsafe.Pointer, iovsLen uint, nwritten *uint) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export fd_read
+func fd_read(fd uint32, iovs unsafe.Pointer, iovsLen uint, nread *uint) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export fd_seek
+func fd_seek(fd uint32, offset int64, whence uint8, newoffset *uint64) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export fd_close
+func fd_close(fd uint32) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export fd_fdstat_get
+func fd_fdstat_get(fd uint32, stat *fdstat) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export fd_prestat_get
+func fd_prestat_get(fd uint32, stat *prestat) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export fd_prestat_dir_name
+func fd_prestat_dir_name(fd uint32, path *byte, pathLen uint) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export path_open
+func path_open(dirfd uint32, dirflags uint32, path *byte, pathLen uint, oflags uint16, rightsBase, rightsInheriting uint64, fdflags uint16, fd *uint32) (errno uint16)
+
+//go:wasm-module wasi_snapshot_preview1
+//go:export random_get
+func random_get(buf *byte, bufLen uint) (errno uint16)
+
+func Write(fd int, p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	iov := iovec{
+		buf:    unsafe.Pointer(&p[0]),
+		bufLen: uint(len(p)),
+	}
+	var nwritten uint
+	if errno := fd_write(uint32(fd), unsafe.Pointer(&iov), 1, &nwritten); errno != 0 {
+		return 0, wasiError(errno)
+	}
+	return int(nwritten), nil
+}
+
+func Read(fd int, p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	iov := iovec{
+		buf:    unsafe.Pointer(&p[0]),
+		bufLen: uint(len(p)),
+	}
+	var nread uint
+	if errno := fd_read(uint32(fd), unsafe.Pointer(&iov), 1, &nread); errno != 0 {
+		return 0, wasiError(errno)
+	}
+	return int(nread), nil
+}
+
+func Seek(fd int, offset int64, whence int) (off int64, err error) {
+	// The whence values (SEEK_SET, SEEK_CUR, SEEK_END) are the same in WASI.
+	var newoffset uint64
+	if errno := fd_seek(uint32(fd), offset, uint8(whence), &newoffset); errno != 0 {
+		return 0, wasiError(errno)
+	}
+	return int64(newoffset), nil
+}
+
+func Close(fd int) (err error) {
+	if errno := fd_close(uint32(fd)); errno != 0 {
+		return wasiError(errno)
+	}
+	return nil
+}
+
+// Open opens the file at the given path, which must be inside one of the
+// directories preopened by the host. Relative paths are resolved against a
+// directory preopened as ".".
+func Open(path string, mode int, perm uint32) (fd int, err error) {
+	dirfd, relpath, ok := findPreopen(path)
+	if !ok {
+		return -1, EACCES
+	}
+
+	var oflags uint16
+	if mode&O_CREAT != 0 {
+		oflags |= oflagCreat
+	}
+	if mode&O_EXCL != 0 {
+		oflags |= oflagExcl
+	}
+	if mode&O_TRUNC != 0 {
+		oflags |= oflagTrunc
+	}
+	var fdflags uint16
+	if mode&O_APPEND != 0 {
+		fdflags |= fdflagAppend
+	}
+	if mode&O_SYNC != 0 {
+		fdflags |= fdflagSync
+	}
+
+	// Request all the rights that the directory passes on to files opened
+	// inside it, except for reading or writing if not allowed by the mode.
+	var stat fdstat
+	if errno := fd_fdstat_get(dirfd, &stat); errno != 0 {
+		return -1, wasiError(errno)
+	}
+	rights := stat.rightsInheriting
+	switch mode & (O_RDONLY | O_WRONLY | O_RDWR) {
+	case O_RDONLY:
+		rights &^= rightFdWrite
+	case O_WRONLY:
+		rights &^= rightFdRead
+	}
+
+	buf := []byte(relpath)
+	var newfd uint32
+	errno := path_open(dirfd, lookupflagSymlinkFollow, &buf[0], uint(len(buf)), oflags, rights, stat.rightsInheriting, fdflags, &newfd)
+	if errno != 0 {
+		return -1, wasiError(errno)
+	}
+	return int(newfd), nil
+}
+
+// A directory that was preopened by the host.
+type preopen struct {
+	fd   uint32
+	name string
+}
+
+var (
+	preopens       []preopen
+	preopensLoaded bool
+)
+
+// loadPreopens enumerates the directories that were preopened by the host.
+// They have sequential file descriptors, starting right after stdin, stdout
+// and stderr.
+func loadPreopens() {
+	if preopensLoaded {
+		return
+	}
+	preopensLoaded = true
+	for fd := uint32(3); ; fd++ {
+		var stat prestat
+		if fd_prestat_get(fd, &stat) != 0 {
+			// EBADF, so this is the last preopened file descriptor.
+			break
+		}
+		if stat.tag != preopentypeDir || stat.nameLen == 0 {
+			continue
+		}
+		buf := make([]byte, stat.nameLen)
+		if fd_prestat_dir_name(fd, &buf[0], uint(len(buf))) != 0 {
+			continue
+		}
+		// Some hosts include a terminating NUL byte, and directories may be
+		// specified with a trailing slash.
+		name := string(buf)
+		for len(name) > 1 && (name[len(name)-1] == 0 || name[len(name)-1] == '/') {
+			name = name[:len(name)-1]
+		}
+		if len(name) > 2 && name[:2] == "./" {
+			name = name[2:]
+		}
+		preopens = append(preopens, preopen{fd, name})
+	}
+}
+
+// findPreopen returns the preopened directory that contains the given path
+// (the one with the longest name if there are multiple) and the path relative
+// to that directory.
+func findPreopen(path string) (dirfd uint32, relpath string, ok bool) {
+	loadPreopens()
+	best := -1
+	for i, dir := range preopens {
+		rel, contains := relativeTo(path, dir.name)
+		if contains && (best < 0 || len(dir.name) > len(preopens[best].name)) {
+			best = i
+			relpath = rel
+		}
+	}
+	if best < 0 {
+		return 0, "", false
+	}
+	return preopens[best].fd, relpath, true
+}
+
+// relativeTo returns path relative to dir, if path is inside dir.
+func relativeTo(path, dir string) (rel string, ok bool) {
+	if path == "" {
+		return "", false
+	}
+	if dir == "." {
+		// The current working directory: contains all relative paths.
+		if path[0] == '/' {
+			return "", false
+		}
+		return path, true
+	}
+	if dir == "/" {
+		if path[0] != '/' {
+			return "", false
+		}
+		dir = ""
+	}
+	if len(path) < len(dir) || path[:len(dir)] != dir {
+		return "", false
+	}
+	rel = path[len(dir):]
+	if rel == "" || rel == "/" {
+		return ".", true
+	}
+	if rel[0] != '/' {
+		// For example, path is /foobar and dir is /foo.
+		return "", false
+	}
+	return rel[1:], true
+}
+
+func runtime_envs() []string // in package runtime
+
+// Getenv returns the value of the environment variable from the environment
+// passed by the host.
+func Getenv(key string) (value string, found bool) {
+	for _, env := range runtime_envs() {
+		if len(env) > len(key) && env[len(key)] == '=' && env[:len(key)] == key {
+			return env[len(key)+1:], true
+		}
+	}
+	return "", false
+}
+
+// Getrandom fills buf with random bytes provided by the host, similar to the
+// getrandom system call on Linux. The flags are ignored.
+func Getrandom(buf []byte, flags int) (n int, err error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	if errno := random_get(&buf[0], uint(len(buf))); errno != 0 {
+		return 0, wasiError(errno)
+	}
+	return len(buf), nil
+}
+
+// wasiErrnos maps WASI error numbers to Errno values. WASI errors without
+// matching Errno are mapped to EIO.
+var wasiErrnos = [...]Errno{
+	1:  E2BIG,
+	2:  EACCES,
+	3:  EADDRINUSE,
+	4:  EADDRNOTAVAIL,
+	5:  EAFNOSUPPORT,
+	6:  EAGAIN,
+	7:  EALREADY,
+	8:  EBADF,
+	9:  EBADMSG,
+	10: EBUSY,
+	11: ECANCELED,
+	12: ECHILD,
+	13: ECONNABORTED,
+	14: ECONNREFUSED,
+	15: ECONNRESET,
+	16: EDEADLK,
+	17: EDESTADDRREQ,
+	18: EDOM,
+	19: EDQUOT,
+	20: EEXIST,
+	21: EFAULT,
+	22: EFBIG,
+	23: EHOSTUNREACH,
+	24: EIDRM,
+	25: EILSEQ,
+	26: EINPROGRESS,
+	27: EINTR,
+	28: EINVAL,
+	29: EIO,
+	30: EISCONN,
+	31: EISDIR,
+	32: ELOOP,
+	33: EMFILE,
+	34: EMLINK,
+	35: EMSGSIZE,
+	36: EMULTIHOP,
+	37: ENAMETOOLONG,
+	38: ENETDOWN,
+	39: ENETRESET,
+	40: ENETUNREACH,
+	41: ENFILE,
+	42: ENOBUFS,
+	43: ENODEV,
+	44: ENOENT,
+	45: ENOEXEC,
+	46: ENOLCK,
+	47: ENOLINK,
+	48: ENOMEM,
+	49: ENOMSG,
+	50: ENOPROTOOPT,
+	51: ENOSPC,
+	52: ENOSYS,
+	53: ENOTCONN,
+	54: ENOTDIR,
+	55: ENOTEMPTY,
+	57: ENOTSOCK,
+	58: ENOTSUP,
+	59: ENOTTY,
+	60: ENXIO,
+	61: EOVERFLOW,
+	63: EPERM,
+	64: EPIPE,
+	65: EPROTO,
+	66: EPROTONOSUPPORT,
+	67: EPROTOTYPE,
+	68: ERANGE,
+	69: EROFS,
+	70: ESPIPE,
+	71: ESRCH,
+	72: ESTALE,
+	73: ETIMEDOUT,
+	75: EXDEV,
+	76: EACCES, // ENOTCAPABLE: the rights of the file descriptor don't allow this
+}
+
+// wasiError converts a WASI error number to an error value.
+func wasiError(errno uint16) error {
+	if int(errno) < len(wasiErrnos) && wasiErrnos[errno] != 0 {
+		return errnoErr(wasiErrnos[errno])
+	}
+	return EIO
+}
@@ -0,0 +1,355 @@
+package stacksize
+
+// This file implements a parser for the DWARF call frame information in the
+// .debug_frame section, as far as needed to determine the frame size of each
+// function.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// frameInfo is the frame size of a single function, as described by a single
+// FDE in the .debug_frame section.
+type frameInfo struct {
+	start     uint64 // start address of the function
+	end       uint64 // end address of the function (exclusive)
+	frameSize uint64 // maximum distance between the CFA and the stack pointer
+	known     bool   // whether the frame size could be determined
+}
+
+// cie is a Common Information Entry, that contains information shared by many
+// FDEs (functions).
+type cie struct {
+	codeAlignmentFactor uint64
+	dataAlignmentFactor int64
+	initialInstructions []byte
+}
+
+// cfaState is the part of the CFA rule that is relevant for determining the
+// stack frame size: the register the CFA is based on and the offset from that
+// register.
+type cfaState struct {
+	register uint64
+	offset   int64
+}
+
+// DWARF call frame instructions. Only the high two bits are used for the first
+// three instructions, the low six bits contain an operand.
+const (
+	dwCFAAdvanceLoc        = 0x1 << 6
+	dwCFAOffset            = 0x2 << 6
+	dwCFARestore           = 0x3 << 6
+	dwCFANop               = 0x00
+	dwCFASetLoc            = 0x01
+	dwCFAAdvanceLoc1       = 0x02
+	dwCFAAdvanceLoc2       = 0x03
+	dwCFAAdvanceLoc4       = 0x04
+	dwCFAOffsetExtended    = 0x05
+	dwCFARestoreExtended   = 0x06
+	dwCFAUndefined         = 0x07
+	dwCFASameValue         = 0x08
+	dwCFARegister          = 0x09
+	dwCFARememberState     = 0x0a
+	dwCFARestoreState      = 0x0b
+	dwCFADefCFA            = 0x0c
+	dwCFADefCFARegister    = 0x0d
+	dwCFADefCFAOffset      = 0x0e
+	dwCFADefCFAExpression  = 0x0f
+	dwCFAExpression        = 0x10
+	dwCFAOffsetExtendedSF  = 0x11
+	dwCFADefCFASF          = 0x12
+	dwCFADefCFAOffsetSF    = 0x13
+	dwCFAValOffset         = 0x14
+	dwCFAValOffsetSF       = 0x15
+	dwCFAValExpression     = 0x16
+	dwCFAGNUArgsSize       = 0x2e
+	dwCFAGNUNegOffsetExtSF = 0x2f
+)
+
+// parseFrames reads all FDEs in the given .debug_frame section data and
+// determines the frame size for each of them. The stack pointer register number
+// (as used in DWARF) must be provided, as the CFA is expected to be relative to
+// the stack pointer for the frame size to be known.
+func parseFrames(data []byte, byteOrder binary.ByteOrder, addressSize int, spRegister uint64) ([]frameInfo, error) {
+	cies := map[uint64]*cie{}
+	var frames []frameInfo
+	offset := uint64(0)
+	for offset < uint64(len(data)) {
+		if uint64(len(data))-offset < 4 {
+			return nil, errors.New("truncated .debug_frame section")
+		}
+		length := uint64(byteOrder.Uint32(data[offset:]))
+		if length == 0xffffffff {
+			return nil, errors.New("64-bit DWARF is not supported in .debug_frame")
+		}
+		if length < 4 || offset+4+length > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid entry length in .debug_frame at offset %#x", offset)
+		}
+		entry := data[offset+4 : offset+4+length]
+		entryOffset := offset
+		offset += 4 + length
+
+		id := uint64(byteOrder.Uint32(entry))
+		r := bytes.NewReader(entry[4:])
+		if id == 0xffffffff {
+			// This is a CIE.
+			c, err := parseCIE(r)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse CIE at offset %#x: %v", entryOffset, err)
+			}
+			cies[entryOffset] = c
+			continue
+		}
+
+		// This is a FDE. The id is the offset of the CIE it belongs to.
+		c, ok := cies[id]
+		if !ok {
+			return nil, fmt.Errorf("FDE at offset %#x refers to unknown CIE at offset %#x", entryOffset, id)
+		}
+		start, err := readAddress(r, byteOrder, addressSize)
+		if err != nil {
+			return nil, err
+		}
+		size, err := readAddress(r, byteOrder, addressSize)
+		if err != nil {
+			return nil, err
+		}
+		instructions := entry[len(entry)-r.Len():]
+		frameSize, known := c.frameSize(instructions, byteOrder, addressSize, spRegister)
+		frames = append(frames, frameInfo{
+			start:     start,
+			end:       start + size,
+			frameSize: frameSize,
+			known:     known,
+		})
+	}
+	return frames, nil
+}
+
+// parseCIE parses the contents of a CIE, after the CIE id.
+func parseCIE(r *bytes.Reader) (*cie, error) {
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != 1 && version != 3 && version != 4 {
+		return nil, fmt.Errorf("unsupported CIE version %d", version)
+	}
+	augmentation, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	if augmentation != "" {
+		return nil, fmt.Errorf("unsupported CIE augmentation %#v", augmentation)
+	}
+	if version >= 4 {
+		// Skip address_size and segment_size.
+		if _, err := r.Seek(2, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	c := &cie{}
+	c.codeAlignmentFactor, err = readULEB128(r)
+	if err != nil {
+		return nil, err
+	}
+	c.dataAlignmentFactor, err = readSLEB128(r)
+	if err != nil {
+		return nil, err
+	}
+	if version == 1 {
+		_, err = r.ReadByte()
+	} else {
+		_, err = readULEB128(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.initialInstructions = make([]byte, r.Len())
+	r.Read(c.initialInstructions)
+	return c, nil
+}
+
+// frameSize executes the initial instructions of the CIE followed by the given
+// FDE instructions, and returns the maximum offset of the CFA from the stack
+// pointer. This is the stack frame size of the function, including the return
+// address if it is pushed on the stack by the call instruction. The second
+// return value is false if the frame size could not be determined, for example
+// because the CFA is defined relative to a frame pointer.
+func (c *cie) frameSize(instructions []byte, byteOrder binary.ByteOrder, addressSize int, spRegister uint64) (uint64, bool) {
+	state := cfaState{register: spRegister}
+	var stack []cfaState
+	var maxOffset int64
+	known := true
+	all := append(append([]byte{}, c.initialInstructions...), instructions...)
+	r := bytes.NewReader(all)
+	for r.Len() != 0 {
+		op, _ := r.ReadByte()
+		var err error
+		switch op & 0xc0 {
+		case dwCFAAdvanceLoc, dwCFARestore:
+			// Operand is encoded in the low six bits.
+		case dwCFAOffset:
+			_, err = readULEB128(r)
+		default:
+			switch op {
+			case dwCFANop:
+			case dwCFARememberState:
+				stack = append(stack, state)
+			case dwCFARestoreState:
+				if len(stack) != 0 {
+					state = stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+				}
+			case dwCFASetLoc:
+				_, err = readAddress(r, byteOrder, addressSize)
+			case dwCFAAdvanceLoc1:
+				_, err = r.Seek(1, io.SeekCurrent)
+			case dwCFAAdvanceLoc2:
+				_, err = r.Seek(2, io.SeekCurrent)
+			case dwCFAAdvanceLoc4:
+				_, err = r.Seek(4, io.SeekCurrent)
+			case dwCFAOffsetExtended, dwCFARegister, dwCFAValOffset:
+				if _, err = readULEB128(r); err == nil {
+					_, err = readULEB128(r)
+				}
+			case dwCFAOffsetExtendedSF, dwCFAValOffsetSF, dwCFAGNUNegOffsetExtSF:
+				if _, err = readULEB128(r); err == nil {
+					_, err = readSLEB128(r)
+				}
+			case dwCFARestoreExtended, dwCFAUndefined, dwCFASameValue, dwCFAGNUArgsSize:
+				_, err = readULEB128(r)
+			case dwCFADefCFA:
+				if state.register, err = readULEB128(r); err == nil {
+					var offset uint64
+					offset, err = readULEB128(r)
+					state.offset = int64(offset)
+				}
+			case dwCFADefCFASF:
+				if state.register, err = readULEB128(r); err == nil {
+					var offset int64
+					offset, err = readSLEB128(r)
+					state.offset = offset * c.dataAlignmentFactor
+				}
+			case dwCFADefCFARegister:
+				state.register, err = readULEB128(r)
+			case dwCFADefCFAOffset:
+				var offset uint64
+				offset, err = readULEB128(r)
+				state.offset = int64(offset)
+			case dwCFADefCFAOffsetSF:
+				var offset int64
+				offset, err = readSLEB128(r)
+				state.offset = offset * c.dataAlignmentFactor
+			case dwCFADefCFAExpression:
+				// The CFA is computed using a DWARF expression, which is not
+				// supported.
+				known = false
+				err = skipBlock(r)
+			case dwCFAExpression, dwCFAValExpression:
+				if _, err = readULEB128(r); err == nil {
+					err = skipBlock(r)
+				}
+			default:
+				// Unknown instruction, so the rest cannot be decoded.
+				return 0, false
+			}
+		}
+		if err != nil {
+			return 0, false
+		}
+		if state.register != spRegister {
+			// The CFA is relative to some other register (usually the frame
+			// pointer), so stack pointer adjustments after this point are not
+			// visible in the call frame information.
+			known = false
+		}
+		if state.offset > maxOffset {
+			maxOffset = state.offset
+		}
+	}
+	return uint64(maxOffset), known
+}
+
+// readAddress reads a target address of the given size.
+func readAddress(r *bytes.Reader, byteOrder binary.ByteOrder, addressSize int) (uint64, error) {
+	buf := make([]byte, addressSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	switch addressSize {
+	case 4:
+		return uint64(byteOrder.Uint32(buf)), nil
+	case 8:
+		return byteOrder.Uint64(buf), nil
+	default:
+		return 0, fmt.Errorf("unsupported address size %d", addressSize)
+	}
+}
+
+// readString reads a NUL-terminated string.
+func readString(r *bytes.Reader) (string, error) {
+	var buf []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == 0 {
+			return string(buf), nil
+		}
+		buf = append(buf, c)
+	}
+}
+
+// readULEB128 reads an unsigned LEB128 encoded integer.
+func readULEB128(r *bytes.Reader) (uint64, error) {
+	var result uint64
+	var shift uint
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+}
+
+// readSLEB128 reads a signed LEB128 encoded integer.
+func readSLEB128(r *bytes.Reader) (int64, error) {
+	var result int64
+	var shift uint
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		result |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				// Sign extend.
+				result |= -1 << shift
+			}
+			return result, nil
+		}
+	}
+}
+
+// skipBlock skips a block of bytes preceded by its ULEB128 encoded length.
+func skipBlock(r *bytes.Reader) error {
+	length, err := readULEB128(r)
+	if err != nil {
+		return err
+	}
+	_, err = r.Seek(int64(length), io.SeekCurrent)
+	return err
+}
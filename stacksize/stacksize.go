@@ -0,0 +1,360 @@
+// Package stacksize tries to determine the maximum stack size of a function
+// (usually a goroutine entry point) by reconstructing the call graph from a
+// linked ELF file and reading the stack frame size of each function from the
+// DWARF call frame information.
+//
+// The call graph is reconstructed from the relocations for call instructions,
+// which are only present in the final executable when it is linked with
+// --emit-relocs. Indirect calls (through a function pointer) do not leave
+// relocations behind, so a list of functions that make indirect calls must be
+// supplied by the caller.
+package stacksize
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SizeType indicates whether a stack or frame size could be determined and if
+// not, why.
+type SizeType uint8
+
+// Results after trying to determine the stack size of a function in the call
+// graph. The goal is to find a maximum (bounded) stack size, but sometimes this
+// is not possible for some reasons such as recursion or indirect calls.
+const (
+	Undefined    SizeType = iota // not yet calculated
+	Unknown                      // child has unknown stack size
+	Bounded                      // stack size is fixed at compile time (no recursion etc)
+	Recursive                    // there is recursion, so the stack size cannot be bounded
+	IndirectCall                 // there is an indirect call, so the call graph is incomplete
+)
+
+func (s SizeType) String() string {
+	switch s {
+	case Undefined:
+		return "undefined"
+	case Unknown:
+		return "unknown"
+	case Bounded:
+		return "bounded"
+	case Recursive:
+		return "recursive"
+	case IndirectCall:
+		return "indirect call"
+	default:
+		return "<?>"
+	}
+}
+
+// CallNode is a node in the call graph (that is, a function). Because this is
+// determined after linking, there may be multiple names for a single function
+// (due to aliases). It is also possible multiple functions have the same name
+// (but are in fact different), for example for static functions in C.
+type CallNode struct {
+	Names         []string
+	Address       uint64 // address at which the function is linked (without the Thumb bit on ARM)
+	Size          uint64 // symbol size, in bytes
+	Children      []*CallNode
+	FrameSize     uint64   // frame size, if FrameSizeType is Bounded
+	FrameSizeType SizeType // can be Undefined or Bounded
+
+	stackSize        uint64
+	stackSizeType    SizeType
+	missingFrameInfo *CallNode // the child function that is the cause for not being able to determine the stack size
+}
+
+func (n *CallNode) String() string {
+	if n == nil {
+		return "<nil>"
+	}
+	return n.Names[0]
+}
+
+// Frame sizes of functions implemented in assembly, which therefore do not
+// have DWARF call frame information.
+var knownFrameSizes = map[elf.Machine]map[string]uint64{
+	elf.EM_ARM: {
+		// Implemented in TinyGo (src/runtime/scheduler_cortexm.S).
+		"tinygo_startTask":             0,     // thunk, only calls the goroutine
+		"tinygo_getSystemStackPointer": 0,     // getter
+		"tinygo_switchToScheduler":     9 * 4, // branches to tinygo_swapTask
+		"tinygo_switchToTask":          9 * 4, // branches to tinygo_swapTask
+		"tinygo_swapTask":              9 * 4, // 9 registers saved
+		"SemihostingCall":              0,     // only a bkpt instruction
+
+		// Implemented in assembly in compiler-rt.
+		"__aeabi_idivmod":  3 * 4, // 3 registers on thumb1 but 1 register on thumb2
+		"__aeabi_uidivmod": 3 * 4, // 3 registers on thumb1 but 1 register on thumb2
+		"__aeabi_ldivmod":  2 * 4,
+		"__aeabi_uldivmod": 2 * 4,
+		"__aeabi_memclr":   2 * 4, // 2 registers on thumb1
+		"__aeabi_memset":   2 * 4, // 2 registers on thumb1
+	},
+}
+
+// CallGraph parses the ELF file and reads DWARF call frame information to
+// determine frame sizes for each function, as far as that's possible. Because
+// at this point it is not possible to determine indirect calls, a list of
+// functions that call a function pointer needs to be supplied.
+func CallGraph(f *elf.File, callsIndirectFunction []string) (map[string][]*CallNode, error) {
+	var spRegister uint64
+	switch f.Machine {
+	case elf.EM_ARM:
+		spRegister = 13 // sp
+	default:
+		return nil, fmt.Errorf("stack size analysis is not supported for machine type %s", f.Machine)
+	}
+	addressSize := 4
+	if f.Class == elf.ELFCLASS64 {
+		addressSize = 8
+	}
+
+	// Create a node for each function symbol.
+	symbols, err := f.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	functions := map[string][]*CallNode{}
+	addressNodes := map[uint64]*CallNode{}
+	symbolNodes := make([]*CallNode, len(symbols))
+	var nodes []*CallNode
+	for i, symbol := range symbols {
+		if elf.ST_TYPE(symbol.Info) != elf.STT_FUNC {
+			continue
+		}
+		address := symbol.Value
+		if f.Machine == elf.EM_ARM {
+			address &^= 1 // clear the Thumb bit
+		}
+		node := addressNodes[address]
+		if node == nil {
+			node = &CallNode{
+				Address: address,
+				Size:    symbol.Size,
+			}
+			addressNodes[address] = node
+			nodes = append(nodes, node)
+		} else if symbol.Size > node.Size {
+			node.Size = symbol.Size
+		}
+		node.Names = append(node.Names, symbol.Name)
+		functions[symbol.Name] = append(functions[symbol.Name], node)
+		symbolNodes[i] = node
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Address < nodes[j].Address
+	})
+
+	// Some functions (mostly implemented in assembly) don't have a symbol
+	// size. Assume they extend up to the next function.
+	for i, node := range nodes {
+		if node.Size == 0 && i+1 < len(nodes) {
+			node.Size = nodes[i+1].Address - node.Address
+		}
+	}
+
+	// Read the frame size of each function from the call frame information.
+	if section := f.Section(".debug_frame"); section != nil {
+		data, err := section.Data()
+		if err != nil {
+			return nil, err
+		}
+		frames, err := parseFrames(data, f.ByteOrder, addressSize, spRegister)
+		if err != nil {
+			return nil, err
+		}
+		for _, frame := range frames {
+			node := addressNodes[frame.start]
+			if node == nil || !frame.known {
+				continue
+			}
+			node.FrameSize = frame.frameSize
+			node.FrameSizeType = Bounded
+		}
+	}
+	for name, size := range knownFrameSizes[f.Machine] {
+		for _, node := range functions[name] {
+			node.FrameSize = size
+			node.FrameSizeType = Bounded
+		}
+	}
+
+	// Mark all functions that do indirect calls. Their stack size cannot be
+	// determined.
+	indirectCallers := map[*CallNode]struct{}{}
+	for _, name := range callsIndirectFunction {
+		for _, node := range functions[name] {
+			indirectCallers[node] = struct{}{}
+		}
+	}
+
+	// Read relocations to find calls between functions.
+	for _, section := range f.Sections {
+		if section.Type != elf.SHT_REL || int(section.Info) >= len(f.Sections) {
+			continue
+		}
+		if f.Sections[section.Info].Flags&elf.SHF_EXECINSTR == 0 {
+			// Not a relocation section for code.
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, err
+		}
+		relocs, err := parseRel(data, f.ByteOrder)
+		if err != nil {
+			return nil, err
+		}
+		for _, reloc := range relocs {
+			if !isCallRelocation(f.Machine, reloc.typ) {
+				continue
+			}
+			caller := findFunction(nodes, reloc.offset)
+			if caller == nil {
+				continue
+			}
+			var callee *CallNode
+			if reloc.symbol != 0 && int(reloc.symbol) <= len(symbolNodes) {
+				// Symbol index 0 is the undefined symbol, which is not part
+				// of the slice returned by f.Symbols().
+				callee = symbolNodes[reloc.symbol-1]
+			}
+			if callee == nil {
+				// Call to something that isn't a known function (for
+				// example, relative to a section symbol). Treat it like an
+				// indirect call, as the callee is unknown.
+				indirectCallers[caller] = struct{}{}
+				continue
+			}
+			caller.addChild(callee)
+		}
+	}
+
+	// Indirect calls are represented as a nil child, so that they are found
+	// while determining the stack size.
+	for node := range indirectCallers {
+		node.Children = append(node.Children, nil)
+	}
+
+	return functions, nil
+}
+
+// addChild adds the given function as a callee, if it hasn't been added
+// already.
+func (n *CallNode) addChild(child *CallNode) {
+	for _, c := range n.Children {
+		if c == child {
+			return
+		}
+	}
+	n.Children = append(n.Children, child)
+}
+
+// findFunction returns the function that contains the given address, or nil
+// if there is none. The list of nodes must be sorted by address.
+func findFunction(nodes []*CallNode, address uint64) *CallNode {
+	i := sort.Search(len(nodes), func(i int) bool {
+		return nodes[i].Address > address
+	}) - 1
+	if i < 0 || address >= nodes[i].Address+nodes[i].Size {
+		return nil
+	}
+	return nodes[i]
+}
+
+// relocation is a single relocation in a relocation section (without addend).
+type relocation struct {
+	offset uint64
+	symbol uint32
+	typ    uint32
+}
+
+// parseRel parses the contents of a SHT_REL section of a 32-bit ELF file.
+func parseRel(data []byte, byteOrder binary.ByteOrder) ([]relocation, error) {
+	if len(data)%8 != 0 {
+		return nil, errors.New("invalid relocation section size")
+	}
+	relocs := make([]relocation, len(data)/8)
+	for i := range relocs {
+		offset := byteOrder.Uint32(data[i*8:])
+		info := byteOrder.Uint32(data[i*8+4:])
+		relocs[i] = relocation{
+			offset: uint64(offset),
+			symbol: info >> 8,
+			typ:    info & 0xff,
+		}
+	}
+	return relocs, nil
+}
+
+// isCallRelocation returns whether the given relocation type is used for a
+// call or (tail call) branch to a function.
+func isCallRelocation(machine elf.Machine, typ uint32) bool {
+	switch machine {
+	case elf.EM_ARM:
+		switch elf.R_ARM(typ) {
+		case elf.R_ARM_CALL, elf.R_ARM_JUMP24, elf.R_ARM_THM_PC22, elf.R_ARM_THM_JUMP24, elf.R_ARM_THM_JUMP19, elf.R_ARM_THM_JUMP11:
+			return true
+		}
+	}
+	return false
+}
+
+// StackSize tries to determine the maximum stack size of this function. It
+// returns the stack size, the type of stack size (Bounded if the stack size is
+// known), and the function that caused the stack size to be unknown if it is
+// not Bounded.
+func (n *CallNode) StackSize() (uint64, SizeType, *CallNode) {
+	if n.stackSizeType == Undefined {
+		n.determineStackSize(map[*CallNode]struct{}{})
+	}
+	return n.stackSize, n.stackSizeType, n.missingFrameInfo
+}
+
+// determineStackSize determines the stack size of this function and all its
+// children recursively, if that's possible. The parents set contains all
+// functions that are currently being analyzed higher up in the call chain,
+// which is used to detect recursion.
+func (n *CallNode) determineStackSize(parents map[*CallNode]struct{}) {
+	if n.FrameSizeType != Bounded {
+		// The frame size of this function itself is unknown.
+		n.stackSizeType = Unknown
+		n.missingFrameInfo = n
+		return
+	}
+
+	parents[n] = struct{}{}
+	defer delete(parents, n)
+
+	var maxChildSize uint64
+	for _, child := range n.Children {
+		if child == nil {
+			n.stackSizeType = IndirectCall
+			n.missingFrameInfo = n
+			return
+		}
+		if _, ok := parents[child]; ok {
+			n.stackSizeType = Recursive
+			n.missingFrameInfo = child
+			return
+		}
+		if child.stackSizeType == Undefined {
+			child.determineStackSize(parents)
+		}
+		if child.stackSizeType != Bounded {
+			// Propagate the reason why the stack size is unknown.
+			n.stackSizeType = child.stackSizeType
+			n.missingFrameInfo = child.missingFrameInfo
+			return
+		}
+		if child.stackSize > maxChildSize {
+			maxChildSize = child.stackSize
+		}
+	}
+	n.stackSize = n.FrameSize + maxChildSize
+	n.stackSizeType = Bounded
+}
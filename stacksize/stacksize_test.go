@@ -0,0 +1,118 @@
+package stacksize
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// makeDebugFrame creates a .debug_frame section with a single CIE (as emitted
+// by LLVM for ARM) and a FDE for each of the given instruction lists.
+func makeDebugFrame(fdes ...[]byte) []byte {
+	appendUint32 := func(buf []byte, n uint32) []byte {
+		var word [4]byte
+		binary.LittleEndian.PutUint32(word[:], n)
+		return append(buf, word[:]...)
+	}
+	var data []byte
+	cie := []byte{
+		0xff, 0xff, 0xff, 0xff, // CIE id
+		1,                  // version
+		0,                  // augmentation
+		1,                  // code alignment factor
+		0x7c,               // data alignment factor (-4)
+		14,                 // return address register (lr)
+		dwCFADefCFA, 13, 0, // CFA = sp + 0
+	}
+	data = appendUint32(data, uint32(len(cie)))
+	data = append(data, cie...)
+	for i, instructions := range fdes {
+		var fde []byte
+		fde = appendUint32(fde, 0)                     // CIE pointer
+		fde = appendUint32(fde, uint32(0x100*i+0x100)) // initial location
+		fde = appendUint32(fde, 0x80)                  // address range
+		fde = append(fde, instructions...)
+		data = appendUint32(data, uint32(len(fde)))
+		data = append(data, fde...)
+	}
+	return data
+}
+
+func TestParseFrames(t *testing.T) {
+	data := makeDebugFrame(
+		// push {r7, lr}; sub sp, #16
+		[]byte{
+			dwCFAAdvanceLoc | 2, dwCFADefCFAOffset, 8,
+			dwCFAOffset | 14, 1, dwCFAOffset | 7, 2,
+			dwCFAAdvanceLoc | 2, dwCFADefCFAOffset, 24,
+		},
+		// leaf function without a stack frame
+		[]byte{},
+		// push {r4, r7, lr}; mov r7, sp (frame pointer)
+		[]byte{
+			dwCFAAdvanceLoc | 2, dwCFADefCFAOffset, 12,
+			dwCFAAdvanceLoc | 2, dwCFADefCFARegister, 7,
+		},
+		// remember/restore state around an early return
+		[]byte{
+			dwCFAAdvanceLoc | 2, dwCFADefCFAOffset, 8,
+			dwCFARememberState,
+			dwCFAAdvanceLoc | 2, dwCFADefCFAOffset, 0,
+			dwCFARestoreState,
+			dwCFAAdvanceLoc | 2, dwCFADefCFAOffset, 32,
+		},
+	)
+	frames, err := parseFrames(data, binary.LittleEndian, 4, 13)
+	if err != nil {
+		t.Fatal("could not parse frames:", err)
+	}
+	expected := []frameInfo{
+		{start: 0x100, end: 0x180, frameSize: 24, known: true},
+		{start: 0x200, end: 0x280, frameSize: 0, known: true},
+		{start: 0x300, end: 0x380, frameSize: 12, known: false},
+		{start: 0x400, end: 0x480, frameSize: 32, known: true},
+	}
+	if len(frames) != len(expected) {
+		t.Fatalf("expected %d frames, got %d", len(expected), len(frames))
+	}
+	for i, frame := range frames {
+		if frame != expected[i] {
+			t.Errorf("frame %d: expected %+v, got %+v", i, expected[i], frame)
+		}
+	}
+}
+
+func TestStackSize(t *testing.T) {
+	node := func(name string, frameSize uint64, children ...*CallNode) *CallNode {
+		return &CallNode{
+			Names:         []string{name},
+			FrameSize:     frameSize,
+			FrameSizeType: Bounded,
+			Children:      children,
+		}
+	}
+
+	leaf := node("leaf", 8)
+	small := node("small", 16, leaf)
+	big := node("big", 64, leaf)
+	root := node("root", 24, small, big)
+	if size, sizeType, _ := root.StackSize(); size != 24+64+8 || sizeType != Bounded {
+		t.Errorf("root: expected bounded stack size of %d, got %d (%s)", 24+64+8, size, sizeType)
+	}
+
+	recursive := node("recursive", 16)
+	recursive.Children = []*CallNode{leaf, recursive}
+	caller := node("caller", 8, recursive)
+	if _, sizeType, missing := caller.StackSize(); sizeType != Recursive || missing != recursive {
+		t.Errorf("caller: expected recursion in %s, got %s in %s", recursive, sizeType, missing)
+	}
+
+	indirect := node("indirect", 8, leaf, nil)
+	if _, sizeType, missing := node("main", 8, indirect).StackSize(); sizeType != IndirectCall || missing != indirect {
+		t.Errorf("main: expected indirect call in %s, got %s in %s", indirect, sizeType, missing)
+	}
+
+	unknown := &CallNode{Names: []string{"extern"}}
+	if _, sizeType, missing := node("user", 8, unknown).StackSize(); sizeType != Unknown || missing != unknown {
+		t.Errorf("user: expected unknown frame size in %s, got %s in %s", unknown, sizeType, missing)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Code addresses as printed by the runtime: the return addresses of a
+// backtrace, one per indented line, and the pc and lr registers of a
+// HardFault. Other hexadecimal numbers, like the fault status registers, are
+// not code addresses.
+var (
+	backtraceRegexp = regexp.MustCompile(`^\s+0x([0-9a-fA-F]+)\s*$`)
+	registerRegexp  = regexp.MustCompile(`\b(pc|lr)=0x([0-9a-fA-F]+)`)
+)
+
+// symbolizer converts code addresses into function names and source locations
+// using the symbol table and DWARF debug information in an ELF file.
+type symbolizer struct {
+	thumb     bool // addresses have the Thumb bit set
+	functions []elf.Symbol
+	lines     []lineEntry
+}
+
+// lineEntry is a single row in the DWARF line table. If end is set, this entry
+// marks the end of a sequence and does not correspond to a source location.
+type lineEntry struct {
+	address uint64
+	file    string
+	line    int
+	end     bool
+}
+
+// newSymbolizer loads the symbol table and line table from the given ELF file.
+func newSymbolizer(path string) (*symbolizer, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := &symbolizer{
+		thumb: file.Machine == elf.EM_ARM,
+	}
+
+	symbols, err := file.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	for _, symbol := range symbols {
+		if elf.ST_TYPE(symbol.Info) != elf.STT_FUNC || symbol.Size == 0 {
+			continue
+		}
+		if s.thumb {
+			symbol.Value &^= 1
+		}
+		s.functions = append(s.functions, symbol)
+	}
+	sort.Slice(s.functions, func(i, j int) bool {
+		return s.functions[i].Value < s.functions[j].Value
+	})
+
+	// Line information is optional: the binary may have been built with
+	// -no-debug.
+	data, err := file.DWARF()
+	if err != nil {
+		return s, nil
+	}
+	r := data.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		lr, err := data.LineReader(entry)
+		if err != nil {
+			return nil, err
+		}
+		if lr == nil {
+			continue
+		}
+		var le dwarf.LineEntry
+		for {
+			err := lr.Next(&le)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			fileName := ""
+			if le.File != nil {
+				fileName = le.File.Name
+			}
+			s.lines = append(s.lines, lineEntry{
+				address: le.Address,
+				file:    fileName,
+				line:    le.Line,
+				end:     le.EndSequence,
+			})
+		}
+	}
+	sort.SliceStable(s.lines, func(i, j int) bool {
+		return s.lines[i].address < s.lines[j].address
+	})
+	return s, nil
+}
+
+// lookup returns the function name and source location of the given address,
+// or an empty function name if the address is not part of any function.
+func (s *symbolizer) lookup(address uint64) (function, location string) {
+	i := sort.Search(len(s.functions), func(i int) bool {
+		return s.functions[i].Value > address
+	}) - 1
+	if i < 0 || address >= s.functions[i].Value+s.functions[i].Size {
+		return "", ""
+	}
+	function = s.functions[i].Name
+
+	j := sort.Search(len(s.lines), func(j int) bool {
+		return s.lines[j].address > address
+	}) - 1
+	if j >= 0 && !s.lines[j].end && s.lines[j].line != 0 {
+		location = s.lines[j].file + ":" + strconv.Itoa(s.lines[j].line)
+	}
+	return
+}
+
+// describe returns a description of the given address as printed in a program
+// log. Return addresses (as found in a backtrace) point to the instruction
+// after the call, so they are adjusted to point into the call instruction
+// itself. The program counter of a fault (pc=...) is used as-is.
+func (s *symbolizer) describe(address uint64, isReturnAddress bool) string {
+	if s.thumb {
+		address &^= 1
+	}
+	if isReturnAddress && address != 0 {
+		address--
+	}
+	function, location := s.lookup(address)
+	if function == "" {
+		return ""
+	}
+	if location == "" {
+		return function
+	}
+	return function + " " + location
+}
+
+// annotate appends function names and source locations to the code addresses
+// on the given line that can be found in the executable.
+func (s *symbolizer) annotate(line string) string {
+	var annotations []string
+	add := func(hex string, isReturnAddress bool) {
+		address, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return
+		}
+		if desc := s.describe(address, isReturnAddress); desc != "" {
+			annotations = append(annotations, desc)
+		}
+	}
+	if m := backtraceRegexp.FindStringSubmatch(line); m != nil {
+		add(m[1], true)
+	}
+	for _, m := range registerRegexp.FindAllStringSubmatch(line, -1) {
+		add(m[2], m[1] == "lr")
+	}
+	if len(annotations) == 0 {
+		return line
+	}
+	return line + "\t" + strings.Join(annotations, ", ")
+}
+
+// Symbolize annotates the code addresses in a program log, such as the
+// backtrace printed by the runtime after a panic or a HardFault, with function
+// names and source locations read from the given executable. When addresses
+// are passed, only those addresses are described. Otherwise the log is read
+// from r and written to w with annotations added.
+func Symbolize(executable string, addresses []string, r io.Reader, w io.Writer) error {
+	s, err := newSymbolizer(executable)
+	if err != nil {
+		return err
+	}
+
+	if len(addresses) != 0 {
+		for _, arg := range addresses {
+			address, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(arg), "0x"), 16, 64)
+			if err != nil {
+				return fmt.Errorf("invalid address: %s", arg)
+			}
+			desc := s.describe(address, false)
+			if desc == "" {
+				desc = "??"
+			}
+			fmt.Fprintf(w, "%s\t%s\n", arg, desc)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fmt.Fprintln(w, s.annotate(strings.TrimRight(scanner.Text(), "\r")))
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"debug/elf"
+	"testing"
+)
+
+func TestSymbolizeAnnotate(t *testing.T) {
+	s := &symbolizer{
+		thumb: true,
+		functions: []elf.Symbol{
+			{Name: "main.main", Value: 0x1000, Size: 0x40},
+			{Name: "runtime._panic", Value: 0x2000, Size: 0x20},
+		},
+		lines: []lineEntry{
+			{address: 0x1000, file: "main.go", line: 5},
+			{address: 0x1010, file: "main.go", line: 7},
+			{address: 0x1040, end: true},
+			{address: 0x2000, file: "panic.go", line: 10},
+			{address: 0x2020, end: true},
+		},
+	}
+
+	for _, tc := range []struct {
+		line     string
+		expected string
+	}{
+		// Backtrace entries are return addresses, which point to the
+		// instruction after the call.
+		{"  0x00001011", "  0x00001011\tmain.main main.go:5"},
+		{"  0x00001013", "  0x00001013\tmain.main main.go:7"},
+		{"  0x00003001", "  0x00003001"},
+		// The pc is used as-is, the lr is a return address.
+		{"fatal error: HardFault with sp=0x20000fc0 pc=0x00002004 lr=0x00001011",
+			"fatal error: HardFault with sp=0x20000fc0 pc=0x00002004 lr=0x00001011\truntime._panic panic.go:10, main.main main.go:5"},
+		// Fault status registers are not code addresses, even if they happen
+		// to look like one.
+		{"  cfsr=0x00001011 hfsr=0x00002004 mmfar=0x00001010 bfar=0x00001010", "  cfsr=0x00001011 hfsr=0x00002004 mmfar=0x00001010 bfar=0x00001010"},
+		// Other numbers in the program output are not annotated either.
+		{"value: 0x00001011", "value: 0x00001011"},
+		{"backtrace:", "backtrace:"},
+	} {
+		if actual := s.annotate(tc.line); actual != tc.expected {
+			t.Errorf("annotate(%q):\nexpected: %q\nactual:   %q", tc.line, tc.expected, actual)
+		}
+	}
+}
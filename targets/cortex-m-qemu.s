@@ -39,6 +39,17 @@ Default_Handler:
     .long PendSV_Handler
     .long SysTick_Handler
 
+    // Peripheral interrupts of the LM3S6965, see device/lm3s6965.
+    .long GPIOA_IRQHandler
+    .long GPIOB_IRQHandler
+    .long GPIOC_IRQHandler
+    .long GPIOD_IRQHandler
+    .long GPIOE_IRQHandler
+    .long UART0_IRQHandler
+    .long UART1_IRQHandler
+    .long SSI0_IRQHandler
+    .long I2C0_IRQHandler
+
     // Define default implementations for interrupts, redirecting to
     // Default_Handler when not implemented.
     IRQ NMI_Handler
@@ -50,3 +61,12 @@ Default_Handler:
     IRQ DebugMon_Handler
     IRQ PendSV_Handler
     IRQ SysTick_Handler
+    IRQ GPIOA_IRQHandler
+    IRQ GPIOB_IRQHandler
+    IRQ GPIOC_IRQHandler
+    IRQ GPIOD_IRQHandler
+    IRQ GPIOE_IRQHandler
+    IRQ UART0_IRQHandler
+    IRQ UART1_IRQHandler
+    IRQ SSI0_IRQHandler
+    IRQ I2C0_IRQHandler
@@ -82,9 +82,15 @@ func testDefer() {
 	var t Printer = &Thing{"foo"}
 	defer t.Print("bar")
 
+	// Deferred calls through a func value and on a builtin.
+	defer deferredFunc("...run as defer through func value", i)
+	defer println("...run as deferred builtin:", i)
+
 	println("deferring...")
 }
 
+var deferredFunc = deferred
+
 func deferred(msg string, i int) {
 	println(msg, i)
 }
@@ -0,0 +1,5 @@
+#include "_cgo_export.h"
+
+int callMul(int a, int b) {
+	return mul(a, b);
+}
@@ -1,3 +1,4 @@
+#include <stdarg.h>
 #include "main.h"
 
 int global = 3;
@@ -19,6 +20,8 @@ joined_t globalUnion;
 int globalUnionSize = sizeof(globalUnion);
 option_t globalOption = optionG;
 bitfield_t globalBitfield = {244, 15, 1, 2, 47, 5};
+anonymous_union_t globalAnonymousUnion = {.tag = 1, .i = 5};
+const char *globalCString = "C string";
 
 int fortytwo() {
 	return 42;
@@ -32,6 +35,25 @@ int doCallback(int a, int b, binop_t callback) {
 	return callback(a, b);
 }
 
+int variadicAdd(int n, ...) {
+	va_list args;
+	va_start(args, n);
+	int sum = 0;
+	for (int i = 0; i < n; i++) {
+		sum += va_arg(args, int);
+	}
+	va_end(args);
+	return sum;
+}
+
+int stringLength(const char *s) {
+	int n = 0;
+	while (s[n] != 0) {
+		n++;
+	}
+	return n;
+}
+
 void store(int value, int *ptr) {
 	*ptr = value;
 }
@@ -34,6 +34,26 @@ func main() {
 	println("callback 1:", C.doCallback(20, 30, cb))
 	cb = C.binop_t(C.mul)
 	println("callback 2:", C.doCallback(20, 30, cb))
+	println("exported:", C.callMul(6, 7))
+	println("static:", C.staticAdd(3, 4))
+	println("macros:", C.MACRO_ANSWER(), C.MACRO_ADD(5, 6))
+	println("variadic:", C.variadicAdd(0), C.variadicAdd(3, C.int(1), C.int(2), C.short(3)), C.variadicAdd(2, 4, 5))
+
+	// CGo helpers
+	cstr := C.CString("hello")
+	println("CString:", C.stringLength(cstr))
+	println("GoString:", C.GoString(cstr), C.GoString(C.globalCString))
+	println("GoStringN:", C.GoStringN(cstr, 4))
+	goBytes := C.GoBytes(unsafe.Pointer(cstr), 3)
+	println("GoBytes:", len(goBytes), goBytes[2])
+	C.free(unsafe.Pointer(cstr))
+	cbytes := C.CBytes([]byte{1, 2, 3})
+	cbytesArray := (*[3]byte)(cbytes)
+	println("CBytes:", cbytesArray[0], cbytesArray[1], cbytesArray[2])
+	C.free(cbytes)
+	buf := C.malloc(16)
+	println("malloc:", buf != nil)
+	C.free(buf)
 
 	// equivalent types
 	var goInt8 int8 = 5
@@ -72,6 +92,9 @@ func main() {
 	C.globalBitfield.set_bitfield_c(0xff)
 	printBitfield(&C.globalBitfield)
 
+	// anonymous union inside a struct
+	println("anonymous union:", C.globalAnonymousUnion.tag, *C.globalAnonymousUnion.anon0.unionfield_i())
+
 	// elaborated type
 	p := C.struct_point2d{x: 3, y: 5}
 	println("struct:", p.x, p.y)
@@ -7,6 +7,9 @@ int add(int a, int b);
 int unusedFunction(void);
 typedef int (*binop_t) (int, int);
 int doCallback(int a, int b, binop_t cb);
+int callMul(int a, int b);
+int variadicAdd(int n, ...);
+int stringLength(const char *s);
 typedef int * intPointer;
 void store(int value, int *ptr);
 
@@ -17,6 +20,11 @@ void store(int value, int *ptr);
 # define CONST_CHAR 'c'
 # define CONST_STRING "defined string"
 
+// static functions and function-like macros are called through a wrapper
+static inline int staticAdd(int a, int b) { return a + b; }
+# define MACRO_ANSWER() (40 + 2)
+# define MACRO_ADD(a, b) add(a, b)
+
 // this signature should not be included by CGo
 void unusedFunction2(int x, __builtin_va_list args);
 
@@ -68,6 +76,14 @@ typedef union {
 	};
 } nested_union_t;
 
+typedef struct {
+	int tag;
+	union {
+		int   i;
+		float f;
+	};
+} anonymous_union_t;
+
 // linked list
 typedef struct list_t {
 	int           n;
@@ -133,6 +149,8 @@ extern joined_t globalUnion;
 extern int globalUnionSize;
 extern option_t globalOption;
 extern bitfield_t globalBitfield;
+extern anonymous_union_t globalAnonymousUnion;
+extern const char *globalCString;
 
 // test duplicate definitions
 int add(int a, int b);
@@ -50,6 +50,9 @@ func main() {
 	time.Sleep(time.Second/2)
 	println("closure go call result:", x)
 
+	// Start goroutines on an interface method and on a builtin.
+	go printer.Print()
+	go println("goroutine started on builtin")
 	time.Sleep(2 * time.Millisecond)
 }
 
@@ -0,0 +1,17 @@
+package main
+
+// Variadic C functions can only be called directly: the extra arguments can't
+// be passed to a deferred call or a new goroutine.
+
+/*
+int variadicAdd(int n, ...);
+*/
+import "C"
+
+// ERROR: cannot defer variadic C function variadicAdd
+// ERROR: cannot start goroutine with variadic C function variadicAdd
+
+func main() {
+	defer C.variadicAdd(1, C.int(2))
+	go C.variadicAdd(1, C.int(2))
+}
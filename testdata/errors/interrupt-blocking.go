@@ -0,0 +1,21 @@
+package main
+
+// Interrupt handlers must not block, as they cannot be suspended.
+
+import (
+	"device/lm3s6965"
+	"runtime/interrupt"
+)
+
+// ERROR: interrupt handler UART1_IRQHandler may block
+
+var ch = make(chan int)
+
+func main() {
+	interrupt.New(lm3s6965.IRQ_UART1, handleUART1).Enable()
+	println(<-ch)
+}
+
+func handleUART1(intr interrupt.Interrupt) {
+	ch <- intr.Number()
+}
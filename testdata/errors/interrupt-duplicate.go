@@ -0,0 +1,18 @@
+package main
+
+// An interrupt can only be registered once.
+
+import (
+	"device/lm3s6965"
+	"runtime/interrupt"
+)
+
+// ERROR: interrupt UART1 is already registered at
+
+func main() {
+	interrupt.New(lm3s6965.IRQ_UART1, handleUART1)
+	interrupt.New(lm3s6965.IRQ_UART1, handleUART1)
+}
+
+func handleUART1(intr interrupt.Interrupt) {
+}
@@ -0,0 +1,22 @@
+package main
+
+// An interrupt registered with interrupt.New cannot also be handled by an
+// exported function with the name of the interrupt handler.
+
+import (
+	"device/lm3s6965"
+	"runtime/interrupt"
+)
+
+// ERROR: interrupt UART1 is already handled by a function named UART1_IRQHandler
+
+func main() {
+	interrupt.New(lm3s6965.IRQ_UART1, handleUART1)
+}
+
+func handleUART1(intr interrupt.Interrupt) {
+}
+
+//go:export UART1_IRQHandler
+func exportedUART1() {
+}
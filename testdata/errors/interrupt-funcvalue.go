@@ -0,0 +1,39 @@
+package main
+
+// A call through a func value in an interrupt handler may call any function of
+// the same type that is used as a func value. It is reported if one of them
+// may block, even if the others don't.
+
+import (
+	"device/lm3s6965"
+	"runtime/interrupt"
+)
+
+// ERROR: interrupt handler UART1_IRQHandler may block: (func value)
+
+var (
+	ch       = make(chan int)
+	count    int
+	callback func(int)
+)
+
+func main() {
+	interrupt.New(lm3s6965.IRQ_UART1, handleUART1).Enable()
+	callback = increment
+	if count > 1 {
+		callback = send
+	}
+	println(<-ch)
+}
+
+func handleUART1(intr interrupt.Interrupt) {
+	callback(intr.Number())
+}
+
+func increment(n int) {
+	count += n
+}
+
+func send(n int) {
+	ch <- n
+}
@@ -0,0 +1,23 @@
+package main
+
+// A select statement with a default case never blocks, so it can be used in an
+// interrupt handler to send a value without blocking.
+
+import (
+	"device/lm3s6965"
+	"runtime/interrupt"
+)
+
+var ch = make(chan int, 1)
+
+func main() {
+	interrupt.New(lm3s6965.IRQ_UART1, handleUART1).Enable()
+	println(<-ch)
+}
+
+func handleUART1(intr interrupt.Interrupt) {
+	select {
+	case ch <- intr.Number():
+	default:
+	}
+}
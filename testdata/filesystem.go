@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+func main() {
+	dir, err := ioutil.TempDir("", "tinygo-filesystem")
+	if err != nil {
+		println("could not create temporary directory:", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Files and directories that don't exist.
+	_, err = os.Stat(dir + "/nonexistent")
+	println("IsNotExist:", os.IsNotExist(err))
+	println("Mkdir existing:", os.IsExist(os.Mkdir(dir, 0777)))
+
+	// Create some files and directories.
+	err = os.MkdirAll(dir+"/a/b/c", 0755)
+	println("MkdirAll:", err == nil)
+	err = ioutil.WriteFile(dir+"/a/file.txt", []byte("hello"), 0644)
+	println("WriteFile:", err == nil)
+	data, err := ioutil.ReadFile(dir + "/a/file.txt")
+	println("ReadFile:", string(data), err == nil)
+
+	// Seek in a file.
+	f, err := os.Open(dir + "/a/file.txt")
+	if err != nil {
+		println("could not open file:", err.Error())
+		return
+	}
+	off, err := f.Seek(-3, 2)
+	println("Seek end:", off, err == nil)
+	buf := make([]byte, 2)
+	n, _ := f.Read(buf)
+	off, err = f.Seek(0, 1)
+	println("Seek current:", string(buf[:n]), off, err == nil)
+	f.Close()
+
+	// Stat them.
+	info, err := os.Stat(dir + "/a/file.txt")
+	if err != nil {
+		println("could not stat file:", err.Error())
+		return
+	}
+	println("Stat:", info.Name(), info.Size(), info.IsDir(), (info.Mode() & 0700).String())
+	info, err = os.Lstat(dir + "/a/b")
+	if err != nil {
+		println("could not stat directory:", err.Error())
+		return
+	}
+	println("Lstat:", info.Name(), info.IsDir(), info.Mode().IsDir())
+
+	// List a directory.
+	infos, err := ioutil.ReadDir(dir + "/a")
+	println("ReadDir:", len(infos), err == nil)
+	for _, info := range infos {
+		println(" -", info.Name(), info.IsDir())
+	}
+	f, err = os.Open(dir + "/a")
+	if err != nil {
+		println("could not open directory:", err.Error())
+		return
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	sort.Strings(names)
+	println("Readdirnames:", len(names), names[0], names[1], err == nil)
+
+	// Rename and remove files.
+	err = os.Rename(dir+"/a/file.txt", dir+"/a/renamed.txt")
+	println("Rename:", err == nil)
+	_, err = os.Stat(dir + "/a/file.txt")
+	println("old name exists:", !os.IsNotExist(err))
+	err = os.Remove(dir + "/a/renamed.txt")
+	println("Remove:", err == nil)
+	err = os.Remove(dir + "/a")
+	println("Remove non-empty:", os.IsExist(err))
+
+	// Change the working directory.
+	err = os.Chdir(dir + "/a/b")
+	println("Chdir:", err == nil)
+	wd, err := os.Getwd()
+	println("Getwd:", len(wd) > len("/a/b") && wd[len(wd)-len("/a/b"):] == "/a/b", err == nil)
+	err = os.Chdir("/")
+	println("Chdir /:", err == nil)
+
+	err = os.RemoveAll(dir)
+	println("RemoveAll:", err == nil)
+	_, err = os.Stat(dir)
+	println("IsNotExist:", os.IsNotExist(err))
+}
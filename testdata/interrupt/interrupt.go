@@ -0,0 +1,23 @@
+package main
+
+// This program registers an interrupt handler with interrupt.New and runs it by
+// making the interrupt pending in software.
+
+import (
+	"device/arm"
+	"device/lm3s6965"
+	"runtime/interrupt"
+)
+
+func main() {
+	intr := interrupt.New(lm3s6965.IRQ_UART1, handleUART1)
+	println("registered:", intr.Number())
+	intr.Enable()
+	arm.NVIC.ISPR[0].Set(1 << lm3s6965.IRQ_UART1)
+	arm.Asm("isb")
+	println("done")
+}
+
+func handleUART1(intr interrupt.Interrupt) {
+	println("interrupt:", intr.Number())
+}
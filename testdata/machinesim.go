@@ -0,0 +1,74 @@
+package main
+
+// Test the host simulator of the generic machine package.
+
+import (
+	"machine"
+	"machine/sim"
+)
+
+func main() {
+	// GPIO
+	led := machine.Pin(3)
+	led.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	led.High()
+	led.Low()
+	led.High()
+	mode, configured := sim.PinMode(led)
+	println("led configured:", configured, mode == machine.PinOutput)
+	println("led history:", len(sim.PinHistory(led)), sim.PinHistory(led)[0], sim.PinHistory(led)[1], sim.PinHistory(led)[2])
+
+	button := machine.Pin(4)
+	button.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	println("button before press:", button.Get())
+	sim.SetPin(button, false)
+	println("button after press:", button.Get())
+
+	// Pin change interrupts
+	presses := 0
+	button.SetInterrupt(machine.PinFalling, func(p machine.Pin) {
+		presses++
+		println("interrupt on pin", p, "level:", p.Get())
+	})
+	sim.SetPin(button, true)
+	sim.SetPin(button, false)
+	sim.SetPin(button, false)
+	button.SetInterrupt(0, nil)
+	sim.SetPin(button, true)
+	sim.SetPin(button, false)
+	println("button presses:", presses, sim.PinInterrupt(button))
+
+	// ADC and PWM
+	sim.SetADC(5, 1234)
+	println("adc:", machine.ADC{Pin: 5}.Get())
+	machine.PWM{Pin: 6}.Set(0x8000)
+	println("pwm:", sim.PWMValue(6))
+
+	// SPI
+	sim.AttachSPI(0, sim.SPIFunc(func(w byte) byte {
+		return w + 1
+	}))
+	machine.SPI0.Configure(machine.SPIConfig{})
+	r, _ := machine.SPI0.Transfer(41)
+	println("spi:", r, len(sim.SPIWritten(0)))
+
+	// I2C
+	regs := &sim.RegisterMap{}
+	regs.Registers[0x0f] = 0x33
+	sim.AttachI2C(0, 0x19, regs)
+	machine.I2C0.Configure(machine.I2CConfig{})
+	buf := make([]byte, 1)
+	err := machine.I2C0.Tx(0x19, []byte{0x0f}, buf)
+	println("i2c read:", err == nil, buf[0])
+	err = machine.I2C0.Tx(0x19, []byte{0x20, 0x57}, nil)
+	println("i2c write:", err == nil, regs.Registers[0x20])
+	err = machine.I2C0.Tx(0x18, []byte{0x0f}, buf)
+	println("i2c missing device:", err != nil)
+
+	// UART loopback
+	machine.UART0.Configure(machine.UARTConfig{})
+	machine.UART0.Write([]byte("hello"))
+	rx := make([]byte, 8)
+	n, _ := machine.UART0.Read(rx)
+	println("uart:", string(rx[:n]), string(sim.UARTOutput(0)))
+}
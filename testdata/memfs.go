@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/memfs"
+)
+
+func main() {
+	err := os.Mount("/mem", memfs.New())
+	println("Mount:", err == nil)
+	println("Mount twice:", os.IsExist(os.Mount("/mem", memfs.New())))
+
+	// Create and read back a file.
+	f, err := os.Create("/mem/hello.txt")
+	if err != nil {
+		println("could not create file:", err.Error())
+		return
+	}
+	n, err := f.Write([]byte("hello "))
+	println("Write:", n, err == nil)
+	f.Write([]byte("world"))
+	f.Close()
+	data, err := ioutil.ReadFile("/mem/hello.txt")
+	println("ReadFile:", string(data), err == nil)
+
+	// Append to the file.
+	f, err = os.OpenFile("/mem/hello.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		println("could not open file:", err.Error())
+		return
+	}
+	f.Write([]byte("!"))
+	f.Close()
+	info, err := os.Stat("/mem/hello.txt")
+	println("Stat:", info.Name(), info.Size(), info.IsDir(), err == nil)
+
+	// Errors.
+	_, err = os.Open("/mem/nonexistent")
+	println("IsNotExist:", os.IsNotExist(err))
+	_, err = os.OpenFile("/mem/hello.txt", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	println("IsExist:", os.IsExist(err))
+
+	// Directories.
+	println("MkdirAll:", os.MkdirAll("/mem/a/b", 0777) == nil)
+	ioutil.WriteFile("/mem/a/b/file1", []byte("1"), 0666)
+	ioutil.WriteFile("/mem/a/file2", []byte("22"), 0666)
+	infos, err := ioutil.ReadDir("/mem/a")
+	println("ReadDir:", len(infos), err == nil)
+	for _, info := range infos {
+		println(" -", info.Name(), info.Size(), info.IsDir())
+	}
+	dir, _ := os.Open("/mem/a")
+	names, err := dir.Readdirnames(1)
+	println("Readdirnames:", len(names), names[0], err == nil)
+	names, err = dir.Readdirnames(1)
+	println("Readdirnames:", len(names), names[0], err == nil)
+	names, err = dir.Readdirnames(1)
+	println("Readdirnames:", len(names), err != nil)
+	dir.Close()
+
+	// Rename and remove.
+	println("Rename:", os.Rename("/mem/a/file2", "/mem/a/b/file2") == nil)
+	println("Remove non-empty:", os.IsExist(os.Remove("/mem/a")))
+	println("RemoveAll:", os.RemoveAll("/mem/a") == nil)
+	_, err = os.Stat("/mem/a/b/file2")
+	println("removed:", os.IsNotExist(err))
+
+	// Unmount.
+	println("Unmount:", os.Unmount("/mem") == nil)
+	_, err = os.Stat("/mem/hello.txt")
+	println("unmounted:", err != nil)
+}
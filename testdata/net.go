@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+)
+
+func main() {
+	testTCP()
+	testUDP()
+	testUnix()
+	testDeadline()
+	testTimers()
+}
+
+// echo accepts a single connection and echoes everything it receives.
+func echo(l net.Listener) {
+	conn, err := l.Accept()
+	if err != nil {
+		println("accept:", err.Error())
+		return
+	}
+	buf := make([]byte, 64)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			break
+		}
+		conn.Write(buf[:n])
+	}
+	conn.Close()
+}
+
+// roundTrip sends a message over the connection and prints the reply.
+func roundTrip(conn net.Conn, msg string) {
+	_, err := conn.Write([]byte(msg))
+	if err != nil {
+		println("write:", err.Error())
+		return
+	}
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		println("read:", err.Error())
+		return
+	}
+	println("reply:", string(buf[:n]))
+}
+
+func testTCP() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		println("listen tcp:", err.Error())
+		return
+	}
+	defer l.Close()
+	go echo(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		println("dial tcp:", err.Error())
+		return
+	}
+	roundTrip(conn, "hello over TCP")
+	roundTrip(conn, "and again")
+	conn.Close()
+}
+
+func testUDP() {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		println("listen udp:", err.Error())
+		return
+	}
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 64)
+		n, addr, err := server.ReadFrom(buf)
+		if err != nil {
+			println("read udp:", err.Error())
+			return
+		}
+		server.WriteTo(buf[:n], addr)
+	}()
+
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		println("dial udp:", err.Error())
+		return
+	}
+	roundTrip(conn, "hello over UDP")
+	conn.Close()
+}
+
+func testUnix() {
+	dir, err := ioutil.TempDir("", "tinygo-net")
+	if err != nil {
+		println("could not create temporary directory:", err.Error())
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", dir+"/socket")
+	if err != nil {
+		println("listen unix:", err.Error())
+		return
+	}
+	defer l.Close()
+	go echo(l)
+
+	conn, err := net.Dial("unix", dir+"/socket")
+	if err != nil {
+		println("dial unix:", err.Error())
+		return
+	}
+	roundTrip(conn, "hello over a Unix socket")
+	conn.Close()
+}
+
+func testDeadline() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		println("listen tcp:", err.Error())
+		return
+	}
+	defer l.Close()
+	go echo(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		println("dial tcp:", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	// Nothing is sent, so the read must time out.
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = conn.Read(make([]byte, 1))
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		println("read timed out")
+	} else {
+		println("expected a timeout, got:", err)
+	}
+}
+
+func testTimers() {
+	done := make(chan struct{})
+	time.AfterFunc(time.Millisecond, func() {
+		println("AfterFunc called")
+		close(done)
+	})
+	<-done
+
+	timer := time.NewTimer(time.Millisecond)
+	<-timer.C
+	println("timer fired")
+	println("stopped fired timer:", timer.Stop())
+}
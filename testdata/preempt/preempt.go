@@ -0,0 +1,65 @@
+package main
+
+// This test is built with the "preempt" build tag, see TestPreemption.
+
+import (
+	"runtime"
+	"runtime/volatile"
+	"time"
+)
+
+var (
+	stop    volatile.Register32
+	counter [2]volatile.Register32
+	done    = make(chan int)
+	wake    = make(chan bool)
+	woken   volatile.Register32
+)
+
+func main() {
+	runtime.SetTimeSlice(int64(time.Millisecond))
+
+	// Start goroutines that never block or call Gosched. Without preemption,
+	// the first one would run forever and starve all other goroutines.
+	for i := range counter {
+		go spin(i)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	println("main goroutine woke up")
+
+	// Check whether both goroutines got to run.
+	for i := range counter {
+		println("goroutine", i, "ran:", counter[i].Get() != 0)
+	}
+
+	// Stop them and wait until they have exited.
+	stop.Set(1)
+	for range counter {
+		<-done
+	}
+	println("goroutines stopped")
+
+	// A goroutine with a higher priority preempts the running goroutine as
+	// soon as it becomes runnable, even without time slicing.
+	runtime.SetTimeSlice(0)
+	go urgent()
+	time.Sleep(time.Millisecond)
+	wake <- true
+	woken.Set(1)
+	<-done
+}
+
+func urgent() {
+	runtime.SetPriority(runtime.MaxPriority)
+	<-wake
+	println("urgent goroutine ran first:", woken.Get() == 0)
+	done <- 0
+}
+
+func spin(i int) {
+	for stop.Get() == 0 {
+		counter[i].Set(counter[i].Get() + 1)
+	}
+	done <- i
+}
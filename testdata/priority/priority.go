@@ -0,0 +1,170 @@
+package main
+
+// This test needs goroutine priorities, which are only supported by the tasks
+// scheduler. See TestPriority.
+
+import (
+	"runtime"
+	"sync"
+)
+
+var wg sync.WaitGroup
+
+func main() {
+	println("main priority:", runtime.Priority())
+
+	// Run the main goroutine at the highest priority, so that the goroutines
+	// below only run once it blocks.
+	runtime.SetPriority(runtime.MaxPriority)
+
+	testOrder()
+	testInheritance()
+	testChannel()
+	testChannelBlockedSender()
+}
+
+// testOrder checks that runnable goroutines run in order of priority, and in
+// the order in which they became runnable within the same priority.
+func testOrder() {
+	println("\n# order")
+	for _, w := range []struct {
+		name     string
+		priority int
+	}{
+		{"a", 1},
+		{"b", 0},
+		{"c", 3},
+		{"d", 1},
+		{"e", 2},
+	} {
+		wg.Add(1)
+		go worker(w.name, w.priority)
+	}
+	wg.Wait()
+}
+
+func worker(name string, priority int) {
+	// New goroutines start with the priority of the main goroutine. Lowering
+	// the priority lets the goroutines with a higher priority run first.
+	println(name, "started with priority", runtime.Priority())
+	runtime.SetPriority(priority)
+	println(name, "runs with priority", runtime.Priority())
+	wg.Done()
+}
+
+var (
+	mu      sync.Mutex
+	locked  = make(chan bool)
+	proceed = make(chan bool)
+)
+
+// testInheritance checks that a goroutine holding a mutex inherits the priority
+// of a goroutine waiting for it. Otherwise, the medium priority goroutine would
+// keep both the low and the high priority goroutines from running.
+func testInheritance() {
+	println("\n# inheritance")
+	wg.Add(3)
+	go low()
+	<-locked
+	go medium()
+	go high()
+	proceed <- true
+	wg.Wait()
+}
+
+func low() {
+	runtime.SetPriority(0)
+	mu.Lock()
+	println("low: locked")
+	locked <- true
+	<-proceed
+	println("low: unlocking")
+	mu.Unlock()
+	println("low: unlocked, priority", runtime.Priority())
+	wg.Done()
+}
+
+func medium() {
+	runtime.SetPriority(1)
+	println("medium: running")
+	wg.Done()
+}
+
+func high() {
+	runtime.SetPriority(2)
+	println("high: waiting for lock")
+	mu.Lock()
+	println("high: locked")
+	mu.Unlock()
+	wg.Done()
+}
+
+var (
+	ready    = make(chan bool)
+	requests chan int
+	replies  chan int
+)
+
+// testChannel checks that a goroutine receiving from an unbuffered channel runs
+// with the priority of the goroutine that sent the value. Otherwise, the medium
+// priority goroutine would run before the low priority server that handles the
+// request of the high priority client.
+func testChannel() {
+	println("\n# channel")
+	requests = make(chan int)
+	replies = make(chan int)
+	wg.Add(3)
+	go server()
+	<-ready
+	go medium()
+	go client()
+	wg.Wait()
+}
+
+func server() {
+	runtime.SetPriority(0)
+	ready <- true
+	for n := range requests {
+		println("server: handling request")
+		replies <- n * 2
+	}
+	println("server: done")
+	wg.Done()
+}
+
+func client() {
+	runtime.SetPriority(2)
+	println("client: sending request")
+	requests <- 21
+	println("client: got reply", <-replies)
+	close(requests)
+	wg.Done()
+}
+
+// testChannelBlockedSender is like testChannel, but the client blocks sending
+// the request before the server receives it. The server then takes over the
+// priority of the client when it receives the request. Otherwise, it would let
+// the medium priority goroutine run first when it yields.
+func testChannelBlockedSender() {
+	println("\n# channel, blocked sender")
+	requests = make(chan int)
+	replies = make(chan int)
+	wg.Add(3)
+	go client()
+	go slowServer()
+	wg.Wait()
+}
+
+func slowServer() {
+	runtime.SetPriority(0)
+	// Let the medium priority goroutine become runnable before the request is
+	// received.
+	go medium()
+	for n := range requests {
+		runtime.Gosched()
+		println("server: handling request")
+		replies <- n * 2
+	}
+	println("server: done")
+	wg.Done()
+}
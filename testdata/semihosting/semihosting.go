@@ -0,0 +1,58 @@
+package main
+
+// This program is run by TestSemihosting in QEMU, with the path of an input
+// file and an output file on the host as arguments and with a line of text on
+// standard input. It exits with exit code 3.
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+func main() {
+	println("args:", len(os.Args))
+	if len(os.Args) != 3 {
+		println("expected an input and an output file")
+		os.Exit(1)
+	}
+
+	// Read the input file.
+	f, err := os.Open(os.Args[1])
+	if err != nil {
+		println("could not open input file:", err.Error())
+		os.Exit(1)
+	}
+	data, err := ioutil.ReadAll(f)
+	println("read:", string(data), err == nil)
+	off, err := f.Seek(6, 0)
+	buf := make([]byte, 5)
+	n, _ := f.Read(buf)
+	println("seek:", off, string(buf[:n]), err == nil)
+	f.Close()
+
+	_, err = os.Open(os.Args[1] + ".nonexistent")
+	println("IsNotExist:", os.IsNotExist(err))
+
+	// Write the output file, which is checked by the test.
+	f, err = os.Create(os.Args[2])
+	if err != nil {
+		println("could not create output file:", err.Error())
+		os.Exit(1)
+	}
+	n, err = f.Write([]byte("output"))
+	println("write:", n, err == nil)
+	println("close:", f.Close() == nil)
+
+	// Read a line from standard input.
+	var line []byte
+	for {
+		n, err := os.Stdin.Read(buf[:1])
+		if n == 0 || err != nil || buf[0] == '\n' {
+			break
+		}
+		line = append(line, buf[0])
+	}
+	println("stdin:", string(line))
+
+	os.Exit(3)
+}
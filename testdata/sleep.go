@@ -0,0 +1,49 @@
+package main
+
+import "time"
+
+func main() {
+	// A sleep must take at least the requested duration, also when the
+	// processor really sleeps until the next wakeup.
+	for _, d := range []time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond} {
+		start := time.Now()
+		time.Sleep(d)
+		if elapsed := time.Since(start); elapsed < d {
+			println("slept too short:", int64(elapsed), "<", int64(d))
+		} else {
+			println("slept at least", int64(d/time.Millisecond), "ms")
+		}
+	}
+
+	// Sleeping goroutines wake up in order of their wakeup time.
+	done := make(chan int)
+	for _, n := range []int{30, 10, 20} {
+		go func(n int) {
+			time.Sleep(time.Duration(n) * time.Millisecond)
+			done <- n
+		}(n)
+	}
+	for i := 0; i < 3; i++ {
+		println("woke up after", <-done, "ms")
+	}
+
+	// The clock keeps running while the processor is busy.
+	start := time.Now()
+	for time.Since(start) < 5*time.Millisecond {
+	}
+	println("busy loop done")
+
+	// Long sleeps must not overflow, also on 32-bit systems where a tick is a
+	// nanosecond.
+	start = time.Now()
+	go func() {
+		time.Sleep(5 * time.Second)
+		done <- 5000
+	}()
+	time.Sleep(10 * time.Millisecond)
+	println("slept 10 ms while another goroutine sleeps 5 s")
+	println("woke up after", <-done, "ms")
+	if elapsed := time.Since(start); elapsed < 5*time.Second {
+		println("long sleep too short:", int64(elapsed/time.Millisecond), "ms")
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+// This test only runs on the wasm target, where syscall/js is implemented by
+// the built-in WebAssembly runner (or by wasm_exec.js in a JavaScript
+// environment).
+
+import "syscall/js"
+
+func main() {
+	global := js.Global()
+	global.Set("answer", 42)
+	println("answer:", global.Get("answer").Int())
+	println("Math.max:", global.Get("Math").Call("max", 3, 7).Int())
+
+	arr := global.Get("Array").New(3)
+	arr.SetIndex(1, "two")
+	println("array:", arr.Length(), arr.Index(1).String(), arr.Index(2).Type() == js.TypeUndefined)
+
+	obj := global.Get("Object").New()
+	obj.Set("name", "tinygo")
+	println("object:", obj.Get("name").String(), obj.Get("missing").Type() == js.TypeUndefined)
+
+	global.Get("console").Call("log", "console:", 1.5, true)
+}
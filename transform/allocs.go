@@ -3,24 +3,30 @@ package transform
 // This file implements an escape analysis pass. It looks for calls to
 // runtime.alloc and replaces these calls with a stack allocation if the
 // allocated value does not escape. It uses the LLVM nocapture flag for
-// interprocedural escape analysis.
+// interprocedural escape analysis, and follows pointers that are stored in
+// other non-escaping objects or returned to the caller.
 
 import (
 	"tinygo.org/x/go-llvm"
 )
 
-// maxStackAlloc is the maximum size of an object that will be allocated on the
-// stack. Bigger objects have increased risk of stack overflows and thus will
-// always be heap allocated.
-//
-// TODO: tune this, this is just a random value.
-const maxStackAlloc = 256
+// maxSinkInstructions is the maximum number of instructions in a function
+// that returns a newly allocated object for it to be inlined into a caller, so
+// that the allocation can be done on the stack of the caller. Such functions
+// are usually small constructors like newFoo() *Foo.
+const maxSinkInstructions = 64
 
 // OptimizeAllocs tries to replace heap allocations with stack allocations
 // whenever possible. It relies on the LLVM 'nocapture' flag for interprocedural
 // escape analysis, and within a function looks whether an allocation can escape
-// to the heap.
-func OptimizeAllocs(mod llvm.Module) {
+// to the heap. Objects bigger than maxStackAlloc are always heap allocated.
+//
+// When an allocation only escapes because it is returned from an internal
+// function, the calls to that function after which the returned value does not
+// escape are marked alwaysinline. Other calls are left alone. After inlining,
+// the allocation is part of the caller and can be moved to the stack when
+// OptimizeAllocs is run again.
+func OptimizeAllocs(mod llvm.Module, maxStackAlloc uint64) {
 	allocator := mod.NamedFunction("runtime.alloc")
 	if allocator.IsNil() {
 		// nothing to optimize
@@ -28,8 +34,10 @@ func OptimizeAllocs(mod llvm.Module) {
 	}
 
 	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
 	i8ptrType := llvm.PointerType(mod.Context().Int8Type(), 0)
 	builder := mod.Context().NewBuilder()
+	defer builder.Dispose()
 
 	for _, heapalloc := range getUses(allocator) {
 		if heapalloc.Operand(0).IsAConstant().IsNil() {
@@ -56,14 +64,28 @@ func OptimizeAllocs(mod llvm.Module) {
 			bitcast = uses[0]
 		}
 
-		if mayEscape(bitcast) {
+		escape := newEscapeAnalysis()
+		if escape.mayEscape(bitcast) {
+			continue
+		}
+		if escape.stored && isInLoop(heapalloc.InstructionParent()) {
+			// The pointer value is kept in another object, where it may still
+			// be live when the next iteration of the loop allocates a new
+			// object. Both objects would be the same stack allocation.
+			continue
+		}
+		fn := bitcast.InstructionParent().Parent()
+		if escape.returned {
+			// The pointer value only escapes by being returned. It can't be
+			// allocated on the stack of this function, but maybe it can be
+			// allocated on the stack of the caller after inlining.
+			markCallsForSinking(fn)
 			continue
 		}
 		// The pointer value does not escape.
 
 		// Insert alloca in the entry block. Do it here so that mem2reg can
 		// promote it to a SSA value.
-		fn := bitcast.InstructionParent().Parent()
 		builder.SetInsertPointBefore(fn.EntryBasicBlock().FirstInstruction())
 		alignment := targetData.ABITypeAlignment(i8ptrType)
 		sizeInWords := (size + uint64(alignment) - 1) / uint64(alignment)
@@ -85,9 +107,73 @@ func OptimizeAllocs(mod llvm.Module) {
 	}
 }
 
+// markCallsForSinking marks the calls to the given function (which returns a
+// newly allocated object) as alwaysinline where that would allow the object to
+// be allocated on the stack of the caller. The function itself is not marked,
+// so that calls that don't benefit are not inlined. This is only done for small
+// internal functions.
+func markCallsForSinking(fn llvm.Value) {
+	if fn.Linkage() != llvm.InternalLinkage && fn.Linkage() != llvm.PrivateLinkage {
+		// The function may be replaced at link time.
+		return
+	}
+	if !fn.GetEnumFunctionAttribute(llvm.AttributeKindID("noinline")).IsNil() {
+		// Inlining is not allowed (for example, because of //go:noinline).
+		return
+	}
+	numInstructions := 0
+	for bb := fn.FirstBasicBlock(); !bb.IsNil(); bb = llvm.NextBasicBlock(bb) {
+		for inst := bb.FirstInstruction(); !inst.IsNil(); inst = llvm.NextInstruction(inst) {
+			numInstructions++
+		}
+	}
+	if numInstructions > maxSinkInstructions {
+		return
+	}
+
+	attr := fn.GlobalParent().Context().CreateEnumAttribute(llvm.AttributeKindID("alwaysinline"), 0)
+	for _, use := range getUses(fn) {
+		if use.IsACallInst().IsNil() || use.CalledValue() != fn {
+			// The function is used in some other way, for example as a
+			// function pointer.
+			continue
+		}
+		escape := newEscapeAnalysis()
+		if !escape.mayEscape(use) && !escape.returned && !(escape.stored && isInLoop(use.InstructionParent())) {
+			// After inlining, the object can be allocated on the stack of
+			// this caller.
+			use.AddCallSiteAttribute(-1, attr) // function index
+		}
+	}
+}
+
+// escapeAnalysis holds the state of an escape analysis of a single pointer
+// value, including values loaded from memory the pointer has been stored in.
+type escapeAnalysis struct {
+	// The value is returned from the function it is defined in. This does not
+	// count as escaping, but means the value can't be allocated on the stack
+	// of this function.
+	returned bool
+
+	// The value is stored in another memory object that doesn't escape. This
+	// does not count as escaping either, but the value may be loaded back
+	// later on.
+	stored bool
+
+	// Memory objects (allocas or heap allocations) that the pointer value has
+	// been stored in and that have already been checked.
+	containers map[llvm.Value]struct{}
+}
+
+func newEscapeAnalysis() *escapeAnalysis {
+	return &escapeAnalysis{
+		containers: map[llvm.Value]struct{}{},
+	}
+}
+
 // mayEscape returns whether the value might escape. It returns true if it might
 // escape, and false if it definitely doesn't. The value must be an instruction.
-func mayEscape(value llvm.Value) bool {
+func (e *escapeAnalysis) mayEscape(value llvm.Value) bool {
 	uses := getUses(value)
 	for _, use := range uses {
 		if use.IsAInstruction().IsNil() {
@@ -95,21 +181,25 @@ func mayEscape(value llvm.Value) bool {
 		}
 		switch use.InstructionOpcode() {
 		case llvm.GetElementPtr:
-			if mayEscape(use) {
+			if e.mayEscape(use) {
 				return true
 			}
 		case llvm.BitCast:
 			// A bitcast escapes if the casted-to value escapes.
-			if mayEscape(use) {
+			if e.mayEscape(use) {
 				return true
 			}
 		case llvm.Load:
 			// Load does not escape.
 		case llvm.Store:
-			// Store only escapes when the value is stored to, not when the
-			// value is stored into another value.
+			// Storing to the value does not let it escape. Storing the value
+			// somewhere else only lets it escape when it can be loaded back
+			// from there in a way that escapes.
 			if use.Operand(0) == value {
-				return true
+				if e.mayEscapeVia(use.Operand(1)) {
+					return true
+				}
+				e.stored = true
 			}
 		case llvm.Call:
 			if !hasFlag(use, value, "nocapture") {
@@ -118,6 +208,10 @@ func mayEscape(value llvm.Value) bool {
 		case llvm.ICmp:
 			// Comparing pointers don't let the pointer escape.
 			// This is often a compiler-inserted nil check.
+		case llvm.Ret:
+			// Returning the value does not let it escape from this function,
+			// but the caller may let it escape.
+			e.returned = true
 		default:
 			// Unknown instruction, might escape.
 			return true
@@ -127,3 +221,87 @@ func mayEscape(value llvm.Value) bool {
 	// Checked all uses, and none let the pointer value escape.
 	return false
 }
+
+// mayEscapeVia returns whether a value stored to the given pointer may escape.
+// This is only known for pointers into stack allocations and into heap
+// allocations that are only accessed directly: the value does not escape if it
+// never escapes after being loaded back.
+func (e *escapeAnalysis) mayEscapeVia(ptr llvm.Value) bool {
+	// Find the object this pointer points into.
+	for !ptr.IsAGetElementPtrInst().IsNil() || !ptr.IsABitCastInst().IsNil() {
+		ptr = ptr.Operand(0)
+	}
+	isAlloca := !ptr.IsAAllocaInst().IsNil()
+	isHeapAlloc := !ptr.IsACallInst().IsNil() && ptr.CalledValue().Name() == "runtime.alloc"
+	if !isAlloca && !isHeapAlloc {
+		// Unknown memory, for example a global or a pointer parameter.
+		return true
+	}
+	if _, ok := e.containers[ptr]; ok {
+		// Already checked (or being checked).
+		return false
+	}
+	e.containers[ptr] = struct{}{}
+	return e.mayEscapeContainer(ptr)
+}
+
+// mayEscapeContainer checks all uses of a memory object that holds the pointer
+// value being analyzed. Values loaded from it must not escape, and the object
+// itself must not be used in any way that would make the contents reachable
+// from elsewhere.
+func (e *escapeAnalysis) mayEscapeContainer(container llvm.Value) bool {
+	for _, use := range getUses(container) {
+		switch use.InstructionOpcode() {
+		case llvm.GetElementPtr, llvm.BitCast:
+			if e.mayEscapeContainer(use) {
+				return true
+			}
+		case llvm.Load:
+			// The loaded value may be the pointer value, so it must not
+			// escape either.
+			if e.mayEscape(use) {
+				return true
+			}
+		case llvm.Store:
+			if use.Operand(0) == container {
+				// The container itself is stored somewhere, so its contents
+				// may be read from anywhere.
+				return true
+			}
+		case llvm.ICmp:
+			// Comparing pointers doesn't read the contents.
+		default:
+			// Any other use (for example, passing it to a function) might
+			// read the contents and let them escape.
+			return true
+		}
+	}
+	return false
+}
+
+// isInLoop returns whether the given basic block may run more than once in a
+// single call of its function, that is, whether it can be reached from itself.
+func isInLoop(start llvm.BasicBlock) bool {
+	visited := map[llvm.BasicBlock]struct{}{}
+	worklist := []llvm.BasicBlock{start}
+	for len(worklist) != 0 {
+		bb := worklist[len(worklist)-1]
+		worklist = worklist[:len(worklist)-1]
+		terminator := bb.LastInstruction()
+		for i := 0; i < terminator.OperandsCount(); i++ {
+			operand := terminator.Operand(i)
+			if !operand.IsBasicBlock() {
+				continue
+			}
+			successor := operand.AsBasicBlock()
+			if successor == start {
+				return true
+			}
+			if _, ok := visited[successor]; !ok {
+				visited[successor] = struct{}{}
+				worklist = append(worklist, successor)
+			}
+		}
+	}
+	return false
+}
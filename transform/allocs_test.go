@@ -2,9 +2,13 @@ package transform
 
 import (
 	"testing"
+
+	"tinygo.org/x/go-llvm"
 )
 
 func TestAllocs(t *testing.T) {
 	t.Parallel()
-	testTransform(t, "testdata/allocs", OptimizeAllocs)
+	testTransform(t, "testdata/allocs", func(mod llvm.Module) {
+		OptimizeAllocs(mod, 256)
+	})
 }
@@ -4,11 +4,18 @@ import (
 	"tinygo.org/x/go-llvm"
 )
 
-// OptimizeMaps eliminates created but unused maps.
-//
-// In the future, this should statically allocate created but never modified
-// maps. This has not yet been implemented, however.
+// OptimizeMaps eliminates created but unused maps, and marks maps that were
+// created at compile time (by the interp package) but are never modified
+// afterwards as constant. Such maps, for example package-level lookup tables,
+// are then stored in flash instead of RAM.
 func OptimizeMaps(mod llvm.Module) {
+	removeUnusedMaps(mod)
+	markReadOnlyMaps(mod)
+}
+
+// removeUnusedMaps removes maps that are created at runtime but are never read
+// from.
+func removeUnusedMaps(mod llvm.Module) {
 	hashmapMake := mod.NamedFunction("runtime.hashmapMake")
 	if hashmapMake.IsNil() {
 		// nothing to optimize
@@ -45,3 +52,114 @@ func OptimizeMaps(mod llvm.Module) {
 		}
 	}
 }
+
+// markReadOnlyMaps looks for maps that were statically allocated by the interp
+// package and marks them (including all buckets) as constant if they are only
+// ever read from.
+func markReadOnlyMaps(mod llvm.Module) {
+	hashmapType := mod.GetTypeByName("runtime.hashmap")
+	if hashmapType.IsNil() {
+		// No maps in this program.
+		return
+	}
+
+	// Runtime functions that only read from the map passed as the first
+	// parameter.
+	readOnlyFuncs := map[llvm.Value]struct{}{}
+	for _, name := range []string{"runtime.hashmapLen", "runtime.hashmapNext", "runtime.hashmapBinaryGet", "runtime.hashmapStringGet"} {
+		fn := mod.NamedFunction(name)
+		if !fn.IsNil() {
+			readOnlyFuncs[fn] = struct{}{}
+		}
+	}
+
+	for global := mod.FirstGlobal(); !global.IsNil(); global = llvm.NextGlobal(global) {
+		if global.Type().ElementType() != hashmapType || global.IsDeclaration() || global.IsGlobalConstant() {
+			continue
+		}
+		if !isReadOnlyMap(global, readOnlyFuncs) {
+			continue
+		}
+		global.SetGlobalConstant(true)
+		markBucketsConstant(llvm.ConstExtractValue(global.Initializer(), []uint32{1}))
+	}
+}
+
+// isReadOnlyMap returns whether the given map pointer is only used in ways
+// that do not modify the map: it may be passed to read-only runtime functions
+// or stored in a global that is itself only loaded from.
+func isReadOnlyMap(value llvm.Value, readOnlyFuncs map[llvm.Value]struct{}) bool {
+	for _, use := range getUses(value) {
+		switch {
+		case !use.IsAConstantExpr().IsNil():
+			// Probably a bitcast or getelementptr to get the right pointer
+			// type. Look at the uses of this expression instead.
+			switch use.Opcode() {
+			case llvm.BitCast, llvm.GetElementPtr:
+				if !isReadOnlyMap(use, readOnlyFuncs) {
+					return false
+				}
+			default:
+				return false
+			}
+		case !use.IsAGlobalVariable().IsNil():
+			// The map is stored in a global, usually the package-level map
+			// variable. This is fine as long as the global itself is only
+			// loaded from, and those loaded values are only read from.
+			if use.Initializer() != value {
+				// Part of a larger initializer.
+				return false
+			}
+			for _, globalUse := range getUses(use) {
+				if globalUse.IsALoadInst().IsNil() {
+					return false
+				}
+				if !isReadOnlyMap(globalUse, readOnlyFuncs) {
+					return false
+				}
+			}
+		case !use.IsACallInst().IsNil():
+			if _, ok := readOnlyFuncs[use.CalledValue()]; !ok {
+				return false
+			}
+			// Only the first parameter is the map being read from.
+			for i := 1; i < use.OperandsCount()-1; i++ {
+				if use.Operand(i) == value {
+					return false
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// markBucketsConstant marks the global buckets of a statically allocated map
+// as constant, given the pointer to the buckets array. Overflow buckets (which
+// are chained using the next pointer) are also marked constant.
+func markBucketsConstant(ptr llvm.Value) {
+	for !ptr.IsAConstantExpr().IsNil() {
+		switch ptr.Opcode() {
+		case llvm.BitCast, llvm.GetElementPtr:
+			ptr = ptr.Operand(0)
+		default:
+			return
+		}
+	}
+	global := ptr.IsAGlobalVariable()
+	if global.IsNil() || global.IsGlobalConstant() {
+		return
+	}
+	global.SetGlobalConstant(true)
+
+	// Follow the next pointer of every bucket.
+	initializer := global.Initializer()
+	if initializer.Type().TypeKind() == llvm.ArrayTypeKind {
+		for i := 0; i < initializer.Type().ArrayLength(); i++ {
+			markBucketsConstant(llvm.ConstExtractValue(initializer, []uint32{uint32(i), 1}))
+		}
+	} else {
+		markBucketsConstant(llvm.ConstExtractValue(initializer, []uint32{1}))
+	}
+}
@@ -0,0 +1,89 @@
+package transform
+
+import (
+	"tinygo.org/x/go-llvm"
+)
+
+// CreateStackSizeLoads replaces runtime.getGoroutineStackSize calls with loads
+// from the runtime.stackSizes global, which is placed in a separate section
+// (.tinygo_stacksizes). All stack sizes are initialized to the default stack
+// size. After linking, when the call graph is known, the section contents can
+// be replaced with the actual stack size of each goroutine.
+//
+// It returns the names of the goroutine start wrappers in the same order as
+// the stack sizes in the new global, or nil if there are no goroutines that
+// need a stack size.
+func CreateStackSizeLoads(mod llvm.Module, defaultStackSize uint64) []string {
+	getStackSize := mod.NamedFunction("runtime.getGoroutineStackSize")
+	if getStackSize.IsNil() {
+		// nothing to do
+		return nil
+	}
+
+	ctx := mod.Context()
+	targetData := llvm.NewTargetData(mod.DataLayout())
+	defer targetData.Dispose()
+	uintptrType := ctx.IntType(targetData.PointerSize() * 8)
+
+	// Collect all goroutine start wrappers, in a stable order.
+	var functionNames []string
+	functionIndices := map[llvm.Value]int{}
+	var calls []llvm.Value
+	for _, call := range getUses(getStackSize) {
+		if call.IsACallInst().IsNil() {
+			panic("expected use of runtime.getGoroutineStackSize to be a call")
+		}
+		calls = append(calls, call)
+		fn := call.Operand(0)
+		if !fn.IsAConstantExpr().IsNil() && fn.Opcode() == llvm.PtrToInt {
+			fn = fn.Operand(0)
+		}
+		if fn.IsAFunction().IsNil() {
+			// Not a known function, so the stack size cannot be determined.
+			continue
+		}
+		if _, ok := functionIndices[fn]; !ok {
+			functionIndices[fn] = len(functionNames)
+			functionNames = append(functionNames, fn.Name())
+		}
+	}
+
+	builder := ctx.NewBuilder()
+	defer builder.Dispose()
+	defaultValue := llvm.ConstInt(uintptrType, defaultStackSize, false)
+
+	// Create the global that will be modified after linking.
+	var stackSizes llvm.Value
+	if len(functionNames) != 0 {
+		values := make([]llvm.Value, len(functionNames))
+		for i := range values {
+			values[i] = defaultValue
+		}
+		stackSizes = llvm.AddGlobal(mod, llvm.ArrayType(uintptrType, len(values)), "runtime.stackSizes")
+		stackSizes.SetInitializer(llvm.ConstArray(uintptrType, values))
+		stackSizes.SetSection(".tinygo_stacksizes")
+		stackSizes.SetAlignment(targetData.ABITypeAlignment(uintptrType))
+		stackSizes.SetLinkage(llvm.InternalLinkage)
+	}
+
+	// Replace the calls with loads from the new global.
+	for _, call := range calls {
+		fn := call.Operand(0)
+		if !fn.IsAConstantExpr().IsNil() && fn.Opcode() == llvm.PtrToInt {
+			fn = fn.Operand(0)
+		}
+		value := defaultValue
+		if index, ok := functionIndices[fn]; ok {
+			builder.SetInsertPointBefore(call)
+			ptr := llvm.ConstGEP(stackSizes, []llvm.Value{
+				llvm.ConstInt(ctx.Int32Type(), 0, false),
+				llvm.ConstInt(ctx.Int32Type(), uint64(index), false),
+			})
+			value = builder.CreateLoad(ptr, "stacksize")
+		}
+		call.ReplaceAllUsesWith(value)
+		call.EraseFromParentAsInstruction()
+	}
+
+	return functionNames
+}
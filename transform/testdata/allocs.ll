@@ -1,6 +1,8 @@
 target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
 target triple = "armv7m-none-eabi"
 
+@escapedPtr = global i32* null
+
 declare nonnull i8* @runtime.alloc(i32)
 
 ; Test allocating a single int (i32) that should be allocated on the stack.
@@ -68,6 +70,74 @@ end:
   ret void
 }
 
+; Store the allocated pointer in a stack object that does not escape. The
+; allocation can still be done on the stack.
+define i32 @testStoredInAlloca() {
+  %holder = alloca i32*
+  %1 = call i8* @runtime.alloc(i32 4)
+  %2 = bitcast i8* %1 to i32*
+  store i32* %2, i32** %holder
+  %3 = load i32*, i32** %holder
+  store i32 5, i32* %3
+  %4 = load i32, i32* %3
+  ret i32 %4
+}
+
+; Store the allocated pointer in a stack object inside a loop. The pointers
+; stored in earlier iterations are still live when the next object is
+; allocated, so the allocation must stay on the heap.
+define i32 @testStoredInAllocaLoop() {
+entry:
+  %holder = alloca [2 x i32*]
+  br label %loop
+loop:
+  %i = phi i32 [ 0, %entry ], [ %next, %loop ]
+  %0 = call i8* @runtime.alloc(i32 4)
+  %1 = bitcast i8* %0 to i32*
+  store i32 %i, i32* %1
+  %2 = getelementptr [2 x i32*], [2 x i32*]* %holder, i32 0, i32 %i
+  store i32* %1, i32** %2
+  %next = add i32 %i, 1
+  %3 = icmp eq i32 %next, 2
+  br i1 %3, label %end, label %loop
+end:
+  %4 = getelementptr [2 x i32*], [2 x i32*]* %holder, i32 0, i32 0
+  %5 = load i32*, i32** %4
+  %6 = load i32, i32* %5
+  ret i32 %6
+}
+
+; Store the allocated pointer in a global, which lets it escape.
+define void @testStoredInGlobal() {
+  %1 = call i8* @runtime.alloc(i32 4)
+  %2 = bitcast i8* %1 to i32*
+  store i32* %2, i32** @escapedPtr
+  ret void
+}
+
+; A small constructor that returns a new object. Calls to it should be marked
+; alwaysinline where the object can be allocated on the stack of the caller after
+; inlining.
+define internal i32* @newInt() {
+  %1 = call i8* @runtime.alloc(i32 4)
+  %2 = bitcast i8* %1 to i32*
+  store i32 3, i32* %2
+  ret i32* %2
+}
+
+define i32 @testReturnedToCaller() {
+  %1 = call i32* @newInt()
+  %2 = load i32, i32* %1
+  ret i32 %2
+}
+
+; The object escapes in this caller, so inlining would not help.
+define void @testReturnedToEscapingCaller() {
+  %1 = call i32* @newInt()
+  store i32* %1, i32** @escapedPtr
+  ret void
+}
+
 declare i32* @escapeIntPtr(i32*)
 
 declare i32* @noescapeIntPtr(i32* nocapture)
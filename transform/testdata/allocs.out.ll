@@ -1,6 +1,8 @@
 target datalayout = "e-m:e-p:32:32-i64:64-v128:64:128-a:0:32-n32-S64"
 target triple = "armv7m-none-eabi"
 
+@escapedPtr = global i32* null
+
 declare nonnull i8* @runtime.alloc(i32)
 
 define void @testInt() {
@@ -64,8 +66,69 @@ end:
   ret void
 }
 
+define i32 @testStoredInAlloca() {
+  %stackalloc.alloca = alloca [1 x i32]
+  %holder = alloca i32*
+  store [1 x i32] zeroinitializer, [1 x i32]* %stackalloc.alloca
+  %stackalloc = bitcast [1 x i32]* %stackalloc.alloca to i32*
+  store i32* %stackalloc, i32** %holder
+  %1 = load i32*, i32** %holder
+  store i32 5, i32* %1
+  %2 = load i32, i32* %1
+  ret i32 %2
+}
+
+define i32 @testStoredInAllocaLoop() {
+entry:
+  %holder = alloca [2 x i32*]
+  br label %loop
+loop:
+  %i = phi i32 [ 0, %entry ], [ %next, %loop ]
+  %0 = call i8* @runtime.alloc(i32 4)
+  %1 = bitcast i8* %0 to i32*
+  store i32 %i, i32* %1
+  %2 = getelementptr [2 x i32*], [2 x i32*]* %holder, i32 0, i32 %i
+  store i32* %1, i32** %2
+  %next = add i32 %i, 1
+  %3 = icmp eq i32 %next, 2
+  br i1 %3, label %end, label %loop
+end:
+  %4 = getelementptr [2 x i32*], [2 x i32*]* %holder, i32 0, i32 0
+  %5 = load i32*, i32** %4
+  %6 = load i32, i32* %5
+  ret i32 %6
+}
+
+define void @testStoredInGlobal() {
+  %1 = call i8* @runtime.alloc(i32 4)
+  %2 = bitcast i8* %1 to i32*
+  store i32* %2, i32** @escapedPtr
+  ret void
+}
+
+define internal i32* @newInt() {
+  %1 = call i8* @runtime.alloc(i32 4)
+  %2 = bitcast i8* %1 to i32*
+  store i32 3, i32* %2
+  ret i32* %2
+}
+
+define i32 @testReturnedToCaller() {
+  %1 = call i32* @newInt() #0
+  %2 = load i32, i32* %1
+  ret i32 %2
+}
+
+define void @testReturnedToEscapingCaller() {
+  %1 = call i32* @newInt()
+  store i32* %1, i32** @escapedPtr
+  ret void
+}
+
 declare i32* @escapeIntPtr(i32*)
 
 declare i32* @noescapeIntPtr(i32* nocapture)
 
 declare i32* @escapeIntPtrSometimes(i32* nocapture, i32*)
+
+attributes #0 = { alwaysinline }
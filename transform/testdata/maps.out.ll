@@ -4,6 +4,12 @@ target triple = "armv7m-none-eabi"
 %runtime.hashmap = type { %runtime.hashmap*, i8*, i32, i8, i8, i8 }
 
 @answer = constant [6 x i8] c"answer"
+@main.readonlyMap = global %runtime.hashmap* @"main$map"
+@main.mutableMap = global %runtime.hashmap* @"main$map.2"
+@"main$mapbucket.1" = internal unnamed_addr constant { [8 x i8], i8*, [8 x i32], [8 x i32] } zeroinitializer
+@"main$mapbucket" = internal unnamed_addr constant [1 x { [8 x i8], i8*, [8 x i32], [8 x i32] }] [{ [8 x i8], i8*, [8 x i32], [8 x i32] } { [8 x i8] zeroinitializer, i8* getelementptr inbounds ({ [8 x i8], i8*, [8 x i32], [8 x i32] }, { [8 x i8], i8*, [8 x i32], [8 x i32] }* @"main$mapbucket.1", i32 0, i32 0, i32 0), [8 x i32] zeroinitializer, [8 x i32] zeroinitializer }]
+@"main$map" = internal unnamed_addr constant %runtime.hashmap { %runtime.hashmap* null, i8* getelementptr inbounds ([1 x { [8 x i8], i8*, [8 x i32], [8 x i32] }], [1 x { [8 x i8], i8*, [8 x i32], [8 x i32] }]* @"main$mapbucket", i32 0, i32 0, i32 0, i32 0), i32 0, i8 4, i8 4, i8 0 }
+@"main$map.2" = internal unnamed_addr global %runtime.hashmap { %runtime.hashmap* null, i8* null, i32 0, i8 4, i8 4, i8 0 }
 
 declare nonnull %runtime.hashmap* @runtime.hashmapMake(i8, i8, i32)
 
@@ -32,3 +38,20 @@ define %runtime.hashmap* @testUsed() {
   %1 = call %runtime.hashmap* @runtime.hashmapMake(i8 4, i8 4, i32 0)
   ret %runtime.hashmap* %1
 }
+
+define i1 @testReadonlyGlobal() {
+  %map = load %runtime.hashmap*, %runtime.hashmap** @main.readonlyMap
+  %hashmap.value = alloca i32
+  %hashmap.value.bitcast = bitcast i32* %hashmap.value to i8*
+  %commaOk = call i1 @runtime.hashmapStringGet(%runtime.hashmap* %map, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @answer, i32 0, i32 0), i32 6, i8* %hashmap.value.bitcast)
+  ret i1 %commaOk
+}
+
+define void @testMutableGlobal() {
+  %map = load %runtime.hashmap*, %runtime.hashmap** @main.mutableMap
+  %hashmap.value = alloca i32
+  store i32 42, i32* %hashmap.value
+  %hashmap.value.bitcast = bitcast i32* %hashmap.value to i8*
+  call void @runtime.hashmapStringSet(%runtime.hashmap* %map, i8* getelementptr inbounds ([6 x i8], [6 x i8]* @answer, i32 0, i32 0), i32 6, i8* %hashmap.value.bitcast)
+  ret void
+}
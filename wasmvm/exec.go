@@ -0,0 +1,467 @@
+package wasmvm
+
+// This file implements the interpreter itself. Function bodies are executed
+// directly from the binary encoding. The only preprocessing done is finding
+// the matching else and end instructions of each block, which is done once per
+// function on the first call.
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Opcodes, see https://webassembly.github.io/spec/core/binary/instructions.html
+const (
+	opUnreachable  = 0x00
+	opNop          = 0x01
+	opBlock        = 0x02
+	opLoop         = 0x03
+	opIf           = 0x04
+	opElse         = 0x05
+	opEnd          = 0x0b
+	opBr           = 0x0c
+	opBrIf         = 0x0d
+	opBrTable      = 0x0e
+	opReturn       = 0x0f
+	opCall         = 0x10
+	opCallIndirect = 0x11
+	opDrop         = 0x1a
+	opSelect       = 0x1b
+	opSelectT      = 0x1c
+	opLocalGet     = 0x20
+	opLocalSet     = 0x21
+	opLocalTee     = 0x22
+	opGlobalGet    = 0x23
+	opGlobalSet    = 0x24
+	opI32Load      = 0x28
+	opI64Store32   = 0x3e
+	opMemorySize   = 0x3f
+	opMemoryGrow   = 0x40
+	opI32Const     = 0x41
+	opI64Const     = 0x42
+	opF32Const     = 0x43
+	opF64Const     = 0x44
+	opPrefixFC     = 0xfc
+)
+
+// Secondary opcodes after the 0xfc prefix.
+const (
+	opMemoryInit = 8
+	opDataDrop   = 9
+	opMemoryCopy = 10
+	opMemoryFill = 11
+)
+
+// block holds the positions of the else (if any) and end instruction that
+// belong to a block, loop or if instruction.
+type block struct {
+	elsePC int // position of the else instruction, or -1
+	endPC  int // position of the end instruction
+}
+
+// label is a branch target on the control stack.
+type label struct {
+	cont   int  // position to continue execution after a branch
+	height int  // operand stack height at the start of the block
+	arity  int  // number of values passed on a branch
+	loop   bool // whether this is the label of a loop
+}
+
+// skipLEB returns the position right after the LEB128 value at pos.
+func skipLEB(buf []byte, pos int) int {
+	for pos < len(buf) && buf[pos]&0x80 != 0 {
+		pos++
+	}
+	return pos + 1
+}
+
+// skipImmediates returns the position after the immediate operands of the
+// given instruction, which start at pos.
+func skipImmediates(buf []byte, pos int, op byte) int {
+	switch {
+	case op == opBlock || op == opLoop || op == opIf:
+		// Block type: empty, a value type, or a signed type index.
+		return skipLEB(buf, pos)
+	case op == opBr || op == opBrIf || op == opCall || op == opLocalGet || op == opLocalSet || op == opLocalTee || op == opGlobalGet || op == opGlobalSet:
+		return skipLEB(buf, pos)
+	case op == opBrTable:
+		count, n := readULEB(buf[minInt(pos, len(buf)):])
+		pos += n
+		for i := uint64(0); i <= count && pos <= len(buf); i++ {
+			pos = skipLEB(buf, pos)
+		}
+		return pos
+	case op == opCallIndirect:
+		return skipLEB(buf, pos) + 1
+	case op == opSelectT:
+		count, n := readULEB(buf[minInt(pos, len(buf)):])
+		return pos + n + int(count)
+	case op >= opI32Load && op <= opI64Store32:
+		// Alignment and offset.
+		return skipLEB(buf, skipLEB(buf, pos))
+	case op == opMemorySize || op == opMemoryGrow:
+		return pos + 1
+	case op == opI32Const || op == opI64Const:
+		return skipLEB(buf, pos)
+	case op == opF32Const:
+		return pos + 4
+	case op == opF64Const:
+		return pos + 8
+	case op == opPrefixFC:
+		sub, n := readULEB(buf[minInt(pos, len(buf)):])
+		pos += n
+		switch sub {
+		case opMemoryInit:
+			return skipLEB(buf, pos) + 1
+		case opDataDrop:
+			return skipLEB(buf, pos)
+		case opMemoryCopy:
+			return pos + 2
+		case opMemoryFill:
+			return pos + 1
+		case 12, 14:
+			// table.init, table.copy
+			return skipLEB(buf, skipLEB(buf, pos))
+		case 13, 15, 16, 17:
+			// elem.drop, table.grow, table.size, table.fill
+			return skipLEB(buf, pos)
+		}
+		return pos
+	}
+	return pos
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// computeBlocks finds the matching else and end instructions for every block
+// in a function body, indexed by the position of the block instruction.
+func computeBlocks(body []byte) map[int]block {
+	blocks := map[int]block{}
+	var open []int
+	for pc := 0; pc < len(body); {
+		op := body[pc]
+		switch op {
+		case opBlock, opLoop, opIf:
+			open = append(open, pc)
+			blocks[pc] = block{elsePC: -1}
+		case opElse:
+			if len(open) != 0 {
+				start := open[len(open)-1]
+				b := blocks[start]
+				b.elsePC = pc
+				blocks[start] = b
+			}
+		case opEnd:
+			if len(open) != 0 {
+				start := open[len(open)-1]
+				open = open[:len(open)-1]
+				b := blocks[start]
+				b.endPC = pc
+				blocks[start] = b
+			}
+		}
+		pc = skipImmediates(body, pc+1, op)
+	}
+	return blocks
+}
+
+// blockType returns the number of parameters and results of a block with the
+// block type at pos, and the position after the block type.
+func (inst *Instance) blockType(body []byte, pos int) (params, results, next int) {
+	switch body[pos] {
+	case 0x40:
+		return 0, 0, pos + 1
+	case byte(I32), byte(I64), byte(F32), byte(F64):
+		return 0, 1, pos + 1
+	}
+	index, n := readSLEB(body[pos:])
+	typ := inst.module.Types[index]
+	return len(typ.Params), len(typ.Results), pos + n
+}
+
+func trap(msg string) {
+	panic(&Trap{msg})
+}
+
+// call calls the function with the given index and returns its results.
+func (inst *Instance) call(index uint32, args []uint64) []uint64 {
+	fn := inst.funcs[index]
+	if fn.host != nil {
+		results, err := fn.host(inst, args)
+		if err != nil {
+			panic(hostError{err})
+		}
+		return results
+	}
+
+	inst.depth++
+	defer func() {
+		inst.depth--
+	}()
+	if inst.depth > maxCallDepth {
+		trap("call stack exhausted")
+	}
+	if fn.blocks == nil {
+		fn.blocks = computeBlocks(fn.code.body)
+	}
+
+	body := fn.code.body
+	locals := make([]uint64, len(fn.typ.Params)+len(fn.code.locals))
+	copy(locals, args)
+	stack := make([]uint64, 0, 16)
+	labels := []label{{cont: len(body), arity: len(fn.typ.Results)}}
+
+	push := func(v uint64) {
+		stack = append(stack, v)
+	}
+	pop := func() uint64 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	branch := func(depth int) int {
+		l := labels[len(labels)-1-depth]
+		copy(stack[l.height:], stack[len(stack)-l.arity:])
+		stack = stack[:l.height+l.arity]
+		if l.loop {
+			labels = labels[:len(labels)-depth]
+		} else {
+			labels = labels[:len(labels)-1-depth]
+		}
+		return l.cont
+	}
+	immU32 := func(pc *int) uint32 {
+		value, n := readULEB(body[*pc:])
+		*pc += n
+		return uint32(value)
+	}
+	address := func(pc *int, size uint64) uint64 {
+		immU32(pc) // alignment
+		offset := uint64(immU32(pc))
+		ea := uint64(uint32(pop())) + offset
+		if ea+size > uint64(len(inst.Memory)) {
+			trap("out of bounds memory access")
+		}
+		return ea
+	}
+
+	pc := 0
+	for pc < len(body) {
+		opPC := pc
+		op := body[pc]
+		pc++
+		switch op {
+		case opUnreachable:
+			trap("unreachable")
+		case opNop:
+		case opBlock, opLoop:
+			params, results, next := inst.blockType(body, pc)
+			pc = next
+			l := label{height: len(stack) - params, arity: results}
+			if op == opLoop {
+				// Branching to a loop continues at the start of the loop body
+				// (without leaving the loop).
+				l.cont = pc
+				l.arity = params
+				l.loop = true
+			} else {
+				l.cont = fn.blocks[opPC].endPC + 1
+			}
+			labels = append(labels, l)
+		case opIf:
+			params, results, next := inst.blockType(body, pc)
+			pc = next
+			b := fn.blocks[opPC]
+			if uint32(pop()) == 0 {
+				if b.elsePC < 0 {
+					pc = b.endPC + 1
+					break
+				}
+				pc = b.elsePC + 1
+			}
+			labels = append(labels, label{cont: b.endPC + 1, height: len(stack) - params, arity: results})
+		case opElse:
+			// End of the then branch: continue after the end of the if.
+			pc = labels[len(labels)-1].cont
+			labels = labels[:len(labels)-1]
+		case opEnd:
+			labels = labels[:len(labels)-1]
+		case opBr:
+			pc = branch(int(immU32(&pc)))
+		case opBrIf:
+			depth := int(immU32(&pc))
+			if uint32(pop()) != 0 {
+				pc = branch(depth)
+			}
+		case opBrTable:
+			count := immU32(&pc)
+			targets := make([]uint32, count+1)
+			for i := range targets {
+				targets[i] = immU32(&pc)
+			}
+			index := uint32(pop())
+			if index > count {
+				index = count
+			}
+			pc = branch(int(targets[index]))
+		case opReturn:
+			pc = branch(len(labels) - 1)
+		case opCall:
+			calleeIndex := immU32(&pc)
+			n := len(inst.funcs[calleeIndex].typ.Params)
+			results := inst.call(calleeIndex, stack[len(stack)-n:])
+			stack = append(stack[:len(stack)-n], results...)
+		case opCallIndirect:
+			typ := inst.module.Types[immU32(&pc)]
+			pc++ // table index
+			elem := uint32(pop())
+			if elem >= uint32(len(inst.table)) {
+				trap("undefined element")
+			}
+			fnIndex := inst.table[elem]
+			if fnIndex < 0 {
+				trap("uninitialized element")
+			}
+			if !inst.funcs[fnIndex].typ.equal(typ) {
+				trap("indirect call type mismatch")
+			}
+			n := len(typ.Params)
+			results := inst.call(uint32(fnIndex), stack[len(stack)-n:])
+			stack = append(stack[:len(stack)-n], results...)
+		case opDrop:
+			pop()
+		case opSelect, opSelectT:
+			pc = skipImmediates(body, pc, op)
+			cond := uint32(pop())
+			b := pop()
+			if cond == 0 {
+				stack[len(stack)-1] = b
+			}
+		case opLocalGet:
+			push(locals[immU32(&pc)])
+		case opLocalSet:
+			locals[immU32(&pc)] = pop()
+		case opLocalTee:
+			locals[immU32(&pc)] = stack[len(stack)-1]
+		case opGlobalGet:
+			push(inst.globals[immU32(&pc)])
+		case opGlobalSet:
+			inst.globals[immU32(&pc)] = pop()
+
+		// Memory instructions.
+		case 0x28: // i32.load
+			push(uint64(binary.LittleEndian.Uint32(inst.Memory[address(&pc, 4):])))
+		case 0x29: // i64.load
+			push(binary.LittleEndian.Uint64(inst.Memory[address(&pc, 8):]))
+		case 0x2a: // f32.load
+			push(uint64(binary.LittleEndian.Uint32(inst.Memory[address(&pc, 4):])))
+		case 0x2b: // f64.load
+			push(binary.LittleEndian.Uint64(inst.Memory[address(&pc, 8):]))
+		case 0x2c: // i32.load8_s
+			push(uint64(uint32(int32(int8(inst.Memory[address(&pc, 1)])))))
+		case 0x2d: // i32.load8_u
+			push(uint64(inst.Memory[address(&pc, 1)]))
+		case 0x2e: // i32.load16_s
+			push(uint64(uint32(int32(int16(binary.LittleEndian.Uint16(inst.Memory[address(&pc, 2):]))))))
+		case 0x2f: // i32.load16_u
+			push(uint64(binary.LittleEndian.Uint16(inst.Memory[address(&pc, 2):])))
+		case 0x30: // i64.load8_s
+			push(uint64(int64(int8(inst.Memory[address(&pc, 1)]))))
+		case 0x31: // i64.load8_u
+			push(uint64(inst.Memory[address(&pc, 1)]))
+		case 0x32: // i64.load16_s
+			push(uint64(int64(int16(binary.LittleEndian.Uint16(inst.Memory[address(&pc, 2):])))))
+		case 0x33: // i64.load16_u
+			push(uint64(binary.LittleEndian.Uint16(inst.Memory[address(&pc, 2):])))
+		case 0x34: // i64.load32_s
+			push(uint64(int64(int32(binary.LittleEndian.Uint32(inst.Memory[address(&pc, 4):])))))
+		case 0x35: // i64.load32_u
+			push(uint64(binary.LittleEndian.Uint32(inst.Memory[address(&pc, 4):])))
+		case 0x36, 0x38, 0x3e: // i32.store, f32.store, i64.store32
+			value := pop()
+			binary.LittleEndian.PutUint32(inst.Memory[address(&pc, 4):], uint32(value))
+		case 0x37, 0x39: // i64.store, f64.store
+			value := pop()
+			binary.LittleEndian.PutUint64(inst.Memory[address(&pc, 8):], value)
+		case 0x3a, 0x3c: // i32.store8, i64.store8
+			value := pop()
+			inst.Memory[address(&pc, 1)] = byte(value)
+		case 0x3b, 0x3d: // i32.store16, i64.store16
+			value := pop()
+			binary.LittleEndian.PutUint16(inst.Memory[address(&pc, 2):], uint16(value))
+		case opMemorySize:
+			pc++ // memory index
+			push(uint64(len(inst.Memory) / pageSize))
+		case opMemoryGrow:
+			pc++ // memory index
+			delta := uint32(pop())
+			oldPages := uint32(len(inst.Memory) / pageSize)
+			if uint64(oldPages)+uint64(delta) > uint64(inst.memMax) {
+				push(uint64(math.MaxUint32)) // -1
+				break
+			}
+			memory := make([]byte, int(oldPages+delta)*pageSize)
+			copy(memory, inst.Memory)
+			inst.Memory = memory
+			push(uint64(oldPages))
+
+		// Constants.
+		case opI32Const:
+			value, n := readSLEB(body[pc:])
+			pc += n
+			push(uint64(uint32(value)))
+		case opI64Const:
+			value, n := readSLEB(body[pc:])
+			pc += n
+			push(uint64(value))
+		case opF32Const:
+			push(uint64(binary.LittleEndian.Uint32(body[pc:])))
+			pc += 4
+		case opF64Const:
+			push(binary.LittleEndian.Uint64(body[pc:]))
+			pc += 8
+
+		case opPrefixFC:
+			sub := immU32(&pc)
+			switch {
+			case sub <= 7:
+				push(truncSat(sub, pop()))
+			case sub == opMemoryCopy:
+				pc += 2 // memory indices
+				n := uint64(uint32(pop()))
+				src := uint64(uint32(pop()))
+				dst := uint64(uint32(pop()))
+				if src+n > uint64(len(inst.Memory)) || dst+n > uint64(len(inst.Memory)) {
+					trap("out of bounds memory access")
+				}
+				copy(inst.Memory[dst:dst+n], inst.Memory[src:src+n])
+			case sub == opMemoryFill:
+				pc++ // memory index
+				n := uint64(uint32(pop()))
+				value := byte(pop())
+				dst := uint64(uint32(pop()))
+				if dst+n > uint64(len(inst.Memory)) {
+					trap("out of bounds memory access")
+				}
+				for i := dst; i < dst+n; i++ {
+					inst.Memory[i] = value
+				}
+			default:
+				trap("unsupported instruction")
+			}
+
+		default:
+			if op >= 0x45 && op <= 0xc4 {
+				numeric(op, &stack)
+				break
+			}
+			trap("unsupported instruction")
+		}
+	}
+	return stack[len(stack)-len(fn.typ.Results):]
+}
@@ -0,0 +1,389 @@
+// Package wasmvm implements a small WebAssembly interpreter. It is intended for
+// running programs compiled by TinyGo (for example, tests) without requiring
+// an external runtime like Node.js. It supports the WebAssembly MVP plus the
+// sign-extension, non-trapping float-to-int and bulk memory (copy/fill)
+// instructions. Modules are not validated: they are assumed to be produced by
+// a correct compiler.
+package wasmvm
+
+// This file decodes the WebAssembly binary format:
+// https://webassembly.github.io/spec/core/binary/index.html
+
+import (
+	"errors"
+	"math"
+)
+
+// ValueType is the type of a WebAssembly value.
+type ValueType byte
+
+const (
+	I32 ValueType = 0x7f
+	I64 ValueType = 0x7e
+	F32 ValueType = 0x7d
+	F64 ValueType = 0x7c
+)
+
+// FuncType is the signature of a function.
+type FuncType struct {
+	Params  []ValueType
+	Results []ValueType
+}
+
+func (t FuncType) equal(other FuncType) bool {
+	if len(t.Params) != len(other.Params) || len(t.Results) != len(other.Results) {
+		return false
+	}
+	for i, param := range t.Params {
+		if other.Params[i] != param {
+			return false
+		}
+	}
+	for i, result := range t.Results {
+		if other.Results[i] != result {
+			return false
+		}
+	}
+	return true
+}
+
+// Import and export kinds.
+const (
+	kindFunc   = 0
+	kindTable  = 1
+	kindMemory = 2
+	kindGlobal = 3
+)
+
+// Import is an imported function, table, memory or global. Only functions can
+// be imported by this interpreter.
+type Import struct {
+	Module string
+	Name   string
+	Kind   byte
+	Type   uint32 // function type index, for function imports
+}
+
+// Export is an exported function, table, memory or global.
+type Export struct {
+	Name  string
+	Kind  byte
+	Index uint32
+}
+
+type limits struct {
+	min    uint32
+	max    uint32
+	hasMax bool
+}
+
+type global struct {
+	typ     ValueType
+	mutable bool
+	init    []byte // constant expression
+}
+
+type element struct {
+	offset []byte // constant expression
+	funcs  []uint32
+}
+
+type dataSegment struct {
+	offset []byte // constant expression
+	init   []byte
+}
+
+type code struct {
+	locals []ValueType
+	body   []byte
+}
+
+// Module is a decoded WebAssembly module.
+type Module struct {
+	Types    []FuncType
+	Imports  []Import
+	Exports  []Export
+	funcs    []uint32 // type index of each defined function
+	tables   []limits
+	memories []limits
+	globals  []global
+	start    int64 // start function or -1
+	elements []element
+	data     []dataSegment
+	codes    []code
+}
+
+// ErrInvalidModule is returned when a binary could not be decoded.
+var ErrInvalidModule = errors.New("wasmvm: invalid module")
+
+// decoder reads values from a WebAssembly binary.
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = ErrInvalidModule
+	}
+	d.pos = len(d.buf)
+}
+
+func (d *decoder) byte() byte {
+	if d.pos >= len(d.buf) {
+		d.fail()
+		return 0
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) bytes(n uint32) []byte {
+	if uint64(d.pos)+uint64(n) > uint64(len(d.buf)) {
+		d.fail()
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b
+}
+
+func (d *decoder) u32() uint32 {
+	value, n := readULEB(d.buf[d.pos:])
+	if n == 0 || value > math.MaxUint32 {
+		d.fail()
+		return 0
+	}
+	d.pos += n
+	return uint32(value)
+}
+
+func (d *decoder) name() string {
+	return string(d.bytes(d.u32()))
+}
+
+func (d *decoder) limits() limits {
+	var l limits
+	flags := d.byte()
+	l.min = d.u32()
+	if flags&1 != 0 {
+		l.max = d.u32()
+		l.hasMax = true
+	}
+	return l
+}
+
+// constExpr returns the bytes of a constant expression, including the final
+// end instruction.
+func (d *decoder) constExpr() []byte {
+	start := d.pos
+	for d.err == nil {
+		op := d.byte()
+		if op == opEnd {
+			break
+		}
+		d.pos = skipImmediates(d.buf, d.pos, op)
+		if d.pos > len(d.buf) {
+			d.fail()
+		}
+	}
+	return d.buf[start:d.pos]
+}
+
+func (d *decoder) valueTypes() []ValueType {
+	n := d.u32()
+	if n > uint32(len(d.buf)) {
+		d.fail()
+		return nil
+	}
+	types := make([]ValueType, n)
+	for i := range types {
+		types[i] = ValueType(d.byte())
+	}
+	return types
+}
+
+// Decode decodes a WebAssembly module in the binary format.
+func Decode(buf []byte) (*Module, error) {
+	if len(buf) < 8 || string(buf[:4]) != "\x00asm" || buf[4] != 1 || buf[5] != 0 || buf[6] != 0 || buf[7] != 0 {
+		return nil, errors.New("wasmvm: not a WebAssembly module (or unsupported version)")
+	}
+	m := &Module{start: -1}
+	d := &decoder{buf: buf, pos: 8}
+	for d.pos < len(d.buf) && d.err == nil {
+		id := d.byte()
+		section := &decoder{buf: d.bytes(d.u32())}
+		if d.err != nil {
+			break
+		}
+		m.decodeSection(id, section)
+		if section.err != nil {
+			return nil, section.err
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(m.funcs) != len(m.codes) {
+		return nil, ErrInvalidModule
+	}
+	return m, nil
+}
+
+func (m *Module) decodeSection(id byte, d *decoder) {
+	switch id {
+	case 0:
+		// Custom section (names, debug information, etc.), ignore.
+	case 1:
+		// Type section.
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			if d.byte() != 0x60 {
+				d.fail()
+			}
+			params := d.valueTypes()
+			results := d.valueTypes()
+			m.Types = append(m.Types, FuncType{params, results})
+		}
+	case 2:
+		// Import section.
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			imp := Import{Module: d.name(), Name: d.name(), Kind: d.byte()}
+			switch imp.Kind {
+			case kindFunc:
+				imp.Type = d.u32()
+			case kindTable:
+				d.byte() // element type
+				d.limits()
+			case kindMemory:
+				d.limits()
+			case kindGlobal:
+				d.byte() // value type
+				d.byte() // mutability
+			default:
+				d.fail()
+			}
+			m.Imports = append(m.Imports, imp)
+		}
+	case 3:
+		// Function section.
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			m.funcs = append(m.funcs, d.u32())
+		}
+	case 4:
+		// Table section.
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			d.byte() // element type (funcref)
+			m.tables = append(m.tables, d.limits())
+		}
+	case 5:
+		// Memory section.
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			m.memories = append(m.memories, d.limits())
+		}
+	case 6:
+		// Global section.
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			g := global{typ: ValueType(d.byte())}
+			g.mutable = d.byte() != 0
+			g.init = d.constExpr()
+			m.globals = append(m.globals, g)
+		}
+	case 7:
+		// Export section.
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			m.Exports = append(m.Exports, Export{Name: d.name(), Kind: d.byte(), Index: d.u32()})
+		}
+	case 8:
+		// Start section.
+		m.start = int64(d.u32())
+	case 9:
+		// Element section (only active segments for table 0).
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			if d.u32() != 0 {
+				d.fail()
+			}
+			e := element{offset: d.constExpr()}
+			for i := d.u32(); i != 0 && d.err == nil; i-- {
+				e.funcs = append(e.funcs, d.u32())
+			}
+			m.elements = append(m.elements, e)
+		}
+	case 10:
+		// Code section.
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			body := &decoder{buf: d.bytes(d.u32())}
+			var c code
+			for i := body.u32(); i != 0 && body.err == nil; i-- {
+				count := body.u32()
+				typ := ValueType(body.byte())
+				if count > uint32(len(d.buf)) {
+					body.fail()
+					break
+				}
+				for j := uint32(0); j < count; j++ {
+					c.locals = append(c.locals, typ)
+				}
+			}
+			c.body = body.buf[body.pos:]
+			if body.err != nil {
+				d.err = body.err
+			}
+			m.codes = append(m.codes, c)
+		}
+	case 11:
+		// Data section (only active segments for memory 0).
+		for n := d.u32(); n != 0 && d.err == nil; n-- {
+			if d.u32() != 0 {
+				d.fail()
+			}
+			seg := dataSegment{offset: d.constExpr()}
+			seg.init = d.bytes(d.u32())
+			m.data = append(m.data, seg)
+		}
+	case 12:
+		// Data count section (bulk memory proposal), not needed.
+	default:
+		d.fail()
+	}
+}
+
+// readULEB reads an unsigned LEB128 value. It returns the number of bytes
+// read, or 0 if the value is invalid.
+func readULEB(buf []byte) (uint64, int) {
+	var value uint64
+	var shift uint
+	for i, b := range buf {
+		if shift >= 64 {
+			return 0, 0
+		}
+		value |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// readSLEB reads a signed LEB128 value. It returns the number of bytes read,
+// or 0 if the value is invalid.
+func readSLEB(buf []byte) (int64, int) {
+	var value int64
+	var shift uint
+	for i, b := range buf {
+		if shift >= 64 {
+			return 0, 0
+		}
+		value |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				value |= -1 << shift
+			}
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,424 @@
+package wasmvm
+
+// This file implements the numeric instructions (opcodes 0x45 through 0xc4)
+// and the non-trapping float-to-int conversions.
+
+import (
+	"math"
+	"math/bits"
+)
+
+func boolToValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func f32(v uint64) float32 {
+	return math.Float32frombits(uint32(v))
+}
+
+func f32Value(f float32) uint64 {
+	return uint64(math.Float32bits(f))
+}
+
+func f64(v uint64) float64 {
+	return math.Float64frombits(v)
+}
+
+func f64Value(f float64) uint64 {
+	return math.Float64bits(f)
+}
+
+// numeric executes a numeric instruction on the operand stack.
+func numeric(op byte, stack *[]uint64) {
+	s := *stack
+	n := len(s)
+	switch {
+	case op >= 0x46 && op <= 0x4f, op >= 0x51 && op <= 0x5a, op >= 0x5b && op <= 0x66:
+		// Comparisons.
+		s[n-2] = boolToValue(compare(op, s[n-2], s[n-1]))
+		*stack = s[:n-1]
+	case op >= 0x6a && op <= 0x78:
+		s[n-2] = uint64(i32Binary(op, uint32(s[n-2]), uint32(s[n-1])))
+		*stack = s[:n-1]
+	case op >= 0x7c && op <= 0x8a:
+		s[n-2] = i64Binary(op, s[n-2], s[n-1])
+		*stack = s[:n-1]
+	case op >= 0x92 && op <= 0x98:
+		s[n-2] = f32Value(float32(floatBinary(op-0x92, float64(f32(s[n-2])), float64(f32(s[n-1])))))
+		*stack = s[:n-1]
+	case op >= 0xa0 && op <= 0xa6:
+		s[n-2] = f64Value(floatBinary(op-0xa0, f64(s[n-2]), f64(s[n-1])))
+		*stack = s[:n-1]
+	default:
+		s[n-1] = unary(op, s[n-1])
+	}
+}
+
+func compare(op byte, a, b uint64) bool {
+	switch op {
+	case 0x46, 0x51: // eq
+		return a == b
+	case 0x47, 0x52: // ne
+		return a != b
+	case 0x48: // i32.lt_s
+		return int32(a) < int32(b)
+	case 0x49, 0x54: // lt_u
+		return a < b
+	case 0x4a: // i32.gt_s
+		return int32(a) > int32(b)
+	case 0x4b, 0x56: // gt_u
+		return a > b
+	case 0x4c: // i32.le_s
+		return int32(a) <= int32(b)
+	case 0x4d, 0x58: // le_u
+		return a <= b
+	case 0x4e: // i32.ge_s
+		return int32(a) >= int32(b)
+	case 0x4f, 0x5a: // ge_u
+		return a >= b
+	case 0x53: // i64.lt_s
+		return int64(a) < int64(b)
+	case 0x55: // i64.gt_s
+		return int64(a) > int64(b)
+	case 0x57: // i64.le_s
+		return int64(a) <= int64(b)
+	case 0x59: // i64.ge_s
+		return int64(a) >= int64(b)
+	}
+	var x, y float64
+	if op <= 0x60 {
+		x, y = float64(f32(a)), float64(f32(b))
+		op -= 0x5b
+	} else {
+		x, y = f64(a), f64(b)
+		op -= 0x61
+	}
+	switch op {
+	case 0: // eq
+		return x == y
+	case 1: // ne
+		return x != y
+	case 2: // lt
+		return x < y
+	case 3: // gt
+		return x > y
+	case 4: // le
+		return x <= y
+	default: // ge
+		return x >= y
+	}
+}
+
+func i32Binary(op byte, a, b uint32) uint32 {
+	switch op {
+	case 0x6a:
+		return a + b
+	case 0x6b:
+		return a - b
+	case 0x6c:
+		return a * b
+	case 0x6d: // div_s
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(a) == math.MinInt32 && int32(b) == -1 {
+			trap("integer overflow")
+		}
+		return uint32(int32(a) / int32(b))
+	case 0x6e: // div_u
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a / b
+	case 0x6f: // rem_s
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int32(b) == -1 {
+			return 0
+		}
+		return uint32(int32(a) % int32(b))
+	case 0x70: // rem_u
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a % b
+	case 0x71:
+		return a & b
+	case 0x72:
+		return a | b
+	case 0x73:
+		return a ^ b
+	case 0x74:
+		return a << (b & 31)
+	case 0x75:
+		return uint32(int32(a) >> (b & 31))
+	case 0x76:
+		return a >> (b & 31)
+	case 0x77:
+		return bits.RotateLeft32(a, int(b&31))
+	default: // 0x78
+		return bits.RotateLeft32(a, -int(b&31))
+	}
+}
+
+func i64Binary(op byte, a, b uint64) uint64 {
+	switch op {
+	case 0x7c:
+		return a + b
+	case 0x7d:
+		return a - b
+	case 0x7e:
+		return a * b
+	case 0x7f: // div_s
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(a) == math.MinInt64 && int64(b) == -1 {
+			trap("integer overflow")
+		}
+		return uint64(int64(a) / int64(b))
+	case 0x80: // div_u
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a / b
+	case 0x81: // rem_s
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		if int64(b) == -1 {
+			return 0
+		}
+		return uint64(int64(a) % int64(b))
+	case 0x82: // rem_u
+		if b == 0 {
+			trap("integer divide by zero")
+		}
+		return a % b
+	case 0x83:
+		return a & b
+	case 0x84:
+		return a | b
+	case 0x85:
+		return a ^ b
+	case 0x86:
+		return a << (b & 63)
+	case 0x87:
+		return uint64(int64(a) >> (b & 63))
+	case 0x88:
+		return a >> (b & 63)
+	case 0x89:
+		return bits.RotateLeft64(a, int(b&63))
+	default: // 0x8a
+		return bits.RotateLeft64(a, -int(b&63))
+	}
+}
+
+// floatBinary implements the binary float operations. The op is relative to
+// f32.add or f64.add. Results of float32 operations are rounded by the caller,
+// which gives the same result as computing in float32 directly.
+func floatBinary(op byte, a, b float64) float64 {
+	switch op {
+	case 0:
+		return a + b
+	case 1:
+		return a - b
+	case 2:
+		return a * b
+	case 3:
+		return a / b
+	case 4: // min
+		if math.IsNaN(a) || math.IsNaN(b) {
+			return math.NaN()
+		}
+		if a == b {
+			// Distinguish between -0 and +0.
+			if math.Signbit(a) {
+				return a
+			}
+			return b
+		}
+		return math.Min(a, b)
+	case 5: // max
+		if math.IsNaN(a) || math.IsNaN(b) {
+			return math.NaN()
+		}
+		if a == b {
+			if math.Signbit(a) {
+				return b
+			}
+			return a
+		}
+		return math.Max(a, b)
+	default: // copysign
+		return math.Copysign(a, b)
+	}
+}
+
+func unary(op byte, v uint64) uint64 {
+	switch op {
+	case 0x45: // i32.eqz
+		return boolToValue(uint32(v) == 0)
+	case 0x50: // i64.eqz
+		return boolToValue(v == 0)
+	case 0x67:
+		return uint64(bits.LeadingZeros32(uint32(v)))
+	case 0x68:
+		return uint64(bits.TrailingZeros32(uint32(v)))
+	case 0x69:
+		return uint64(bits.OnesCount32(uint32(v)))
+	case 0x79:
+		return uint64(bits.LeadingZeros64(v))
+	case 0x7a:
+		return uint64(bits.TrailingZeros64(v))
+	case 0x7b:
+		return uint64(bits.OnesCount64(v))
+	case 0x8b: // f32.abs
+		return v &^ (1 << 31)
+	case 0x8c: // f32.neg
+		return v ^ (1 << 31)
+	case 0x8d, 0x8e, 0x8f, 0x90, 0x91:
+		return f32Value(float32(floatUnary(op-0x8d, float64(f32(v)))))
+	case 0x99: // f64.abs
+		return v &^ (1 << 63)
+	case 0x9a: // f64.neg
+		return v ^ (1 << 63)
+	case 0x9b, 0x9c, 0x9d, 0x9e, 0x9f:
+		return f64Value(floatUnary(op-0x9b, f64(v)))
+	case 0xa7: // i32.wrap_i64
+		return uint64(uint32(v))
+	case 0xa8:
+		return truncate(float64(f32(v)), true, 32, false)
+	case 0xa9:
+		return truncate(float64(f32(v)), false, 32, false)
+	case 0xaa:
+		return truncate(f64(v), true, 32, false)
+	case 0xab:
+		return truncate(f64(v), false, 32, false)
+	case 0xac: // i64.extend_i32_s
+		return uint64(int64(int32(v)))
+	case 0xad: // i64.extend_i32_u
+		return uint64(uint32(v))
+	case 0xae:
+		return truncate(float64(f32(v)), true, 64, false)
+	case 0xaf:
+		return truncate(float64(f32(v)), false, 64, false)
+	case 0xb0:
+		return truncate(f64(v), true, 64, false)
+	case 0xb1:
+		return truncate(f64(v), false, 64, false)
+	case 0xb2:
+		return f32Value(float32(int32(v)))
+	case 0xb3:
+		return f32Value(float32(uint32(v)))
+	case 0xb4:
+		return f32Value(float32(int64(v)))
+	case 0xb5:
+		return f32Value(float32(v))
+	case 0xb6: // f32.demote_f64
+		return f32Value(float32(f64(v)))
+	case 0xb7:
+		return f64Value(float64(int32(v)))
+	case 0xb8:
+		return f64Value(float64(uint32(v)))
+	case 0xb9:
+		return f64Value(float64(int64(v)))
+	case 0xba:
+		return f64Value(float64(v))
+	case 0xbb: // f64.promote_f32
+		return f64Value(float64(f32(v)))
+	case 0xbc, 0xbd, 0xbe, 0xbf:
+		// Reinterpret instructions: values are already stored as bits.
+		return v
+	case 0xc0: // i32.extend8_s
+		return uint64(uint32(int32(int8(v))))
+	case 0xc1: // i32.extend16_s
+		return uint64(uint32(int32(int16(v))))
+	case 0xc2: // i64.extend8_s
+		return uint64(int64(int8(v)))
+	case 0xc3: // i64.extend16_s
+		return uint64(int64(int16(v)))
+	case 0xc4: // i64.extend32_s
+		return uint64(int64(int32(v)))
+	}
+	trap("unsupported instruction")
+	return 0
+}
+
+// floatUnary implements ceil, floor, trunc, nearest and sqrt (relative to
+// f32.ceil or f64.ceil).
+func floatUnary(op byte, f float64) float64 {
+	switch op {
+	case 0:
+		return math.Ceil(f)
+	case 1:
+		return math.Floor(f)
+	case 2:
+		return math.Trunc(f)
+	case 3:
+		return math.RoundToEven(f)
+	default:
+		return math.Sqrt(f)
+	}
+}
+
+// truncate converts a float to an integer of the given size. Conversions that
+// are out of range trap, unless saturate is set in which case they are clamped
+// to the nearest representable value (and NaN converts to zero).
+func truncate(f float64, signed bool, size uint, saturate bool) uint64 {
+	var lo, hi float64 // valid range is lo <= t < hi
+	if signed {
+		lo = -math.Ldexp(1, int(size-1))
+		hi = math.Ldexp(1, int(size-1))
+	} else {
+		hi = math.Ldexp(1, int(size))
+	}
+	mask := uint64(math.MaxUint64) >> (64 - size)
+	if math.IsNaN(f) {
+		if saturate {
+			return 0
+		}
+		trap("invalid conversion to integer")
+	}
+	t := math.Trunc(f)
+	if t < lo {
+		if !saturate {
+			trap("integer overflow")
+		}
+		return uint64(int64(lo)) & mask
+	}
+	if t >= hi {
+		if !saturate {
+			trap("integer overflow")
+		}
+		if signed {
+			return mask >> 1
+		}
+		return mask
+	}
+	if signed {
+		return uint64(int64(t)) & mask
+	}
+	return uint64(t)
+}
+
+// truncSat implements the non-trapping float-to-int conversions (opcodes 0
+// through 7 after the 0xfc prefix).
+func truncSat(sub uint32, v uint64) uint64 {
+	var f float64
+	if sub&2 == 0 {
+		f = float64(f32(v)) // from f32
+	} else {
+		f = f64(v) // from f64
+	}
+	signed := sub&1 == 0
+	size := uint(32)
+	if sub >= 4 {
+		size = 64
+	}
+	return truncate(f, signed, size, true)
+}
@@ -0,0 +1,200 @@
+package wasmvm
+
+// This file implements module instantiation and the API used by the host to
+// call into the module.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const pageSize = 64 * 1024
+
+// Maximum number of nested calls before a call traps. This avoids exhausting
+// the Go stack on infinite recursion.
+const maxCallDepth = 20000
+
+// HostFunc is a function implemented by the host that can be imported by a
+// module. Values are passed in the same representation as on the operand
+// stack: integers are zero extended to 64 bits and floats are stored as their
+// IEEE 754 bit pattern.
+type HostFunc func(inst *Instance, args []uint64) ([]uint64, error)
+
+// Resolver returns the host function for the given import, or nil if there is
+// no such function.
+type Resolver func(module, name string, typ FuncType) HostFunc
+
+// Trap is returned when execution of WebAssembly code traps, for example on a
+// division by zero or the unreachable instruction.
+type Trap struct {
+	Msg string
+}
+
+func (t *Trap) Error() string {
+	return "wasm trap: " + t.Msg
+}
+
+// hostError wraps an error returned by a host function so that it can be
+// propagated through a panic.
+type hostError struct {
+	err error
+}
+
+// Instance is an instantiated module with its own memory, globals and table.
+type Instance struct {
+	// Memory is the linear memory of the instance. It may be reallocated when
+	// the module grows the memory, so it should not be retained by host
+	// functions across calls.
+	Memory []byte
+
+	module  *Module
+	memMax  uint32 // maximum number of pages
+	globals []uint64
+	table   []int64 // function index or -1
+	funcs   []*function
+	exports map[string]Export
+	depth   int
+}
+
+type function struct {
+	typ    FuncType
+	host   HostFunc
+	code   *code
+	blocks map[int]block // lazily computed on first call
+}
+
+// Instantiate creates a new instance of the module. All imported functions are
+// looked up using the resolver. The start function (if any) is run before
+// returning.
+func Instantiate(m *Module, resolve Resolver) (inst *Instance, err error) {
+	inst = &Instance{
+		module:  m,
+		exports: map[string]Export{},
+	}
+	for _, imp := range m.Imports {
+		if imp.Kind != kindFunc {
+			return nil, fmt.Errorf("wasmvm: unsupported import %s.%s: only functions can be imported", imp.Module, imp.Name)
+		}
+		typ := m.Types[imp.Type]
+		host := resolve(imp.Module, imp.Name, typ)
+		if host == nil {
+			return nil, fmt.Errorf("wasmvm: unknown import %s.%s", imp.Module, imp.Name)
+		}
+		inst.funcs = append(inst.funcs, &function{typ: typ, host: host})
+	}
+	for i, typeIndex := range m.funcs {
+		inst.funcs = append(inst.funcs, &function{typ: m.Types[typeIndex], code: &m.codes[i]})
+	}
+	for _, exp := range m.Exports {
+		inst.exports[exp.Name] = exp
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			inst, err = nil, recoveredError(r)
+		}
+	}()
+
+	if len(m.memories) != 0 {
+		mem := m.memories[0]
+		inst.Memory = make([]byte, int(mem.min)*pageSize)
+		inst.memMax = 65536
+		if mem.hasMax {
+			inst.memMax = mem.max
+		}
+	}
+	for _, g := range m.globals {
+		inst.globals = append(inst.globals, inst.evalConst(g.init))
+	}
+	if len(m.tables) != 0 {
+		inst.table = make([]int64, m.tables[0].min)
+		for i := range inst.table {
+			inst.table[i] = -1
+		}
+	}
+	for _, e := range m.elements {
+		offset := uint32(inst.evalConst(e.offset))
+		if uint64(offset)+uint64(len(e.funcs)) > uint64(len(inst.table)) {
+			return nil, errors.New("wasmvm: element segment does not fit in table")
+		}
+		for i, fn := range e.funcs {
+			inst.table[int(offset)+i] = int64(fn)
+		}
+	}
+	for _, seg := range m.data {
+		offset := uint32(inst.evalConst(seg.offset))
+		if uint64(offset)+uint64(len(seg.init)) > uint64(len(inst.Memory)) {
+			return nil, errors.New("wasmvm: data segment does not fit in memory")
+		}
+		copy(inst.Memory[offset:], seg.init)
+	}
+
+	if m.start >= 0 {
+		inst.call(uint32(m.start), nil)
+	}
+	return inst, nil
+}
+
+// evalConst evaluates a constant expression, as used for global initializers
+// and segment offsets.
+func (inst *Instance) evalConst(expr []byte) uint64 {
+	if len(expr) == 0 {
+		panic(&Trap{"invalid constant expression"})
+	}
+	switch expr[0] {
+	case opI32Const:
+		value, _ := readSLEB(expr[1:])
+		return uint64(uint32(value))
+	case opI64Const:
+		value, _ := readSLEB(expr[1:])
+		return uint64(value)
+	case opF32Const:
+		return uint64(binary.LittleEndian.Uint32(expr[1:]))
+	case opF64Const:
+		return binary.LittleEndian.Uint64(expr[1:])
+	case opGlobalGet:
+		index, _ := readULEB(expr[1:])
+		return inst.globals[index]
+	default:
+		panic(&Trap{"invalid constant expression"})
+	}
+}
+
+// Call calls the exported function with the given name.
+func (inst *Instance) Call(name string, args ...uint64) (results []uint64, err error) {
+	exp, ok := inst.exports[name]
+	if !ok || exp.Kind != kindFunc {
+		return nil, fmt.Errorf("wasmvm: no exported function %q", name)
+	}
+	fn := inst.funcs[exp.Index]
+	if len(args) != len(fn.typ.Params) {
+		return nil, fmt.Errorf("wasmvm: function %q expects %d parameters, got %d", name, len(fn.typ.Params), len(args))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			results, err = nil, recoveredError(r)
+		}
+	}()
+	results = inst.call(exp.Index, args)
+	return append([]uint64(nil), results...), nil
+}
+
+// HasExport returns whether the module exports something with this name.
+func (inst *Instance) HasExport(name string) bool {
+	_, ok := inst.exports[name]
+	return ok
+}
+
+// recoveredError converts a recovered panic to an error. Panics other than
+// traps and host errors are real bugs and are propagated.
+func recoveredError(r interface{}) error {
+	switch r := r.(type) {
+	case *Trap:
+		return r
+	case hostError:
+		return r.err
+	default:
+		panic(r)
+	}
+}
@@ -0,0 +1,308 @@
+package wasmvm
+
+import (
+	"errors"
+	"testing"
+)
+
+// testModule assembles a module with a single exported function "f" of the
+// given type, with the given locals and body (without the final end
+// instruction). The module has one page of memory and imports env.host as
+// function 0 with type (i32) -> i32.
+func testModule(params, results []ValueType, locals []ValueType, body ...byte) []byte {
+	section := func(id byte, contents ...byte) []byte {
+		return append([]byte{id, byte(len(contents))}, contents...)
+	}
+	vec := func(types []ValueType) []byte {
+		buf := []byte{byte(len(types))}
+		for _, t := range types {
+			buf = append(buf, byte(t))
+		}
+		return buf
+	}
+
+	buf := []byte("\x00asm\x01\x00\x00\x00")
+
+	// Types: 0 is the test function, 1 is the host function.
+	types := []byte{2, 0x60}
+	types = append(types, vec(params)...)
+	types = append(types, vec(results)...)
+	types = append(types, 0x60, 1, byte(I32), 1, byte(I32))
+	buf = append(buf, section(1, types...)...)
+
+	buf = append(buf, section(2, 1, 3, 'e', 'n', 'v', 4, 'h', 'o', 's', 't', kindFunc, 1)...)
+	buf = append(buf, section(3, 1, 0)...)
+	buf = append(buf, section(4, 1, 0x70, 0, 2)...)
+	buf = append(buf, section(5, 1, 0, 1)...)
+	buf = append(buf, section(7, 1, 1, 'f', kindFunc, 1)...)
+	// Table: [host, f]
+	buf = append(buf, section(9, 1, 0, opI32Const, 0, opEnd, 2, 0, 1)...)
+
+	fn := []byte{byte(len(locals))}
+	for _, t := range locals {
+		fn = append(fn, 1, byte(t))
+	}
+	fn = append(fn, body...)
+	fn = append(fn, opEnd)
+	code := append([]byte{1, byte(len(fn))}, fn...)
+	buf = append(buf, section(10, code...)...)
+
+	// Data: "hi" at address 16.
+	buf = append(buf, section(11, 1, 0, opI32Const, 16, opEnd, 2, 'h', 'i')...)
+	return buf
+}
+
+func instantiate(t *testing.T, buf []byte) *Instance {
+	t.Helper()
+	m, err := Decode(buf)
+	if err != nil {
+		t.Fatal("could not decode module:", err)
+	}
+	inst, err := Instantiate(m, func(module, name string, typ FuncType) HostFunc {
+		if module != "env" || name != "host" {
+			return nil
+		}
+		return func(inst *Instance, args []uint64) ([]uint64, error) {
+			if args[0] == 0 {
+				return nil, errors.New("host error")
+			}
+			return []uint64{args[0] * 2}, nil
+		}
+	})
+	if err != nil {
+		t.Fatal("could not instantiate module:", err)
+	}
+	return inst
+}
+
+var (
+	i32    = []ValueType{I32}
+	i32i32 = []ValueType{I32, I32}
+	i64    = []ValueType{I64}
+	f64s   = []ValueType{F64}
+)
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []ValueType
+		results []ValueType
+		locals  []ValueType
+		body    []byte
+		args    []uint64
+		result  uint64
+		trap    string
+	}{
+		{
+			name:   "add",
+			params: i32i32, results: i32,
+			body:   []byte{opLocalGet, 0, opLocalGet, 1, 0x6a},
+			args:   []uint64{3, 0xffffffff},
+			result: 2,
+		},
+		{
+			name:   "div_s",
+			params: i32i32, results: i32,
+			body:   []byte{opLocalGet, 0, opLocalGet, 1, 0x6d},
+			args:   []uint64{uint64(uint32(0xfffffff9)), 2}, // -7 / 2
+			result: 0xfffffffd,
+		},
+		{
+			name:   "div-by-zero",
+			params: i32i32, results: i32,
+			body: []byte{opLocalGet, 0, opLocalGet, 1, 0x6e},
+			args: []uint64{1, 0},
+			trap: "integer divide by zero",
+		},
+		{
+			// Factorial using a loop: f(n) = n!
+			name:   "loop",
+			params: i32, results: i64,
+			locals: i64,
+			body: []byte{
+				opI64Const, 1, opLocalSet, 1,
+				opBlock, 0x40,
+				opLoop, 0x40,
+				opLocalGet, 0, 0x45, opBrIf, 1, // exit when n == 0
+				opLocalGet, 1, opLocalGet, 0, 0xad, 0x7e, opLocalSet, 1, // acc *= n
+				opLocalGet, 0, opI32Const, 1, 0x6b, opLocalSet, 0, // n--
+				opBr, 0,
+				opEnd,
+				opEnd,
+				opLocalGet, 1,
+			},
+			args:   []uint64{20},
+			result: 2432902008176640000,
+		},
+		{
+			name:   "if-else",
+			params: i32, results: i32,
+			body: []byte{
+				opLocalGet, 0,
+				opIf, byte(I32), opI32Const, 10, opElse, opI32Const, 20, opEnd,
+			},
+			args:   []uint64{0},
+			result: 20,
+		},
+		{
+			name:   "br_table",
+			params: i32, results: i32,
+			body: []byte{
+				opBlock, 0x40,
+				opBlock, 0x40,
+				opLocalGet, 0, opBrTable, 1, 0, 1,
+				opEnd,
+				opI32Const, 10, opReturn,
+				opEnd,
+				opI32Const, 20,
+			},
+			args:   []uint64{5},
+			result: 20,
+		},
+		{
+			name:   "memory",
+			params: i32, results: i32,
+			body: []byte{
+				opLocalGet, 0, opI32Const, 0x21, 0x3a, 0, 2, // mem[n+2] = '!'
+				opI32Const, 0, 0x2f, 1, 16, // load16_u at 16
+				opLocalGet, 0, 0x2d, 0, 2, // load8_u at n+2
+				0x73,
+			},
+			args:   []uint64{16},
+			result: ('h' | 'i'<<8) ^ '!',
+		},
+		{
+			name:   "out-of-bounds",
+			params: i32, results: i32,
+			body: []byte{opLocalGet, 0, opI32Load, 2, 0},
+			args: []uint64{65534},
+			trap: "out of bounds memory access",
+		},
+		{
+			name:   "memory.grow",
+			params: i32, results: i32,
+			body:   []byte{opLocalGet, 0, opMemoryGrow, 0, opDrop, opMemorySize, 0},
+			args:   []uint64{2},
+			result: 3,
+		},
+		{
+			name:   "call-host",
+			params: i32, results: i32,
+			body:   []byte{opLocalGet, 0, opCall, 0},
+			args:   []uint64{21},
+			result: 42,
+		},
+		{
+			name:   "call-indirect",
+			params: i32, results: i32,
+			body:   []byte{opLocalGet, 0, opI32Const, 0, opCallIndirect, 1, 0},
+			args:   []uint64{4},
+			result: 8,
+		},
+		{
+			name:   "call-indirect-mismatch",
+			params: i32i32, results: i32,
+			body: []byte{opLocalGet, 0, opI32Const, 1, opCallIndirect, 1, 0},
+			args: []uint64{4, 0},
+			trap: "indirect call type mismatch",
+		},
+		{
+			name:   "trunc-nan",
+			params: f64s, results: i32,
+			body: []byte{opLocalGet, 0, 0xaa},
+			args: []uint64{f64Value(nanValue())},
+			trap: "invalid conversion to integer",
+		},
+		{
+			name:   "trunc-sat",
+			params: f64s, results: i64,
+			body:   []byte{opLocalGet, 0, opPrefixFC, 6},
+			args:   []uint64{f64Value(-1e30)},
+			result: 1 << 63,
+		},
+		{
+			name:   "nearest",
+			params: f64s, results: f64s,
+			body:   []byte{opLocalGet, 0, 0x9e},
+			args:   []uint64{f64Value(2.5)},
+			result: f64Value(2),
+		},
+		{
+			name:   "extend8_s",
+			params: i32, results: i32,
+			body:   []byte{opLocalGet, 0, 0xc0},
+			args:   []uint64{0x180},
+			result: 0xffffff80,
+		},
+		{
+			name:   "memory.fill-copy",
+			params: i32, results: i32,
+			body: []byte{
+				opI32Const, 32, opLocalGet, 0, opI32Const, 4, opPrefixFC, opMemoryFill, 0,
+				opI32Const, 34, opI32Const, 16, opI32Const, 2, opPrefixFC, opMemoryCopy, 0, 0,
+				opI32Const, 32, opI32Load, 2, 0,
+			},
+			args:   []uint64{'x'},
+			result: 'x' | 'x'<<8 | 'h'<<16 | 'i'<<24,
+		},
+		{
+			name:   "unreachable",
+			params: i32, results: i32,
+			body: []byte{opUnreachable},
+			args: []uint64{0},
+			trap: "unreachable",
+		},
+		{
+			name:   "recursion",
+			params: i32, results: i32,
+			body: []byte{opLocalGet, 0, opCall, 1},
+			args: []uint64{0},
+			trap: "call stack exhausted",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			inst := instantiate(t, testModule(tc.params, tc.results, tc.locals, tc.body...))
+			results, err := inst.Call("f", tc.args...)
+			if tc.trap != "" {
+				if trap, ok := err.(*Trap); !ok || trap.Msg != tc.trap {
+					t.Fatalf("expected trap %q, got %v", tc.trap, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if len(results) != 1 || results[0] != tc.result {
+				t.Errorf("expected result %#x, got %#x", tc.result, results)
+			}
+		})
+	}
+}
+
+func TestHostError(t *testing.T) {
+	inst := instantiate(t, testModule(i32, i32, nil, opLocalGet, 0, opCall, 0))
+	_, err := inst.Call("f", 0)
+	if err == nil || err.Error() != "host error" {
+		t.Errorf("expected host error, got %v", err)
+	}
+}
+
+func TestUnknownImport(t *testing.T) {
+	m, err := Decode(testModule(i32, i32, nil, opLocalGet, 0))
+	if err != nil {
+		t.Fatal("could not decode module:", err)
+	}
+	_, err = Instantiate(m, func(module, name string, typ FuncType) HostFunc {
+		return nil
+	})
+	if err == nil {
+		t.Error("expected error for unresolved import")
+	}
+}
+
+func nanValue() float64 {
+	zero := 0.0
+	return zero / zero
+}